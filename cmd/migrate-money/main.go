@@ -0,0 +1,172 @@
+// Command migrate-money rewrites the amounts stored as floats or bare
+// Decimal128 to {amount, currency} documents, the amount rounded to the cent
+// so they add up exactly in aggregations and the currency CURRENCY. It also
+// moves the amounts of FIXED discounts and service charges out of their
+// float value. It can be run more than once, amounts already migrated are
+// left alone.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"golang-restaurant-backend-app/database"
+	"golang-restaurant-backend-app/money"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// amounts lists the money fields of each collection, and for arrays of
+// embedded documents the money fields of their elements.
+type amounts struct {
+	fields []string
+	arrays map[string][]string
+}
+
+var collections = map[string]amounts{
+	"food":         {fields: []string{"price"}},
+	"orderItem":    {fields: []string{"unit_price"}},
+	"pricing_rule": {fields: []string{"min_subtotal", "amount"}},
+	"order":        {arrays: map[string][]string{"discounts": {"min_subtotal", "amount"}}},
+	"card_payment": {fields: []string{"amount", "tip"}},
+	"invoice": {
+		fields: []string{"discount_total", "subtotal", "service_total", "tax_total", "total", "tip", "amount_paid", "outstanding", "credited", "refunded", "late_fee_total", "account_charge"},
+		arrays: map[string][]string{
+			"discount_lines": {"amount"},
+			"service_lines":  {"amount"},
+			"tax_lines":      {"taxable_amount", "amount"},
+			"payments":       {"amount", "tip", "tendered", "change"},
+			"splits":         {"amount", "amount_paid"},
+			"late_fees":      {"amount"},
+		},
+	},
+	"credit_note": {
+		fields: []string{"amount", "refunded"},
+		arrays: map[string][]string{
+			"lines":     {"amount"},
+			"tax_lines": {"taxable_amount", "amount"},
+		},
+	},
+	"service_charge":   {fields: []string{"amount"}},
+	"customer_account": {fields: []string{"credit_limit"}},
+	"account_payment":  {fields: []string{"amount"}, arrays: map[string][]string{"allocations": {"amount"}}},
+	"account_statement": {
+		fields: []string{"opening_balance", "charges", "credits", "closing_balance"},
+		arrays: map[string][]string{"lines": {"amount"}},
+	},
+	"drawer_session": {
+		fields: []string{"opening_float", "expected_cash", "counted_cash", "variance"},
+		arrays: map[string][]string{"movements": {"amount"}},
+	},
+}
+
+// toMoney turns a number into an amount of money, rounded to the cent as a
+// decimal, and leaves anything else as it is.
+func toMoney(path string) bson.D {
+	return bson.D{{Key: "$cond", Value: bson.A{
+		bson.D{{Key: "$in", Value: bson.A{bson.D{{Key: "$type", Value: path}}, bson.A{"double", "int", "long", "decimal"}}}},
+		bson.D{
+			{Key: "amount", Value: bson.D{{Key: "$toDecimal", Value: bson.D{{Key: "$round", Value: bson.A{path, 2}}}}}},
+			{Key: "currency", Value: bson.D{{Key: "$literal", Value: money.DefaultCurrency()}}},
+		},
+		path,
+	}}}
+}
+
+func migration(spec amounts) mongo.Pipeline {
+	set := bson.D{}
+	for _, field := range spec.fields {
+		set = append(set, bson.E{Key: field, Value: toMoney("$" + field)})
+	}
+	for array, fields := range spec.arrays {
+		element := bson.D{}
+		for _, field := range fields {
+			element = append(element, bson.E{Key: field, Value: toMoney("$$item." + field)})
+		}
+		set = append(set, bson.E{Key: array, Value: bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$isArray", Value: "$" + array}},
+			bson.D{{Key: "$map", Value: bson.D{
+				{Key: "input", Value: "$" + array},
+				{Key: "as", Value: "item"},
+				{Key: "in", Value: bson.D{{Key: "$mergeObjects", Value: bson.A{"$$item", element}}}},
+			}}},
+			"$" + array,
+		}}}})
+	}
+	return mongo.Pipeline{bson.D{{Key: "$set", Value: set}}}
+}
+
+// fixedKinds lists the collections holding discounts and service charges, and
+// the arrays embedding them. A FIXED kind used to keep its amount in value;
+// it is moved to amount so value is only ever a percentage.
+var fixedKinds = map[string][]string{
+	"pricing_rule":   nil,
+	"service_charge": nil,
+	"order":          {"discounts"},
+	"invoice":        {"service_lines"},
+}
+
+// fixedAmount moves the value of FIXED documents to amount.
+func fixedAmount(arrays []string) mongo.Pipeline {
+	if len(arrays) == 0 {
+		isFixed := bson.D{{Key: "$eq", Value: bson.A{"$kind", "FIXED"}}}
+		noAmount := bson.D{{Key: "$eq", Value: bson.A{bson.D{{Key: "$type", Value: "$amount"}}, "missing"}}}
+		return mongo.Pipeline{bson.D{{Key: "$set", Value: bson.D{
+			{Key: "amount", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$and", Value: bson.A{isFixed, noAmount}}},
+				toMoney("$value"),
+				"$amount",
+			}}}},
+			{Key: "value", Value: bson.D{{Key: "$cond", Value: bson.A{isFixed, "$$REMOVE", "$value"}}}},
+		}}}}
+	}
+
+	set := bson.D{}
+	for _, array := range arrays {
+		isFixed := bson.D{{Key: "$eq", Value: bson.A{"$$item.kind", "FIXED"}}}
+		element := bson.D{{Key: "$cond", Value: bson.A{
+			isFixed,
+			bson.D{{Key: "$mergeObjects", Value: bson.A{"$$item", bson.D{
+				{Key: "amount", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$$item.amount", toMoney("$$item.value")}}}},
+				{Key: "value", Value: nil},
+			}}}},
+			"$$item",
+		}}}
+		set = append(set, bson.E{Key: array, Value: bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$isArray", Value: "$" + array}},
+			bson.D{{Key: "$map", Value: bson.D{
+				{Key: "input", Value: "$" + array},
+				{Key: "as", Value: "item"},
+				{Key: "in", Value: element},
+			}}},
+			"$" + array,
+		}}}})
+	}
+	return mongo.Pipeline{bson.D{{Key: "$set", Value: set}}}
+}
+
+func main() {
+	var ctx, cancel = context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	for name, spec := range collections {
+		collection := database.OpenCollection(database.Client, name)
+		result, err := collection.UpdateMany(ctx, bson.M{}, migration(spec))
+		if err != nil {
+			log.Fatalf("migrating the amounts of %s failed: %v", name, err)
+		}
+		fmt.Printf("%s: %d of %d documents migrated\n", name, result.ModifiedCount, result.MatchedCount)
+	}
+
+	for name, arrays := range fixedKinds {
+		collection := database.OpenCollection(database.Client, name)
+		result, err := collection.UpdateMany(ctx, bson.M{}, fixedAmount(arrays))
+		if err != nil {
+			log.Fatalf("migrating the fixed amounts of %s failed: %v", name, err)
+		}
+		fmt.Printf("%s: fixed amounts of %d of %d documents migrated\n", name, result.ModifiedCount, result.MatchedCount)
+	}
+}
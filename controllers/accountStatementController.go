@@ -0,0 +1,433 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"golang-restaurant-backend-app/notifier"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var accountPaymentCollection *mongo.Collection = database.OpenCollection(database.Client, "account_payment")
+var accountStatementCollection *mongo.Collection = database.OpenCollection(database.Client, "account_statement")
+var accountStatementIndex sync.Once
+
+// AccountPaymentRequest records money received on an account. It settles the
+// listed invoices, or the oldest due first when none are listed.
+type AccountPaymentRequest struct {
+	Amount      *money.Money `json:"amount" validate:"required,gt=0"`
+	Method      *string      `json:"method" validate:"required,eq=BANK_TRANSFER|eq=CHEQUE|eq=CARD|eq=CASH"`
+	Reference   *string      `json:"reference" validate:"omitempty,max=100"`
+	Invoice_ids []string     `json:"invoice_ids" validate:"max=100"`
+}
+
+// StatementRequest asks for the statement of a month that has ended,
+// last month when Period is left out.
+type StatementRequest struct {
+	Period *string `json:"period"`
+}
+
+var (
+	errStatementExists   = errors.New("the statement of this month was already made")
+	errStatementPeriod   = errors.New("period must look like 2006-01 and be a month that has ended")
+	errPaymentIncomplete = errors.New("the payment could only be put towards some of the invoices, the rest was not taken")
+)
+
+func ensureAccountStatementIndex(ctx context.Context) {
+	_, err := accountStatementCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "account_id", Value: 1}, {Key: "period", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("failed to create the account statement index: %v", err)
+	}
+}
+
+// statementPeriod reads a month, defaulting to the one before now.
+func statementPeriod(period *string, now time.Time) (time.Time, error) {
+	lastMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local).AddDate(0, -1, 0)
+	if period == nil || *period == "" {
+		return lastMonth, nil
+	}
+	start, err := time.ParseInLocation("2006-01", *period, time.Local)
+	if err != nil || start.AddDate(0, 1, 0).After(now) {
+		return start, errStatementPeriod
+	}
+	return start, nil
+}
+
+// makeStatement works out the statement of an account for the month that
+// starts at start and stores it.
+func makeStatement(ctx context.Context, account models.CustomerAccount, start time.Time, createdBy string) (models.AccountStatement, error) {
+	accountStatementIndex.Do(func() { ensureAccountStatementIndex(ctx) })
+
+	statement := models.AccountStatement{
+		Account_id:   account.Customer_account_id,
+		Period:       start.Format("2006-01"),
+		Period_start: start,
+		Period_end:   start.AddDate(0, 1, 0),
+		Currency:     money.DefaultCurrency(),
+		Created_by:   createdBy,
+	}
+	count, err := accountStatementCollection.CountDocuments(ctx, bson.M{"account_id": statement.Account_id, "period": statement.Period})
+	if err != nil {
+		return statement, err
+	}
+	if count > 0 {
+		return statement, errStatementExists
+	}
+
+	invoices, err := accountInvoices(ctx, account.Customer_account_id, bson.M{"charged_at": bson.M{"$lt": statement.Period_end}})
+	if err != nil {
+		return statement, err
+	}
+	invoiceIds := []string{}
+	for _, invoice := range invoices {
+		invoiceIds = append(invoiceIds, invoice.Invoice_id)
+	}
+	result, err := creditNoteCollection.Find(ctx, bson.M{"invoice_id": bson.M{"$in": invoiceIds}})
+	if err != nil {
+		return statement, err
+	}
+	var credits []models.CreditNote
+	if err = result.All(ctx, &credits); err != nil {
+		return statement, err
+	}
+
+	helper.BuildStatement(&statement, helper.AccountLedger(invoices, credits))
+	statement.Due_date = statement.Period_end.AddDate(0, 0, helper.PaymentTermsDays(account))
+	statement.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	statement.ID = primitive.NewObjectID()
+	statement.Account_statement_id = statement.ID.Hex()
+	statement.Version = 1
+
+	if _, err := accountStatementCollection.InsertOne(ctx, statement); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return statement, errStatementExists
+		}
+		return statement, err
+	}
+	return statement, nil
+}
+
+// statementText writes a statement out for an email.
+func statementText(account models.CustomerAccount, statement models.AccountStatement) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "Statement of account %s for %s\n\n", *account.Name, statement.Period)
+	fmt.Fprintf(&out, "%-52s %12s\n", "Balance brought forward", statement.Opening_balance)
+	for _, line := range statement.Lines {
+		fmt.Fprintf(&out, "%s  %-40s %12s\n", line.Date.In(time.Local).Format("2006-01-02"), line.Description, line.Amount)
+	}
+	fmt.Fprintf(&out, "%-52s %12s\n\n", "Balance "+statement.Currency, statement.Closing_balance)
+	fmt.Fprintf(&out, "Please pay the balance by %s.\n", statement.Due_date.In(time.Local).Format("2006-01-02"))
+	return out.String()
+}
+
+// sendStatement emails a statement with a balance to the account, if it has
+// an address.
+func sendStatement(ctx context.Context, account models.CustomerAccount, statement models.AccountStatement) error {
+	if account.Email == nil || !statement.Closing_balance.IsPositive() {
+		return nil
+	}
+	message := notifier.Message{
+		Channel: notifier.EMAIL,
+		To:      *account.Email,
+		Subject: "Statement for " + statement.Period,
+		Body:    statementText(account, statement),
+	}
+	if err := receiptNotifier.Send(ctx, message); err != nil {
+		return err
+	}
+	_, err := accountStatementCollection.UpdateOne(ctx, bson.M{"account_statement_id": statement.Account_statement_id}, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "sent_to", Value: account.Email}}},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+	})
+	return err
+}
+
+// makeMonthlyStatements makes last month's statement of every account that
+// does not have it yet and had something on it.
+func makeMonthlyStatements(ctx context.Context) {
+	start, _ := statementPeriod(nil, time.Now())
+
+	result, err := customerAccountCollection.Find(ctx, notDeleted(bson.M{}))
+	if err != nil {
+		log.Printf("accounts could not be listed for their statements: %v", err)
+		return
+	}
+	var accounts []models.CustomerAccount
+	if err = result.All(ctx, &accounts); err != nil {
+		log.Printf("accounts could not be listed for their statements: %v", err)
+		return
+	}
+
+	for _, account := range accounts {
+		count, err := invoiceCollection.CountDocuments(ctx, notDeleted(bson.M{"account_id": account.Customer_account_id, "charged_at": bson.M{"$lt": start.AddDate(0, 1, 0)}}))
+		if err != nil || count == 0 {
+			continue
+		}
+		statement, err := makeStatement(ctx, account, start, "")
+		if err == errStatementExists {
+			continue
+		}
+		if err != nil {
+			log.Printf("statement of account %s could not be made: %v", account.Customer_account_id, err)
+			continue
+		}
+		if err := sendStatement(ctx, account, statement); err != nil {
+			log.Printf("statement of account %s could not be sent: %v", account.Customer_account_id, err)
+		}
+	}
+}
+
+// StartStatementJob makes the monthly account statements in the background,
+// checking at start and then every STATEMENT_INTERVAL.
+func StartStatementJob() {
+	interval, err := time.ParseDuration(os.Getenv("STATEMENT_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = 6 * time.Hour
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			makeMonthlyStatements(ctx)
+			cancel()
+			<-ticker.C
+		}
+	}()
+}
+
+// CreateAccountPayment takes money received on an account and puts it
+// towards its invoices. Each invoice gets an ACCOUNT payment pointing back at
+// the account payment.
+func CreateAccountPayment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var request AccountPaymentRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		account, err := findAccount(ctx, c.Param("account_id"))
+		if err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{"payment_status": bson.M{"$ne": helper.InvoicePaid}}
+		if len(request.Invoice_ids) > 0 {
+			filter["invoice_id"] = bson.M{"$in": request.Invoice_ids}
+		}
+		invoices, err := accountInvoices(ctx, account.Customer_account_id, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the invoices"})
+			return
+		}
+		if len(request.Invoice_ids) > 0 && len(invoices) != len(request.Invoice_ids) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "some of the invoices are not open on this account"})
+			return
+		}
+
+		parts, err := helper.AllocateAccountPayment(invoices, *request.Amount)
+		if err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": "the payment is more than what the invoices owe"})
+			return
+		}
+
+		receivedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		accountPayment := models.AccountPayment{
+			ID:          primitive.NewObjectID(),
+			Account_id:  account.Customer_account_id,
+			Method:      *request.Method,
+			Reference:   request.Reference,
+			Amount:      money.Zero(),
+			Allocations: []models.PaymentAllocation{},
+			Received_by: c.GetString("uid"),
+			Received_at: receivedAt,
+			Created_at:  receivedAt,
+			Version:     1,
+		}
+		accountPayment.Account_payment_id = accountPayment.ID.Hex()
+
+		// only what reached an invoice is recorded, so a clash half way
+		// leaves nothing unaccounted for
+		var applyErr error
+		for i, invoice := range invoices {
+			if !parts[i].IsPositive() {
+				continue
+			}
+			payment := newPayment(c, helper.ACCOUNT)
+			payment.Amount = parts[i]
+			payment.Account_payment_id = &accountPayment.Account_payment_id
+			if _, applyErr = takePayment(ctx, invoice.Invoice_id, payment); applyErr != nil {
+				break
+			}
+			accountPayment.Allocations = append(accountPayment.Allocations, models.PaymentAllocation{
+				Invoice_id: invoice.Invoice_id, Invoice_number: invoice.Invoice_number, Amount: parts[i],
+			})
+			accountPayment.Amount = accountPayment.Amount.Add(parts[i])
+		}
+
+		if len(accountPayment.Allocations) > 0 {
+			if _, err := accountPaymentCollection.InsertOne(ctx, accountPayment); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "the invoices were paid but the account payment could not be recorded"})
+				return
+			}
+		}
+		if applyErr != nil {
+			c.JSON(accountErrorStatus(applyErr), gin.H{
+				"error":           errPaymentIncomplete.Error() + ": " + applyErr.Error(),
+				"account_payment": accountPayment,
+				"unapplied":       request.Amount.Sub(accountPayment.Amount),
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, accountPayment)
+	}
+}
+
+func GetAccountPayments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := helper.Paginate(ctx, accountPaymentCollection, bson.M{"account_id": c.Param("account_id")}, params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the account payments"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// CreateAccountStatement makes the statement of an account for a month that
+// has ended and emails it to the account.
+func CreateAccountStatement() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var request StatementRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.BindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		start, err := statementPeriod(request.Period, time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		account, err := findAccount(ctx, c.Param("account_id"))
+		if err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		statement, err := makeStatement(ctx, account, start, c.GetString("uid"))
+		if err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if err := sendStatement(ctx, account, statement); err != nil {
+			log.Printf("statement of account %s could not be sent: %v", account.Customer_account_id, err)
+		}
+
+		c.JSON(http.StatusCreated, statement)
+	}
+}
+
+func GetAccountStatements() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := helper.Paginate(ctx, accountStatementCollection, bson.M{"account_id": c.Param("account_id")}, params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the statements"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetAccountStatement() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var statement models.AccountStatement
+		err := accountStatementCollection.FindOne(ctx, bson.M{"account_statement_id": c.Param("account_statement_id")}).Decode(&statement)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "statement was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the statement"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.ETag(statement.Version)) {
+			return
+		}
+		c.JSON(http.StatusOK, statement)
+	}
+}
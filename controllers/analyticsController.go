@@ -0,0 +1,748 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// analyticsCache keeps the dashboard reports for REPORT_CACHE_TTL.
+var analyticsCache = helper.NewReportCache(helper.ReportCacheTTL())
+
+// Revenue is grouped by one of these periods, in the local time zone.
+var revenueIntervals = map[string]string{
+	"hour": "%Y-%m-%dT%H:00",
+	"day":  "%Y-%m-%d",
+	"week": "%G-W%V",
+}
+
+// RevenuePeriod is what was billed in one period, less the credit notes
+// issued in it. Revenue is what guests were charged before tips, net sales
+// leave out the tax as well.
+type RevenuePeriod struct {
+	Period        string      `json:"period"`
+	Invoice_count int         `json:"invoice_count"`
+	Credit_total  money.Money `json:"credit_total"`
+	Revenue       money.Money `json:"revenue"`
+	Net_sales     money.Money `json:"net_sales"`
+	Tax_total     money.Money `json:"tax_total"`
+	Tip_total     money.Money `json:"tip_total"`
+	Average_check money.Money `json:"average_check"`
+}
+
+type TableCovers struct {
+	Table_id      string      `json:"table_id"`
+	Table_number  *int        `json:"table_number"`
+	Order_count   int         `json:"order_count"`
+	Covers        int         `json:"covers"`
+	Net_sales     money.Money `json:"net_sales"`
+	Net_per_cover money.Money `json:"net_per_cover"`
+}
+
+// ItemSales is how much of one food or menu sold, leaving out voided items.
+type ItemSales struct {
+	Food_id   string      `json:"food_id,omitempty"`
+	Menu_id   string      `json:"menu_id"`
+	Name      string      `json:"name"`
+	Quantity  int         `json:"quantity"`
+	Net_sales money.Money `json:"net_sales"`
+}
+
+// ServerSales is what a server's orders were billed, less the credit notes
+// issued on them.
+type ServerSales struct {
+	Server_id     string      `json:"server_id"`
+	Name          string      `json:"name"`
+	Invoice_count int         `json:"invoice_count"`
+	Credit_total  money.Money `json:"credit_total"`
+	Revenue       money.Money `json:"revenue"`
+	Net_sales     money.Money `json:"net_sales"`
+	Tip_total     money.Money `json:"tip_total"`
+	Average_check money.Money `json:"average_check"`
+}
+
+// analyticsQuery is the date range and branch a dashboard report covers. An
+// empty branch covers them all.
+type analyticsQuery struct {
+	From   time.Time
+	To     time.Time
+	Branch string
+}
+
+func (query analyticsQuery) window() bson.M {
+	return bson.M{"$gte": query.From, "$lt": query.To}
+}
+
+// issuedInvoices matches the invoices issued in the range.
+func (query analyticsQuery) issuedInvoices() bson.D {
+	filter := notDeleted(bson.M{"issued_at": query.window()})
+	if query.Branch != "" {
+		filter["branch"] = query.Branch
+	}
+	return bson.D{{Key: "$match", Value: filter}}
+}
+
+// creditTotals is what the credit notes of one period or server took off the
+// sales, Amount off the revenue and Tax of it off the tax.
+type creditTotals struct {
+	Key    string `bson:"_id"`
+	Amount money.Money
+	Tax    money.Money
+}
+
+// issuedCredits sums the credit notes issued in the range by key, those on
+// the branch's invoices when there is one. The credit note has its invoice
+// as invoice for the stages and key.
+func (query analyticsQuery) issuedCredits(ctx context.Context, stages []bson.D, key interface{}) (map[string]creditTotals, error) {
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{{Key: "created_at", Value: query.window()}}}},
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "invoice"},
+			{Key: "localField", Value: "invoice_id"},
+			{Key: "foreignField", Value: "invoice_id"},
+			{Key: "as", Value: "invoice"},
+		}}},
+		bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$invoice"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}},
+	}
+	if query.Branch != "" {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.D{{Key: "invoice.branch", Value: query.Branch}}}})
+	}
+	pipeline = append(pipeline, stages...)
+	pipeline = append(pipeline, bson.D{{Key: "$group", Value: bson.D{
+		{Key: "_id", Value: key},
+		{Key: "amount", Value: bson.D{{Key: "$sum", Value: money.Field("$amount")}}},
+		{Key: "tax", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$sum", Value: money.Field("$tax_lines.amount")}}}}},
+	}}})
+
+	var rows []creditTotals
+	if err := aggregateAll(ctx, creditNoteCollection, pipeline, &rows); err != nil {
+		return nil, err
+	}
+	credits := map[string]creditTotals{}
+	for _, row := range rows {
+		credits[row.Key] = row
+	}
+	return credits, nil
+}
+
+// localTimezone is the name of the server's time zone, such as Europe/Rome,
+// so periods on either side of a daylight saving change are cut at their own
+// local midnight. Without TZ Go only calls it Local, and the name is read from
+// the /etc/localtime link instead; failing that the current offset is used.
+func localTimezone() string {
+	if zone := time.Local.String(); zone != "Local" {
+		return zone
+	}
+	if target, err := os.Readlink("/etc/localtime"); err == nil {
+		if _, zone, ok := strings.Cut(target, "zoneinfo/"); ok {
+			return zone
+		}
+	}
+	return time.Now().Format("-07:00")
+}
+
+// billedAtBranch keeps the orders and order items billed at the branch.
+// Orders carry no branch, only their invoices do.
+func (query analyticsQuery) billedAtBranch() []bson.D {
+	if query.Branch == "" {
+		return nil
+	}
+	return []bson.D{
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "invoice"},
+			{Key: "let", Value: bson.D{{Key: "order_id", Value: "$order_id"}}},
+			{Key: "pipeline", Value: bson.A{
+				bson.D{{Key: "$match", Value: bson.D{
+					{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$order_id", "$$order_id"}}}},
+					{Key: "branch", Value: query.Branch},
+				}}},
+				bson.D{{Key: "$project", Value: bson.D{{Key: "_id", Value: 1}}}},
+			}},
+			{Key: "as", Value: "branch_invoices"},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "branch_invoices.0", Value: bson.D{{Key: "$exists", Value: true}}}}}},
+	}
+}
+
+func (query analyticsQuery) body(report gin.H) gin.H {
+	report["from"] = query.From.Format("2006-01-02")
+	report["to"] = query.To.AddDate(0, 0, -1).Format("2006-01-02")
+	report["branch"] = query.Branch
+	return report
+}
+
+// average is the amount shared out over a count, nothing when there is none.
+func average(amount money.Money, count int) money.Money {
+	if count <= 0 {
+		return money.Zero()
+	}
+	return amount.Mul(big.NewRat(1, int64(count)))
+}
+
+// reportLimit reads how many rows a ranking returns, ten by default.
+func reportLimit(c *gin.Context) (int, error) {
+	value := c.DefaultQuery("limit", "10")
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > 100 {
+		return 0, errors.New("limit must be a number from 1 to 100")
+	}
+	return limit, nil
+}
+
+// analyticsRequest checks who asks for a dashboard report and reads its
+// date range and ?branch.
+func analyticsRequest(c *gin.Context) (analyticsQuery, bool) {
+	if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return analyticsQuery{}, false
+	}
+
+	from, to, err := reportRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return analyticsQuery{}, false
+	}
+	return analyticsQuery{From: from, To: to, Branch: c.Query("branch")}, true
+}
+
+// serveAnalytics answers a dashboard report from the cache, or builds and
+// keeps it. The key is the path with its sorted query, so the same report
+// asked for with the parameters in another order is shared.
+func serveAnalytics(c *gin.Context, query analyticsQuery, name string, build func(ctx context.Context) (gin.H, error)) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	key := c.Request.URL.Path + "?" + c.Request.URL.Query().Encode()
+	body, ok := analyticsCache.Get(key)
+	if !ok {
+		report, err := build(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the " + name + " report"})
+			return
+		}
+		body = query.body(report)
+		analyticsCache.Put(key, body)
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(analyticsCache.TTL().Seconds())))
+	if helper.CheckNotModified(c, helper.BodyETag(body)) {
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// GetRevenueReport sums the invoices issued in the range per hour, day or
+// week with the average check size.
+func GetRevenueReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := analyticsRequest(c)
+		if !ok {
+			return
+		}
+		interval := c.DefaultQuery("interval", "day")
+		format, ok := revenueIntervals[interval]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be hour, day or week"})
+			return
+		}
+
+		serveAnalytics(c, query, "revenue", func(ctx context.Context) (gin.H, error) {
+			period := func(date string) bson.D {
+				return bson.D{{Key: "$dateToString", Value: bson.D{
+					{Key: "format", Value: format},
+					{Key: "date", Value: date},
+					{Key: "timezone", Value: localTimezone()},
+				}}}
+			}
+
+			type revenueRow struct {
+				Period        string `bson:"_id"`
+				Invoice_count int
+				Total         money.Money
+				Subtotal      money.Money
+				Tax_total     money.Money
+				Tip           money.Money
+			}
+			var rows []revenueRow
+			err := aggregateAll(ctx, invoiceCollection, mongo.Pipeline{
+				query.issuedInvoices(),
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: period("$issued_at")},
+					{Key: "invoice_count", Value: bson.D{{Key: "$sum", Value: 1}}},
+					{Key: "total", Value: bson.D{{Key: "$sum", Value: money.Field("$total")}}},
+					{Key: "subtotal", Value: bson.D{{Key: "$sum", Value: money.Field("$subtotal")}}},
+					{Key: "tax_total", Value: bson.D{{Key: "$sum", Value: money.Field("$tax_total")}}},
+					{Key: "tip", Value: bson.D{{Key: "$sum", Value: money.Field("$tip")}}},
+				}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+			}, &rows)
+			if err != nil {
+				return nil, err
+			}
+
+			credits, err := query.issuedCredits(ctx, nil, period("$created_at"))
+			if err != nil {
+				return nil, err
+			}
+
+			// credits in a period nothing was billed in get a period of their own
+			billed := map[string]bool{}
+			for _, row := range rows {
+				billed[row.Period] = true
+			}
+			for key := range credits {
+				if !billed[key] {
+					rows = append(rows, revenueRow{Period: key, Total: money.Zero(), Subtotal: money.Zero(), Tax_total: money.Zero(), Tip: money.Zero()})
+				}
+			}
+			sort.Slice(rows, func(i, j int) bool { return rows[i].Period < rows[j].Period })
+
+			periods := []RevenuePeriod{}
+			invoiceCount, revenue, netSales, credited := 0, money.Zero(), money.Zero(), money.Zero()
+			for _, row := range rows {
+				creditAmount, creditTax := money.Zero(), money.Zero()
+				if credit, ok := credits[row.Period]; ok {
+					creditAmount, creditTax = credit.Amount, credit.Tax
+				}
+				period := RevenuePeriod{
+					Period:        row.Period,
+					Invoice_count: row.Invoice_count,
+					Credit_total:  creditAmount,
+					Revenue:       row.Total.Sub(row.Tip).Sub(creditAmount),
+					Net_sales:     row.Subtotal.Sub(creditAmount.Sub(creditTax)),
+					Tax_total:     row.Tax_total.Sub(creditTax),
+					Tip_total:     row.Tip,
+				}
+				period.Average_check = average(period.Revenue, period.Invoice_count)
+				periods = append(periods, period)
+
+				invoiceCount += period.Invoice_count
+				revenue = revenue.Add(period.Revenue)
+				netSales = netSales.Add(period.Net_sales)
+				credited = credited.Add(period.Credit_total)
+			}
+
+			return gin.H{
+				"interval":      interval,
+				"periods":       periods,
+				"invoice_count": invoiceCount,
+				"credit_total":  credited,
+				"revenue":       revenue,
+				"net_sales":     netSales,
+				"average_check": average(revenue, invoiceCount),
+			}, nil
+		})
+	}
+}
+
+// GetCoversReport counts the guests served at each table. Orders that did not
+// record their guests count the seats of the table.
+func GetCoversReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := analyticsRequest(c)
+		if !ok {
+			return
+		}
+
+		serveAnalytics(c, query, "covers", func(ctx context.Context) (gin.H, error) {
+			pipeline := mongo.Pipeline{
+				bson.D{{Key: "$match", Value: notDeleted(bson.M{"merged_into": nil, "order_date": query.window()})}},
+			}
+			pipeline = append(pipeline, query.billedAtBranch()...)
+			pipeline = append(pipeline,
+				bson.D{{Key: "$lookup", Value: bson.D{
+					{Key: "from", Value: "invoice"},
+					{Key: "let", Value: bson.D{{Key: "order_id", Value: "$order_id"}}},
+					{Key: "pipeline", Value: bson.A{
+						bson.D{{Key: "$match", Value: bson.D{
+							{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$order_id", "$$order_id"}}}},
+							{Key: "deleted_at", Value: nil},
+						}}},
+						bson.D{{Key: "$project", Value: bson.D{{Key: "subtotal", Value: 1}}}},
+					}},
+					{Key: "as", Value: "invoices"},
+				}}},
+				bson.D{{Key: "$lookup", Value: bson.D{
+					{Key: "from", Value: "table"},
+					{Key: "localField", Value: "table_id"},
+					{Key: "foreignField", Value: "table_id"},
+					{Key: "as", Value: "table"},
+				}}},
+				bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$table"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}},
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: "$table_id"},
+					{Key: "table_number", Value: bson.D{{Key: "$first", Value: "$table.table_number"}}},
+					{Key: "order_count", Value: bson.D{{Key: "$sum", Value: 1}}},
+					{Key: "covers", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$guests", "$table.number_of_guests", 0}}}}}},
+					{Key: "net_sales", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$sum", Value: money.Field("$invoices.subtotal")}}}}},
+				}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "table_number", Value: 1}}}},
+			)
+
+			var rows []struct {
+				Table_id     string `bson:"_id"`
+				Table_number *int
+				Order_count  int
+				Covers       int
+				Net_sales    money.Money
+			}
+			if err := aggregateAll(ctx, orderCollection, pipeline, &rows); err != nil {
+				return nil, err
+			}
+
+			tables := []TableCovers{}
+			covers, netSales := 0, money.Zero()
+			for _, row := range rows {
+				tables = append(tables, TableCovers{
+					Table_id:      row.Table_id,
+					Table_number:  row.Table_number,
+					Order_count:   row.Order_count,
+					Covers:        row.Covers,
+					Net_sales:     row.Net_sales,
+					Net_per_cover: average(row.Net_sales, row.Covers),
+				})
+				covers += row.Covers
+				netSales = netSales.Add(row.Net_sales)
+			}
+
+			return gin.H{
+				"tables":        tables,
+				"covers":        covers,
+				"net_sales":     netSales,
+				"net_per_cover": average(netSales, covers),
+			}, nil
+		})
+	}
+}
+
+// foodSales is what every food sold on the invoices issued in the range,
+// those on the menus that sold nothing included.
+func foodSales(ctx context.Context, query analyticsQuery) ([]ItemSales, error) {
+	pipeline := mongo.Pipeline{
+		query.issuedInvoices(),
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$order_id"}}}},
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "orderItem"},
+			{Key: "let", Value: bson.D{{Key: "order_id", Value: "$_id"}}},
+			{Key: "pipeline", Value: bson.A{
+				bson.D{{Key: "$match", Value: bson.D{
+					{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$order_id", "$$order_id"}}}},
+					{Key: "void", Value: nil},
+					{Key: "deleted_at", Value: nil},
+				}}},
+			}},
+			{Key: "as", Value: "items"},
+		}}},
+		bson.D{{Key: "$unwind", Value: "$items"}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$items.food_id"},
+			{Key: "quantity", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "net_sales", Value: bson.D{{Key: "$sum", Value: money.Field("$items.unit_price")}}},
+		}}},
+	}
+
+	var sold []struct {
+		Food_id   string `bson:"_id"`
+		Quantity  int
+		Net_sales money.Money
+	}
+	if err := aggregateAll(ctx, invoiceCollection, pipeline, &sold); err != nil {
+		return nil, err
+	}
+
+	var foods []struct {
+		Food_id    string
+		Menu_id    *string
+		Name       *string
+		Deleted_at *time.Time
+	}
+	// deleted foods are only listed when they sold
+	result, err := foodCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	if err = result.All(ctx, &foods); err != nil {
+		return nil, err
+	}
+
+	quantities := map[string]int{}
+	amounts := map[string]money.Money{}
+	for _, row := range sold {
+		quantities[row.Food_id] = row.Quantity
+		amounts[row.Food_id] = row.Net_sales
+	}
+
+	sales := []ItemSales{}
+	for _, food := range foods {
+		quantity, ok := quantities[food.Food_id]
+		if !ok && food.Deleted_at != nil {
+			continue
+		}
+		row := ItemSales{Food_id: food.Food_id, Quantity: quantity, Net_sales: money.Zero()}
+		if ok {
+			row.Net_sales = amounts[food.Food_id]
+		}
+		if food.Menu_id != nil {
+			row.Menu_id = *food.Menu_id
+		}
+		if food.Name != nil {
+			row.Name = *food.Name
+		}
+		sales = append(sales, row)
+	}
+	return sales, nil
+}
+
+// salesRanking reads how a ranking is ordered, best selling first or worst
+// with ?order=bottom, and how many rows it keeps.
+type salesRanking struct {
+	Order string
+	Limit int
+}
+
+func rankingRequest(c *gin.Context) (salesRanking, bool) {
+	ranking := salesRanking{Order: c.DefaultQuery("order", "top")}
+	if ranking.Order != "top" && ranking.Order != "bottom" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be top or bottom"})
+		return ranking, false
+	}
+	limit, err := reportLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return ranking, false
+	}
+	ranking.Limit = limit
+	return ranking, true
+}
+
+func (ranking salesRanking) rank(sales []ItemSales) []ItemSales {
+	sort.SliceStable(sales, func(i, j int) bool {
+		a, b := sales[i], sales[j]
+		if ranking.Order == "bottom" {
+			a, b = b, a
+		}
+		if a.Quantity != b.Quantity {
+			return a.Quantity > b.Quantity
+		}
+		if cmp := a.Net_sales.Cmp(b.Net_sales); cmp != 0 {
+			return cmp > 0
+		}
+		return a.Name < b.Name
+	})
+	if len(sales) > ranking.Limit {
+		sales = sales[:ranking.Limit]
+	}
+	return sales
+}
+
+// GetFoodSalesReport ranks the foods by how many sold, optionally within one
+// ?menu_id.
+func GetFoodSalesReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := analyticsRequest(c)
+		if !ok {
+			return
+		}
+		ranking, ok := rankingRequest(c)
+		if !ok {
+			return
+		}
+
+		serveAnalytics(c, query, "food sales", func(ctx context.Context) (gin.H, error) {
+			sales, err := foodSales(ctx, query)
+			if err != nil {
+				return nil, err
+			}
+			if menuId := c.Query("menu_id"); menuId != "" {
+				onMenu := []ItemSales{}
+				for _, row := range sales {
+					if row.Menu_id == menuId {
+						onMenu = append(onMenu, row)
+					}
+				}
+				sales = onMenu
+			}
+
+			return gin.H{"order": ranking.Order, "foods": ranking.rank(sales)}, nil
+		})
+	}
+}
+
+// GetMenuSalesReport ranks the menus by how many of their foods sold.
+func GetMenuSalesReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := analyticsRequest(c)
+		if !ok {
+			return
+		}
+		ranking, ok := rankingRequest(c)
+		if !ok {
+			return
+		}
+
+		serveAnalytics(c, query, "menu sales", func(ctx context.Context) (gin.H, error) {
+			sales, err := foodSales(ctx, query)
+			if err != nil {
+				return nil, err
+			}
+
+			var menus []struct {
+				Menu_id string
+				Name    string
+			}
+			result, err := menuCollection.Find(ctx, notDeleted(bson.M{}))
+			if err != nil {
+				return nil, err
+			}
+			if err = result.All(ctx, &menus); err != nil {
+				return nil, err
+			}
+
+			menuSales := []ItemSales{}
+			index := map[string]int{}
+			for _, menu := range menus {
+				index[menu.Menu_id] = len(menuSales)
+				menuSales = append(menuSales, ItemSales{Menu_id: menu.Menu_id, Name: menu.Name, Net_sales: money.Zero()})
+			}
+			for _, row := range sales {
+				i, ok := index[row.Menu_id]
+				if !ok {
+					i = len(menuSales)
+					index[row.Menu_id] = i
+					menuSales = append(menuSales, ItemSales{Menu_id: row.Menu_id, Net_sales: money.Zero()})
+				}
+				menuSales[i].Quantity += row.Quantity
+				menuSales[i].Net_sales = menuSales[i].Net_sales.Add(row.Net_sales)
+			}
+
+			return gin.H{"order": ranking.Order, "menus": ranking.rank(menuSales)}, nil
+		})
+	}
+}
+
+// GetServerSalesReport sums the invoices issued in the range per server of
+// their order, less the credit notes issued on them in the range.
+func GetServerSalesReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := analyticsRequest(c)
+		if !ok {
+			return
+		}
+
+		serveAnalytics(c, query, "server sales", func(ctx context.Context) (gin.H, error) {
+			var rows []struct {
+				Server_id     string `bson:"_id"`
+				First_name    *string
+				Last_name     *string
+				Invoice_count int
+				Total         money.Money
+				Subtotal      money.Money
+				Tip           money.Money
+			}
+			err := aggregateAll(ctx, invoiceCollection, mongo.Pipeline{
+				query.issuedInvoices(),
+				bson.D{{Key: "$lookup", Value: bson.D{
+					{Key: "from", Value: "order"},
+					{Key: "localField", Value: "order_id"},
+					{Key: "foreignField", Value: "order_id"},
+					{Key: "as", Value: "order"},
+				}}},
+				bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$order"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}},
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$order.server_id", "$tip_server_id", ""}}}},
+					{Key: "invoice_count", Value: bson.D{{Key: "$sum", Value: 1}}},
+					{Key: "total", Value: bson.D{{Key: "$sum", Value: money.Field("$total")}}},
+					{Key: "subtotal", Value: bson.D{{Key: "$sum", Value: money.Field("$subtotal")}}},
+					{Key: "tip", Value: bson.D{{Key: "$sum", Value: money.Field("$tip")}}},
+				}}},
+				bson.D{{Key: "$lookup", Value: bson.D{
+					{Key: "from", Value: "user"},
+					{Key: "localField", Value: "_id"},
+					{Key: "foreignField", Value: "user_id"},
+					{Key: "as", Value: "user"},
+				}}},
+				bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$user"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}},
+				bson.D{{Key: "$addFields", Value: bson.D{
+					{Key: "first_name", Value: "$user.first_name"},
+					{Key: "last_name", Value: "$user.last_name"},
+				}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "subtotal", Value: -1}}}},
+			}, &rows)
+			if err != nil {
+				return nil, err
+			}
+
+			credits, err := query.issuedCredits(ctx, []bson.D{
+				{{Key: "$lookup", Value: bson.D{
+					{Key: "from", Value: "order"},
+					{Key: "localField", Value: "order_id"},
+					{Key: "foreignField", Value: "order_id"},
+					{Key: "as", Value: "order"},
+				}}},
+				{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$order"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}},
+			}, bson.D{{Key: "$ifNull", Value: bson.A{"$order.server_id", "$invoice.tip_server_id", ""}}})
+			if err != nil {
+				return nil, err
+			}
+
+			servers := []ServerSales{}
+			for _, row := range rows {
+				server := ServerSales{
+					Server_id:     row.Server_id,
+					Invoice_count: row.Invoice_count,
+					Credit_total:  money.Zero(),
+					Revenue:       row.Total.Sub(row.Tip),
+					Net_sales:     row.Subtotal,
+					Tip_total:     row.Tip,
+				}
+				if row.First_name != nil && row.Last_name != nil {
+					server.Name = *row.First_name + " " + *row.Last_name
+				}
+				servers = append(servers, server)
+			}
+
+			// servers credited in the range without billing anything in it
+			listed := map[string]bool{}
+			for _, server := range servers {
+				listed[server.Server_id] = true
+			}
+			for serverId := range credits {
+				if listed[serverId] {
+					continue
+				}
+				server := ServerSales{Server_id: serverId, Revenue: money.Zero(), Net_sales: money.Zero(), Tip_total: money.Zero()}
+				var user models.User
+				if err := userCollection.FindOne(ctx, bson.M{"user_id": serverId}).Decode(&user); err == nil && user.First_name != nil && user.Last_name != nil {
+					server.Name = *user.First_name + " " + *user.Last_name
+				}
+				servers = append(servers, server)
+			}
+
+			for i := range servers {
+				server := &servers[i]
+				if credit, ok := credits[server.Server_id]; ok {
+					server.Credit_total = credit.Amount
+					server.Revenue = server.Revenue.Sub(credit.Amount)
+					server.Net_sales = server.Net_sales.Sub(credit.Amount.Sub(credit.Tax))
+				}
+				server.Average_check = average(server.Revenue, server.Invoice_count)
+			}
+			sort.SliceStable(servers, func(i, j int) bool { return servers[i].Net_sales.Cmp(servers[j].Net_sales) > 0 })
+			return gin.H{"servers": servers}, nil
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// notDeleted narrows a filter to records that have not been archived.
+func notDeleted(filter bson.M) bson.M {
+	filter["deleted_at"] = nil
+	return filter
+}
+
+// matchVersion narrows a filter to the version a write was based on. Records
+// created before versioning have no version field and count as version 0.
+func matchVersion(filter bson.M, version int64) bson.M {
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	} else {
+		filter["version"] = version
+	}
+	return filter
+}
+
+// archiveRecord soft deletes the record matching filter by stamping
+// deleted_at and deleted_by. Already archived records are not matched.
+func archiveRecord(ctx context.Context, collection *mongo.Collection, filter bson.M, uid string) (*mongo.UpdateResult, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	return collection.UpdateOne(
+		ctx,
+		notDeleted(filter),
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "deleted_at", Value: now},
+				{Key: "deleted_by", Value: uid},
+				{Key: "updated_at", Value: now},
+			}},
+			{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+		},
+	)
+}
+
+// restoreRecord clears the archive stamp of the record matching filter.
+func restoreRecord(ctx context.Context, collection *mongo.Collection, filter bson.M) (*mongo.UpdateResult, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	filter["deleted_at"] = bson.M{"$ne": nil}
+
+	return collection.UpdateOne(
+		ctx,
+		filter,
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "deleted_at", Value: nil},
+				{Key: "deleted_by", Value: nil},
+				{Key: "updated_at", Value: now},
+			}},
+			{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+		},
+	)
+}
@@ -0,0 +1,528 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var businessDayCollection *mongo.Collection = database.OpenCollection(database.Client, "business_day")
+var businessDayIndex sync.Once
+
+var (
+	errBusinessDayNotFound = errors.New("business day was not found")
+	errDrawerNotFound      = errors.New("drawer session was not found")
+)
+
+func ensureBusinessDayIndex(ctx context.Context) {
+	_, err := businessDayCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "branch", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.D{{Key: "status", Value: helper.DayOpen}}),
+	})
+	if err != nil {
+		log.Printf("failed to create the business day index: %v", err)
+	}
+}
+
+func businessDayErrorStatus(err error) int {
+	switch err {
+	case errBusinessDayNotFound, errDrawerNotFound:
+		return http.StatusNotFound
+	case helper.ErrDayAlreadyOpen, helper.ErrDayClosed, helper.ErrDrawersOpen, helper.ErrDrawerInUse, helper.ErrDrawerClosed:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func findBusinessDay(ctx context.Context, dayId string) (models.BusinessDay, error) {
+	var day models.BusinessDay
+	err := businessDayCollection.FindOne(ctx, bson.M{"business_day_id": dayId}).Decode(&day)
+	if err == mongo.ErrNoDocuments {
+		return day, errBusinessDayNotFound
+	}
+	return day, err
+}
+
+// aggregateAll runs a pipeline and decodes every result into out.
+func aggregateAll(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline, out interface{}) error {
+	result, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return result.All(ctx, out)
+}
+
+// branchInvoiceLookup keeps the documents whose invoice the branch issued,
+// for credit notes which do not carry the branch themselves.
+func branchInvoiceLookup(branch string) []bson.D {
+	return []bson.D{
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "invoice"},
+			{Key: "localField", Value: "invoice_id"},
+			{Key: "foreignField", Value: "invoice_id"},
+			{Key: "as", Value: "invoice"},
+		}}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "invoice.branch", Value: branch}}}},
+	}
+}
+
+// drawerCash is the cash a drawer's cashiers took while it was open, and the
+// cash refunds paid out of it.
+func drawerCash(ctx context.Context, session models.DrawerSession, to time.Time) (money.Money, money.Money, error) {
+	if session.Closed_at != nil {
+		to = *session.Closed_at
+	}
+	window := bson.D{{Key: "$gte", Value: session.Opened_at}, {Key: "$lte", Value: to}}
+
+	var sales []struct{ Amount money.Money }
+	err := aggregateAll(ctx, invoiceCollection, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{{Key: "payments.method", Value: helper.CASH}}}},
+		bson.D{{Key: "$unwind", Value: "$payments"}},
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "payments.method", Value: helper.CASH},
+			{Key: "payments.received_by", Value: bson.D{{Key: "$in", Value: session.Cashiers}}},
+			{Key: "payments.paid_at", Value: window},
+		}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "amount", Value: bson.D{{Key: "$sum", Value: money.Field("$payments.amount")}}},
+		}}},
+	}, &sales)
+	if err != nil {
+		return money.Zero(), money.Zero(), err
+	}
+
+	var refunds []struct{ Amount money.Money }
+	err = aggregateAll(ctx, creditNoteCollection, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "refund_method", Value: helper.CASH},
+			{Key: "drawer_session_id", Value: session.Drawer_session_id},
+		}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "amount", Value: bson.D{{Key: "$sum", Value: money.Field("$refunded")}}},
+		}}},
+	}, &refunds)
+	if err != nil {
+		return money.Zero(), money.Zero(), err
+	}
+
+	cashSales, cashRefunds := money.Zero(), money.Zero()
+	if len(sales) > 0 {
+		cashSales = sales[0].Amount
+	}
+	if len(refunds) > 0 {
+		cashRefunds = refunds[0].Amount
+	}
+	return cashSales, cashRefunds, nil
+}
+
+// summarizeDrawer reconciles a drawer as of now or when it was closed.
+func summarizeDrawer(ctx context.Context, session models.DrawerSession, to time.Time) (models.DrawerSummary, error) {
+	cashSales, cashRefunds, err := drawerCash(ctx, session, to)
+	if err != nil {
+		return models.DrawerSummary{}, err
+	}
+	return helper.SummarizeDrawer(session, cashSales, cashRefunds), nil
+}
+
+// buildShiftReport sums up the trading of a branch's business day up to a
+// time: invoices issued, payments taken, voids, credit notes and drawers.
+func buildShiftReport(ctx context.Context, day models.BusinessDay, kind string, to time.Time, generatedBy string) (models.ShiftReport, error) {
+	report := models.ShiftReport{
+		Kind:            kind,
+		Branch:          day.Branch,
+		From:            day.Opened_at,
+		To:              to,
+		Currency:        money.DefaultCurrency(),
+		Tax_lines:       []models.ReportTaxLine{},
+		Payment_methods: []models.ReportPaymentLine{},
+		Credit_notes:    []models.ReportCreditLine{},
+		Drawers:         []models.DrawerSummary{},
+		Tip_total:       money.Zero(),
+		Cash_variance:   money.Zero(),
+		Generated_by:    generatedBy,
+	}
+	report.Generated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	window := bson.D{{Key: "$gte", Value: day.Opened_at}, {Key: "$lte", Value: to}}
+
+	issued := bson.D{{Key: "$match", Value: notDeleted(bson.M{"branch": day.Branch, "issued_at": window})}}
+	var sales []struct {
+		Invoice_count  int
+		Discount_total money.Money
+		Service_total  money.Money
+		Subtotal       money.Money
+		Tax_total      money.Money
+	}
+	err := aggregateAll(ctx, invoiceCollection, mongo.Pipeline{
+		issued,
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "invoice_count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "discount_total", Value: bson.D{{Key: "$sum", Value: money.Field("$discount_total")}}},
+			{Key: "service_total", Value: bson.D{{Key: "$sum", Value: money.Field("$service_total")}}},
+			{Key: "subtotal", Value: bson.D{{Key: "$sum", Value: money.Field("$subtotal")}}},
+			{Key: "tax_total", Value: bson.D{{Key: "$sum", Value: money.Field("$tax_total")}}},
+		}}},
+	}, &sales)
+	if err != nil {
+		return report, err
+	}
+	report.Discount_total, report.Service_total, report.Net_sales, report.Tax_total = money.Zero(), money.Zero(), money.Zero(), money.Zero()
+	if len(sales) > 0 {
+		report.Invoice_count = sales[0].Invoice_count
+		report.Discount_total = sales[0].Discount_total
+		report.Service_total = sales[0].Service_total
+		report.Net_sales = sales[0].Subtotal
+		report.Tax_total = sales[0].Tax_total
+	}
+	report.Gross_sales = report.Net_sales.Add(report.Discount_total)
+
+	err = aggregateAll(ctx, invoiceCollection, mongo.Pipeline{
+		issued,
+		bson.D{{Key: "$unwind", Value: "$tax_lines"}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "code", Value: "$tax_lines.code"},
+				{Key: "name", Value: "$tax_lines.name"},
+				{Key: "rate", Value: "$tax_lines.rate"},
+				{Key: "inclusive", Value: "$tax_lines.inclusive"},
+			}},
+			{Key: "taxable_amount", Value: bson.D{{Key: "$sum", Value: money.Field("$tax_lines.taxable_amount")}}},
+			{Key: "amount", Value: bson.D{{Key: "$sum", Value: money.Field("$tax_lines.amount")}}},
+		}}},
+		bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "code", Value: "$_id.code"},
+			{Key: "name", Value: "$_id.name"},
+			{Key: "rate", Value: "$_id.rate"},
+			{Key: "inclusive", Value: "$_id.inclusive"},
+			{Key: "taxable_amount", Value: 1},
+			{Key: "amount", Value: 1},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "code", Value: 1}}}},
+	}, &report.Tax_lines)
+	if err != nil {
+		return report, err
+	}
+
+	err = aggregateAll(ctx, invoiceCollection, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: notDeleted(bson.M{"branch": day.Branch, "payments.paid_at": window})}},
+		bson.D{{Key: "$unwind", Value: "$payments"}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "payments.paid_at", Value: window}}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$payments.method"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "amount", Value: bson.D{{Key: "$sum", Value: money.Field("$payments.amount")}}},
+			{Key: "tips", Value: bson.D{{Key: "$sum", Value: money.Field("$payments.tip")}}},
+		}}},
+		bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "method", Value: "$_id"},
+			{Key: "count", Value: 1},
+			{Key: "amount", Value: 1},
+			{Key: "tips", Value: 1},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "method", Value: 1}}}},
+	}, &report.Payment_methods)
+	if err != nil {
+		return report, err
+	}
+	for _, method := range report.Payment_methods {
+		report.Tip_total = report.Tip_total.Add(method.Tips)
+	}
+
+	// order items carry no branch, so voids count for the branch that billed
+	// their order
+	var voids []struct {
+		Count  int
+		Amount money.Money
+	}
+	voidPipeline := mongo.Pipeline{bson.D{{Key: "$match", Value: bson.D{{Key: "void.voided_at", Value: window}}}}}
+	voidPipeline = append(voidPipeline, analyticsQuery{Branch: day.Branch}.billedAtBranch()...)
+	err = aggregateAll(ctx, OrderItemCollection, append(voidPipeline,
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "amount", Value: bson.D{{Key: "$sum", Value: money.Field("$unit_price")}}},
+		}}},
+	), &voids)
+	if err != nil {
+		return report, err
+	}
+	report.Void_total = money.Zero()
+	if len(voids) > 0 {
+		report.Void_count = voids[0].Count
+		report.Void_total = voids[0].Amount
+	}
+
+	creditPipeline := mongo.Pipeline{bson.D{{Key: "$match", Value: bson.D{{Key: "created_at", Value: window}}}}}
+	creditPipeline = append(creditPipeline, branchInvoiceLookup(day.Branch)...)
+	creditPipeline = append(creditPipeline,
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$kind"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "amount", Value: bson.D{{Key: "$sum", Value: money.Field("$amount")}}},
+			{Key: "refunded", Value: bson.D{{Key: "$sum", Value: money.Field("$refunded")}}},
+		}}},
+		bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "kind", Value: "$_id"},
+			{Key: "count", Value: 1},
+			{Key: "amount", Value: 1},
+			{Key: "refunded", Value: 1},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "kind", Value: 1}}}},
+	)
+	if err = aggregateAll(ctx, creditNoteCollection, creditPipeline, &report.Credit_notes); err != nil {
+		return report, err
+	}
+
+	sessions, err := daySessions(ctx, day.Business_day_id)
+	if err != nil {
+		return report, err
+	}
+	for _, session := range sessions {
+		summary, err := summarizeDrawer(ctx, session, to)
+		if err != nil {
+			return report, err
+		}
+		report.Drawers = append(report.Drawers, summary)
+		if summary.Variance != nil {
+			report.Cash_variance = report.Cash_variance.Add(*summary.Variance)
+		}
+	}
+	return report, nil
+}
+
+// GetBusinessDays lists the business days of this branch, the open one with
+// ?status=OPEN.
+func GetBusinessDays() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{"branch": helper.BranchCode()}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+
+		page, err := helper.Paginate(ctx, businessDayCollection, filter, params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the business days"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetBusinessDay() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		day, err := findBusinessDay(ctx, c.Param("business_day_id"))
+		if err != nil {
+			c.JSON(businessDayErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.ETag(day.Version)) {
+			return
+		}
+		c.JSON(http.StatusOK, day)
+	}
+}
+
+// OpenBusinessDay starts trading for this branch. Only one day is open at a
+// time.
+func OpenBusinessDay() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		businessDayIndex.Do(func() { ensureBusinessDayIndex(ctx) })
+
+		var day models.BusinessDay
+		day.ID = primitive.NewObjectID()
+		day.Business_day_id = day.ID.Hex()
+		day.Branch = helper.BranchCode()
+		day.Status = helper.DayOpen
+		day.Opened_by = c.GetString("uid")
+		day.Opened_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		day.Created_at = day.Opened_at
+		day.Updated_at = day.Opened_at
+		day.Version = 1
+
+		openCount, err := businessDayCollection.CountDocuments(ctx, bson.M{"branch": day.Branch, "status": helper.DayOpen})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while opening the business day"})
+			return
+		}
+		if openCount > 0 {
+			c.JSON(businessDayErrorStatus(helper.ErrDayAlreadyOpen), gin.H{"error": helper.ErrDayAlreadyOpen.Error()})
+			return
+		}
+
+		if _, err := businessDayCollection.InsertOne(ctx, day); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				c.JSON(businessDayErrorStatus(helper.ErrDayAlreadyOpen), gin.H{"error": helper.ErrDayAlreadyOpen.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while opening the business day"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(day.Version))
+		c.JSON(http.StatusCreated, day)
+	}
+}
+
+// GetXReport sums up the business day so far without closing anything.
+func GetXReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		day, err := findBusinessDay(ctx, c.Param("business_day_id"))
+		if err != nil {
+			c.JSON(businessDayErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		to := time.Now()
+		if day.Closed_at != nil {
+			to = *day.Closed_at
+		}
+		report, err := buildShiftReport(ctx, day, helper.XReport, to, c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the X report"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// CloseBusinessDay ends the day once every drawer is counted and stores its
+// Z report under the next Z number of the branch.
+func CloseBusinessDay() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		day, err := findBusinessDay(ctx, c.Param("business_day_id"))
+		if err != nil {
+			c.JSON(businessDayErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if day.Status != helper.DayOpen {
+			c.JSON(businessDayErrorStatus(helper.ErrDayClosed), gin.H{"error": helper.ErrDayClosed.Error()})
+			return
+		}
+		if !helper.CheckIfMatch(c, helper.ETag(day.Version)) {
+			return
+		}
+
+		openDrawers, err := drawerSessionCollection.CountDocuments(ctx, bson.M{"business_day_id": day.Business_day_id, "status": helper.DrawerOpen})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while closing the business day"})
+			return
+		}
+		if openDrawers > 0 {
+			c.JSON(businessDayErrorStatus(helper.ErrDrawersOpen), gin.H{"error": helper.ErrDrawersOpen.Error()})
+			return
+		}
+
+		closedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		report, err := buildShiftReport(ctx, day, helper.ZReport, closedAt, c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the Z report"})
+			return
+		}
+
+		var counter struct {
+			Seq int64 `bson:"seq"`
+		}
+		err = counterCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": "z:" + day.Branch},
+			bson.D{{Key: "$inc", Value: bson.D{{Key: "seq", Value: 1}}}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&counter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while numbering the Z report"})
+			return
+		}
+		report.Number = &counter.Seq
+
+		closedBy := c.GetString("uid")
+		var updatedDay models.BusinessDay
+		err = businessDayCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"business_day_id": day.Business_day_id, "status": helper.DayOpen, "version": day.Version},
+			bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "status", Value: helper.DayClosed},
+					{Key: "closed_at", Value: closedAt},
+					{Key: "closed_by", Value: closedBy},
+					{Key: "z_report", Value: report},
+					{Key: "updated_at", Value: closedAt},
+				}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedDay)
+		if err == mongo.ErrNoDocuments {
+			log.Printf("Z report %d of branch %s was numbered but the day %s changed before it closed", counter.Seq, day.Branch, day.Business_day_id)
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the business day was modified by someone else, reload it and try again"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while closing the business day"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedDay.Version))
+		c.JSON(http.StatusOK, updatedDay)
+	}
+}
@@ -0,0 +1,386 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"golang-restaurant-backend-app/payments"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var cardPaymentCollection *mongo.Collection = database.OpenCollection(database.Client, "card_payment")
+
+// paymentProvider takes the card payments, set up by UsePaymentProvider at
+// startup.
+var paymentProvider payments.Provider
+
+func UsePaymentProvider(provider payments.Provider) {
+	paymentProvider = provider
+}
+
+// CardPaymentRequest authorizes a card for a payment towards an invoice.
+// Source is the card token from the terminal.
+type CardPaymentRequest struct {
+	Source   *string      `json:"source" validate:"required"`
+	Amount   *money.Money `json:"amount" validate:"omitempty,gt=0"`
+	Tip      *money.Money `json:"tip" validate:"omitempty,gte=0"`
+	Split_id *string      `json:"split_id"`
+}
+
+var errCardPaymentNotFound = errors.New("card payment was not found")
+
+func providerErrorStatus(err error) int {
+	switch err {
+	case payments.ErrDeclined:
+		return http.StatusPaymentRequired
+	case payments.ErrNotFound, errCardPaymentNotFound:
+		return http.StatusNotFound
+	case payments.ErrInvalidState:
+		return http.StatusConflict
+	}
+	return http.StatusBadGateway
+}
+
+// previewPayment checks a payment against the invoice without recording it
+// and works out what it would charge.
+func previewPayment(ctx context.Context, invoiceId string, payment models.Payment) (models.Payment, error) {
+	invoice, err := findInvoice(ctx, invoiceId)
+	if err != nil {
+		return payment, err
+	}
+	if _, err := settleInvoice(ctx, &invoice); err != nil {
+		return payment, err
+	}
+	invoice.Splits = append([]models.BillSplit{}, invoice.Splits...)
+	err = helper.ApplyPayment(&invoice, &payment)
+	return payment, err
+}
+
+func cardPaymentAsPayment(cardPayment models.CardPayment) models.Payment {
+	paidAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return models.Payment{
+		Payment_id:  primitive.NewObjectID().Hex(),
+		Split_id:    cardPayment.Split_id,
+		Method:      helper.CARD,
+		Provider:    &cardPayment.Provider,
+		Intent_id:   &cardPayment.Intent_id,
+		Amount:      cardPayment.Amount,
+		Tip:         cardPayment.Tip,
+		Received_by: cardPayment.Created_by,
+		Paid_at:     paidAt,
+	}
+}
+
+func findCardPayment(ctx context.Context, filter bson.M) (models.CardPayment, error) {
+	var cardPayment models.CardPayment
+	err := cardPaymentCollection.FindOne(ctx, filter).Decode(&cardPayment)
+	if err == mongo.ErrNoDocuments {
+		return cardPayment, errCardPaymentNotFound
+	}
+	return cardPayment, err
+}
+
+// setCardPaymentStatus moves a card payment on from an authorization that is
+// still open, so a capture and a void cannot both win.
+func setCardPaymentStatus(ctx context.Context, cardPaymentId string, status string, at string) error {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	set := bson.D{
+		{Key: "status", Value: status},
+		{Key: "updated_at", Value: now},
+	}
+	if at != "" {
+		set = append(set, bson.E{Key: at, Value: now})
+	}
+
+	_, err := cardPaymentCollection.UpdateOne(
+		ctx,
+		bson.M{"card_payment_id": cardPaymentId, "status": payments.AUTHORIZED},
+		bson.D{{Key: "$set", Value: set}, {Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}}},
+	)
+	return err
+}
+
+// recordCapture puts a captured card payment on its invoice. It is safe to
+// call again for the same capture.
+func recordCapture(ctx context.Context, cardPayment models.CardPayment) (models.Invoice, error) {
+	invoice, err := takePayment(ctx, cardPayment.Invoice_id, cardPaymentAsPayment(cardPayment))
+	if err != nil {
+		return invoice, err
+	}
+	return invoice, setCardPaymentStatus(ctx, cardPayment.Card_payment_id, payments.CAPTURED, "captured_at")
+}
+
+func GetCardPayments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := helper.Paginate(ctx, cardPaymentCollection, bson.M{"invoice_id": c.Param("invoice_id")}, params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the card payments"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetCardPayment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		cardPayment, err := findCardPayment(ctx, bson.M{"card_payment_id": c.Param("card_payment_id")})
+		if err != nil {
+			c.JSON(providerErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.ETag(cardPayment.Version)) {
+			return
+		}
+		c.JSON(http.StatusOK, cardPayment)
+	}
+}
+
+// AuthorizeCardPayment holds the amount on the guest's card. Nothing is paid
+// on the invoice until the payment is captured.
+func AuthorizeCardPayment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request CardPaymentRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		invoiceId := c.Param("invoice_id")
+
+		payment := newPayment(c, helper.CARD)
+		payment.Split_id = request.Split_id
+		if request.Amount != nil {
+			payment.Amount = *request.Amount
+		}
+		if request.Tip != nil {
+			payment.Tip = *request.Tip
+		}
+
+		payment, err := previewPayment(ctx, invoiceId, payment)
+		if err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		var cardPayment models.CardPayment
+		cardPayment.ID = primitive.NewObjectID()
+		cardPayment.Card_payment_id = cardPayment.ID.Hex()
+
+		intent, err := paymentProvider.Authorize(ctx, payments.AuthorizeRequest{
+			Amount:          payment.Amount.Minor,
+			Currency:        payments.Currency(),
+			Source:          *request.Source,
+			Reference:       invoiceId,
+			Idempotency_key: cardPayment.Card_payment_id,
+		})
+		if err != nil {
+			c.JSON(providerErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		cardPayment.Invoice_id = invoiceId
+		cardPayment.Split_id = request.Split_id
+		cardPayment.Provider = paymentProvider.Name()
+		cardPayment.Intent_id = intent.ID
+		cardPayment.Status = payments.AUTHORIZED
+		cardPayment.Amount = payment.Amount.Sub(payment.Tip)
+		cardPayment.Tip = payment.Tip
+		cardPayment.Created_by = c.GetString("uid")
+		cardPayment.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		cardPayment.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		cardPayment.Version = 1
+
+		if _, err := cardPaymentCollection.InsertOne(ctx, cardPayment); err != nil {
+			// do not leave the guest's money held for a payment we lost
+			if _, voidErr := paymentProvider.Void(ctx, intent.ID); voidErr != nil {
+				log.Printf("failed to void payment intent %s: %v", intent.ID, voidErr)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while saving the card payment"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(cardPayment.Version))
+		c.JSON(http.StatusCreated, cardPayment)
+	}
+}
+
+// CaptureCardPayment charges an authorized card. The invoice is only paid
+// once the provider confirms the capture, here or through the webhook.
+func CaptureCardPayment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		cardPayment, err := findCardPayment(ctx, bson.M{"card_payment_id": c.Param("card_payment_id")})
+		if err != nil {
+			c.JSON(providerErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if cardPayment.Status != payments.AUTHORIZED && cardPayment.Status != payments.CAPTURED {
+			c.JSON(http.StatusConflict, gin.H{"error": "only authorized card payments can be captured"})
+			return
+		}
+
+		// a capture already confirmed only needs to reach the invoice
+		if cardPayment.Status == payments.AUTHORIZED {
+			if _, err := previewPayment(ctx, cardPayment.Invoice_id, cardPaymentAsPayment(cardPayment)); err != nil {
+				c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+
+			intent, err := paymentProvider.Capture(ctx, cardPayment.Intent_id)
+			if err != nil {
+				c.JSON(providerErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			if intent.Status != payments.CAPTURED {
+				c.JSON(http.StatusAccepted, gin.H{"message": "the capture is waiting for the provider to confirm it", "card_payment_id": cardPayment.Card_payment_id})
+				return
+			}
+		}
+
+		invoice, err := recordCapture(ctx, cardPayment)
+		if err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(invoice.Version))
+		c.JSON(http.StatusOK, invoice)
+	}
+}
+
+// VoidCardPayment releases an authorization that will not be captured.
+func VoidCardPayment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		cardPaymentId := c.Param("card_payment_id")
+		cardPayment, err := findCardPayment(ctx, bson.M{"card_payment_id": cardPaymentId})
+		if err != nil {
+			c.JSON(providerErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if cardPayment.Status != payments.AUTHORIZED {
+			c.JSON(http.StatusConflict, gin.H{"error": "only authorized card payments can be voided"})
+			return
+		}
+
+		if _, err := paymentProvider.Void(ctx, cardPayment.Intent_id); err != nil {
+			c.JSON(providerErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if err := setCardPaymentStatus(ctx, cardPaymentId, payments.VOIDED, "voided_at"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "card payment failed to update"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "card payment voided", "card_payment_id": cardPaymentId})
+	}
+}
+
+// PaymentWebhook takes the provider's notices about payments. It answers
+// 200 for payments it does not know so the provider stops retrying them.
+func PaymentWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		payload, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		event, err := paymentProvider.ParseWebhook(payload, c.Request.Header)
+		if err == payments.ErrNotFound {
+			c.JSON(http.StatusOK, gin.H{"received": true})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		cardPayment, err := findCardPayment(ctx, bson.M{"provider": paymentProvider.Name(), "intent_id": event.Intent.ID})
+		if err == errCardPaymentNotFound {
+			c.JSON(http.StatusOK, gin.H{"received": true})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the card payment"})
+			return
+		}
+
+		switch event.Type {
+		case payments.EventCaptured:
+			if cardPayment.Status == payments.CAPTURED {
+				break
+			}
+			// only a capture of the whole authorization pays the invoice
+			authorized := cardPayment.Amount.Add(cardPayment.Tip)
+			if event.Intent.Status != payments.CAPTURED || event.Intent.Captured != authorized.Minor {
+				log.Printf("ignored the capture of %s: %s for %d cents, %s was authorized", cardPayment.Intent_id, event.Intent.Status, event.Intent.Captured, authorized)
+				break
+			}
+			_, err = recordCapture(ctx, cardPayment)
+			if err == helper.ErrInvoicePaid {
+				// the card was charged for an invoice settled some other way,
+				// which staff refund, so the provider need not send it again
+				log.Printf("card payment %s was captured on invoice %s, which is already paid", cardPayment.Intent_id, cardPayment.Invoice_id)
+				err = setCardPaymentStatus(ctx, cardPayment.Card_payment_id, payments.CAPTURED, "captured_at")
+			}
+			if err != nil {
+				log.Printf("failed to record the capture of %s: %v", cardPayment.Intent_id, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while recording the capture"})
+				return
+			}
+		case payments.EventVoided:
+			err = setCardPaymentStatus(ctx, cardPayment.Card_payment_id, payments.VOIDED, "voided_at")
+		case payments.EventFailed:
+			err = setCardPaymentStatus(ctx, cardPayment.Card_payment_id, payments.FAILED, "")
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "card payment failed to update"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"received": true})
+	}
+}
@@ -0,0 +1,547 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"golang-restaurant-backend-app/payments"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var creditNoteCollection *mongo.Collection = database.OpenCollection(database.Client, "credit_note")
+
+// RefundRequest gives money back on one payment of an invoice, all that is
+// left of it unless an amount is given. Cash is paid out of the open drawer
+// Drawer_session_id.
+type RefundRequest struct {
+	Payment_id        *string      `json:"payment_id" validate:"required"`
+	Drawer_session_id *string      `json:"drawer_session_id"`
+	Amount            *money.Money `json:"amount" validate:"omitempty,gt=0"`
+	Reason_code       *string      `json:"reason_code" validate:"required,eq=WRONG_ITEM|eq=QUALITY|eq=COMPLAINT|eq=OVERCHARGE|eq=DUPLICATE|eq=OTHER"`
+	Reason            *string      `json:"reason" validate:"required,min=3,max=200"`
+}
+
+// VoidItemRequest takes an item off the bill. Refund_payment_id gives the
+// credit back on that payment when the bill is already paid, in cash out of
+// the open drawer Drawer_session_id.
+type VoidItemRequest struct {
+	Reason_code       *string `json:"reason_code" validate:"required,eq=WRONG_ITEM|eq=QUALITY|eq=COMPLAINT|eq=OVERCHARGE|eq=DUPLICATE|eq=OTHER"`
+	Reason            *string `json:"reason" validate:"required,min=3,max=200"`
+	Refund_payment_id *string `json:"refund_payment_id"`
+	Drawer_session_id *string `json:"drawer_session_id"`
+}
+
+var (
+	errPaymentNotFound = errors.New("the payment was not found on this invoice")
+	errRefundTooLarge  = errors.New("the refund is more than what is left of the payment")
+	errItemVoided      = errors.New("the order item is already voided")
+	errDrawerRequired  = errors.New("cash refunds need the drawer_session_id of the open drawer they are paid from")
+)
+
+func creditErrorStatus(err error) int {
+	switch err {
+	case errInvoiceNotFound, errPaymentNotFound, payments.ErrNotFound, errDrawerNotFound:
+		return http.StatusNotFound
+	case errRefundTooLarge, errDrawerRequired:
+		return http.StatusBadRequest
+	case errItemVoided, payments.ErrInvalidState, helper.ErrDrawerClosed:
+		return http.StatusConflict
+	case errInvoiceChanged:
+		return http.StatusPreconditionFailed
+	case payments.ErrDeclined:
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// refundedOnPayment is how much of a payment was already given back.
+func refundedOnPayment(ctx context.Context, paymentId string) (money.Money, error) {
+	result, err := creditNoteCollection.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{{Key: "payment_id", Value: paymentId}}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$payment_id"},
+			{Key: "refunded", Value: bson.D{{Key: "$sum", Value: money.Field("$refunded")}}},
+		}}},
+	})
+	if err != nil {
+		return money.Zero(), err
+	}
+
+	var totals []bson.M
+	if err = result.All(ctx, &totals); err != nil {
+		return money.Zero(), err
+	}
+	if len(totals) == 0 {
+		return money.Zero(), nil
+	}
+	return money.FromValue(totals[0]["refunded"]), nil
+}
+
+// refundDrawer is the open drawer a cash refund on a payment is paid out of,
+// recorded on its credit note so the drawer expects that much less cash.
+// Other refunds go back on the card and need no drawer.
+func refundDrawer(ctx context.Context, invoice models.Invoice, paymentId string, drawerId *string) (*string, error) {
+	for _, payment := range invoice.Payments {
+		if payment.Payment_id != paymentId {
+			continue
+		}
+		if payment.Method != helper.CASH {
+			return nil, nil
+		}
+		if drawerId == nil {
+			return nil, errDrawerRequired
+		}
+		session, err := findDrawerSession(ctx, *drawerId)
+		if err != nil {
+			return nil, err
+		}
+		if session.Status != helper.DrawerOpen {
+			return nil, helper.ErrDrawerClosed
+		}
+		return &session.Drawer_session_id, nil
+	}
+	return nil, errPaymentNotFound
+}
+
+// refundCounterKey is the counter of the cents refunded on a payment.
+func refundCounterKey(paymentId string) string {
+	return "refund:" + paymentId
+}
+
+// reserveRefund takes an amount off what is left to refund on a payment in
+// one conditional update, so two refunds at once cannot both fit. The
+// counter starts at what the payment's credit notes already gave back. An
+// amount of zero reserves all that is left.
+func reserveRefund(ctx context.Context, payment models.Payment, amount money.Money) (money.Money, error) {
+	key := refundCounterKey(payment.Payment_id)
+
+	refunded, err := refundedOnPayment(ctx, payment.Payment_id)
+	if err != nil {
+		return amount, err
+	}
+	if _, err := counterCollection.UpdateOne(ctx,
+		bson.M{"_id": key},
+		bson.D{{Key: "$setOnInsert", Value: bson.D{{Key: "refunded", Value: refunded.Minor}}}},
+		options.Update().SetUpsert(true),
+	); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return amount, err
+	}
+
+	var counter struct {
+		Refunded int64 `bson:"refunded"`
+	}
+	if err := counterCollection.FindOne(ctx, bson.M{"_id": key}).Decode(&counter); err != nil {
+		return amount, err
+	}
+	if amount.IsZero() {
+		amount = payment.Amount.Sub(money.New(counter.Refunded))
+	}
+	if !amount.IsPositive() {
+		return amount, errRefundTooLarge
+	}
+
+	result, err := counterCollection.UpdateOne(ctx,
+		bson.M{"_id": key, "refunded": bson.M{"$lte": payment.Amount.Minor - amount.Minor}},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "refunded", Value: amount.Minor}}}},
+	)
+	if err != nil {
+		return amount, err
+	}
+	if result.ModifiedCount == 0 {
+		return amount, errRefundTooLarge
+	}
+	return amount, nil
+}
+
+// releaseRefund gives back a reservation whose refund was not made.
+func releaseRefund(paymentId string, amount money.Money) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := counterCollection.UpdateOne(ctx,
+		bson.M{"_id": refundCounterKey(paymentId)},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "refunded", Value: -amount.Minor}}}},
+	); err != nil {
+		log.Printf("refund of %s on payment %s failed and could not be released: %v", amount, paymentId, err)
+	}
+}
+
+// refundPayment gives money back on a payment, through the payment provider
+// for card payments. An amount of zero refunds all that is left of it. The
+// amount is reserved before the provider is asked, and released if it
+// refuses. The provider is asked under the id of the credit note the refund
+// goes on, so a retried refund is only paid once.
+func refundPayment(ctx context.Context, invoice models.Invoice, paymentId string, amount money.Money, creditNoteId string) (models.Payment, money.Money, *string, error) {
+	var payment models.Payment
+	found := false
+	for _, taken := range invoice.Payments {
+		if taken.Payment_id == paymentId {
+			payment, found = taken, true
+		}
+	}
+	if !found {
+		return payment, money.Zero(), nil, errPaymentNotFound
+	}
+
+	amount, err := reserveRefund(ctx, payment, amount)
+	if err != nil {
+		return payment, money.Zero(), nil, err
+	}
+
+	if payment.Intent_id == nil {
+		return payment, amount, nil, nil
+	}
+	refund, err := paymentProvider.Refund(ctx, *payment.Intent_id, amount.Minor, "refund-"+creditNoteId)
+	if err != nil {
+		releaseRefund(paymentId, amount)
+		return payment, money.Zero(), nil, err
+	}
+	return payment, amount, &refund.ID, nil
+}
+
+// adjustInvoice books a credit note on its invoice. The billed amounts stay as
+// they were, only what is due changes.
+func adjustInvoice(ctx context.Context, invoiceId string, credited money.Money, refunded money.Money) (models.Invoice, error) {
+	for attempt := 0; ; attempt++ {
+		invoice, err := findInvoice(ctx, invoiceId)
+		if err != nil {
+			return invoice, err
+		}
+
+		invoice.Credited = money.Ptr(money.Value(invoice.Credited).Add(credited))
+		invoice.Refunded = money.Ptr(money.Value(invoice.Refunded).Add(refunded))
+		helper.SettleStatus(&invoice)
+
+		updatedInvoice, err := saveInvoice(ctx, invoice)
+		if err != errInvoiceChanged || attempt == 2 {
+			return updatedInvoice, err
+		}
+	}
+}
+
+// newCreditNoteId takes the id of a credit note before it is saved, for the
+// refund made on it.
+func newCreditNoteId(note *models.CreditNote) {
+	note.ID = primitive.NewObjectID()
+	note.Credit_note_id = note.ID.Hex()
+}
+
+func insertCreditNote(ctx context.Context, c *gin.Context, note *models.CreditNote) error {
+	if note.Credit_note_id == "" {
+		newCreditNoteId(note)
+	}
+	note.Authorized_by = c.GetString("uid")
+	note.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	note.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	note.Version = 1
+
+	_, err := creditNoteCollection.InsertOne(ctx, note)
+	return err
+}
+
+func GetCreditNotes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{}
+		if invoiceId := c.Query("invoice_id"); invoiceId != "" {
+			filter["invoice_id"] = invoiceId
+		}
+		if kind := c.Query("kind"); kind != "" {
+			filter["kind"] = kind
+		}
+
+		page, err := helper.Paginate(ctx, creditNoteCollection, filter, params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the credit notes"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetCreditNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var note models.CreditNote
+		err := creditNoteCollection.FindOne(ctx, bson.M{"credit_note_id": c.Param("credit_note_id")}).Decode(&note)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "credit note was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the credit note"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.ETag(note.Version)) {
+			return
+		}
+		c.JSON(http.StatusOK, note)
+	}
+}
+
+// RefundPayment gives money back on a payment of an invoice and records it on
+// a credit note. Only managers can refund.
+func RefundPayment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var request RefundRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		invoice, err := findInvoice(ctx, c.Param("invoice_id"))
+		if err != nil {
+			c.JSON(creditErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		amount := money.Zero()
+		if request.Amount != nil {
+			amount = *request.Amount
+		}
+		note := models.CreditNote{
+			Invoice_id:  invoice.Invoice_id,
+			Order_id:    invoice.Order_id,
+			Currency:    invoiceCurrency(invoice),
+			Kind:        helper.CreditRefund,
+			Reason_code: *request.Reason_code,
+			Reason:      *request.Reason,
+		}
+		if note.Drawer_session_id, err = refundDrawer(ctx, invoice, *request.Payment_id, request.Drawer_session_id); err != nil {
+			c.JSON(creditErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		newCreditNoteId(&note)
+		payment, amount, reference, err := refundPayment(ctx, invoice, *request.Payment_id, amount, note.Credit_note_id)
+		if err != nil {
+			c.JSON(creditErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		note.Lines = []models.CreditNoteLine{{
+			Description: fmt.Sprintf("Refund on %s payment %s", payment.Method, payment.Payment_id),
+			Amount:      amount,
+		}}
+		note.Amount = amount
+		note.Tax_lines = helper.ProrateTaxLines(invoice.Tax_lines, amount, money.Value(invoice.Total))
+		note.Payment_id = &payment.Payment_id
+		note.Refund_method = &payment.Method
+		note.Refund_reference = reference
+		note.Refunded = amount
+		if err := insertCreditNote(ctx, c, &note); err != nil {
+			log.Printf("refund of %s on payment %s was made but its credit note failed: %v", amount, payment.Payment_id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the refund was made but its credit note could not be saved"})
+			return
+		}
+
+		if _, err := adjustInvoice(ctx, invoice.Invoice_id, amount, amount); err != nil {
+			c.JSON(creditErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(note.Version))
+		c.JSON(http.StatusCreated, note)
+	}
+}
+
+// VoidOrderItem takes an item off an order with a reason, on a manager's
+// authority. Before the order is billed the item just stops counting, after
+// that its share of the bill is credited on a credit note.
+func VoidOrderItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var request VoidItemRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		orderItemId := c.Param("order_item_id")
+
+		var orderItem models.OrderItem
+		err := OrderItemCollection.FindOne(ctx, notDeleted(bson.M{"order_item_id": orderItemId})).Decode(&orderItem)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order item was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the order item"})
+			return
+		}
+		if orderItem.Void != nil {
+			c.JSON(creditErrorStatus(errItemVoided), gin.H{"error": errItemVoided.Error()})
+			return
+		}
+
+		var invoice models.Invoice
+		err = invoiceCollection.FindOne(ctx, notDeleted(bson.M{"order_id": orderItem.Order_id})).Decode(&invoice)
+		if err != nil && err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the invoice"})
+			return
+		}
+		billed := err == nil && invoiceFrozen(invoice)
+		if request.Refund_payment_id != nil && !billed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "nothing was paid for this item yet"})
+			return
+		}
+
+		void := models.ItemVoid{
+			Reason_code: *request.Reason_code,
+			Reason:      *request.Reason,
+			Voided_by:   c.GetString("uid"),
+		}
+		void.Voided_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		setVoid := func(value interface{}) (*mongo.UpdateResult, error) {
+			filter := bson.M{"order_item_id": orderItemId}
+			if value != nil {
+				filter["void"] = nil
+			}
+			return OrderItemCollection.UpdateOne(ctx, filter, bson.D{
+				{Key: "$set", Value: bson.D{{Key: "void", Value: value}, {Key: "updated_at", Value: void.Voided_at}}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			})
+		}
+
+		var before helper.TaxBreakdown
+		if billed {
+			if before, _, err = priceOrder(ctx, orderItem.Order_id); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while pricing the order"})
+				return
+			}
+		}
+
+		result, err := setVoid(void)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order item failed to void"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(creditErrorStatus(errItemVoided), gin.H{"error": errItemVoided.Error()})
+			return
+		}
+
+		if !billed {
+			c.JSON(http.StatusOK, gin.H{"message": "order item voided", "order_item_id": orderItemId, "void": void})
+			return
+		}
+
+		// the credit is what the bill comes to less without the item
+		after, _, err := priceOrder(ctx, orderItem.Order_id)
+		if err != nil {
+			setVoid(nil)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while pricing the order"})
+			return
+		}
+		amount := before.Total.Sub(after.Total)
+
+		description := "Order item " + orderItemId
+		var food models.Food
+		if orderItem.Food_id != nil && foodCollection.FindOne(ctx, bson.M{"food_id": orderItem.Food_id}).Decode(&food) == nil && food.Name != nil {
+			description = *food.Name
+		}
+
+		note := models.CreditNote{
+			Invoice_id:  invoice.Invoice_id,
+			Order_id:    invoice.Order_id,
+			Currency:    invoiceCurrency(invoice),
+			Kind:        helper.CreditVoid,
+			Reason_code: void.Reason_code,
+			Reason:      void.Reason,
+			Lines: []models.CreditNoteLine{{
+				Order_item_id: &orderItemId,
+				Description:   description,
+				Amount:        amount,
+			}},
+			Amount:    amount,
+			Tax_lines: helper.DiffTaxLines(before.Tax_lines, after.Tax_lines),
+		}
+
+		if request.Refund_payment_id != nil && amount.IsPositive() {
+			if note.Drawer_session_id, err = refundDrawer(ctx, invoice, *request.Refund_payment_id, request.Drawer_session_id); err != nil {
+				setVoid(nil)
+				c.JSON(creditErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			newCreditNoteId(&note)
+			payment, refunded, reference, err := refundPayment(ctx, invoice, *request.Refund_payment_id, amount, note.Credit_note_id)
+			if err != nil {
+				setVoid(nil)
+				c.JSON(creditErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			note.Payment_id = &payment.Payment_id
+			note.Refund_method = &payment.Method
+			note.Refund_reference = reference
+			note.Refunded = refunded
+		}
+
+		if err := insertCreditNote(ctx, c, &note); err != nil {
+			log.Printf("order item %s was voided but its credit note failed: %v", orderItemId, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the item was voided but its credit note could not be saved"})
+			return
+		}
+
+		void.Credit_note_id = &note.Credit_note_id
+		if _, err := OrderItemCollection.UpdateOne(ctx, bson.M{"order_item_id": orderItemId}, bson.D{{Key: "$set", Value: bson.D{{Key: "void.credit_note_id", Value: note.Credit_note_id}}}}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order item failed to void"})
+			return
+		}
+
+		if _, err := adjustInvoice(ctx, invoice.Invoice_id, note.Amount, note.Refunded); err != nil {
+			c.JSON(creditErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"message": "order item voided", "order_item_id": orderItemId, "void": void, "credit_note": note})
+	}
+}
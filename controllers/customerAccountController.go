@@ -0,0 +1,432 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var customerAccountCollection *mongo.Collection = database.OpenCollection(database.Client, "customer_account")
+
+// ChargeAccountRequest charges what is due on an invoice to a house account.
+type ChargeAccountRequest struct {
+	Account_id *string `json:"account_id" validate:"required"`
+}
+
+// AccountView is an account with what it owes and how much more it may
+// charge.
+type AccountView struct {
+	models.CustomerAccount `bson:",inline"`
+	Balance                money.Money `json:"balance"`
+	Available_credit       money.Money `json:"available_credit"`
+}
+
+var (
+	errAccountNotFound = errors.New("account was not found")
+	errAccountOwes     = errors.New("accounts with a balance cannot be deleted")
+	errAccountBusy     = errors.New("another invoice is being charged to the account, try again")
+)
+
+func accountErrorStatus(err error) int {
+	switch err {
+	case errAccountNotFound, errInvoiceNotFound, helper.ErrSplitNotFound:
+		return http.StatusNotFound
+	case helper.ErrAccountSuspended, helper.ErrCreditLimit, helper.ErrAlreadyCharged, helper.ErrNothingDue,
+		helper.ErrInvoicePaid, helper.ErrInvoiceDraft, errAccountOwes, errStatementExists, errAccountBusy:
+		return http.StatusConflict
+	case helper.ErrOverpayment:
+		return http.StatusBadRequest
+	case errInvoiceChanged:
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusInternalServerError
+}
+
+func findAccount(ctx context.Context, accountId string) (models.CustomerAccount, error) {
+	var account models.CustomerAccount
+	err := customerAccountCollection.FindOne(ctx, notDeleted(bson.M{"customer_account_id": accountId})).Decode(&account)
+	if err == mongo.ErrNoDocuments {
+		return account, errAccountNotFound
+	}
+	return account, err
+}
+
+// accountInvoices are the invoices charged to an account, oldest due first.
+func accountInvoices(ctx context.Context, accountId string, filter bson.M) ([]models.Invoice, error) {
+	filter["account_id"] = accountId
+	result, err := invoiceCollection.Find(ctx, notDeleted(filter), options.Find().SetSort(bson.D{{Key: "payment_due_date", Value: 1}, {Key: "charged_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	invoices := []models.Invoice{}
+	if err = result.All(ctx, &invoices); err != nil {
+		return nil, err
+	}
+	return invoices, nil
+}
+
+// openAccountInvoices are the invoices of an account not paid yet.
+func openAccountInvoices(ctx context.Context, accountId string) ([]models.Invoice, error) {
+	return accountInvoices(ctx, accountId, bson.M{"payment_status": bson.M{"$ne": helper.InvoicePaid}})
+}
+
+func accountView(ctx context.Context, account models.CustomerAccount) (AccountView, error) {
+	invoices, err := openAccountInvoices(ctx, account.Customer_account_id)
+	if err != nil {
+		return AccountView{}, err
+	}
+	balance := helper.AccountBalance(invoices)
+	available := money.Value(account.Credit_limit).Sub(balance)
+	if available.IsNegative() {
+		available = money.Zero()
+	}
+	return AccountView{CustomerAccount: account, Balance: balance, Available_credit: available}, nil
+}
+
+func GetAccounts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := helper.Paginate(ctx, customerAccountCollection, notDeleted(bson.M{}), params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the accounts"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// GetAccount shows an account with its balance and the credit it has left.
+func GetAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		account, err := findAccount(ctx, c.Param("account_id"))
+		if err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		view, err := accountView(ctx, account)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while working out the balance"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(view)) {
+			return
+		}
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+func CreateAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var account models.CustomerAccount
+
+		if err := c.BindJSON(&account); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validatorErr := validate.Struct(account); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		account.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		account.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		account.ID = primitive.NewObjectID()
+		account.Customer_account_id = account.ID.Hex()
+		account.Deleted_at = nil
+		account.Deleted_by = nil
+		account.Version = 1
+
+		if _, insertErr := customerAccountCollection.InsertOne(ctx, account); insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the account"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(account.Version))
+		c.JSON(http.StatusCreated, account)
+	}
+}
+
+func UpdateAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		accountId := c.Param("account_id")
+		filter := notDeleted(bson.M{"customer_account_id": accountId})
+
+		account, err := findAccount(ctx, accountId)
+		if err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(account.Version)) {
+			return
+		}
+
+		var patched models.CustomerAccount
+		if err := applyMergePatch(c, account, &patched); err != nil {
+			c.JSON(patchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		patched.ID = account.ID
+		patched.Customer_account_id = account.Customer_account_id
+		patched.Created_at = account.Created_at
+		patched.Deleted_at = account.Deleted_at
+		patched.Deleted_by = account.Deleted_by
+		patched.Charging_until = account.Charging_until
+		patched.Version = account.Version + 1
+
+		if validatorErr := validate.Struct(patched); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		patched.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedAccount models.CustomerAccount
+		err = customerAccountCollection.FindOneAndReplace(
+			ctx,
+			matchVersion(filter, account.Version),
+			patched,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		).Decode(&updatedAccount)
+
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the account was modified by someone else, reload it and try again"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "account failed to update"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedAccount.Version))
+		c.JSON(http.StatusOK, updatedAccount)
+	}
+}
+
+// DeleteAccount archives an account once everything charged to it is paid.
+func DeleteAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		accountId := c.Param("account_id")
+
+		account, err := findAccount(ctx, accountId)
+		if err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(account.Version)) {
+			return
+		}
+
+		view, err := accountView(ctx, account)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "account failed to delete"})
+			return
+		}
+		if view.Balance.IsPositive() {
+			c.JSON(accountErrorStatus(errAccountOwes), gin.H{"error": errAccountOwes.Error(), "balance": view.Balance})
+			return
+		}
+
+		result, err := archiveRecord(ctx, customerAccountCollection, matchVersion(bson.M{"customer_account_id": accountId}, account.Version), c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "account failed to delete"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the account was modified by someone else, reload it and try again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "account deleted", "account_id": accountId})
+	}
+}
+
+// GetAccountInvoices lists the invoices charged to an account, only the
+// unpaid ones with ?open=true.
+func GetAccountInvoices() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		account, err := findAccount(ctx, c.Param("account_id"))
+		if err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{}
+		if c.Query("open") == "true" {
+			filter["payment_status"] = bson.M{"$ne": helper.InvoicePaid}
+		}
+		invoices, err := accountInvoices(ctx, account.Customer_account_id, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the invoices"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(invoices)) {
+			return
+		}
+		c.JSON(http.StatusOK, invoices)
+	}
+}
+
+// lockAccount holds an account for one charge at a time, for half a minute at
+// most should the charge never finish. The balance is only worked out once
+// it is held, so the credit limit cannot be overrun by charges made at once.
+func lockAccount(ctx context.Context, accountId string) (func(), error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	until := now.Add(30 * time.Second)
+	result, err := customerAccountCollection.UpdateOne(ctx,
+		notDeleted(bson.M{"customer_account_id": accountId, "charging_until": bson.M{"$not": bson.M{"$gte": now}}}),
+		bson.D{{Key: "$set", Value: bson.D{{Key: "charging_until", Value: until}}}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, errAccountBusy
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := customerAccountCollection.UpdateOne(ctx,
+			bson.M{"customer_account_id": accountId, "charging_until": until},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "charging_until", Value: nil}}}},
+		); err != nil {
+			log.Printf("account %s could not be released after a charge: %v", accountId, err)
+		}
+	}, nil
+}
+
+// ChargeInvoiceToAccount puts what is due on an invoice on a house account
+// instead of taking payment now. It is refused when the account is suspended
+// or would go over its credit limit. Only managers charge accounts.
+func ChargeInvoiceToAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var request ChargeAccountRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		invoice, err := findInvoice(ctx, c.Param("invoice_id"))
+		if err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if !checkInvoiceIfMatch(ctx, c, invoice) {
+			return
+		}
+
+		if _, err := findAccount(ctx, *request.Account_id); err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		release, err := lockAccount(ctx, *request.Account_id)
+		if err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		defer release()
+
+		account, err := findAccount(ctx, *request.Account_id)
+		if err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		open, err := openAccountInvoices(ctx, account.Customer_account_id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while working out the balance"})
+			return
+		}
+
+		if _, err := settleInvoice(ctx, &invoice); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while pricing the invoice"})
+			return
+		}
+		chargedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		if err := helper.ChargeToAccount(&invoice, account, helper.AccountBalance(open), chargedAt); err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		updatedInvoice, err := saveInvoice(ctx, invoice)
+		if err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedInvoice.Version))
+		c.JSON(http.StatusOK, updatedInvoice)
+	}
+}
@@ -0,0 +1,331 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var drawerSessionCollection *mongo.Collection = database.OpenCollection(database.Client, "drawer_session")
+
+// DrawerView is a drawer session with the cash it should hold so far.
+type DrawerView struct {
+	models.DrawerSession `bson:",inline"`
+	Summary              models.DrawerSummary `json:"summary"`
+}
+
+// DrawerCount is what the cashier counted in the drawer when closing it.
+type DrawerCount struct {
+	Counted_cash *money.Money `json:"counted_cash" validate:"required,gte=0"`
+	Note         *string      `json:"note" validate:"omitempty,max=200"`
+}
+
+func findDrawerSession(ctx context.Context, sessionId string) (models.DrawerSession, error) {
+	var session models.DrawerSession
+	err := drawerSessionCollection.FindOne(ctx, bson.M{"drawer_session_id": sessionId}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return session, errDrawerNotFound
+	}
+	return session, err
+}
+
+func daySessions(ctx context.Context, dayId string) ([]models.DrawerSession, error) {
+	result, err := drawerSessionCollection.Find(ctx, bson.M{"business_day_id": dayId}, options.Find().SetSort(bson.D{{Key: "opened_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []models.DrawerSession{}
+	if err = result.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func drawerView(ctx context.Context, session models.DrawerSession) (DrawerView, error) {
+	summary, err := summarizeDrawer(ctx, session, time.Now())
+	if err != nil {
+		return DrawerView{}, err
+	}
+	return DrawerView{DrawerSession: session, Summary: summary}, nil
+}
+
+// OpenDrawer puts a drawer into use on an open business day with its
+// opening float. A cashier opens a drawer for themselves; managers may name
+// its cashiers, who default to whoever opens it.
+func OpenDrawer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER, helper.CASHIER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		day, err := findBusinessDay(ctx, c.Param("business_day_id"))
+		if err != nil {
+			c.JSON(businessDayErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if day.Status != helper.DayOpen {
+			c.JSON(businessDayErrorStatus(helper.ErrDayClosed), gin.H{"error": helper.ErrDayClosed.Error()})
+			return
+		}
+
+		var session models.DrawerSession
+		if err := c.BindJSON(&session); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validatorErr := validate.Struct(session); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		inUse, err := drawerSessionCollection.CountDocuments(ctx, bson.M{"business_day_id": day.Business_day_id, "drawer": *session.Drawer, "status": helper.DrawerOpen})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while opening the drawer"})
+			return
+		}
+		if inUse > 0 {
+			c.JSON(businessDayErrorStatus(helper.ErrDrawerInUse), gin.H{"error": helper.ErrDrawerInUse.Error()})
+			return
+		}
+
+		session.ID = primitive.NewObjectID()
+		session.Drawer_session_id = session.ID.Hex()
+		session.Business_day_id = day.Business_day_id
+		if len(session.Cashiers) == 0 || helper.CheckUserType(c, helper.ADMIN, helper.MANAGER) != nil {
+			session.Cashiers = []string{c.GetString("uid")}
+		}
+		session.Movements = []models.DrawerMovement{}
+		session.Status = helper.DrawerOpen
+		session.Expected_cash = nil
+		session.Counted_cash = nil
+		session.Variance = nil
+		session.Count_note = nil
+		session.Opened_by = c.GetString("uid")
+		session.Opened_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		session.Closed_at = nil
+		session.Closed_by = nil
+		session.Version = 1
+
+		if _, insertErr := drawerSessionCollection.InsertOne(ctx, session); insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while opening the drawer"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(session.Version))
+		c.JSON(http.StatusCreated, session)
+	}
+}
+
+func GetDrawers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		day, err := findBusinessDay(ctx, c.Param("business_day_id"))
+		if err != nil {
+			c.JSON(businessDayErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		sessions, err := daySessions(ctx, day.Business_day_id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the drawers"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(sessions)) {
+			return
+		}
+		c.JSON(http.StatusOK, sessions)
+	}
+}
+
+func GetDrawer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		session, err := findDrawerSession(ctx, c.Param("drawer_session_id"))
+		if err != nil {
+			c.JSON(businessDayErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		view, err := drawerView(ctx, session)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while counting the drawer"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(view)) {
+			return
+		}
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+// AddDrawerMovement records a cash drop, payout or pay in on an open drawer.
+// Cashiers record them on their own drawers, payouts need a manager.
+func AddDrawerMovement() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER, helper.CASHIER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		isManager := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER) == nil
+
+		session, err := findDrawerSession(ctx, c.Param("drawer_session_id"))
+		if err != nil {
+			c.JSON(businessDayErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if session.Status != helper.DrawerOpen {
+			c.JSON(businessDayErrorStatus(helper.ErrDrawerClosed), gin.H{"error": helper.ErrDrawerClosed.Error()})
+			return
+		}
+		if !isManager && !slices.Contains(session.Cashiers, c.GetString("uid")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only the drawer's cashiers can record cash movements on it"})
+			return
+		}
+
+		var movement models.DrawerMovement
+		if err := c.BindJSON(&movement); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validatorErr := validate.Struct(movement); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		if *movement.Kind == helper.DrawerPayout && !isManager {
+			c.JSON(http.StatusForbidden, gin.H{"error": "payouts need a manager"})
+			return
+		}
+
+		movement.Movement_id = primitive.NewObjectID().Hex()
+		movement.Recorded_by = c.GetString("uid")
+		movement.Recorded_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedSession models.DrawerSession
+		err = drawerSessionCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"drawer_session_id": session.Drawer_session_id, "status": helper.DrawerOpen},
+			bson.D{
+				{Key: "$push", Value: bson.D{{Key: "movements", Value: movement}}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedSession)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(businessDayErrorStatus(helper.ErrDrawerClosed), gin.H{"error": helper.ErrDrawerClosed.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while recording the cash movement"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedSession.Version))
+		c.JSON(http.StatusCreated, updatedSession)
+	}
+}
+
+// CloseDrawer takes the counted cash of a drawer and stores it against what
+// the drawer should hold. Only managers close drawers.
+func CloseDrawer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		session, err := findDrawerSession(ctx, c.Param("drawer_session_id"))
+		if err != nil {
+			c.JSON(businessDayErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if session.Status != helper.DrawerOpen {
+			c.JSON(businessDayErrorStatus(helper.ErrDrawerClosed), gin.H{"error": helper.ErrDrawerClosed.Error()})
+			return
+		}
+		if !helper.CheckIfMatch(c, helper.ETag(session.Version)) {
+			return
+		}
+
+		var count DrawerCount
+		if err := c.BindJSON(&count); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validatorErr := validate.Struct(count); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		closedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		closedBy := c.GetString("uid")
+		session.Closed_at = &closedAt
+		session.Counted_cash = count.Counted_cash
+		summary, err := summarizeDrawer(ctx, session, closedAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while counting the drawer"})
+			return
+		}
+
+		var updatedSession models.DrawerSession
+		err = drawerSessionCollection.FindOneAndUpdate(
+			ctx,
+			matchVersion(bson.M{"drawer_session_id": session.Drawer_session_id, "status": helper.DrawerOpen}, session.Version),
+			bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "status", Value: helper.DrawerClosed},
+					{Key: "expected_cash", Value: summary.Expected_cash},
+					{Key: "counted_cash", Value: count.Counted_cash},
+					{Key: "variance", Value: summary.Variance},
+					{Key: "count_note", Value: count.Note},
+					{Key: "closed_at", Value: closedAt},
+					{Key: "closed_by", Value: closedBy},
+				}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedSession)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the drawer was modified by someone else, reload it and try again"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while closing the drawer"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedSession.Version))
+		c.JSON(http.StatusOK, DrawerView{DrawerSession: updatedSession, Summary: summary})
+	}
+}
@@ -0,0 +1,565 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	TableAvailable    = "AVAILABLE"
+	TableSeated       = "SEATED"
+	TableOrdering     = "ORDERING"
+	TableAwaitingBill = "AWAITING_BILL"
+	TableDirty        = "DIRTY"
+	TableReserved     = "RESERVED"
+
+	// only orders from the last day are considered when deriving table status
+	floorOrderWindow = 24 * time.Hour
+)
+
+var sectionCollection *mongo.Collection = database.OpenCollection(database.Client, "section")
+
+type FloorTable struct {
+	Table_id       string     `json:"table_id"`
+	Table_number   *int       `json:"table_number"`
+	Seats          *int       `json:"seats"`
+	Section_id     *string    `json:"section_id"`
+	Pos_x          *float64   `json:"pos_x"`
+	Pos_y          *float64   `json:"pos_y"`
+	Shape          *string    `json:"shape"`
+	Combined_with  *string    `json:"combined_with"`
+	Status         string     `json:"status"`
+	Order_id       *string    `json:"order_id"`
+	Reservation_id *string    `json:"reservation_id"`
+	Since          *time.Time `json:"since"`
+}
+
+type FloorSection struct {
+	Section_id  string       `json:"section_id"`
+	Name        *string      `json:"name"`
+	Description *string      `json:"description"`
+	Tables      []FloorTable `json:"tables"`
+}
+
+// tableActivity is what the floor needs to know about recent orders of a table.
+type tableActivity struct {
+	openOrder     *models.Order
+	openItemCount int
+	openInvoice   bool
+	lastClosedAt  *time.Time
+	reservation   *models.Reservation
+}
+
+// reservationHold is how long before a booking its table shows as reserved,
+// configured with RESERVATION_HOLD_MINUTES.
+func reservationHold() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("RESERVATION_HOLD_MINUTES")); err == nil && minutes >= 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return 60 * time.Minute
+}
+
+// deriveTableStatus turns the recent activity of a table into its live status.
+// Occupied states win over a dirty table, which wins over a reservation.
+func deriveTableStatus(table models.Table, activity tableActivity) FloorTable {
+	floorTable := FloorTable{
+		Table_id:      table.Table_id,
+		Table_number:  table.Table_number,
+		Seats:         table.Number_of_guests,
+		Section_id:    table.Section_id,
+		Pos_x:         table.Pos_x,
+		Pos_y:         table.Pos_y,
+		Shape:         table.Shape,
+		Combined_with: table.Combined_with,
+		Status:        TableAvailable,
+	}
+
+	switch {
+	case activity.openOrder != nil:
+		floorTable.Order_id = &activity.openOrder.Order_id
+		floorTable.Since = &activity.openOrder.Created_at
+		switch {
+		case activity.openInvoice:
+			floorTable.Status = TableAwaitingBill
+		case activity.openItemCount > 0:
+			floorTable.Status = TableOrdering
+		default:
+			floorTable.Status = TableSeated
+		}
+	case activity.lastClosedAt != nil && (table.Cleaned_at == nil || table.Cleaned_at.Before(*activity.lastClosedAt)):
+		floorTable.Status = TableDirty
+		floorTable.Since = activity.lastClosedAt
+	case activity.reservation != nil:
+		floorTable.Status = TableReserved
+		floorTable.Reservation_id = &activity.reservation.Reservation_id
+		floorTable.Since = activity.reservation.Start_time
+	}
+
+	return floorTable
+}
+
+// tableActivities loads recent orders, invoices and upcoming reservations for
+// the given tables in two queries.
+func tableActivities(ctx context.Context, tableIds []string) (map[string]*tableActivity, error) {
+	now := time.Now()
+	activities := map[string]*tableActivity{}
+	for _, tableId := range tableIds {
+		activities[tableId] = &tableActivity{}
+	}
+
+	matchStage := bson.D{{Key: "$match", Value: bson.D{
+		{Key: "table_id", Value: bson.D{{Key: "$in", Value: tableIds}}},
+		{Key: "deleted_at", Value: nil},
+		{Key: "created_at", Value: bson.D{{Key: "$gte", Value: now.Add(-floorOrderWindow)}}},
+	}}}
+	lookupInvoiceStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "invoice"},
+		{Key: "let", Value: bson.D{{Key: "order_id", Value: "$order_id"}}},
+		{Key: "pipeline", Value: bson.A{
+			bson.D{{Key: "$match", Value: bson.D{
+				{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$order_id", "$$order_id"}}}},
+				{Key: "deleted_at", Value: nil},
+			}}},
+		}},
+		{Key: "as", Value: "invoice"},
+	}}}
+	lookupItemsStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "orderItem"},
+		{Key: "let", Value: bson.D{{Key: "order_id", Value: "$order_id"}}},
+		{Key: "pipeline", Value: bson.A{
+			bson.D{{Key: "$match", Value: bson.D{
+				{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$order_id", "$$order_id"}}}},
+				{Key: "deleted_at", Value: nil},
+			}}},
+			bson.D{{Key: "$count", Value: "count"}},
+		}},
+		{Key: "as", Value: "item_count"},
+	}}}
+	sortStage := bson.D{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}}}}
+
+	result, err := orderCollection.Aggregate(ctx, mongo.Pipeline{matchStage, lookupInvoiceStage, lookupItemsStage, sortStage})
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []struct {
+		models.Order `bson:",inline"`
+		Invoice      []models.Invoice `bson:"invoice"`
+		Item_count   []struct {
+			Count int `bson:"count"`
+		} `bson:"item_count"`
+	}
+	if err = result.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		order := orders[i]
+		if order.Table_id == nil {
+			continue
+		}
+		activity := activities[*order.Table_id]
+
+		var paidAt *time.Time
+		for _, invoice := range order.Invoice {
+			if invoice.Payment_status != nil && *invoice.Payment_status == "PAID" {
+				updatedAt := invoice.Updated_at
+				paidAt = &updatedAt
+			}
+		}
+
+		if paidAt != nil {
+			if activity.lastClosedAt == nil || activity.lastClosedAt.Before(*paidAt) {
+				activity.lastClosedAt = paidAt
+			}
+			continue
+		}
+
+		// the most recent open order decides the status
+		activity.openOrder = &orders[i].Order
+		activity.openInvoice = len(order.Invoice) > 0
+		activity.openItemCount = 0
+		if len(order.Item_count) > 0 {
+			activity.openItemCount = order.Item_count[0].Count
+		}
+	}
+
+	reservationResult, err := reservationCollection.Find(ctx, notDeleted(bson.M{
+		"table_id":   bson.M{"$in": tableIds},
+		"status":     bson.M{"$in": activeReservationStatuses},
+		"start_time": bson.M{"$lte": now.Add(reservationHold())},
+		"end_time":   bson.M{"$gt": now},
+	}), options.Find().SetSort(bson.D{{Key: "start_time", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var reservations []models.Reservation
+	if err = reservationResult.All(ctx, &reservations); err != nil {
+		return nil, err
+	}
+
+	for i := range reservations {
+		activity := activities[*reservations[i].Table_id]
+		if activity.reservation == nil {
+			activity.reservation = &reservations[i]
+		}
+	}
+
+	return activities, nil
+}
+
+// floorTables returns the live status of every table matching filter.
+func floorTables(ctx context.Context, filter bson.M) ([]FloorTable, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "table_number", Value: 1}})
+
+	result, err := tableCollection.Find(ctx, notDeleted(filter), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []models.Table
+	if err = result.All(ctx, &tables); err != nil {
+		return nil, err
+	}
+
+	tableIds := []string{}
+	for _, table := range tables {
+		tableIds = append(tableIds, table.Table_id)
+	}
+
+	activities, err := tableActivities(ctx, tableIds)
+	if err != nil {
+		return nil, err
+	}
+
+	floor := []FloorTable{}
+	byId := map[string]FloorTable{}
+	for _, table := range tables {
+		floorTable := deriveTableStatus(table, *activities[table.Table_id])
+		floor = append(floor, floorTable)
+		byId[table.Table_id] = floorTable
+	}
+
+	// combined tables serve the party of the table they were pushed against
+	for i, floorTable := range floor {
+		if floorTable.Combined_with == nil {
+			continue
+		}
+		if primary, ok := byId[*floorTable.Combined_with]; ok {
+			floor[i].Status = primary.Status
+			floor[i].Order_id = primary.Order_id
+			floor[i].Since = primary.Since
+		}
+	}
+	return floor, nil
+}
+
+func GetFloor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		opts := options.Find().SetSort(bson.D{{Key: "sort_order", Value: 1}, {Key: "name", Value: 1}})
+		result, err := sectionCollection.Find(ctx, notDeleted(bson.M{}), opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the floor"})
+			return
+		}
+
+		var sections []models.Section
+		if err = result.All(ctx, &sections); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the floor"})
+			return
+		}
+
+		tables, err := floorTables(ctx, bson.M{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while loading the floor"})
+			return
+		}
+
+		floorSections := []FloorSection{}
+		bySection := map[string]int{}
+		for _, section := range sections {
+			bySection[section.Section_id] = len(floorSections)
+			floorSections = append(floorSections, FloorSection{
+				Section_id:  section.Section_id,
+				Name:        section.Name,
+				Description: section.Description,
+				Tables:      []FloorTable{},
+			})
+		}
+
+		unassigned := []FloorTable{}
+		for _, table := range tables {
+			if table.Section_id != nil {
+				if i, ok := bySection[*table.Section_id]; ok {
+					floorSections[i].Tables = append(floorSections[i].Tables, table)
+					continue
+				}
+			}
+			unassigned = append(unassigned, table)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"sections":     floorSections,
+			"unassigned":   unassigned,
+			"generated_at": time.Now(),
+		})
+	}
+}
+
+func GetTableStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		tables, err := floorTables(ctx, bson.M{"table_id": c.Param("table_id")})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the table status"})
+			return
+		}
+		if len(tables) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "table was not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, tables[0])
+	}
+}
+
+// MarkTableClean tells the floor a dirty table was bussed and can be seated.
+func MarkTableClean() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		tableId := c.Param("table_id")
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var table models.Table
+		err := tableCollection.FindOneAndUpdate(
+			ctx,
+			notDeleted(bson.M{"table_id": tableId}),
+			bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "cleaned_at", Value: now},
+					{Key: "updated_at", Value: now},
+				}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&table)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "table was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "table item failed to update"})
+			return
+		}
+
+		notifyWaitlistForTable(ctx, table)
+
+		c.Header("ETag", helper.ETag(table.Version))
+		c.JSON(http.StatusOK, table)
+	}
+}
+
+func GetSections() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := helper.Paginate(ctx, sectionCollection, notDeleted(bson.M{}), params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the sections"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func CreateSection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var section models.Section
+
+		if err := c.BindJSON(&section); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validatorErr := validate.Struct(section); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		section.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		section.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		section.ID = primitive.NewObjectID()
+		section.Section_id = section.ID.Hex()
+		section.Deleted_at = nil
+		section.Deleted_by = nil
+		section.Version = 1
+
+		if _, insertErr := sectionCollection.InsertOne(ctx, section); insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the section"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(section.Version))
+		c.JSON(http.StatusCreated, section)
+	}
+}
+
+func UpdateSection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		sectionId := c.Param("section_id")
+		filter := notDeleted(bson.M{"section_id": sectionId})
+
+		var section models.Section
+		err := sectionCollection.FindOne(ctx, filter).Decode(&section)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "section was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the section"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(section.Version)) {
+			return
+		}
+
+		var patched models.Section
+		if err := applyMergePatch(c, section, &patched); err != nil {
+			c.JSON(patchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		patched.ID = section.ID
+		patched.Section_id = section.Section_id
+		patched.Created_at = section.Created_at
+		patched.Deleted_at = section.Deleted_at
+		patched.Deleted_by = section.Deleted_by
+		patched.Version = section.Version + 1
+
+		if validatorErr := validate.Struct(patched); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		patched.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedSection models.Section
+		err = sectionCollection.FindOneAndReplace(
+			ctx,
+			matchVersion(filter, section.Version),
+			patched,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		).Decode(&updatedSection)
+
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the section was modified by someone else, reload it and try again"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "section failed to update"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedSection.Version))
+		c.JSON(http.StatusOK, updatedSection)
+	}
+}
+
+func DeleteSection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		sectionId := c.Param("section_id")
+
+		var section models.Section
+		err := sectionCollection.FindOne(ctx, notDeleted(bson.M{"section_id": sectionId})).Decode(&section)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "section was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "section failed to delete"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(section.Version)) {
+			return
+		}
+
+		tableCount, err := tableCollection.CountDocuments(ctx, notDeleted(bson.M{"section_id": sectionId}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "section failed to delete"})
+			return
+		}
+		if tableCount > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "section still has tables, move them first", "table_count": tableCount})
+			return
+		}
+
+		result, err := archiveRecord(ctx, sectionCollection, matchVersion(bson.M{"section_id": sectionId}, section.Version), c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "section failed to delete"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the section was modified by someone else, reload it and try again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "section deleted", "section_id": sectionId})
+	}
+}
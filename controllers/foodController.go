@@ -4,11 +4,11 @@ import (
 	"context"
 	"fmt"
 	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
 	"golang-restaurant-backend-app/models"
-	"log"
-	"math"
+	"golang-restaurant-backend-app/money"
 	"net/http"
-	"strconv"
+	"reflect"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -20,76 +20,62 @@ import (
 )
 
 var foodCollection *mongo.Collection = database.OpenCollection(database.Client, "food")
-var validate = validator.New()
+var validate = newValidator()
+
+// newValidator checks amounts of money on their cents, so tags such as gt=0
+// work on them as they do on numbers.
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+		return field.Interface().(money.Money).Minor
+	}, money.Money{})
+	return v
+}
 
 func GetFoods() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		// Pagination parameters
-		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
-		if err != nil || recordPerPage < 1 {
-			recordPerPage = 10
-		}
-
-		page, err := strconv.Atoi(c.Query("page"))
-		if err != nil || page < 1 {
-			page = 1
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
-		startIndex := (page - 1) * recordPerPage
-
-		// MongoDB aggregation pipeline stages
-		matchStage := bson.D{{Key: "$match", Value: bson.D{}}}
-		groupStage := bson.D{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: nil},
-			{Key: "total_count", Value: bson.D{{Key: "$sum", Value: 1}}},
-			{Key: "data", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}},
-		}}}
-		projectStage := bson.D{{Key: "$project", Value: bson.D{
-			{Key: "_id", Value: 0},
-			{Key: "total_count", Value: 1},
-			{Key: "food_items", Value: bson.D{
-				{Key: "$slice", Value: []interface{}{"$data", startIndex, recordPerPage}},
-			}},
-		}}}
-
-		// Perform aggregation
-		result, err := foodCollection.Aggregate(ctx, mongo.Pipeline{
-			matchStage, groupStage, projectStage,
-		})
-
+		page, err := helper.Paginate(ctx, foodCollection, notDeleted(bson.M{}), params, nil)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching foods"})
-			return // Exit early if aggregation fails
-		}
-
-		var allFoods []bson.M
-		if err = result.All(ctx, &allFoods); err != nil {
-			log.Fatal(err)
+			return
 		}
 
-		// Return response
-		if len(allFoods) > 0 {
-			c.JSON(http.StatusOK, allFoods[0])
-		} else {
-			c.JSON(http.StatusOK, gin.H{"message": "No foods found"})
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
 		}
+		c.JSON(http.StatusOK, page)
 	}
 }
 
 func GetFood() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 		foodId := c.Param("food_id")
 
 		var food models.Food
 
-		err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food)
-		defer cancel()
+		err := foodCollection.FindOne(ctx, notDeleted(bson.M{"food_id": foodId})).Decode(&food)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the food "})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.ETag(food.Version)) {
+			return
 		}
 		c.JSON(http.StatusOK, food)
 	}
@@ -98,6 +84,7 @@ func CreateFood() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
 		var menu models.Menu
 		var food models.Food
@@ -114,8 +101,7 @@ func CreateFood() gin.HandlerFunc {
 			return
 		}
 
-		err := menuCollection.FindOne(ctx, bson.M{"menu_id": food.Menu_id}).Decode(&menu)
-		defer cancel()
+		err := menuCollection.FindOne(ctx, notDeleted(bson.M{"menu_id": food.Menu_id})).Decode(&menu)
 		if err != nil {
 			msg := fmt.Sprintf("menu was not found")
 			c.JSON(http.StatusNotFound, gin.H{"error": msg})
@@ -130,8 +116,9 @@ func CreateFood() gin.HandlerFunc {
 		food.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		food.ID = primitive.NewObjectID()
 		food.Food_id = food.ID.Hex()
-		var num = toFixed(*food.Price, 2)
-		food.Price = &num
+		food.Deleted_at = nil
+		food.Deleted_by = nil
+		food.Version = 1
 
 		result, insertErr := foodCollection.InsertOne(ctx, food)
 
@@ -140,77 +127,165 @@ func CreateFood() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
-		defer cancel()
 		c.JSON(http.StatusOK, result)
 	}
 }
 
-func round(num float64) int {
-	return int(num + math.Copysign(0.5, num))
-}
-
-func toFixed(num float64, precision int) float64 {
-	output := math.Pow(10, float64(precision))
-	return float64(round(num*output)) / output
-}
-
 func UpdateFood() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 		foodId := c.Param("food_id")
-		filter := bson.M{"food_id": foodId}
+		filter := notDeleted(bson.M{"food_id": foodId})
 
 		var menu models.Menu
 		var food models.Food
-		var updateObj primitive.D
 
-		if err := c.BindJSON(&menu); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		err := foodCollection.FindOne(ctx, filter).Decode(&food)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
 			return
 		}
-		if food.Name != nil {
-			updateObj = append(updateObj, bson.E{Key: "name", Value: food.Name})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the food"})
+			return
 		}
-		if food.Price != nil {
-			updateObj = append(updateObj, bson.E{Key: "price", Value: food.Price})
+
+		if !helper.CheckIfMatch(c, helper.ETag(food.Version)) {
+			return
 		}
-		if food.Food_image != nil {
-			updateObj = append(updateObj, bson.E{Key: "food_image", Value: food.Food_image})
+
+		var patched models.Food
+		if err := applyMergePatch(c, food, &patched); err != nil {
+			c.JSON(patchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		// fields owned by the server cannot be patched
+		patched.ID = food.ID
+		patched.Food_id = food.Food_id
+		patched.Created_at = food.Created_at
+		patched.Deleted_at = food.Deleted_at
+		patched.Deleted_by = food.Deleted_by
+		patched.Version = food.Version + 1
+
+		if validatorErr := validate.Struct(patched); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
 		}
-		if food.Menu_id != nil {
-			err := menuCollection.FindOne(ctx, bson.M{"menu_id": food.Menu_id}).Decode(&menu)
-			defer cancel()
+
+		if food.Menu_id == nil || *patched.Menu_id != *food.Menu_id {
+			err := menuCollection.FindOne(ctx, notDeleted(bson.M{"menu_id": patched.Menu_id})).Decode(&menu)
 			if err != nil {
 				msg := fmt.Sprint("message: Menu was not found")
 				c.JSON(http.StatusNotFound, gin.H{"error": msg})
 				return
 			}
-			updateObj = append(updateObj, bson.E{Key: "menu_id", Value: food.Menu_id})
 		}
 
-		food.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		patched.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 
-		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: food.Updated_at})
+		var updatedFood models.Food
+		err = foodCollection.FindOneAndReplace(
+			ctx,
+			matchVersion(filter, food.Version),
+			patched,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		).Decode(&updatedFood)
 
-		upsert := true
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the food was modified by someone else, reload it and try again"})
+			return
+		}
+		if err != nil {
+			msg := fmt.Sprint("food item failed to update")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+		c.Header("ETag", helper.ETag(updatedFood.Version))
+		c.JSON(http.StatusOK, updatedFood)
+	}
+}
 
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
+func DeleteFood() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
 		}
 
-		result, err := foodCollection.UpdateOne(
-			ctx,
-			filter,
-			bson.D{
-				{Key: "$set", Value: updateObj},
-			},
-			&opt,
-		)
+		foodId := c.Param("food_id")
 
+		var food models.Food
+		err := foodCollection.FindOne(ctx, notDeleted(bson.M{"food_id": foodId})).Decode(&food)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
 		if err != nil {
-			msg := fmt.Sprint("food item failed to update")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "food item failed to delete"})
+			return
 		}
-		c.JSON(http.StatusOK, result)
+
+		if !helper.CheckIfMatch(c, helper.ETag(food.Version)) {
+			return
+		}
+
+		result, err := archiveRecord(ctx, foodCollection, matchVersion(bson.M{"food_id": foodId}, food.Version), c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "food item failed to delete"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the food was modified by someone else, reload it and try again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "food deleted", "food_id": foodId})
+	}
+}
+
+func RestoreFood() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		foodId := c.Param("food_id")
+
+		var food models.Food
+		if err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+			return
+		}
+
+		menuCount, err := menuCollection.CountDocuments(ctx, notDeleted(bson.M{"menu_id": food.Menu_id}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "food item failed to restore"})
+			return
+		}
+		if menuCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "the menu of this food is archived, restore it first"})
+			return
+		}
+
+		result, err := restoreRecord(ctx, foodCollection, bson.M{"food_id": foodId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "food item failed to restore"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no archived food with this id"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "food restored", "food_id": foodId})
 	}
 }
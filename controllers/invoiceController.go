@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
 	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,78 +21,368 @@ import (
 
 type InvoiceViewFormat struct {
 	Invoice_id       string      `json:"invoice_id"`
+	Invoice_number   *string     `json:"invoice_number"`
+	Issued_at        *time.Time  `json:"issued_at"`
 	Payment_method   string      `json:"payment_method"`
 	Order_id         string      `json:"order_id"`
 	Payment_status   *string     `json:"payment_status"`
+	Currency         string      `json:"currency"`
 	Payment_due      interface{} `json:"payment_due"`
+	Discount_total   interface{} `json:"discount_total"`
+	Discount_lines   interface{} `json:"discount_lines"`
+	Subtotal         interface{} `json:"subtotal"`
+	Tax_total        interface{} `json:"tax_total"`
+	Tax_lines        interface{} `json:"tax_lines"`
+	Service_total    interface{} `json:"service_total"`
+	Service_lines    interface{} `json:"service_lines"`
+	Tip              interface{} `json:"tip"`
+	Amount_paid      interface{} `json:"amount_paid"`
+	Outstanding      interface{} `json:"outstanding"`
+	Payments         interface{} `json:"payments"`
+	Splits           interface{} `json:"splits"`
+	Credited         interface{} `json:"credited"`
+	Refunded         interface{} `json:"refunded"`
 	Table_number     interface{} `json:"table_number"`
 	Payment_due_date time.Time   `json:"payment_due_date"`
+	Overdue_at       *time.Time  `json:"overdue_at"`
+	Account_id       *string     `json:"account_id"`
+	Late_fee_total   interface{} `json:"late_fee_total"`
+	Late_fees        interface{} `json:"late_fees"`
 	Order_details    interface{} `json:"order_details"`
+	Version          int64       `json:"version"`
 }
 
 var invoiceCollection *mongo.Collection = database.OpenCollection(database.Client, "invoice")
+var counterCollection *mongo.Collection = database.OpenCollection(database.Client, "counter")
+var invoiceNumberIndex sync.Once
+
+func ensureInvoiceNumberIndex(ctx context.Context) {
+	_, err := invoiceCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "invoice_number", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.D{{Key: "invoice_number", Value: bson.D{{Key: "$type", Value: "string"}}}}),
+	})
+	if err != nil {
+		log.Printf("failed to create the invoice number index: %v", err)
+	}
+}
+
+// nextInvoiceNumber takes the next number of the branch for the year. The
+// counter is only ever moved by one atomic update, so two tills never get
+// the same number.
+func nextInvoiceNumber(ctx context.Context, branch string, year int) (string, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := counterCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": invoiceCounterKey(branch, year)},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "seq", Value: 1}}}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return "", err
+	}
+	return helper.FormatInvoiceNumber(helper.InvoiceNumberFormat(), branch, year, counter.Seq, helper.InvoiceNumberDigits()), nil
+}
+
+// numberInvoice issues an invoice under the next number of the branch.
+func numberInvoice(ctx context.Context, invoice *models.Invoice) error {
+	invoiceNumberIndex.Do(func() { ensureInvoiceNumberIndex(ctx) })
+	branch := helper.BranchCode()
+	issuedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	number, err := nextInvoiceNumber(ctx, branch, issuedAt.Year())
+	if err != nil {
+		return err
+	}
+	invoice.Invoice_number = &number
+	invoice.Branch = &branch
+	invoice.Issued_at = &issuedAt
+	invoice.Draft = false
+	return nil
+}
+
+// voidInvoiceNumber accounts for a number whose invoice could not be saved.
+// Numbers are never handed back, as the invoice may have been saved after
+// all, so the number is recorded on an archived VOID invoice instead and
+// the numbering has no gaps. A number already in use needs nothing.
+func voidInvoiceNumber(invoice models.Invoice) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	status := helper.InvoiceVoid
+	void := models.Invoice{
+		ID:             primitive.NewObjectID(),
+		Invoice_number: invoice.Invoice_number,
+		Branch:         invoice.Branch,
+		Issued_at:      invoice.Issued_at,
+		Order_id:       invoice.Order_id,
+		Payment_status: &status,
+		Currency:       invoice.Currency,
+		Total:          money.Ptr(money.Zero()),
+		Amount_paid:    money.Ptr(money.Zero()),
+		Outstanding:    money.Ptr(money.Zero()),
+		Payments:       []models.Payment{},
+		Splits:         []models.BillSplit{},
+		Created_at:     now,
+		Updated_at:     now,
+		Deleted_at:     &now,
+		Version:        1,
+	}
+	void.Invoice_id = void.ID.Hex()
+
+	_, err := invoiceCollection.InsertOne(ctx, void)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		log.Printf("invoice number %s was taken but not used and could not be voided: %v", *invoice.Invoice_number, err)
+	}
+}
+
+func invoiceCounterKey(branch string, year int) string {
+	return fmt.Sprintf("invoice:%s:%d", branch, year)
+}
+
+// setInvoiceTotals stores the priced order on the invoice so the amounts stay
+// as they were billed once the invoice is paid. The total includes the tip.
+func setInvoiceTotals(invoice *models.Invoice, breakdown helper.TaxBreakdown) {
+	total := breakdown.Total.Add(money.Value(invoice.Tip))
+
+	invoice.Discount_total = &breakdown.Discount_total
+	invoice.Discount_lines = breakdown.Discount_lines
+	invoice.Subtotal = &breakdown.Subtotal
+	invoice.Service_total = &breakdown.Service_total
+	invoice.Service_lines = breakdown.Service_lines
+	invoice.Tax_total = &breakdown.Tax_total
+	invoice.Total = &total
+	invoice.Tax_lines = breakdown.Tax_lines
+
+	if invoice.Amount_paid == nil {
+		invoice.Amount_paid = money.Ptr(money.Zero())
+	}
+	outstanding := helper.InvoiceDue(*invoice)
+	invoice.Outstanding = &outstanding
+}
+
+// invoiceCurrency is the currency an invoice was billed in, the restaurant's
+// currency for invoices from before it was recorded.
+func invoiceCurrency(invoice models.Invoice) string {
+	if invoice.Currency != "" {
+		return invoice.Currency
+	}
+	return money.DefaultCurrency()
+}
+
+// invoiceFrozen reports whether the amounts of an invoice are settled. Issued
+// invoices never change; invoices from before numbering follow the order
+// until they are split or the first payment is taken.
+func invoiceFrozen(invoice models.Invoice) bool {
+	return invoice.Total != nil && (invoice.Invoice_number != nil || len(invoice.Splits) > 0 ||
+		(invoice.Payment_status != nil && *invoice.Payment_status != helper.InvoicePending))
+}
+
+// invoiceETag tags what GET returns. Invoices still priced from their order
+// change whenever the order does, so they are tagged by the view itself.
+func invoiceETag(invoice models.Invoice, view InvoiceViewFormat) string {
+	if invoiceFrozen(invoice) {
+		return helper.ETag(invoice.Version)
+	}
+	return helper.BodyETag(view)
+}
+
+// checkInvoiceIfMatch is helper.CheckIfMatch for invoices, taking the tag GET
+// gave out as well as the version.
+func checkInvoiceIfMatch(ctx context.Context, c *gin.Context, invoice models.Invoice) bool {
+	if header := c.GetHeader("If-Match"); header != "" && !invoiceFrozen(invoice) {
+		if view, err := buildInvoiceView(ctx, invoice); err == nil && helper.ETagMatches(header, invoiceETag(invoice, view)) {
+			return true
+		}
+	}
+	return helper.CheckIfMatch(c, helper.ETag(invoice.Version))
+}
+
+// storedBreakdown reads back the amounts an invoice was billed with.
+func storedBreakdown(invoice models.Invoice) helper.TaxBreakdown {
+	breakdown := helper.TaxBreakdown{
+		Discount_lines: invoice.Discount_lines,
+		Service_lines:  invoice.Service_lines,
+		Tax_lines:      invoice.Tax_lines,
+	}
+	if invoice.Discount_total != nil {
+		breakdown.Discount_total = *invoice.Discount_total
+	}
+	if invoice.Service_total != nil {
+		breakdown.Service_total = *invoice.Service_total
+	}
+	if invoice.Subtotal != nil {
+		breakdown.Subtotal = *invoice.Subtotal
+	}
+	if invoice.Tax_total != nil {
+		breakdown.Tax_total = *invoice.Tax_total
+	}
+	if invoice.Total != nil {
+		breakdown.Total = invoice.Total.Sub(money.Value(invoice.Tip))
+	}
+	return breakdown
+}
 
 func GetInvoices() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-		result, err := invoiceCollection.Find(context.TODO(), bson.M{})
-
 		defer cancel()
 
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{}
+		if c.Query("overdue") == "true" {
+			filter["overdue_at"] = bson.M{"$ne": nil}
+		}
+
+		page, err := helper.Paginate(ctx, invoiceCollection, notDeleted(filter), params, nil)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the invoice items"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
 		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// buildInvoiceView lays an invoice out with its order for the till and the
+// printed bill.
+func buildInvoiceView(ctx context.Context, invoice models.Invoice) (InvoiceViewFormat, error) {
+	var invoiceView InvoiceViewFormat
+
+	breakdown, allOrderItems, err := priceOrder(ctx, invoice.Order_id)
+	if err != nil {
+		return invoiceView, err
+	}
+
+	// settled invoices show what was billed, not what the order costs today
+	if invoiceFrozen(invoice) {
+		breakdown = storedBreakdown(invoice)
+	}
 
-		var allInvoices []bson.M
-		if err = result.All(ctx, &allInvoices); err != nil {
-			log.Fatal(err)
+	tip := money.Value(invoice.Tip)
+
+	invoiceView.Order_id = invoice.Order_id
+	invoiceView.Payment_due_date = invoice.Payment_due_date
+	invoiceView.Overdue_at = invoice.Overdue_at
+	invoiceView.Account_id = invoice.Account_id
+	invoiceView.Late_fee_total = invoice.Late_fee_total
+	invoiceView.Late_fees = invoice.Late_fees
+
+	invoiceView.Payment_method = "null"
+	if invoice.Payment_method != nil {
+		invoiceView.Payment_method = *invoice.Payment_method
+	} else {
+		invoiceView.Payment_method = "null"
+	}
+	invoiceView.Invoice_id = invoice.Invoice_id
+	invoiceView.Invoice_number = invoice.Invoice_number
+	invoiceView.Issued_at = invoice.Issued_at
+	invoiceView.Payment_status = invoice.Payment_status
+	invoiceView.Currency = invoiceCurrency(invoice)
+	if len(allOrderItems) > 0 {
+		invoiceView.Payment_due = breakdown.Total.Add(tip)
+		invoiceView.Discount_total = breakdown.Discount_total
+		invoiceView.Discount_lines = breakdown.Discount_lines
+		invoiceView.Subtotal = breakdown.Subtotal
+		invoiceView.Tax_total = breakdown.Tax_total
+		invoiceView.Tax_lines = breakdown.Tax_lines
+		invoiceView.Service_total = breakdown.Service_total
+		invoiceView.Service_lines = breakdown.Service_lines
+		invoiceView.Tip = tip
+		invoiceView.Amount_paid = invoice.Amount_paid
+		invoiceView.Outstanding = breakdown.Total.Add(tip)
+		if invoiceFrozen(invoice) {
+			invoiceView.Outstanding = helper.InvoiceDue(invoice)
 		}
-		c.JSON(http.StatusOK, allInvoices)
+		invoiceView.Credited = invoice.Credited
+		invoiceView.Refunded = invoice.Refunded
+		invoiceView.Payments = invoice.Payments
+		invoiceView.Splits = invoice.Splits
+		invoiceView.Table_number = allOrderItems[0]["table_number"]
+		invoiceView.Order_details = allOrderItems[0]["order_items"]
+	} else {
+		invoiceView.Payment_due = nil
+		invoiceView.Table_number = nil
+		invoiceView.Order_details = nil
 	}
+
+	invoiceView.Version = invoice.Version
+	return invoiceView, nil
 }
 
 func GetInvoice() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
 		invoiceId := c.Param("invoice_id")
 
 		var invoice models.Invoice
 
-		err := invoiceCollection.FindOne(ctx, bson.M{"order_id": invoiceId}).Decode(&invoice)
-
-		defer cancel()
-
+		err := invoiceCollection.FindOne(ctx, notDeleted(bson.M{"invoice_id": invoiceId})).Decode(&invoice)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the invoice items"})
 			return
 		}
 
-		var invoiceView InvoiceViewFormat
+		invoiceView, err := buildInvoiceView(ctx, invoice)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while pricing the invoice"})
+			return
+		}
 
-		allOrderItems, err := ItemsByOrder(invoice.Order_id)
-		invoiceView.Order_id = invoice.Order_id
-		invoiceView.Payment_due_date = invoice.Payment_due_date
+		if helper.CheckNotModified(c, invoiceETag(invoice, invoiceView)) {
+			return
+		}
+		c.JSON(http.StatusOK, invoiceView)
+	}
+}
 
-		invoiceView.Payment_method = "null"
-		if invoice.Payment_method != nil {
-			invoiceView.Payment_method = *invoice.Payment_method
-		} else {
-			invoiceView.Payment_method = "null"
-		}
-		invoiceView.Invoice_id = invoice.Invoice_id
-		invoiceView.Payment_status = invoice.Payment_status
-		if len(allOrderItems) > 0 {
-			invoiceView.Payment_due = allOrderItems[0]["payment_due"]
-			invoiceView.Table_number = allOrderItems[0]["table_number"]
-			invoiceView.Order_details = allOrderItems[0]["order_items"]
-		} else {
-			invoiceView.Payment_due = nil
-			invoiceView.Table_number = nil
-			invoiceView.Order_details = nil
+// GetInvoiceByNumber looks an invoice up by the number printed on it.
+func GetInvoiceByNumber() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var invoice models.Invoice
+		// voided numbers are archived but still answer for their number
+		err := invoiceCollection.FindOne(ctx, bson.M{
+			"invoice_number": c.Param("invoice_number"),
+			"$or":            bson.A{bson.M{"deleted_at": nil}, bson.M{"payment_status": helper.InvoiceVoid}},
+		}).Decode(&invoice)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the invoice"})
+			return
+		}
+
+		invoiceView, err := buildInvoiceView(ctx, invoice)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while pricing the invoice"})
+			return
 		}
 
+		if helper.CheckNotModified(c, invoiceETag(invoice, invoiceView)) {
+			return
+		}
 		c.JSON(http.StatusOK, invoiceView)
 	}
 }
@@ -104,22 +397,36 @@ func CreateInvoice() gin.HandlerFunc {
 			return
 		}
 		var order models.Order
-		err := orderCollection.FindOne(ctx, bson.M{"order_id": invoice.Order_id}).Decode(&order)
+		err := orderCollection.FindOne(ctx, notDeleted(bson.M{"order_id": invoice.Order_id})).Decode(&order)
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "order not found"})
 			return
 		}
 
-		status := "PENDING"
+		for _, discount := range order.Discounts {
+			if discount.Status == helper.DiscountPendingApproval {
+				c.JSON(http.StatusConflict, gin.H{"error": "the order has comps waiting for a manager's approval"})
+				return
+			}
+		}
+
+		status := helper.InvoicePending
 		if invoice.Payment_status == nil {
 			invoice.Payment_status = &status
 		}
-		invoice.Payment_due_date, _ = time.Parse(time.RFC3339, time.Now().AddDate(0, 0, 1).Format(time.RFC3339))
+		payNow := *invoice.Payment_status == helper.InvoicePaid
+		// catering and account customers are given longer to pay
+		if !invoice.Payment_due_date.After(time.Now()) {
+			invoice.Payment_due_date, _ = time.Parse(time.RFC3339, time.Now().AddDate(0, 0, 1).Format(time.RFC3339))
+		}
 		invoice.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		invoice.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		invoice.ID = primitive.NewObjectID()
 		invoice.Invoice_id = invoice.ID.Hex()
+		invoice.Deleted_at = nil
+		invoice.Deleted_by = nil
+		invoice.Version = 1
 
 		validationErr := validate.Struct(invoice)
 
@@ -128,9 +435,70 @@ func CreateInvoice() gin.HandlerFunc {
 			return
 		}
 
+		// an invoice created as paid is settled by one payment of the total
+		invoice.Payment_status = &status
+		invoice.Tip_server_id = nil
+		invoice.Amount_paid = nil
+		invoice.Payments = []models.Payment{}
+		invoice.Splits = []models.BillSplit{}
+		invoice.Credited = nil
+		invoice.Refunded = nil
+		invoice.Overdue_at = nil
+		invoice.Late_fee_total = nil
+		invoice.Late_fees = []models.LateFee{}
+		invoice.Reminders = []models.PaymentReminder{}
+		invoice.Account_id = nil
+		invoice.Account_charge = nil
+		invoice.Charged_at = nil
+		invoice.Currency = money.DefaultCurrency()
+
+		breakdown, _, err := priceOrder(ctx, invoice.Order_id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while pricing the invoice"})
+			return
+		}
+		setInvoiceTotals(&invoice, breakdown)
+
+		if payNow {
+			if invoice.Payment_method == nil || *invoice.Payment_method == "" || *invoice.Payment_method == helper.MIXED {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "payment_method must be CARD or CASH to pay the invoice"})
+				return
+			}
+			if err := checkManualPayment(*invoice.Payment_method); err != nil {
+				c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			payment := newPayment(c, *invoice.Payment_method)
+			if err := helper.ApplyPayment(&invoice, &payment); err != nil {
+				c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			invoice.Tip_server_id = order.Server_id
+		}
+
+		// issuing the invoice gives it its number and fixes its amounts,
+		// drafts keep following the order until they are issued
+		if invoice.Draft && payNow {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a draft invoice cannot be paid, issue it first"})
+			return
+		}
+		if !invoice.Draft {
+			if err := numberInvoice(ctx, &invoice); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while numbering the invoice"})
+				return
+			}
+		} else {
+			invoice.Invoice_number = nil
+			invoice.Branch = nil
+			invoice.Issued_at = nil
+		}
+
 		result, insertErr := invoiceCollection.InsertOne(ctx, invoice)
 
 		if insertErr != nil {
+			if invoice.Invoice_number != nil {
+				voidInvoiceNumber(invoice)
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "some error occurred while creating invoice"})
 			return
 		}
@@ -140,60 +508,294 @@ func CreateInvoice() gin.HandlerFunc {
 	}
 }
 
-func UpdateInvoice() gin.HandlerFunc {
+// IssueInvoice numbers a draft invoice, which fixes its amounts as the order
+// prices them now.
+func IssueInvoice() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
-		var invoice models.Invoice
+		invoice, err := findInvoice(ctx, c.Param("invoice_id"))
+		if err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
 
-		invoiceId := c.Param("invoice_id")
+		if !checkInvoiceIfMatch(ctx, c, invoice) {
+			return
+		}
 
-		if err := c.BindJSON(&invoice); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if invoice.Invoice_number != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "the invoice is already issued"})
 			return
 		}
 
-		filter := bson.M{"invoice_id": invoiceId}
+		var order models.Order
+		if err := orderCollection.FindOne(ctx, notDeleted(bson.M{"order_id": invoice.Order_id})).Decode(&order); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "order not found"})
+			return
+		}
+		for _, discount := range order.Discounts {
+			if discount.Status == helper.DiscountPendingApproval {
+				c.JSON(http.StatusConflict, gin.H{"error": "the order has comps waiting for a manager's approval"})
+				return
+			}
+		}
+
+		if _, err := settleInvoice(ctx, &invoice); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while pricing the invoice"})
+			return
+		}
+		if err := numberInvoice(ctx, &invoice); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while numbering the invoice"})
+			return
+		}
+
+		issued, err := saveInvoice(ctx, invoice)
+		if err != nil {
+			voidInvoiceNumber(invoice)
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(issued.Version))
+		c.JSON(http.StatusOK, issued)
+	}
+}
+
+func UpdateInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var invoice models.Invoice
+
+		invoiceId := c.Param("invoice_id")
 
-		var updateObj primitive.D
+		filter := notDeleted(bson.M{"invoice_id": invoiceId})
 
-		if invoice.Payment_method != nil {
-			updateObj = append(updateObj, bson.E{Key: "payment_method", Value: invoice.Payment_method})
+		err := invoiceCollection.FindOne(ctx, filter).Decode(&invoice)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
 		}
-		if invoice.Payment_status != nil {
-			updateObj = append(updateObj, bson.E{Key: "payment_status", Value: invoice.Payment_status})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the invoice items"})
+			return
 		}
 
-		invoice.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		if !checkInvoiceIfMatch(ctx, c, invoice) {
+			return
+		}
 
-		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: invoice.Updated_at})
+		var patched models.Invoice
+		if err := applyMergePatch(c, invoice, &patched); err != nil {
+			c.JSON(patchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		patched.ID = invoice.ID
+		patched.Invoice_id = invoice.Invoice_id
+		patched.Order_id = invoice.Order_id
+		patched.Created_at = invoice.Created_at
+		patched.Deleted_at = invoice.Deleted_at
+		patched.Deleted_by = invoice.Deleted_by
+		patched.Version = invoice.Version + 1
+		patched.Discount_total = invoice.Discount_total
+		patched.Discount_lines = invoice.Discount_lines
+		patched.Subtotal = invoice.Subtotal
+		patched.Service_total = invoice.Service_total
+		patched.Service_lines = invoice.Service_lines
+		patched.Tax_total = invoice.Tax_total
+		patched.Total = invoice.Total
+		patched.Tax_lines = invoice.Tax_lines
+		patched.Tip_server_id = invoice.Tip_server_id
+		patched.Amount_paid = invoice.Amount_paid
+		patched.Outstanding = invoice.Outstanding
+		patched.Payments = invoice.Payments
+		patched.Splits = invoice.Splits
+		patched.Credited = invoice.Credited
+		patched.Refunded = invoice.Refunded
+		patched.Overdue_at = invoice.Overdue_at
+		patched.Late_fee_total = invoice.Late_fee_total
+		patched.Late_fees = invoice.Late_fees
+		patched.Reminders = invoice.Reminders
+		patched.Account_id = invoice.Account_id
+		patched.Account_charge = invoice.Account_charge
+		patched.Charged_at = invoice.Charged_at
+		patched.Currency = invoice.Currency
+		patched.Invoice_number = invoice.Invoice_number
+		patched.Branch = invoice.Branch
+		patched.Issued_at = invoice.Issued_at
+		patched.Draft = invoice.Draft
+
+		// the status follows the payments, asking for PAID settles what is
+		// left in one payment
+		payNow := invoice.Payment_status != nil && *invoice.Payment_status != helper.InvoicePaid &&
+			patched.Payment_status != nil && *patched.Payment_status == helper.InvoicePaid
+		patched.Payment_status = invoice.Payment_status
+		if len(invoice.Payments) > 0 {
+			patched.Payment_method = invoice.Payment_method
+		}
 
-		upsert := true
+		validationErr := validate.Struct(patched)
 
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
 		}
 
-		status := "PENDING"
+		if !invoiceFrozen(invoice) {
+			breakdown, _, err := priceOrder(ctx, patched.Order_id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while pricing the invoice"})
+				return
+			}
+			setInvoiceTotals(&patched, breakdown)
+		} else {
+			patched.Tip = invoice.Tip
+		}
 
-		if invoice.Payment_status == nil {
-			invoice.Payment_status = &status
+		if payNow {
+			if patched.Payment_method == nil || *patched.Payment_method == "" || *patched.Payment_method == helper.MIXED {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "payment_method must be CARD or CASH to pay the invoice"})
+				return
+			}
+			if err := checkManualPayment(*patched.Payment_method); err != nil {
+				c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			payment := newPayment(c, *patched.Payment_method)
+			if err := helper.ApplyPayment(&patched, &payment); err != nil {
+				c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			if err := allocateTip(ctx, &patched); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while allocating the tip"})
+				return
+			}
 		}
 
-		result, err := invoiceCollection.UpdateOne(
+		patched.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedInvoice models.Invoice
+		err = invoiceCollection.FindOneAndReplace(
 			ctx,
-			filter,
-			bson.D{
-				{Key: "$set", Value: updateObj},
-			},
-			&opt,
-		)
+			matchVersion(filter, invoice.Version),
+			patched,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		).Decode(&updatedInvoice)
 
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the invoice was modified by someone else, reload it and try again"})
+			return
+		}
 		if err != nil {
 			msg := fmt.Sprint("Invoice item failed to update")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
 		}
+		c.Header("ETag", helper.ETag(updatedInvoice.Version))
+		c.JSON(http.StatusOK, updatedInvoice)
+	}
+}
+
+func DeleteInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
-		c.JSON(http.StatusOK, result)
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		invoiceId := c.Param("invoice_id")
+
+		var invoice models.Invoice
+		err := invoiceCollection.FindOne(ctx, notDeleted(bson.M{"invoice_id": invoiceId})).Decode(&invoice)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invoice item failed to delete"})
+			return
+		}
+
+		if !checkInvoiceIfMatch(ctx, c, invoice) {
+			return
+		}
+
+		if invoice.Payment_status != nil && *invoice.Payment_status == "PAID" {
+			c.JSON(http.StatusConflict, gin.H{"error": "paid invoices cannot be deleted"})
+			return
+		}
+		if len(invoice.Payments) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "invoices with payments cannot be deleted"})
+			return
+		}
+		if invoice.Invoice_number != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "issued invoices cannot be deleted, correct them with a credit note"})
+			return
+		}
+
+		result, err := archiveRecord(ctx, invoiceCollection, matchVersion(bson.M{"invoice_id": invoiceId}, invoice.Version), c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invoice item failed to delete"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the invoice was modified by someone else, reload it and try again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "invoice deleted", "invoice_id": invoiceId})
+	}
+}
+
+func RestoreInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		invoiceId := c.Param("invoice_id")
+
+		var invoice models.Invoice
+		if err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceId}).Decode(&invoice); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice was not found"})
+			return
+		}
+		if invoice.Payment_status != nil && *invoice.Payment_status == helper.InvoiceVoid {
+			c.JSON(http.StatusConflict, gin.H{"error": "a voided invoice number cannot be restored"})
+			return
+		}
+
+		orderCount, err := orderCollection.CountDocuments(ctx, notDeleted(bson.M{"order_id": invoice.Order_id}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invoice item failed to restore"})
+			return
+		}
+		if orderCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "the order of this invoice is archived, restore it first"})
+			return
+		}
+
+		result, err := restoreRecord(ctx, invoiceCollection, bson.M{"invoice_id": invoiceId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invoice item failed to restore"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no archived invoice with this id"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "invoice restored", "invoice_id": invoiceId})
 	}
 }
@@ -4,8 +4,8 @@ import (
 	"context"
 	"fmt"
 	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
 	"golang-restaurant-backend-app/models"
-	"log"
 	"net/http"
 	"time"
 
@@ -20,22 +20,25 @@ var menuCollection *mongo.Collection = database.OpenCollection(database.Client,
 
 func GetMenus() gin.HandlerFunc {
 	return func(c *gin.Context) {
-
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-
-		result, err := menuCollection.Find(context.TODO(), bson.M{})
-
 		defer cancel()
 
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := helper.Paginate(ctx, menuCollection, notDeleted(bson.M{}), params, nil)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the menu items"})
+			return
 		}
 
-		var allMenu []bson.M
-		if err = result.All(ctx, &allMenu); err != nil {
-			log.Fatal(err)
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
 		}
-		c.JSON(http.StatusOK, allMenu)
+		c.JSON(http.StatusOK, page)
 	}
 }
 
@@ -43,17 +46,24 @@ func GetMenu() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
 		menuId := c.Param("menu_id")
 
 		var menu models.Menu
 
-		err := menuCollection.FindOne(ctx, bson.M{"menu_id": menuId}).Decode(&menu)
-
-		defer cancel()
-
+		err := menuCollection.FindOne(ctx, notDeleted(bson.M{"menu_id": menuId})).Decode(&menu)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu was not found"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the menu item"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.ETag(menu.Version)) {
+			return
 		}
 		c.JSON(http.StatusOK, menu)
 	}
@@ -63,6 +73,7 @@ func CreateMenu() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var menu models.Menu
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
 		if err := c.BindJSON(&menu); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -74,12 +85,20 @@ func CreateMenu() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
 			return
 		}
+
+		if !validMenuSpan(menu) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "kindly retype the time"})
+			return
+		}
 		now := time.Now()
 
 		menu.ID = primitive.NewObjectID()
 		menu.Menu_id = menu.ID.Hex()
 		menu.Created_at = &now
 		menu.Updated_at = &now
+		menu.Deleted_at = nil
+		menu.Deleted_by = nil
+		menu.Version = 1
 
 		result, insertErr := menuCollection.InsertOne(ctx, menu)
 		if insertErr != nil {
@@ -87,75 +106,164 @@ func CreateMenu() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
-		defer cancel()
 
 		c.JSON(http.StatusOK, result)
-		defer cancel()
 	}
 }
 
-func inTimeSpan(start, end, check time.Time) bool {
-	return start.After(time.Now()) && end.Before(start)
+// validMenuSpan makes sure a menu does not end before it starts.
+func validMenuSpan(menu models.Menu) bool {
+	if menu.Start_date == nil || menu.End_date == nil {
+		return true
+	}
+	return menu.End_date.After(*menu.Start_date)
 }
 
 func UpdateMenu() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 		menuId := c.Param("menu_id")
-		filter := bson.M{"menu_id": menuId}
+		filter := notDeleted(bson.M{"menu_id": menuId})
 
 		var menu models.Menu
-		var updateObj primitive.D
 		now := time.Now()
 
-		if err := c.BindJSON(&menu); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		err := menuCollection.FindOne(ctx, filter).Decode(&menu)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the menu item"})
 			return
 		}
 
-		if menu.Start_date != nil && menu.End_date != nil {
-			if !inTimeSpan(*menu.Start_date, *menu.End_date, time.Now()) {
-				msg := "kindly retype the time"
-				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
-				defer cancel()
-				return
-			}
+		if !helper.CheckIfMatch(c, helper.ETag(menu.Version)) {
+			return
+		}
 
-			updateObj = append(updateObj, bson.E{Key: "start_date", Value: menu.Start_date})
-			updateObj = append(updateObj, bson.E{Key: "end_date", Value: menu.End_date})
+		var patched models.Menu
+		if err := applyMergePatch(c, menu, &patched); err != nil {
+			c.JSON(patchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
 
-			if menu.Name != "" {
-				updateObj = append(updateObj, bson.E{Key: "name", Value: menu.Name})
-			}
-			if menu.Category != "" {
-				updateObj = append(updateObj, bson.E{Key: "category", Value: menu.Category})
-			}
+		patched.ID = menu.ID
+		patched.Menu_id = menu.Menu_id
+		patched.Created_at = menu.Created_at
+		patched.Deleted_at = menu.Deleted_at
+		patched.Deleted_by = menu.Deleted_by
+		patched.Version = menu.Version + 1
 
-			menu.Updated_at = &now
+		if validatorErr := validate.Struct(patched); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
 
-			updateObj = append(updateObj, bson.E{Key: "updated_at", Value: menu.Updated_at})
+		if !validMenuSpan(patched) {
+			msg := "kindly retype the time"
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
 
-			upsert := true
+		patched.Updated_at = &now
 
-			opt := options.UpdateOptions{
-				Upsert: &upsert,
-			}
+		var updatedMenu models.Menu
+		err = menuCollection.FindOneAndReplace(
+			ctx,
+			matchVersion(filter, menu.Version),
+			patched,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		).Decode(&updatedMenu)
 
-			result, err := menuCollection.UpdateOne(
-				ctx,
-				filter,
-				bson.D{
-					{Key: "$set", Value: updateObj},
-				},
-				&opt,
-			)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the menu was modified by someone else, reload it and try again"})
+			return
+		}
+		if err != nil {
+			msg := "Menu update failed"
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+		c.Header("ETag", helper.ETag(updatedMenu.Version))
+		c.JSON(http.StatusOK, updatedMenu)
+	}
+}
 
-			if err != nil {
-				msg := "Menu update failed"
-				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
-			}
-			defer cancel()
-			c.JSON(http.StatusOK, result)
+func DeleteMenu() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
 		}
+
+		menuId := c.Param("menu_id")
+
+		var menu models.Menu
+		err := menuCollection.FindOne(ctx, notDeleted(bson.M{"menu_id": menuId})).Decode(&menu)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "menu was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Menu delete failed"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(menu.Version)) {
+			return
+		}
+
+		foodCount, err := foodCollection.CountDocuments(ctx, notDeleted(bson.M{"menu_id": menuId}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Menu delete failed"})
+			return
+		}
+		if foodCount > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "menu still has foods, delete or move them first", "food_count": foodCount})
+			return
+		}
+
+		result, err := archiveRecord(ctx, menuCollection, matchVersion(bson.M{"menu_id": menuId}, menu.Version), c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Menu delete failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the menu was modified by someone else, reload it and try again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "menu deleted", "menu_id": menuId})
+	}
+}
+
+func RestoreMenu() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		menuId := c.Param("menu_id")
+
+		result, err := restoreRecord(ctx, menuCollection, bson.M{"menu_id": menuId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Menu restore failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no archived menu with this id"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "menu restored", "menu_id": menuId})
 	}
 }
@@ -4,8 +4,8 @@ import (
 	"context"
 	"fmt"
 	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
 	"golang-restaurant-backend-app/models"
-	"log"
 	"net/http"
 	"time"
 
@@ -21,37 +21,53 @@ var orderCollection *mongo.Collection = database.OpenCollection(database.Client,
 func GetOrders() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
-		result, err := orderCollection.Find(context.TODO(), bson.M{})
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		defer cancel()
+		filter := notDeleted(bson.M{})
+		if serverId := c.Query("server_id"); serverId != "" {
+			filter["server_id"] = serverId
+		}
 
+		page, err := helper.Paginate(ctx, orderCollection, filter, params, nil)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the order items"})
+			return
 		}
 
-		var allOrder []bson.M
-		if err = result.All(ctx, &allOrder); err != nil {
-			log.Fatal(err)
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
 		}
-		c.JSON(http.StatusOK, allOrder)
+		c.JSON(http.StatusOK, page)
 	}
 }
 
 func GetOrder() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
 		orderId := c.Param("order_id")
 
 		var order models.Order
 
-		err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order)
-
-		defer cancel()
-
+		err := orderCollection.FindOne(ctx, notDeleted(bson.M{"order_id": orderId})).Decode(&order)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order was not found"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the order item"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.ETag(order.Version)) {
+			return
 		}
 		c.JSON(http.StatusOK, order)
 	}
@@ -63,6 +79,7 @@ func CreateOrder() gin.HandlerFunc {
 		var table models.Table
 		var order models.Order
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
 		if err := c.BindJSON(&order); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -77,8 +94,7 @@ func CreateOrder() gin.HandlerFunc {
 		}
 
 		if order.Table_id != nil {
-			err := tableCollection.FindOne(ctx, bson.M{"table_id": order.Table_id}).Decode(&table)
-			defer cancel()
+			err := tableCollection.FindOne(ctx, notDeleted(bson.M{"table_id": order.Table_id})).Decode(&table)
 
 			if err != nil {
 				msg := fmt.Sprintf("message:Table was not found")
@@ -92,6 +108,14 @@ func CreateOrder() gin.HandlerFunc {
 
 		order.ID = primitive.NewObjectID()
 		order.Order_id = order.ID.Hex()
+		order.Deleted_at = nil
+		order.Deleted_by = nil
+		order.Merged_into = nil
+		uid := c.GetString("uid")
+		order.Server_id = &uid
+		order.Discounts = []models.OrderDiscount{}
+		order.History = []models.OrderEvent{}
+		order.Version = 1
 
 		result, insertErr := orderCollection.InsertOne(ctx, order)
 
@@ -100,7 +124,6 @@ func CreateOrder() gin.HandlerFunc {
 			return
 		}
 
-		defer cancel()
 		c.JSON(http.StatusCreated, result)
 	}
 }
@@ -108,56 +131,84 @@ func CreateOrder() gin.HandlerFunc {
 func UpdateOrder() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
-		var table models.Table
 		var order models.Order
 
-		var updateObj primitive.D
-
 		orderID := c.Param("order_id")
 
-		filter := bson.M{"order_id": orderID}
+		filter := notDeleted(bson.M{"order_id": orderID})
 
-		if err := c.BindJSON(&order); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		err := orderCollection.FindOne(ctx, filter).Decode(&order)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the order item"})
 			return
 		}
 
-		if order.Table_id != nil {
-			err := orderCollection.FindOne(ctx, bson.M{"table_id": table.Table_id}).Decode(&table)
-			defer cancel()
-			if err != nil {
-				msg := fmt.Sprint("message: Table was not found")
-				c.JSON(http.StatusNotFound, gin.H{"error": msg})
-				return
-			}
-			updateObj = append(updateObj, bson.E{Key: "table_id", Value: table.Table_id})
+		if !helper.CheckIfMatch(c, helper.ETag(order.Version)) {
+			return
 		}
 
-		order.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		var patched models.Order
+		if err := applyMergePatch(c, order, &patched); err != nil {
+			c.JSON(patchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
 
-		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: order.Updated_at})
+		patched.ID = order.ID
+		patched.Order_id = order.Order_id
+		patched.Created_at = order.Created_at
+		patched.Deleted_at = order.Deleted_at
+		patched.Deleted_by = order.Deleted_by
+		patched.Version = order.Version + 1
+		patched.Merged_into = order.Merged_into
+		patched.Server_id = order.Server_id
+		patched.Discounts = append([]models.OrderDiscount{}, order.Discounts...)
+		patched.History = append([]models.OrderEvent{}, order.History...)
+
+		if validatorErr := validate.Struct(patched); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
 
-		upsert := true
+		if order.Table_id == nil || *patched.Table_id != *order.Table_id {
+			table, err := checkTransferTarget(ctx, *patched.Table_id)
+			if err != nil {
+				c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+				return
+			}
 
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
+			event := newOrderEvent(c, OrderTransferred)
+			event.From_table_id = order.Table_id
+			event.To_table_id = &table.Table_id
+			patched.History = append(patched.History, event)
 		}
 
-		result, err := orderCollection.UpdateOne(
+		patched.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedOrder models.Order
+		err = orderCollection.FindOneAndReplace(
 			ctx,
-			filter,
-			bson.D{
-				{Key: "$set", Value: updateObj},
-			},
-			&opt,
-		)
+			matchVersion(filter, order.Version),
+			patched,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		).Decode(&updatedOrder)
 
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the order was modified by someone else, reload it and try again"})
+			return
+		}
 		if err != nil {
 			msg := fmt.Sprint("order item failed to update")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
 		}
-		c.JSON(http.StatusOK, result)
+		c.Header("ETag", helper.ETag(updatedOrder.Version))
+		c.JSON(http.StatusOK, updatedOrder)
 	}
 }
 
@@ -168,9 +219,168 @@ func OrderItemOrderCreated(order models.Order) string {
 	order.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	order.ID = primitive.NewObjectID()
 	order.Order_id = order.ID.Hex()
+	order.Discounts = []models.OrderDiscount{}
+	order.History = []models.OrderEvent{}
+	order.Version = 1
 
 	orderCollection.InsertOne(ctx, order)
 	defer cancel()
 
 	return order.Order_id
 }
+
+// tableHasOpenOrders reports whether the table still has orders that were not
+// settled by a paid invoice.
+func tableHasOpenOrders(ctx context.Context, tableId string) (bool, error) {
+	matchStage := bson.D{{Key: "$match", Value: bson.D{{Key: "table_id", Value: tableId}, {Key: "deleted_at", Value: nil}}}}
+	lookupStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "invoice"}, {Key: "localField", Value: "order_id"}, {Key: "foreignField", Value: "order_id"}, {Key: "as", Value: "invoice"}}}}
+	unpaidStage := bson.D{{Key: "$match", Value: bson.D{{Key: "invoice", Value: bson.D{{Key: "$not", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+		{Key: "payment_status", Value: "PAID"},
+		{Key: "deleted_at", Value: nil},
+	}}}}}}}}}
+	countStage := bson.D{{Key: "$count", Value: "open_orders"}}
+
+	result, err := orderCollection.Aggregate(ctx, mongo.Pipeline{matchStage, lookupStage, unpaidStage, countStage})
+	if err != nil {
+		return false, err
+	}
+
+	var counts []bson.M
+	if err = result.All(ctx, &counts); err != nil {
+		return false, err
+	}
+
+	return len(counts) > 0, nil
+}
+
+func DeleteOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		orderId := c.Param("order_id")
+
+		var order models.Order
+		err := orderCollection.FindOne(ctx, notDeleted(bson.M{"order_id": orderId})).Decode(&order)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order failed to delete"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(order.Version)) {
+			return
+		}
+
+		invoiceCount, err := invoiceCollection.CountDocuments(ctx, notDeleted(bson.M{"order_id": orderId}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order failed to delete"})
+			return
+		}
+		if invoiceCount > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "order has been invoiced, delete the invoice first"})
+			return
+		}
+
+		result, err := archiveRecord(ctx, orderCollection, matchVersion(bson.M{"order_id": orderId}, order.Version), c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order failed to delete"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the order was modified by someone else, reload it and try again"})
+			return
+		}
+
+		// archive the items with the same stamp so a restore can bring them back
+		var archived models.Order
+		if err = orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&archived); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order failed to delete"})
+			return
+		}
+
+		_, err = OrderItemCollection.UpdateMany(
+			ctx,
+			notDeleted(bson.M{"order_id": orderId}),
+			bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "deleted_at", Value: archived.Deleted_at},
+					{Key: "deleted_by", Value: archived.Deleted_by},
+				}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order items failed to delete"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "order deleted", "order_id": orderId})
+	}
+}
+
+func RestoreOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		orderId := c.Param("order_id")
+
+		var order models.Order
+		err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId, "deleted_at": bson.M{"$ne": nil}}).Decode(&order)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no archived order with this id"})
+			return
+		}
+		if order.Merged_into != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "order was merged into " + *order.Merged_into + " and cannot be restored"})
+			return
+		}
+
+		tableCount, err := tableCollection.CountDocuments(ctx, notDeleted(bson.M{"table_id": order.Table_id}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order failed to restore"})
+			return
+		}
+		if tableCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "the table of this order is archived, restore it first"})
+			return
+		}
+
+		if _, err = restoreRecord(ctx, orderCollection, bson.M{"order_id": orderId}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order failed to restore"})
+			return
+		}
+
+		_, err = OrderItemCollection.UpdateMany(
+			ctx,
+			bson.M{"order_id": orderId, "deleted_at": order.Deleted_at},
+			bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "deleted_at", Value: nil},
+					{Key: "deleted_by", Value: nil},
+				}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order items failed to restore"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "order restored", "order_id": orderId})
+	}
+}
@@ -3,8 +3,9 @@ package controller
 import (
 	"context"
 	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
 	"golang-restaurant-backend-app/models"
-	"log"
+	"golang-restaurant-backend-app/money"
 	"net/http"
 	"time"
 
@@ -25,41 +26,47 @@ var OrderItemCollection *mongo.Collection = database.OpenCollection(database.Cli
 func GetOrderItems() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-
-		result, err := OrderItemCollection.Find(context.TODO(), bson.M{})
-
 		defer cancel()
 
+		params, err := helper.GetPageParams(c)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occured while listing ordered items"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		var allOrderItems []bson.M
+		page, err := helper.Paginate(ctx, OrderItemCollection, notDeleted(bson.M{}), params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occured while listing ordered items"})
+			return
+		}
 
-		if err = result.All(ctx, &allOrderItems); err != nil {
-			log.Fatal(err)
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
 			return
 		}
-		c.JSON(http.StatusOK, allOrderItems)
+		c.JSON(http.StatusOK, page)
 	}
 }
 
 func GetOrderItem() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 		orderItemId := c.Param("order_item_id")
 		var orderItem models.OrderItem
 
-		err := OrderItemCollection.FindOne(ctx, bson.M{"orderItem_id": orderItemId}).Decode(&orderItem)
-
-		defer cancel()
-
+		err := OrderItemCollection.FindOne(ctx, notDeleted(bson.M{"order_item_id": orderItemId})).Decode(&orderItem)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order item was not found"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occured while listing ordered items"})
 			return
 		}
 
+		if helper.CheckNotModified(c, helper.ETag(orderItem.Version)) {
+			return
+		}
 		c.JSON(http.StatusOK, orderItem)
 	}
 }
@@ -84,10 +91,13 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 	defer cancel()
 
 	// Aggregation pipeline stages
-	matchStage := bson.D{{Key: "$match", Value: bson.D{{Key: "order_id", Value: id}}}}
+	matchStage := bson.D{{Key: "$match", Value: bson.D{{Key: "order_id", Value: id}, {Key: "deleted_at", Value: nil}, {Key: "void", Value: nil}}}}
 	lookupStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "food"}, {Key: "localField", Value: "food_id"}, {Key: "foreignField", Value: "food_id"}, {Key: "as", Value: "food"}}}}
 	unwindStage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$food"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}}
 
+	lookupMenuStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "menu"}, {Key: "localField", Value: "food.menu_id"}, {Key: "foreignField", Value: "menu_id"}, {Key: "as", Value: "menu"}}}}
+	unwindMenuStage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$menu"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}}
+
 	lookupOrderStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "order"}, {Key: "localField", Value: "order_id"}, {Key: "foreignField", Value: "order_id"}, {Key: "as", Value: "order"}}}}
 	unwindOrderStage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$order"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}}
 
@@ -97,14 +107,18 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 	projectStage := bson.D{
 		{Key: "$project", Value: bson.D{
 			{Key: "id", Value: 0},
-			{Key: "amount", Value: "$food.price"},
+			{Key: "amount", Value: bson.D{{Key: "$toDecimal", Value: money.Field("$food.price")}}},
 			{Key: "total_count", Value: 1},
+			{Key: "order_item_id", Value: 1},
+			{Key: "created_at", Value: 1},
+			{Key: "food_id", Value: "$food.food_id"},
 			{Key: "food_name", Value: "$food.name"},
+			{Key: "category", Value: "$menu.category"},
 			{Key: "food_image", Value: "$food.image"},
 			{Key: "table_number", Value: "$table.table_number"},
 			{Key: "table_id", Value: "$table.table_id"},
 			{Key: "order_id", Value: "$order.order_id"},
-			{Key: "price", Value: "$food.price"},
+			{Key: "price", Value: bson.D{{Key: "$toDecimal", Value: money.Field("$food.price")}}},
 			{Key: "quantity", Value: 1},
 		}},
 	}
@@ -137,6 +151,8 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 		matchStage,
 		lookupStage,
 		unwindStage,
+		lookupMenuStage,
+		unwindMenuStage,
 		lookupOrderStage,
 		unwindOrderStage,
 		lookupTableStage,
@@ -154,6 +170,7 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 	if err = result.All(ctx, &OrderItems); err != nil {
 		return nil, err
 	}
+	money.Decimals(OrderItems)
 
 	return OrderItems, nil
 }
@@ -177,6 +194,8 @@ func CreateOrderItem() gin.HandlerFunc {
 
 		orderItemsToBeInserted := []interface{}{}
 		order.Table_id = orderItemPack.Table_id
+		uid := c.GetString("uid")
+		order.Server_id = &uid
 		order_id := OrderItemOrderCreated(order)
 
 		for _, orderItem := range orderItemPack.Order_items {
@@ -192,8 +211,11 @@ func CreateOrderItem() gin.HandlerFunc {
 			orderItem.Created_at = time.Now()
 			orderItem.Updated_at = time.Now()
 			orderItem.Order_item_id = orderItem.ID.Hex()
-			var num = toFixed(*orderItem.Unit_price, 2)
-			orderItem.Unit_price = &num
+			orderItem.Deleted_at = nil
+			orderItem.Deleted_by = nil
+			orderItem.Void = nil
+			orderItem.Sent_at = nil
+			orderItem.Version = 1
 
 			orderItemsToBeInserted = append(orderItemsToBeInserted, orderItem)
 		}
@@ -212,53 +234,181 @@ func CreateOrderItem() gin.HandlerFunc {
 func UpdateOrderItem() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
 		var orderItem models.OrderItem
 
 		orderItemId := c.Param("order_item_id")
 
-		filter := bson.M{"order_item_id": orderItemId}
-
-		var updateObj primitive.D
+		filter := notDeleted(bson.M{"order_item_id": orderItemId})
 
-		if orderItem.Unit_price != nil {
-			updateObj = append(updateObj, bson.E{Key: "unit_price", Value: *&orderItem.Unit_price})
+		err := OrderItemCollection.FindOne(ctx, filter).Decode(&orderItem)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order item was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occured while listing ordered items"})
+			return
 		}
 
-		if orderItem.Quantity != nil {
-			updateObj = append(updateObj, bson.E{Key: "quantity", Value: *orderItem.Quantity})
+		if !helper.CheckIfMatch(c, helper.ETag(orderItem.Version)) {
+			return
 		}
 
-		if orderItem.Food_id != nil {
-			updateObj = append(updateObj, bson.E{Key: "food_id", Value: *orderItem.Food_id})
+		if _, err := findChangeableOrder(ctx, orderItem.Order_id, false); err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
 		}
 
-		orderItem.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		var patched models.OrderItem
+		if err := applyMergePatch(c, orderItem, &patched); err != nil {
+			c.JSON(patchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
 
-		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: orderItem.Updated_at})
+		// moving an item to another order is not a plain update
+		patched.ID = orderItem.ID
+		patched.Order_item_id = orderItem.Order_item_id
+		patched.Order_id = orderItem.Order_id
+		patched.Created_at = orderItem.Created_at
+		patched.Deleted_at = orderItem.Deleted_at
+		patched.Deleted_by = orderItem.Deleted_by
+		patched.Void = orderItem.Void
+		patched.Sent_at = orderItem.Sent_at
+		patched.Version = orderItem.Version + 1
+
+		if validatorErr := validate.Struct(patched); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
 
-		upsert := true
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
+		if orderItem.Food_id == nil || *patched.Food_id != *orderItem.Food_id {
+			foodCount, err := foodCollection.CountDocuments(ctx, notDeleted(bson.M{"food_id": patched.Food_id}))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Order Item failed to update"})
+				return
+			}
+			if foodCount == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "food was not found"})
+				return
+			}
 		}
 
-		result, err := OrderItemCollection.UpdateOne(
+		patched.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedOrderItem models.OrderItem
+		err = OrderItemCollection.FindOneAndReplace(
 			ctx,
-			filter,
-			bson.D{
-				{Key: "$set", Value: updateObj},
-			},
-			&opt,
-		)
+			matchVersion(filter, orderItem.Version),
+			patched,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		).Decode(&updatedOrderItem)
 
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the order item was modified by someone else, reload it and try again"})
+			return
+		}
 		if err != nil {
 			msg := "Order Item failed to update"
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
 
+		c.Header("ETag", helper.ETag(updatedOrderItem.Version))
+		c.JSON(http.StatusOK, updatedOrderItem)
+	}
+}
+
+func DeleteOrderItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		c.JSON(http.StatusOK, result)
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		orderItemId := c.Param("order_item_id")
+
+		var orderItem models.OrderItem
+		err := OrderItemCollection.FindOne(ctx, notDeleted(bson.M{"order_item_id": orderItemId})).Decode(&orderItem)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order item was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Order Item failed to delete"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(orderItem.Version)) {
+			return
+		}
+
+		if _, err := findChangeableOrder(ctx, orderItem.Order_id, false); err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := archiveRecord(ctx, OrderItemCollection, matchVersion(bson.M{"order_item_id": orderItemId}, orderItem.Version), c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Order Item failed to delete"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the order item was modified by someone else, reload it and try again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "order item deleted", "order_item_id": orderItemId})
+	}
+}
+
+func RestoreOrderItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		orderItemId := c.Param("order_item_id")
+
+		var orderItem models.OrderItem
+		if err := OrderItemCollection.FindOne(ctx, bson.M{"order_item_id": orderItemId}).Decode(&orderItem); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order item was not found"})
+			return
+		}
+
+		orderCount, err := orderCollection.CountDocuments(ctx, notDeleted(bson.M{"order_id": orderItem.Order_id}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Order Item failed to restore"})
+			return
+		}
+		if orderCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "the order of this item is archived, restore it first"})
+			return
+		}
+
+		if _, err := findChangeableOrder(ctx, orderItem.Order_id, false); err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := restoreRecord(ctx, OrderItemCollection, bson.M{"order_item_id": orderItemId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Order Item failed to restore"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no archived order item with this id"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "order item restored", "order_item_id": orderItemId})
 	}
 }
@@ -0,0 +1,427 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	OrderTransferred   = "TRANSFERRED"
+	OrderMergedFrom    = "MERGED_FROM"
+	OrderMergedInto    = "MERGED_INTO"
+	OrderItemsMovedIn  = "ITEMS_MOVED_IN"
+	OrderItemsMovedOut = "ITEMS_MOVED_OUT"
+	OrderSplitFrom     = "SPLIT_FROM"
+	TablesCombined     = "TABLES_COMBINED"
+	TablesSplit        = "TABLES_SPLIT"
+)
+
+var (
+	errOrderNotFound   = errors.New("order was not found")
+	errOrderPaid       = errors.New("order has been paid and can no longer change")
+	errOrderInvoiced   = errors.New("order has been invoiced, correct it with a void or a credit note")
+	errTableNotFound   = errors.New("table was not found")
+	errTableCombined   = errors.New("table is combined with another table, use that table instead")
+	errTableOccupied   = errors.New("table already has an open order, merge the orders instead")
+	errOrderChanged    = errors.New("the order was modified by someone else, reload it and try again")
+	errSameOrder       = errors.New("an order cannot be merged or moved into itself")
+	errItemsNotInOrder = errors.New("some order items do not belong to this order")
+)
+
+type TransferOrderRequest struct {
+	Table_id *string `json:"table_id" validate:"required"`
+}
+
+type MergeOrderRequest struct {
+	Order_id *string `json:"order_id" validate:"required"`
+}
+
+// MoveItemsRequest moves items to an existing order, or to a new order at
+// Table_id when the bill is being split.
+type MoveItemsRequest struct {
+	Order_item_ids []string `json:"order_item_ids" validate:"required,min=1,dive,required"`
+	To_order_id    *string  `json:"to_order_id" validate:"required_without=Table_id"`
+	Table_id       *string  `json:"table_id" validate:"required_without=To_order_id"`
+}
+
+// orderChangeStatus maps the errors of order operations to a response status.
+func orderChangeStatus(err error) int {
+	switch err {
+	case errOrderNotFound, errTableNotFound:
+		return http.StatusNotFound
+	case errOrderPaid, errOrderInvoiced, errTableCombined, errTableOccupied:
+		return http.StatusConflict
+	case errOrderChanged:
+		return http.StatusPreconditionFailed
+	case errSameOrder, errItemsNotInOrder:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func newOrderEvent(c *gin.Context, action string) models.OrderEvent {
+	at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return models.OrderEvent{Action: action, User_id: c.GetString("uid"), At: at}
+}
+
+// findChangeableOrder loads an order that can still be moved around. Paid
+// orders never change; orders with any invoice may only change table or
+// server, since changing their items or discounts would change the bill.
+func findChangeableOrder(ctx context.Context, orderId string, allowInvoiced bool) (models.Order, error) {
+	var order models.Order
+	err := orderCollection.FindOne(ctx, notDeleted(bson.M{"order_id": orderId})).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return order, errOrderNotFound
+	}
+	if err != nil {
+		return order, err
+	}
+
+	var invoices []models.Invoice
+	result, err := invoiceCollection.Find(ctx, notDeleted(bson.M{"order_id": orderId}))
+	if err != nil {
+		return order, err
+	}
+	if err = result.All(ctx, &invoices); err != nil {
+		return order, err
+	}
+
+	for _, invoice := range invoices {
+		if invoice.Payment_status != nil && *invoice.Payment_status == "PAID" {
+			return order, errOrderPaid
+		}
+	}
+	if len(invoices) > 0 && !allowInvoiced {
+		return order, errOrderInvoiced
+	}
+	return order, nil
+}
+
+// checkTransferTarget makes sure an order can be moved to the table: it has
+// to exist, stand on its own and not be serving another party.
+func checkTransferTarget(ctx context.Context, tableId string) (models.Table, error) {
+	var table models.Table
+	err := tableCollection.FindOne(ctx, notDeleted(bson.M{"table_id": tableId})).Decode(&table)
+	if err == mongo.ErrNoDocuments {
+		return table, errTableNotFound
+	}
+	if err != nil {
+		return table, err
+	}
+	if table.Combined_with != nil {
+		return table, errTableCombined
+	}
+
+	hasOpenOrders, err := tableHasOpenOrders(ctx, tableId)
+	if err != nil {
+		return table, err
+	}
+	if hasOpenOrders {
+		return table, errTableOccupied
+	}
+	return table, nil
+}
+
+// recordOrderEvent applies set to the order matching filter and appends the
+// event to its history.
+func recordOrderEvent(ctx context.Context, filter bson.M, set bson.D, event models.OrderEvent) (models.Order, error) {
+	set = append(set, bson.E{Key: "updated_at", Value: event.At})
+
+	var order models.Order
+	err := orderCollection.FindOneAndUpdate(
+		ctx,
+		filter,
+		bson.D{
+			{Key: "$set", Value: set},
+			{Key: "$push", Value: bson.D{{Key: "history", Value: event}}},
+			{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return order, errOrderChanged
+	}
+	return order, err
+}
+
+// TransferOrder moves an order, with its items, to another table.
+func TransferOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request TransferOrderRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		order, err := findChangeableOrder(ctx, c.Param("order_id"), true)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if order.Table_id != nil && *order.Table_id == *request.Table_id {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the order is already at this table"})
+			return
+		}
+
+		if _, err := checkTransferTarget(ctx, *request.Table_id); err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		event := newOrderEvent(c, OrderTransferred)
+		event.From_table_id = order.Table_id
+		event.To_table_id = request.Table_id
+
+		updatedOrder, err := recordOrderEvent(
+			ctx,
+			matchVersion(notDeleted(bson.M{"order_id": order.Order_id}), order.Version),
+			bson.D{{Key: "table_id", Value: request.Table_id}},
+			event,
+		)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedOrder.Version))
+		c.JSON(http.StatusOK, updatedOrder)
+	}
+}
+
+// MergeOrder brings every item of another order onto this one so both
+// parties get a single bill. The emptied order is archived.
+func MergeOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request MergeOrderRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		orderId := c.Param("order_id")
+		if *request.Order_id == orderId {
+			c.JSON(orderChangeStatus(errSameOrder), gin.H{"error": errSameOrder.Error()})
+			return
+		}
+
+		order, err := findChangeableOrder(ctx, orderId, false)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		source, err := findChangeableOrder(ctx, *request.Order_id, false)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		var items []models.OrderItem
+		result, err := OrderItemCollection.Find(ctx, notDeleted(bson.M{"order_id": source.Order_id}))
+		if err == nil {
+			err = result.All(ctx, &items)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while merging the orders"})
+			return
+		}
+
+		itemIds := []string{}
+		for _, item := range items {
+			itemIds = append(itemIds, item.Order_item_id)
+		}
+
+		// archive the source first so nothing can be added to it while its items move
+		mergedEvent := newOrderEvent(c, OrderMergedInto)
+		mergedEvent.Other_order_id = &order.Order_id
+		mergedEvent.To_table_id = order.Table_id
+		mergedEvent.Order_item_ids = itemIds
+
+		uid := c.GetString("uid")
+		_, err = recordOrderEvent(
+			ctx,
+			matchVersion(notDeleted(bson.M{"order_id": source.Order_id}), source.Version),
+			bson.D{
+				{Key: "merged_into", Value: order.Order_id},
+				{Key: "deleted_at", Value: mergedEvent.At},
+				{Key: "deleted_by", Value: uid},
+			},
+			mergedEvent,
+		)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if _, err = moveOrderItems(ctx, source.Order_id, order.Order_id, itemIds); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while merging the orders"})
+			return
+		}
+
+		// discounts follow the items they were given on
+		if len(source.Discounts) > 0 {
+			_, err = orderCollection.UpdateOne(
+				ctx,
+				bson.M{"order_id": order.Order_id},
+				bson.D{{Key: "$push", Value: bson.D{{Key: "discounts", Value: bson.D{{Key: "$each", Value: source.Discounts}}}}}},
+			)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while merging the orders"})
+				return
+			}
+		}
+
+		event := newOrderEvent(c, OrderMergedFrom)
+		event.Other_order_id = &source.Order_id
+		event.From_table_id = source.Table_id
+		event.Order_item_ids = itemIds
+
+		updatedOrder, err := recordOrderEvent(ctx, notDeleted(bson.M{"order_id": order.Order_id}), bson.D{}, event)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedOrder.Version))
+		c.JSON(http.StatusOK, updatedOrder)
+	}
+}
+
+func moveOrderItems(ctx context.Context, fromOrderId string, toOrderId string, itemIds []string) (*mongo.UpdateResult, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	return OrderItemCollection.UpdateMany(
+		ctx,
+		notDeleted(bson.M{"order_id": fromOrderId, "order_item_id": bson.M{"$in": itemIds}}),
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "order_id", Value: toOrderId},
+				{Key: "updated_at", Value: now},
+			}},
+			{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+		},
+	)
+}
+
+// MoveOrderItems moves selected items to another order. Without a target
+// order a new one is opened at the given table, which splits the bill.
+func MoveOrderItems() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request MoveItemsRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		orderId := c.Param("order_id")
+		if request.To_order_id != nil && *request.To_order_id == orderId {
+			c.JSON(orderChangeStatus(errSameOrder), gin.H{"error": errSameOrder.Error()})
+			return
+		}
+
+		order, err := findChangeableOrder(ctx, orderId, false)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		itemCount, err := OrderItemCollection.CountDocuments(ctx, notDeleted(bson.M{"order_id": orderId, "order_item_id": bson.M{"$in": request.Order_item_ids}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while moving the order items"})
+			return
+		}
+		if int(itemCount) != len(request.Order_item_ids) {
+			c.JSON(orderChangeStatus(errItemsNotInOrder), gin.H{"error": errItemsNotInOrder.Error()})
+			return
+		}
+
+		var target models.Order
+		inEvent := newOrderEvent(c, OrderItemsMovedIn)
+
+		if request.To_order_id != nil {
+			target, err = findChangeableOrder(ctx, *request.To_order_id, false)
+			if err != nil {
+				c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+		} else {
+			// a split may stay at the same table, so only the table itself is checked
+			var table models.Table
+			err := tableCollection.FindOne(ctx, notDeleted(bson.M{"table_id": request.Table_id})).Decode(&table)
+			if err != nil {
+				c.JSON(orderChangeStatus(errTableNotFound), gin.H{"error": errTableNotFound.Error()})
+				return
+			}
+
+			var newOrder models.Order
+			newOrder.Order_date = time.Now()
+			newOrder.Table_id = &table.Table_id
+			newOrder.Server_id = order.Server_id
+			target.Order_id = OrderItemOrderCreated(newOrder)
+			inEvent.Action = OrderSplitFrom
+		}
+
+		outEvent := newOrderEvent(c, OrderItemsMovedOut)
+		outEvent.Other_order_id = &target.Order_id
+		outEvent.Order_item_ids = request.Order_item_ids
+
+		updatedOrder, err := recordOrderEvent(
+			ctx,
+			matchVersion(notDeleted(bson.M{"order_id": order.Order_id}), order.Version),
+			bson.D{},
+			outEvent,
+		)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if _, err = moveOrderItems(ctx, order.Order_id, target.Order_id, request.Order_item_ids); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while moving the order items"})
+			return
+		}
+
+		inEvent.Other_order_id = &order.Order_id
+		inEvent.From_table_id = order.Table_id
+		inEvent.Order_item_ids = request.Order_item_ids
+
+		targetOrder, err := recordOrderEvent(ctx, notDeleted(bson.M{"order_id": target.Order_id}), bson.D{}, inEvent)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"from": updatedOrder, "to": targetOrder})
+	}
+}
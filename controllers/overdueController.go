@@ -0,0 +1,332 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"golang-restaurant-backend-app/notifier"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// nextReminderDay is the day overdue the next reminder of an invoice goes out
+// on, or -1 when the schedule is done. Days missed while the job was not
+// running are skipped rather than sent all at once.
+func nextReminderDay(invoice models.Invoice, schedule []int) int {
+	last := -1
+	if len(invoice.Reminders) > 0 {
+		last = invoice.Reminders[len(invoice.Reminders)-1].Days_overdue
+	}
+	for _, day := range schedule {
+		if day > last {
+			return day
+		}
+	}
+	return -1
+}
+
+// reminderMessage asks the customer of an invoice to pay it, by email when
+// the invoice has an address and by text message otherwise.
+func reminderMessage(ctx context.Context, invoice models.Invoice, daysOverdue int) (notifier.Message, bool) {
+	message := notifier.Message{}
+	switch {
+	case invoice.Billing_email != nil:
+		message.Channel, message.To = notifier.EMAIL, *invoice.Billing_email
+	case invoice.Billing_phone != nil:
+		message.Channel, message.To = notifier.SMS, *invoice.Billing_phone
+	default:
+		return message, false
+	}
+
+	restaurant := "us"
+	branch := helper.BranchCode()
+	if invoice.Branch != nil {
+		branch = *invoice.Branch
+	}
+	if template, err := receiptTemplate(ctx, branch); err == nil && template.Restaurant_name != nil {
+		restaurant = *template.Restaurant_name
+	}
+	number := invoice.Invoice_id
+	if invoice.Invoice_number != nil {
+		number = *invoice.Invoice_number
+	}
+
+	message.Subject = "Payment reminder for invoice " + number
+	message.Body = fmt.Sprintf("Invoice %s from %s over %s %s was due on %s and is %d days overdue. Please settle it at your earliest convenience.",
+		number, restaurant, helper.InvoiceDue(invoice), invoiceCurrency(invoice),
+		invoice.Payment_due_date.In(time.Local).Format("2006-01-02"), daysOverdue)
+	return message, true
+}
+
+// chaseInvoice flags an invoice past its due date, charges the late fees it
+// has run up and sends the reminder that is due, if any.
+func chaseInvoice(ctx context.Context, invoice models.Invoice, policy helper.LateFeePolicy, schedule []int, now time.Time) error {
+	days := helper.DaysOverdue(invoice, now)
+	if days < 0 {
+		return nil
+	}
+
+	changed := false
+	if invoice.Overdue_at == nil {
+		invoice.Overdue_at = &now
+		changed = true
+	}
+	for len(invoice.Late_fees) < policy.FeesDue(days) {
+		unpaid := helper.InvoiceDue(invoice).Sub(money.Value(invoice.Late_fee_total))
+		if !unpaid.IsPositive() {
+			break
+		}
+		helper.ChargeLateFee(&invoice, models.LateFee{
+			Late_fee_id:  primitive.NewObjectID().Hex(),
+			Amount:       policy.Fee(unpaid),
+			Days_overdue: days,
+			Charged_at:   now,
+		})
+		changed = true
+	}
+	if changed {
+		saved, err := saveInvoice(ctx, invoice)
+		if err != nil {
+			return err
+		}
+		invoice = saved
+	}
+
+	day := nextReminderDay(invoice, schedule)
+	if day < 0 || days < day {
+		return nil
+	}
+	message, ok := reminderMessage(ctx, invoice, days)
+	if !ok {
+		return nil
+	}
+	// a reminder that fails is tried again on the next run
+	if err := receiptNotifier.Send(ctx, message); err != nil {
+		return err
+	}
+	reminder := models.PaymentReminder{Channel: message.Channel, To: message.To, Days_overdue: days, Sent_at: now}
+	_, err := invoiceCollection.UpdateOne(ctx, bson.M{"invoice_id": invoice.Invoice_id}, bson.D{
+		{Key: "$push", Value: bson.D{{Key: "reminders", Value: reminder}}},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+	})
+	return err
+}
+
+// processOverdueInvoices clears the flag of invoices that were paid or given
+// longer, then chases every unpaid invoice past its due date.
+func processOverdueInvoices(ctx context.Context) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	if _, err := invoiceCollection.UpdateMany(ctx,
+		bson.M{"overdue_at": bson.M{"$ne": nil}, "$or": bson.A{
+			bson.M{"payment_status": helper.InvoicePaid},
+			bson.M{"payment_due_date": bson.M{"$gt": now}},
+		}},
+		bson.D{
+			{Key: "$set", Value: bson.D{{Key: "overdue_at", Value: nil}}},
+			{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+		},
+	); err != nil {
+		log.Printf("overdue invoices could not be cleared: %v", err)
+	}
+
+	result, err := invoiceCollection.Find(ctx, notDeleted(bson.M{
+		"payment_status":   bson.M{"$ne": helper.InvoicePaid},
+		"payment_due_date": bson.M{"$lte": now},
+		"total":            bson.M{"$ne": nil},
+	}))
+	if err != nil {
+		log.Printf("overdue invoices could not be listed: %v", err)
+		return
+	}
+	var invoices []models.Invoice
+	if err = result.All(ctx, &invoices); err != nil {
+		log.Printf("overdue invoices could not be listed: %v", err)
+		return
+	}
+
+	policy := helper.LateFeePolicyFromEnv()
+	schedule := helper.ReminderDays()
+	for _, invoice := range invoices {
+		if !helper.InvoiceDue(invoice).IsPositive() {
+			continue
+		}
+		if err := chaseInvoice(ctx, invoice, policy, schedule, now); err != nil {
+			log.Printf("overdue invoice %s could not be chased: %v", invoice.Invoice_id, err)
+		}
+	}
+}
+
+// StartOverdueJob chases overdue invoices in the background, at start and
+// then every OVERDUE_INTERVAL.
+func StartOverdueJob() {
+	interval, err := time.ParseDuration(os.Getenv("OVERDUE_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			processOverdueInvoices(ctx)
+			cancel()
+			<-ticker.C
+		}
+	}()
+}
+
+// WaiveLateFee takes a late fee off an invoice.
+func WaiveLateFee() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		invoice, err := findInvoice(ctx, c.Param("invoice_id"))
+		if err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if !checkInvoiceIfMatch(ctx, c, invoice) {
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		if err := helper.WaiveLateFee(&invoice, c.Param("late_fee_id"), c.GetString("uid"), now); err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		updatedInvoice, err := saveInvoice(ctx, invoice)
+		if err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedInvoice.Version))
+		c.JSON(http.StatusOK, updatedInvoice)
+	}
+}
+
+// agingInvoice is an unpaid invoice as the aging report lists it.
+type agingInvoice struct {
+	Invoice_id       string      `json:"invoice_id"`
+	Invoice_number   *string     `json:"invoice_number"`
+	Branch           *string     `json:"branch"`
+	Payment_due_date time.Time   `json:"payment_due_date"`
+	Days_overdue     int         `json:"days_overdue"`
+	Outstanding      money.Money `json:"outstanding"`
+	Late_fee_total   money.Money `json:"late_fee_total"`
+	Reminders_sent   int         `json:"reminders_sent"`
+	Billing_email    *string     `json:"billing_email"`
+	Billing_phone    *string     `json:"billing_phone"`
+}
+
+type agingBucket struct {
+	Bucket        string         `json:"bucket"`
+	Invoice_count int            `json:"invoice_count"`
+	Outstanding   money.Money    `json:"outstanding"`
+	Invoices      []agingInvoice `json:"invoices"`
+}
+
+// GetAgingReport sorts what is owed on unpaid invoices by how long it is past
+// due, as of ?as_of= or today, optionally for one ?branch=.
+func GetAgingReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		asOf := time.Now()
+		if value := c.Query("as_of"); value != "" {
+			day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "as_of must look like 2006-01-02"})
+				return
+			}
+			asOf = day.AddDate(0, 0, 1).Add(-time.Second)
+		}
+
+		filter := bson.M{
+			"payment_status": bson.M{"$ne": helper.InvoicePaid},
+			"total":          bson.M{"$ne": nil},
+			"created_at":     bson.M{"$lte": asOf},
+		}
+		if branch := c.Query("branch"); branch != "" {
+			filter["branch"] = branch
+		}
+		result, err := invoiceCollection.Find(ctx, notDeleted(filter))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the aging report"})
+			return
+		}
+		var invoices []models.Invoice
+		if err = result.All(ctx, &invoices); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the aging report"})
+			return
+		}
+
+		buckets := []*agingBucket{}
+		byName := map[string]*agingBucket{}
+		for _, name := range []string{helper.AgingCurrent, helper.Aging0to30, helper.Aging31to60, helper.Aging60Plus} {
+			bucket := &agingBucket{Bucket: name, Outstanding: money.Zero(), Invoices: []agingInvoice{}}
+			buckets = append(buckets, bucket)
+			byName[name] = bucket
+		}
+
+		total := money.Zero()
+		for _, invoice := range invoices {
+			outstanding := helper.InvoiceDue(invoice)
+			if !outstanding.IsPositive() {
+				continue
+			}
+			days := helper.DaysOverdue(invoice, asOf)
+			bucket := byName[helper.AgingBucket(days)]
+			bucket.Invoice_count++
+			bucket.Outstanding = bucket.Outstanding.Add(outstanding)
+			bucket.Invoices = append(bucket.Invoices, agingInvoice{
+				Invoice_id:       invoice.Invoice_id,
+				Invoice_number:   invoice.Invoice_number,
+				Branch:           invoice.Branch,
+				Payment_due_date: invoice.Payment_due_date,
+				Days_overdue:     days,
+				Outstanding:      outstanding,
+				Late_fee_total:   money.Value(invoice.Late_fee_total),
+				Reminders_sent:   len(invoice.Reminders),
+				Billing_email:    invoice.Billing_email,
+				Billing_phone:    invoice.Billing_phone,
+			})
+			total = total.Add(outstanding)
+		}
+		for _, bucket := range buckets {
+			sort.Slice(bucket.Invoices, func(i, j int) bool {
+				return bucket.Invoices[i].Days_overdue > bucket.Invoices[j].Days_overdue
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"as_of":             asOf.Format("2006-01-02"),
+			"buckets":           buckets,
+			"outstanding_total": total,
+		})
+	}
+}
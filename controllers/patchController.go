@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+
+	helper "golang-restaurant-backend-app/helper"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errUnsupportedPatchType = errors.New("PATCH bodies must be application/merge-patch+json or application/json")
+
+// applyMergePatch merges the request body into current and decodes the merged
+// document into target. Fields removed by the patch come back as zero values.
+func applyMergePatch(c *gin.Context, current interface{}, target interface{}) error {
+	if contentType := c.GetHeader("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+			return errUnsupportedPatchType
+		}
+	}
+
+	patch, err := c.GetRawData()
+	if err != nil {
+		return err
+	}
+
+	original, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+
+	merged, err := helper.MergePatch(original, patch)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(merged, target)
+}
+
+func patchErrorStatus(err error) int {
+	if err == errUnsupportedPatchType {
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,423 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PaymentRequest takes a payment against an invoice. Amount is what goes
+// towards the bill, leave it out to pay all that is due on the invoice or the
+// split. Cash payments may tender more than that and get change back.
+type PaymentRequest struct {
+	Method   *string      `json:"method" validate:"required,eq=CARD|eq=CASH"`
+	Amount   *money.Money `json:"amount" validate:"omitempty,gt=0"`
+	Tip      *money.Money `json:"tip" validate:"omitempty,gte=0"`
+	Tendered *money.Money `json:"tendered" validate:"omitempty,gt=0"`
+	Split_id *string      `json:"split_id"`
+}
+
+type PayInvoiceRequest struct {
+	Payment_method *string      `json:"payment_method" validate:"required,eq=CARD|eq=CASH"`
+	Tip            *money.Money `json:"tip" validate:"omitempty,gte=0"`
+}
+
+// SplitRequest splits an invoice EVEN ways, by the ITEMS each guest had or
+// into AMOUNTS agreed at the table.
+type SplitRequest struct {
+	Mode    *string       `json:"mode" validate:"required,eq=EVEN|eq=ITEMS|eq=AMOUNTS"`
+	Ways    *int          `json:"ways" validate:"omitempty,gte=2,lte=50"`
+	Items   [][]string    `json:"items"`
+	Amounts []money.Money `json:"amounts"`
+	Labels  []string      `json:"labels"`
+}
+
+var (
+	errInvoiceNotFound   = errors.New("invoice was not found")
+	errInvoiceChanged    = errors.New("the invoice was modified by someone else, reload it and try again")
+	errCardNeedsProvider = errors.New("card payments are taken through /invoices/:invoice_id/card-payments")
+)
+
+func paymentErrorStatus(err error) int {
+	switch err {
+	case errInvoiceNotFound, helper.ErrSplitNotFound, helper.ErrLateFeeNotFound:
+		return http.StatusNotFound
+	case helper.ErrInvoicePaid, helper.ErrInvoiceDraft, helper.ErrSplitPaid, helper.ErrLateFeeWaived:
+		return http.StatusConflict
+	case helper.ErrOverpayment, helper.ErrShortTender, errCardNeedsProvider:
+		return http.StatusBadRequest
+	case errInvoiceChanged:
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusInternalServerError
+}
+
+// checkManualPayment refuses card payments keyed in by hand, a card only
+// counts once the payment provider has captured it.
+func checkManualPayment(method string) error {
+	if method == helper.CARD {
+		return errCardNeedsProvider
+	}
+	return nil
+}
+
+func newPayment(c *gin.Context, method string) models.Payment {
+	paidAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return models.Payment{
+		Payment_id:  primitive.NewObjectID().Hex(),
+		Method:      method,
+		Received_by: c.GetString("uid"),
+		Paid_at:     paidAt,
+	}
+}
+
+// allocateTip credits the tip of a paid invoice to the server who held the
+// order.
+func allocateTip(ctx context.Context, invoice *models.Invoice) error {
+	var order models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"order_id": invoice.Order_id}).Decode(&order); err != nil {
+		return err
+	}
+	invoice.Tip_server_id = order.Server_id
+	return nil
+}
+
+// settleInvoice prices an invoice for the last time before it is split or
+// paid.
+func settleInvoice(ctx context.Context, invoice *models.Invoice) (helper.TaxBreakdown, error) {
+	breakdown, _, err := priceOrder(ctx, invoice.Order_id)
+	if err != nil {
+		return breakdown, err
+	}
+	if !invoiceFrozen(*invoice) {
+		setInvoiceTotals(invoice, breakdown)
+	}
+	return breakdown, nil
+}
+
+func findInvoice(ctx context.Context, invoiceId string) (models.Invoice, error) {
+	var invoice models.Invoice
+	err := invoiceCollection.FindOne(ctx, notDeleted(bson.M{"invoice_id": invoiceId})).Decode(&invoice)
+	if err == mongo.ErrNoDocuments {
+		return invoice, errInvoiceNotFound
+	}
+	return invoice, err
+}
+
+// saveInvoice replaces the invoice if nobody changed it since it was read.
+func saveInvoice(ctx context.Context, invoice models.Invoice) (models.Invoice, error) {
+	oldVersion := invoice.Version
+	invoice.Version = oldVersion + 1
+	invoice.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	var updatedInvoice models.Invoice
+	err := invoiceCollection.FindOneAndReplace(
+		ctx,
+		matchVersion(notDeleted(bson.M{"invoice_id": invoice.Invoice_id}), oldVersion),
+		invoice,
+		options.FindOneAndReplace().SetReturnDocument(options.After),
+	).Decode(&updatedInvoice)
+	if err == mongo.ErrNoDocuments {
+		return updatedInvoice, errInvoiceChanged
+	}
+	return updatedInvoice, err
+}
+
+// takePayment records a payment on an invoice and credits the tips to the
+// server once it is paid in full.
+func takePayment(ctx context.Context, invoiceId string, payment models.Payment) (models.Invoice, error) {
+	invoice, err := findInvoice(ctx, invoiceId)
+	if err != nil {
+		return invoice, err
+	}
+
+	// providers may confirm a capture more than once
+	if payment.Intent_id != nil {
+		for _, taken := range invoice.Payments {
+			if taken.Intent_id != nil && *taken.Intent_id == *payment.Intent_id {
+				return invoice, nil
+			}
+		}
+	}
+
+	if invoice.Payment_status != nil && *invoice.Payment_status == helper.InvoicePaid {
+		return invoice, helper.ErrInvoicePaid
+	}
+
+	if _, err := settleInvoice(ctx, &invoice); err != nil {
+		return invoice, err
+	}
+	if err := helper.ApplyPayment(&invoice, &payment); err != nil {
+		return invoice, err
+	}
+	if *invoice.Payment_status == helper.InvoicePaid {
+		if err := allocateTip(ctx, &invoice); err != nil {
+			return invoice, err
+		}
+	}
+
+	return saveInvoice(ctx, invoice)
+}
+
+// AddPayment takes one payment towards an invoice. The invoice is
+// PARTIALLY_PAID until the payments cover its total, then PAID.
+func AddPayment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request PaymentRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+		if err := checkManualPayment(*request.Method); err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if request.Tendered != nil && *request.Method != helper.CASH {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only cash payments are tendered"})
+			return
+		}
+
+		payment := newPayment(c, *request.Method)
+		payment.Split_id = request.Split_id
+		if request.Amount != nil {
+			payment.Amount = *request.Amount
+		}
+		if request.Tip != nil {
+			payment.Tip = *request.Tip
+		}
+		if request.Tendered != nil {
+			payment.Tendered = *request.Tendered
+		}
+
+		invoice, err := takePayment(ctx, c.Param("invoice_id"), payment)
+		if err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		payment = invoice.Payments[len(invoice.Payments)-1]
+		c.Header("ETag", helper.ETag(invoice.Version))
+		c.JSON(http.StatusCreated, gin.H{
+			"payment":        payment,
+			"change_due":     payment.Change,
+			"amount_paid":    invoice.Amount_paid,
+			"outstanding":    invoice.Outstanding,
+			"payment_status": invoice.Payment_status,
+			"invoice":        invoice,
+		})
+	}
+}
+
+// PayInvoice settles what is left on an invoice in one payment, taking the
+// tip the guest adds at the till.
+func PayInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request PayInvoiceRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		if err := checkManualPayment(*request.Payment_method); err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		payment := newPayment(c, *request.Payment_method)
+		if request.Tip != nil {
+			payment.Tip = *request.Tip
+		}
+
+		invoice, err := takePayment(ctx, c.Param("invoice_id"), payment)
+		if err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(invoice.Version))
+		c.JSON(http.StatusOK, invoice)
+	}
+}
+
+// SplitInvoice divides an invoice into the shares the guests pay. The splits
+// can be changed until the first payment is taken.
+func SplitInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request SplitRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		invoice, err := findInvoice(ctx, c.Param("invoice_id"))
+		if err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if len(invoice.Payments) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "the invoice cannot be split once payments are taken"})
+			return
+		}
+
+		// a new split starts from the order as it is now
+		invoice.Splits = nil
+		breakdown, err := settleInvoice(ctx, &invoice)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while pricing the invoice"})
+			return
+		}
+		total := *invoice.Total
+
+		var amounts []money.Money
+		var groups [][]string
+		switch *request.Mode {
+		case "EVEN":
+			if request.Ways == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "ways is required to split evenly"})
+				return
+			}
+			amounts = total.Split(*request.Ways)
+
+		case "ITEMS":
+			if len(request.Items) < 2 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "items must list the order items of at least two guests"})
+				return
+			}
+			group := map[string]int{}
+			for i, ids := range request.Items {
+				for _, id := range ids {
+					if _, taken := group[id]; taken {
+						c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("order item %s is in more than one split", id)})
+						return
+					}
+					group[id] = i
+				}
+			}
+			shares := make([]money.Money, len(request.Items))
+			for _, item := range breakdown.Items {
+				i, ok := group[item.Order_item_id]
+				if !ok {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("order item %s is in no split", item.Order_item_id)})
+					return
+				}
+				shares[i] = shares[i].Add(item.Amount)
+				delete(group, item.Order_item_id)
+			}
+			for id := range group {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("order item %s is not on this invoice", id)})
+				return
+			}
+			// taxes, service and tip are shared in proportion to the items
+			amounts = total.Allocate(shares)
+			groups = request.Items
+
+		case "AMOUNTS":
+			if len(request.Amounts) < 2 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "amounts must have at least two entries"})
+				return
+			}
+			for _, amount := range request.Amounts {
+				if !amount.IsPositive() {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "amounts must be greater than zero"})
+					return
+				}
+			}
+			if money.Sum(request.Amounts...).Cmp(total) != 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("the amounts must add up to the invoice total of %s", total)})
+				return
+			}
+			amounts = request.Amounts
+		}
+
+		if len(request.Labels) > 0 && len(request.Labels) != len(amounts) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "labels must have one entry per split"})
+			return
+		}
+
+		invoice.Splits = []models.BillSplit{}
+		for i, amount := range amounts {
+			split := models.BillSplit{
+				Split_id:       primitive.NewObjectID().Hex(),
+				Label:          fmt.Sprintf("Guest %d", i+1),
+				Order_item_ids: []string{},
+				Amount:         amount,
+			}
+			if len(request.Labels) > 0 {
+				split.Label = request.Labels[i]
+			}
+			if groups != nil {
+				split.Order_item_ids = groups[i]
+			}
+			invoice.Splits = append(invoice.Splits, split)
+		}
+
+		updatedInvoice, err := saveInvoice(ctx, invoice)
+		if err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedInvoice.Version))
+		c.JSON(http.StatusOK, updatedInvoice)
+	}
+}
+
+// ClearInvoiceSplits puts an invoice back to a single bill.
+func ClearInvoiceSplits() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		invoice, err := findInvoice(ctx, c.Param("invoice_id"))
+		if err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if len(invoice.Payments) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "the splits cannot change once payments are taken"})
+			return
+		}
+
+		invoice.Splits = []models.BillSplit{}
+		updatedInvoice, err := saveInvoice(ctx, invoice)
+		if err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedInvoice.Version))
+		c.JSON(http.StatusOK, updatedInvoice)
+	}
+}
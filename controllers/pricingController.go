@@ -0,0 +1,707 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var pricingRuleCollection *mongo.Collection = database.OpenCollection(database.Client, "pricing_rule")
+
+type PromoCodeRequest struct {
+	Promo_code *string `json:"promo_code" validate:"required"`
+}
+
+// CompRequest is a manual discount given by staff.
+type CompRequest struct {
+	Name           *string      `json:"name"`
+	Kind           *string      `json:"kind" validate:"required,eq=PERCENTAGE|eq=FIXED"`
+	Value          *float64     `json:"value" validate:"omitempty,gt=0"`
+	Amount         *money.Money `json:"amount" validate:"omitempty,gt=0"`
+	Scope          *string      `json:"scope" validate:"required,eq=ITEM|eq=BILL"`
+	Order_item_ids []string     `json:"order_item_ids"`
+	Reason         *string      `json:"reason" validate:"required,min=3,max=200"`
+}
+
+// priceOrder works out what an order costs now: its discounts first, then the
+// service charges for the party, then the taxes on what is left. Tips are
+// not part of it, they belong to the invoice.
+func priceOrder(ctx context.Context, orderId string) (helper.TaxBreakdown, []primitive.M, error) {
+	allOrderItems, err := ItemsByOrder(orderId)
+	if err != nil {
+		return helper.TaxBreakdown{}, nil, err
+	}
+
+	var order models.Order
+	err = orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return helper.TaxBreakdown{}, nil, err
+	}
+
+	rules, err := automaticPricingRules(ctx)
+	if err != nil {
+		return helper.TaxBreakdown{}, nil, err
+	}
+
+	rates, err := activeTaxRates(ctx)
+	if err != nil {
+		return helper.TaxBreakdown{}, nil, err
+	}
+
+	items := []helper.TaxableItem{}
+	if len(allOrderItems) > 0 {
+		orderItems, _ := allOrderItems[0]["order_items"].(primitive.A)
+		for _, raw := range orderItems {
+			orderItem, ok := raw.(primitive.M)
+			if !ok {
+				continue
+			}
+			item := helper.TaxableItem{}
+			item.Order_item_id, _ = orderItem["order_item_id"].(string)
+			item.Food_id, _ = orderItem["food_id"].(string)
+			item.Category, _ = orderItem["category"].(string)
+			item.Amount = money.FromValue(orderItem["amount"])
+			if orderedAt, ok := orderItem["created_at"].(primitive.DateTime); ok {
+				item.Ordered_at = orderedAt.Time()
+			}
+			items = append(items, item)
+		}
+	}
+
+	charges, err := activeServiceCharges(ctx)
+	if err != nil {
+		return helper.TaxBreakdown{}, nil, err
+	}
+
+	// the party is as large as the table it sits at
+	partySize := 0
+	if order.Table_id != nil {
+		var table models.Table
+		if err := tableCollection.FindOne(ctx, bson.M{"table_id": order.Table_id}).Decode(&table); err == nil {
+			if partySize, err = tableCapacity(ctx, table); err != nil {
+				return helper.TaxBreakdown{}, nil, err
+			}
+		}
+	}
+
+	discounted, discountLines := helper.ApplyDiscounts(items, rules, order.Discounts, time.Now())
+	serviceLines := helper.ServiceCharges(discounted, charges, partySize)
+
+	taxable := append([]helper.TaxableItem{}, discounted...)
+	untaxedService := money.Zero()
+	for _, line := range serviceLines {
+		if line.Taxable {
+			taxable = append(taxable, helper.TaxableItem{Category: helper.SERVICE_CHARGE, Amount: line.Amount})
+		} else {
+			untaxedService = untaxedService.Add(line.Amount)
+		}
+	}
+
+	breakdown := helper.ComputeTaxes(taxable, rates)
+	breakdown.Items = discounted
+	breakdown.Discount_lines = discountLines
+	breakdown.Discount_total = money.Zero()
+	for _, line := range discountLines {
+		breakdown.Discount_total = breakdown.Discount_total.Add(line.Amount)
+	}
+
+	breakdown.Service_lines = serviceLines
+	breakdown.Service_total = money.Zero()
+	for _, line := range serviceLines {
+		breakdown.Service_total = breakdown.Service_total.Add(line.Amount)
+	}
+	breakdown.Total = breakdown.Total.Add(untaxedService)
+	breakdown.Subtotal = breakdown.Total.Sub(breakdown.Tax_total).Sub(breakdown.Service_total)
+
+	return breakdown, allOrderItems, nil
+}
+
+func automaticPricingRules(ctx context.Context) ([]models.PricingRule, error) {
+	result, err := pricingRuleCollection.Find(ctx, notDeleted(bson.M{"automatic": true}))
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []models.PricingRule
+	if err = result.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// checkPricingRule normalises the promo code and refuses rules that are both
+// automatic and behind a code, or whose code is taken.
+func checkPricingRule(ctx context.Context, rule *models.PricingRule) (int, string) {
+	if rule.Promo_code != nil {
+		code := strings.ToUpper(strings.TrimSpace(*rule.Promo_code))
+		rule.Promo_code = &code
+
+		if rule.Automatic {
+			return http.StatusBadRequest, "a rule with a promo code cannot be automatic"
+		}
+
+		codeCount, err := pricingRuleCollection.CountDocuments(ctx, notDeleted(bson.M{"promo_code": code, "pricing_rule_id": bson.M{"$ne": rule.Pricing_rule_id}}))
+		if err != nil {
+			return http.StatusInternalServerError, "error occured while checking the promo code"
+		}
+		if codeCount > 0 {
+			return http.StatusConflict, "this promo code is already in use"
+		}
+	}
+
+	if rule.Starts_at != nil && rule.Expires_at != nil && !rule.Expires_at.After(*rule.Starts_at) {
+		return http.StatusBadRequest, "expires_at must be after starts_at"
+	}
+	if err := helper.CheckKindValue(*rule.Kind, rule.Value, rule.Amount); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if *rule.Kind == helper.PERCENTAGE && *rule.Value > 100 {
+		return http.StatusBadRequest, "a percentage cannot be more than 100"
+	}
+	return http.StatusOK, ""
+}
+
+func GetPricingRules() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := helper.Paginate(ctx, pricingRuleCollection, notDeleted(bson.M{}), params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the pricing rules"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetPricingRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var rule models.PricingRule
+		err := pricingRuleCollection.FindOne(ctx, notDeleted(bson.M{"pricing_rule_id": c.Param("pricing_rule_id")})).Decode(&rule)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "pricing rule was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the pricing rule"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.ETag(rule.Version)) {
+			return
+		}
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+func CreatePricingRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var rule models.PricingRule
+
+		if err := c.BindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validatorErr := validate.Struct(rule); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		rule.ID = primitive.NewObjectID()
+		rule.Pricing_rule_id = rule.ID.Hex()
+
+		if status, msg := checkPricingRule(ctx, &rule); msg != "" {
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		rule.Uses = 0
+		rule.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		rule.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		rule.Deleted_at = nil
+		rule.Deleted_by = nil
+		rule.Version = 1
+
+		if _, insertErr := pricingRuleCollection.InsertOne(ctx, rule); insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the pricing rule"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(rule.Version))
+		c.JSON(http.StatusCreated, rule)
+	}
+}
+
+func UpdatePricingRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		ruleId := c.Param("pricing_rule_id")
+		filter := notDeleted(bson.M{"pricing_rule_id": ruleId})
+
+		var rule models.PricingRule
+		err := pricingRuleCollection.FindOne(ctx, filter).Decode(&rule)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "pricing rule was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the pricing rule"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(rule.Version)) {
+			return
+		}
+
+		var patched models.PricingRule
+		if err := applyMergePatch(c, rule, &patched); err != nil {
+			c.JSON(patchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		patched.ID = rule.ID
+		patched.Pricing_rule_id = rule.Pricing_rule_id
+		patched.Uses = rule.Uses
+		patched.Created_at = rule.Created_at
+		patched.Deleted_at = rule.Deleted_at
+		patched.Deleted_by = rule.Deleted_by
+		patched.Version = rule.Version + 1
+
+		if validatorErr := validate.Struct(patched); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		if status, msg := checkPricingRule(ctx, &patched); msg != "" {
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+
+		patched.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedRule models.PricingRule
+		err = pricingRuleCollection.FindOneAndReplace(
+			ctx,
+			matchVersion(filter, rule.Version),
+			patched,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		).Decode(&updatedRule)
+
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the pricing rule was modified by someone else, reload it and try again"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "pricing rule failed to update"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedRule.Version))
+		c.JSON(http.StatusOK, updatedRule)
+	}
+}
+
+func DeletePricingRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		ruleId := c.Param("pricing_rule_id")
+
+		var rule models.PricingRule
+		err := pricingRuleCollection.FindOne(ctx, notDeleted(bson.M{"pricing_rule_id": ruleId})).Decode(&rule)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "pricing rule was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "pricing rule failed to delete"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(rule.Version)) {
+			return
+		}
+
+		result, err := archiveRecord(ctx, pricingRuleCollection, matchVersion(bson.M{"pricing_rule_id": ruleId}, rule.Version), c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "pricing rule failed to delete"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the pricing rule was modified by someone else, reload it and try again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "pricing rule deleted", "pricing_rule_id": ruleId})
+	}
+}
+
+// addOrderDiscount appends the discount to an order that is not paid yet.
+func addOrderDiscount(ctx context.Context, orderId string, discount models.OrderDiscount) (models.Order, error) {
+	var order models.Order
+	err := orderCollection.FindOneAndUpdate(
+		ctx,
+		notDeleted(bson.M{"order_id": orderId}),
+		bson.D{
+			{Key: "$set", Value: bson.D{{Key: "updated_at", Value: discount.Created_at}}},
+			{Key: "$push", Value: bson.D{{Key: "discounts", Value: discount}}},
+			{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return order, errOrderNotFound
+	}
+	return order, err
+}
+
+// ApplyPromoCode redeems a promo code on an order. Each redemption counts
+// against the code's usage limit.
+func ApplyPromoCode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request PromoCodeRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		code := strings.ToUpper(strings.TrimSpace(*request.Promo_code))
+
+		order, err := findChangeableOrder(ctx, c.Param("order_id"), false)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		for _, discount := range order.Discounts {
+			if discount.Promo_code != nil && *discount.Promo_code == code && discount.Status == helper.DiscountApplied {
+				c.JSON(http.StatusConflict, gin.H{"error": "this promo code is already applied to the order"})
+				return
+			}
+		}
+
+		var rule models.PricingRule
+		err = pricingRuleCollection.FindOne(ctx, notDeleted(bson.M{"promo_code": code})).Decode(&rule)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "promo code is not valid"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the promo code"})
+			return
+		}
+
+		now := time.Now()
+		if !helper.RuleActiveAt(rule, now) {
+			c.JSON(http.StatusConflict, gin.H{"error": "promo code is expired or not valid at this time"})
+			return
+		}
+
+		// count the use only if the limit still allows it
+		redeemFilter := notDeleted(bson.M{"pricing_rule_id": rule.Pricing_rule_id})
+		if rule.Max_uses != nil {
+			redeemFilter["uses"] = bson.M{"$lt": *rule.Max_uses}
+		}
+		redeemed, err := pricingRuleCollection.UpdateOne(ctx, redeemFilter, bson.D{{Key: "$inc", Value: bson.D{{Key: "uses", Value: 1}}}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while redeeming the promo code"})
+			return
+		}
+		if redeemed.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "promo code has been used up"})
+			return
+		}
+
+		createdAt, _ := time.Parse(time.RFC3339, now.Format(time.RFC3339))
+		discount := models.OrderDiscount{
+			Discount_id:     primitive.NewObjectID().Hex(),
+			Source:          helper.DiscountPromo,
+			Pricing_rule_id: &rule.Pricing_rule_id,
+			Promo_code:      &code,
+			Name:            *rule.Name,
+			Kind:            *rule.Kind,
+			Value:           rule.Value,
+			Amount:          rule.Amount,
+			Scope:           *rule.Scope,
+			Categories:      rule.Categories,
+			Food_ids:        rule.Food_ids,
+			Min_subtotal:    rule.Min_subtotal,
+			Status:          helper.DiscountApplied,
+			Applied_by:      c.GetString("uid"),
+			Created_at:      createdAt,
+		}
+
+		updatedOrder, err := addOrderDiscount(ctx, order.Order_id, discount)
+		if err != nil {
+			pricingRuleCollection.UpdateOne(ctx, bson.M{"pricing_rule_id": rule.Pricing_rule_id}, bson.D{{Key: "$inc", Value: bson.D{{Key: "uses", Value: -1}}}})
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedOrder.Version))
+		c.JSON(http.StatusOK, updatedOrder)
+	}
+}
+
+// AddComp gives a manual discount. Managers' comps apply at once, everyone
+// else's wait for a manager to approve them.
+func AddComp() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request CompRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+		if err := helper.CheckKindValue(*request.Kind, request.Value, request.Amount); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if *request.Kind == helper.PERCENTAGE && *request.Value > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a percentage cannot be more than 100"})
+			return
+		}
+
+		order, err := findChangeableOrder(ctx, c.Param("order_id"), false)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(request.Order_item_ids) > 0 {
+			itemCount, err := OrderItemCollection.CountDocuments(ctx, notDeleted(bson.M{"order_id": order.Order_id, "order_item_id": bson.M{"$in": request.Order_item_ids}}))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while adding the comp"})
+				return
+			}
+			if int(itemCount) != len(request.Order_item_ids) {
+				c.JSON(orderChangeStatus(errItemsNotInOrder), gin.H{"error": errItemsNotInOrder.Error()})
+				return
+			}
+		}
+
+		name := "Comp"
+		if request.Name != nil {
+			name = *request.Name
+		}
+
+		uid := c.GetString("uid")
+		createdAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		discount := models.OrderDiscount{
+			Discount_id:    primitive.NewObjectID().Hex(),
+			Source:         helper.DiscountComp,
+			Name:           name,
+			Kind:           *request.Kind,
+			Value:          request.Value,
+			Amount:         request.Amount,
+			Scope:          *request.Scope,
+			Order_item_ids: request.Order_item_ids,
+			Reason:         request.Reason,
+			Status:         helper.DiscountPendingApproval,
+			Applied_by:     uid,
+			Created_at:     createdAt,
+		}
+
+		if helper.CheckUserType(c, helper.ADMIN, helper.MANAGER) == nil {
+			discount.Status = helper.DiscountApplied
+			discount.Approved_by = &uid
+			discount.Approved_at = &createdAt
+		}
+
+		updatedOrder, err := addOrderDiscount(ctx, order.Order_id, discount)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedOrder.Version))
+		c.JSON(http.StatusCreated, updatedOrder)
+	}
+}
+
+func reviewComp(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		order, err := findChangeableOrder(ctx, c.Param("order_id"), false)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedOrder models.Order
+		err = orderCollection.FindOneAndUpdate(
+			ctx,
+			notDeleted(bson.M{
+				"order_id": order.Order_id,
+				"discounts": bson.M{"$elemMatch": bson.M{
+					"discount_id": c.Param("discount_id"),
+					"status":      helper.DiscountPendingApproval,
+				}},
+			}),
+			bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "discounts.$.status", Value: status},
+					{Key: "discounts.$.approved_by", Value: uid},
+					{Key: "discounts.$.approved_at", Value: now},
+					{Key: "updated_at", Value: now},
+				}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedOrder)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no comp waiting for approval with this id"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while reviewing the comp"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedOrder.Version))
+		c.JSON(http.StatusOK, updatedOrder)
+	}
+}
+
+func ApproveComp() gin.HandlerFunc {
+	return reviewComp(helper.DiscountApplied)
+}
+
+func RejectComp() gin.HandlerFunc {
+	return reviewComp(helper.DiscountRejected)
+}
+
+// RemoveOrderDiscount takes a discount off an order. A removed promo code
+// gives its use back.
+func RemoveOrderDiscount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		order, err := findChangeableOrder(ctx, c.Param("order_id"), false)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		discountId := c.Param("discount_id")
+
+		var removed *models.OrderDiscount
+		for i := range order.Discounts {
+			if order.Discounts[i].Discount_id == discountId {
+				removed = &order.Discounts[i]
+			}
+		}
+		if removed == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "discount was not found on this order"})
+			return
+		}
+
+		// only managers take back a comp once it counts
+		if removed.Source == helper.DiscountComp && removed.Status == helper.DiscountApplied {
+			if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedOrder models.Order
+		err = orderCollection.FindOneAndUpdate(
+			ctx,
+			matchVersion(notDeleted(bson.M{"order_id": order.Order_id}), order.Version),
+			bson.D{
+				{Key: "$set", Value: bson.D{{Key: "updated_at", Value: now}}},
+				{Key: "$pull", Value: bson.D{{Key: "discounts", Value: bson.D{{Key: "discount_id", Value: discountId}}}}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedOrder)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(orderChangeStatus(errOrderChanged), gin.H{"error": errOrderChanged.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while removing the discount"})
+			return
+		}
+
+		if removed.Source == helper.DiscountPromo && removed.Status == helper.DiscountApplied && removed.Pricing_rule_id != nil {
+			pricingRuleCollection.UpdateOne(ctx, bson.M{"pricing_rule_id": removed.Pricing_rule_id, "uses": bson.M{"$gt": 0}}, bson.D{{Key: "$inc", Value: bson.D{{Key: "uses", Value: -1}}}})
+		}
+
+		c.Header("ETag", helper.ETag(updatedOrder.Version))
+		c.JSON(http.StatusOK, updatedOrder)
+	}
+}
@@ -0,0 +1,574 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/printing"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var printJobCollection *mongo.Collection = database.OpenCollection(database.Client, "print_job")
+
+const (
+	PrintTicket  = "TICKET"
+	PrintReceipt = "RECEIPT"
+
+	PrintQueued   = "QUEUED"
+	PrintPrinting = "PRINTING"
+	PrintPrinted  = "PRINTED"
+	PrintFailed   = "FAILED"
+
+	// DefaultStation takes the items of foods that name no station.
+	DefaultStation = "KITCHEN"
+)
+
+// TicketRequest sends the items of an order to the kitchen. Only items not
+// sent yet go, unless Reprint asks for every item again.
+type TicketRequest struct {
+	Reprint bool `json:"reprint"`
+}
+
+// PrintReceiptRequest prints the receipt of an invoice, on the first receipt
+// printer unless one is named.
+type PrintReceiptRequest struct {
+	Printer_id *string `json:"printer_id"`
+}
+
+var (
+	errNoReceiptPrinter = errors.New("no receipt printer is set up")
+	errPrinterNotFound  = errors.New("printer was not found")
+	errJobNotFailed     = errors.New("only failed print jobs can be retried")
+)
+
+func printErrorStatus(err error) int {
+	switch err {
+	case errInvoiceNotFound, errPrinterNotFound, errOrderNotFound:
+		return http.StatusNotFound
+	case errNoReceiptPrinter, errJobNotFailed:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// printMaxAttempts is how many times a job is sent before it is given up,
+// from PRINT_MAX_ATTEMPTS.
+func printMaxAttempts() int {
+	if attempts, err := strconv.Atoi(os.Getenv("PRINT_MAX_ATTEMPTS")); err == nil && attempts > 0 {
+		return attempts
+	}
+	return 5
+}
+
+// retryDelay backs off exponentially from two seconds up to five
+// minutes.
+func retryDelay(attempts int) time.Duration {
+	delay := 2 * time.Second
+	for i := 1; i < attempts && delay < 5*time.Minute; i++ {
+		delay *= 2
+	}
+	if delay > 5*time.Minute {
+		delay = 5 * time.Minute
+	}
+	return delay
+}
+
+func printerColumns(printer models.Printer) int {
+	if printer.Columns != nil {
+		return *printer.Columns
+	}
+	return printing.DefaultColumns
+}
+
+func stationOf(food models.Food) string {
+	if food.Station != nil && *food.Station != "" {
+		return strings.ToUpper(*food.Station)
+	}
+	return DefaultStation
+}
+
+func servesStation(printer models.Printer, station string) bool {
+	for _, served := range printer.Stations {
+		if strings.ToUpper(served) == station {
+			return true
+		}
+	}
+	return false
+}
+
+func queuePrintJob(ctx context.Context, c *gin.Context, printer models.Printer, kind string, reference string, station *string, data []byte) (models.PrintJob, error) {
+	var job models.PrintJob
+	job.ID = primitive.NewObjectID()
+	job.Print_job_id = job.ID.Hex()
+	job.Printer_id = printer.Printer_id
+	job.Kind = kind
+	job.Reference = reference
+	job.Station = station
+	job.Data = data
+	job.Status = PrintQueued
+	job.Created_by = c.GetString("uid")
+	job.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	job.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	job.Next_attempt_at = job.Created_at
+	job.Version = 1
+
+	_, err := printJobCollection.InsertOne(ctx, job)
+	return job, err
+}
+
+// sendPrintJob sends a job to its printer and records how it went, returning
+// why it did not print.
+func sendPrintJob(ctx context.Context, job models.PrintJob) error {
+	var printer models.Printer
+	err := printerCollection.FindOne(ctx, notDeleted(bson.M{"printer_id": job.Printer_id})).Decode(&printer)
+	if err == mongo.ErrNoDocuments {
+		err = errPrinterNotFound
+	}
+
+	if err == nil {
+		var output printing.Output
+		if output, err = printing.NewOutput(*printer.Connection, *printer.Address); err == nil {
+			err = output.Write(ctx, job.Data)
+		}
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	set := bson.D{{Key: "updated_at", Value: now}, {Key: "attempts", Value: job.Attempts + 1}}
+	switch {
+	case err == nil:
+		set = append(set, bson.E{Key: "status", Value: PrintPrinted}, bson.E{Key: "printed_at", Value: now}, bson.E{Key: "last_error", Value: nil})
+	case job.Attempts+1 >= printMaxAttempts():
+		log.Printf("print job %s to printer %s failed for good: %v", job.Print_job_id, job.Printer_id, err)
+		set = append(set, bson.E{Key: "status", Value: PrintFailed}, bson.E{Key: "last_error", Value: err.Error()})
+	default:
+		set = append(set, bson.E{Key: "status", Value: PrintQueued}, bson.E{Key: "last_error", Value: err.Error()},
+			bson.E{Key: "next_attempt_at", Value: now.Add(retryDelay(job.Attempts + 1))})
+	}
+
+	if _, updateErr := printJobCollection.UpdateOne(ctx, bson.M{"print_job_id": job.Print_job_id}, bson.D{
+		{Key: "$set", Value: set},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+	}); updateErr != nil {
+		log.Printf("print job %s could not be updated: %v", job.Print_job_id, updateErr)
+	}
+	return err
+}
+
+// processPrinter sends the jobs of one printer in the order they were
+// queued. It stops at the first job that is waiting for a retry or being sent
+// by another instance, so nothing queued after it prints first.
+func processPrinter(ctx context.Context, printerId string) {
+	for {
+		var job models.PrintJob
+		err := printJobCollection.FindOne(ctx,
+			bson.M{"printer_id": printerId, "status": bson.M{"$in": bson.A{PrintQueued, PrintPrinting}}},
+			options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}),
+		).Decode(&job)
+		if err == mongo.ErrNoDocuments {
+			return
+		}
+		if err != nil {
+			log.Printf("print queue could not fetch a job for printer %s: %v", printerId, err)
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		if job.Status != PrintQueued || job.Next_attempt_at.After(now) {
+			return
+		}
+
+		claimed, err := printJobCollection.UpdateOne(ctx,
+			bson.M{"print_job_id": job.Print_job_id, "status": PrintQueued},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: PrintPrinting}, {Key: "updated_at", Value: now}}}},
+		)
+		if err != nil {
+			log.Printf("print queue could not claim job %s: %v", job.Print_job_id, err)
+			return
+		}
+		if claimed.ModifiedCount == 0 {
+			return
+		}
+
+		if err := sendPrintJob(ctx, job); err != nil {
+			return
+		}
+	}
+}
+
+// processPrintJobs sends the jobs that are due, each printer on its own so a
+// printer that is off does not hold up the others. Jobs left PRINTING by a
+// crash are queued again after a minute.
+func processPrintJobs(ctx context.Context) {
+	stale, _ := time.Parse(time.RFC3339, time.Now().Add(-time.Minute).Format(time.RFC3339))
+	if _, err := printJobCollection.UpdateMany(ctx,
+		bson.M{"status": PrintPrinting, "updated_at": bson.M{"$lt": stale}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: PrintQueued}}}},
+	); err != nil {
+		log.Printf("print queue could not requeue stale jobs: %v", err)
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	printerIds, err := printJobCollection.Distinct(ctx, "printer_id", bson.M{"status": PrintQueued, "next_attempt_at": bson.M{"$lte": now}})
+	if err != nil {
+		log.Printf("print queue could not list the printers with jobs due: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, printerId := range printerIds {
+		printerId, ok := printerId.(string)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			processPrinter(ctx, printerId)
+		}()
+	}
+	wg.Wait()
+}
+
+// StartPrintQueue sends queued print jobs in the background, checking every
+// PRINT_QUEUE_INTERVAL.
+func StartPrintQueue() {
+	interval, err := time.ParseDuration(os.Getenv("PRINT_QUEUE_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			processPrintJobs(ctx)
+			cancel()
+		}
+	}()
+}
+
+// orderTickets builds a ticket per station for the items of an order, with
+// the ids of the items on each.
+func orderTickets(ctx context.Context, order models.Order, reprint bool) (map[string]*printing.Ticket, map[string][]string, error) {
+	filter := notDeleted(bson.M{"order_id": order.Order_id, "void": nil})
+	if !reprint {
+		filter["sent_at"] = nil
+	}
+	result, err := OrderItemCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, nil, err
+	}
+	var orderItems []models.OrderItem
+	if err = result.All(ctx, &orderItems); err != nil {
+		return nil, nil, err
+	}
+
+	foodIds := []string{}
+	for _, item := range orderItems {
+		if item.Food_id != nil {
+			foodIds = append(foodIds, *item.Food_id)
+		}
+	}
+	result, err = foodCollection.Find(ctx, bson.M{"food_id": bson.M{"$in": foodIds}})
+	if err != nil {
+		return nil, nil, err
+	}
+	var foods []models.Food
+	if err = result.All(ctx, &foods); err != nil {
+		return nil, nil, err
+	}
+	foodsById := map[string]models.Food{}
+	for _, food := range foods {
+		foodsById[food.Food_id] = food
+	}
+
+	table := "-"
+	if order.Table_id != nil {
+		var tableRecord models.Table
+		if tableCollection.FindOne(ctx, bson.M{"table_id": order.Table_id}).Decode(&tableRecord) == nil && tableRecord.Table_number != nil {
+			table = strconv.Itoa(*tableRecord.Table_number)
+		}
+	}
+	server := ""
+	if order.Server_id != nil {
+		var user models.User
+		if userCollection.FindOne(ctx, bson.M{"user_id": order.Server_id}).Decode(&user) == nil && user.First_name != nil {
+			server = *user.First_name
+		}
+	}
+
+	tickets := map[string]*printing.Ticket{}
+	itemIds := map[string][]string{}
+	issuedAt := time.Now()
+	for _, item := range orderItems {
+		food := models.Food{}
+		if item.Food_id != nil {
+			food = foodsById[*item.Food_id]
+		}
+		station := stationOf(food)
+
+		ticket, ok := tickets[station]
+		if !ok {
+			ticket = &printing.Ticket{Station: station, Order_id: order.Order_id, Table: table, Server: server, Reprint: reprint, Issued_at: issuedAt}
+			tickets[station] = ticket
+		}
+
+		ticketItem := printing.TicketItem{Name: "Item", Quantity: 1, Modifiers: item.Modifiers}
+		if food.Name != nil {
+			ticketItem.Name = *food.Name
+		}
+		if item.Quantity != nil {
+			ticketItem.Size = *item.Quantity
+		}
+		if item.Notes != nil {
+			ticketItem.Notes = *item.Notes
+		}
+		ticket.AddItem(ticketItem)
+		itemIds[station] = append(itemIds[station], item.Order_item_id)
+	}
+	return tickets, itemIds, nil
+}
+
+// SendOrderTickets prints a kitchen ticket for the items of an order on every
+// printer serving their station. Items of stations no printer serves are
+// listed back and stay unsent.
+func SendOrderTickets() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request TicketRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.BindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		var order models.Order
+		err := orderCollection.FindOne(ctx, notDeleted(bson.M{"order_id": c.Param("order_id")})).Decode(&order)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(printErrorStatus(errOrderNotFound), gin.H{"error": errOrderNotFound.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the order"})
+			return
+		}
+
+		tickets, itemIds, err := orderTickets(ctx, order, request.Reprint)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the tickets"})
+			return
+		}
+		if len(tickets) == 0 {
+			c.JSON(http.StatusOK, gin.H{"message": "no items are waiting to be sent", "jobs": []models.PrintJob{}, "unrouted": []string{}})
+			return
+		}
+
+		printers, err := activePrinters(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the printers"})
+			return
+		}
+
+		jobs := []models.PrintJob{}
+		sent := []string{}
+		unrouted := []string{}
+		for station, ticket := range tickets {
+			station := station
+			routed := false
+			for _, printer := range printers {
+				if !servesStation(printer, station) {
+					continue
+				}
+				job, err := queuePrintJob(ctx, c, printer, PrintTicket, order.Order_id, &station, printing.RenderTicket(*ticket, printerColumns(printer)))
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while queueing the tickets"})
+					return
+				}
+				jobs = append(jobs, job)
+				routed = true
+			}
+			if routed {
+				sent = append(sent, itemIds[station]...)
+			} else {
+				unrouted = append(unrouted, itemIds[station]...)
+			}
+		}
+
+		if len(sent) > 0 && !request.Reprint {
+			now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+			if _, err := OrderItemCollection.UpdateMany(ctx, bson.M{"order_item_id": bson.M{"$in": sent}}, bson.D{{Key: "$set", Value: bson.D{{Key: "sent_at", Value: now}}}}); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "the tickets were queued but the items could not be marked as sent"})
+				return
+			}
+		}
+
+		status := http.StatusCreated
+		if len(jobs) == 0 {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"jobs": jobs, "unrouted": unrouted})
+	}
+}
+
+// PrintInvoiceReceipt queues the receipt of an invoice on a receipt printer.
+func PrintInvoiceReceipt() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request PrintReceiptRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.BindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		invoice, err := findInvoice(ctx, c.Param("invoice_id"))
+		if err != nil {
+			c.JSON(printErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		printers, err := activePrinters(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the printers"})
+			return
+		}
+		var printer *models.Printer
+		for i := range printers {
+			if request.Printer_id != nil && printers[i].Printer_id == *request.Printer_id {
+				printer = &printers[i]
+				break
+			}
+			if request.Printer_id == nil && printers[i].Receipts {
+				printer = &printers[i]
+				break
+			}
+		}
+		if printer == nil {
+			err := errNoReceiptPrinter
+			if request.Printer_id != nil {
+				err = errPrinterNotFound
+			}
+			c.JSON(printErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		bill, err := buildReceipt(ctx, invoice)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the receipt"})
+			return
+		}
+
+		job, err := queuePrintJob(ctx, c, *printer, PrintReceipt, invoice.Invoice_id, nil, printing.RenderReceipt(bill, printerColumns(*printer)))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while queueing the receipt"})
+			return
+		}
+		c.JSON(http.StatusCreated, job)
+	}
+}
+
+// GetPrintJobs lists the print jobs, filtered by ?status= and ?printer_id=.
+func GetPrintJobs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := bson.M{}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = strings.ToUpper(status)
+		}
+		if printerId := c.Query("printer_id"); printerId != "" {
+			filter["printer_id"] = printerId
+		}
+
+		page, err := helper.Paginate(ctx, printJobCollection, filter, params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the print jobs"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// RetryPrintJob queues a failed print job again with a fresh set of attempts.
+func RetryPrintJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		jobId := c.Param("print_job_id")
+
+		var job models.PrintJob
+		err := printJobCollection.FindOne(ctx, bson.M{"print_job_id": jobId}).Decode(&job)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "print job was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the print job"})
+			return
+		}
+		if job.Status != PrintFailed {
+			c.JSON(printErrorStatus(errJobNotFailed), gin.H{"error": errJobNotFailed.Error()})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		var updatedJob models.PrintJob
+		err = printJobCollection.FindOneAndUpdate(ctx,
+			bson.M{"print_job_id": jobId, "status": PrintFailed},
+			bson.D{
+				{Key: "$set", Value: bson.D{{Key: "status", Value: PrintQueued}, {Key: "attempts", Value: 0}, {Key: "next_attempt_at", Value: now}, {Key: "updated_at", Value: now}}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedJob)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("print job %s is already being retried", jobId)})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while retrying the print job"})
+			return
+		}
+
+		c.JSON(http.StatusOK, updatedJob)
+	}
+}
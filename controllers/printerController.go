@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/printing"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var printerCollection *mongo.Collection = database.OpenCollection(database.Client, "printer")
+
+// activePrinters are the printers tickets and receipts can be routed to.
+func activePrinters(ctx context.Context) ([]models.Printer, error) {
+	result, err := printerCollection.Find(ctx, notDeleted(bson.M{"paused": false}))
+	if err != nil {
+		return nil, err
+	}
+
+	var printers []models.Printer
+	if err = result.All(ctx, &printers); err != nil {
+		return nil, err
+	}
+	return printers, nil
+}
+
+func GetPrinters() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := helper.Paginate(ctx, printerCollection, notDeleted(bson.M{}), params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the printers"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetPrinter() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var printer models.Printer
+		err := printerCollection.FindOne(ctx, notDeleted(bson.M{"printer_id": c.Param("printer_id")})).Decode(&printer)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "printer was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the printer"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.ETag(printer.Version)) {
+			return
+		}
+		c.JSON(http.StatusOK, printer)
+	}
+}
+
+func CreatePrinter() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var printer models.Printer
+
+		if err := c.BindJSON(&printer); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validatorErr := validate.Struct(printer); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		if _, err := printing.NewOutput(*printer.Connection, *printer.Address); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		printer.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		printer.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		printer.ID = primitive.NewObjectID()
+		printer.Printer_id = printer.ID.Hex()
+		printer.Deleted_at = nil
+		printer.Deleted_by = nil
+		printer.Version = 1
+
+		if _, insertErr := printerCollection.InsertOne(ctx, printer); insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the printer"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(printer.Version))
+		c.JSON(http.StatusCreated, printer)
+	}
+}
+
+func UpdatePrinter() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		printerId := c.Param("printer_id")
+		filter := notDeleted(bson.M{"printer_id": printerId})
+
+		var printer models.Printer
+		err := printerCollection.FindOne(ctx, filter).Decode(&printer)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "printer was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the printer"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(printer.Version)) {
+			return
+		}
+
+		var patched models.Printer
+		if err := applyMergePatch(c, printer, &patched); err != nil {
+			c.JSON(patchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		patched.ID = printer.ID
+		patched.Printer_id = printer.Printer_id
+		patched.Created_at = printer.Created_at
+		patched.Deleted_at = printer.Deleted_at
+		patched.Deleted_by = printer.Deleted_by
+		patched.Version = printer.Version + 1
+
+		if validatorErr := validate.Struct(patched); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		if _, err := printing.NewOutput(*patched.Connection, *patched.Address); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		patched.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedPrinter models.Printer
+		err = printerCollection.FindOneAndReplace(
+			ctx,
+			matchVersion(filter, printer.Version),
+			patched,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		).Decode(&updatedPrinter)
+
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the printer was modified by someone else, reload it and try again"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "printer failed to update"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedPrinter.Version))
+		c.JSON(http.StatusOK, updatedPrinter)
+	}
+}
+
+func DeletePrinter() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		printerId := c.Param("printer_id")
+
+		var printer models.Printer
+		err := printerCollection.FindOne(ctx, notDeleted(bson.M{"printer_id": printerId})).Decode(&printer)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "printer was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "printer failed to delete"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(printer.Version)) {
+			return
+		}
+
+		result, err := archiveRecord(ctx, printerCollection, matchVersion(bson.M{"printer_id": printerId}, printer.Version), c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "printer failed to delete"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the printer was modified by someone else, reload it and try again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "printer deleted", "printer_id": printerId})
+	}
+}
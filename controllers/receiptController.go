@@ -0,0 +1,334 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/receipt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var receiptTemplateCollection *mongo.Collection = database.OpenCollection(database.Client, "receipt_template")
+
+// receiptTemplate is the template of a branch. Branches without one print a
+// plain receipt under RESTAURANT_NAME.
+func receiptTemplate(ctx context.Context, branch string) (models.ReceiptTemplate, error) {
+	var template models.ReceiptTemplate
+	err := receiptTemplateCollection.FindOne(ctx, notDeleted(bson.M{"branch": branch})).Decode(&template)
+	if err != mongo.ErrNoDocuments {
+		return template, err
+	}
+
+	name := os.Getenv("RESTAURANT_NAME")
+	if name == "" {
+		name = "Restaurant"
+	}
+	paper := receipt.RECEIPT
+	return models.ReceiptTemplate{
+		Branch:          &branch,
+		Restaurant_name: &name,
+		Footer_lines:    []string{"Thank you for your visit"},
+		Paper:           &paper,
+	}, nil
+}
+
+// buildReceipt lays out the receipt of an invoice with the template of the
+// branch that issued it.
+func buildReceipt(ctx context.Context, invoice models.Invoice) (receipt.Receipt, error) {
+	branch := helper.BranchCode()
+	if invoice.Branch != nil {
+		branch = *invoice.Branch
+	}
+	template, err := receiptTemplate(ctx, branch)
+	if err != nil {
+		return receipt.Receipt{}, err
+	}
+
+	breakdown, allOrderItems, err := priceOrder(ctx, invoice.Order_id)
+	if err != nil {
+		return receipt.Receipt{}, err
+	}
+	if invoiceFrozen(invoice) {
+		breakdown = storedBreakdown(invoice)
+	}
+
+	var order primitive.M
+	if len(allOrderItems) > 0 {
+		order = allOrderItems[0]
+	}
+	return receipt.Build(template, invoice, breakdown, order), nil
+}
+
+// GetInvoicePDF renders the receipt of an invoice as a PDF.
+func GetInvoicePDF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		invoice, err := findInvoice(ctx, c.Param("invoice_id"))
+		if err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		bill, err := buildReceipt(ctx, invoice)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the receipt"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(bill)) {
+			return
+		}
+
+		document, err := receipt.PDF(bill)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while rendering the receipt"})
+			return
+		}
+
+		name := invoice.Invoice_id
+		if invoice.Invoice_number != nil {
+			name = *invoice.Invoice_number
+		}
+		c.Header("Content-Disposition", `inline; filename="`+name+`.pdf"`)
+		c.Data(http.StatusOK, "application/pdf", document)
+	}
+}
+
+func GetReceiptTemplates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := helper.Paginate(ctx, receiptTemplateCollection, notDeleted(bson.M{}), params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the receipt templates"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetReceiptTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var template models.ReceiptTemplate
+		err := receiptTemplateCollection.FindOne(ctx, notDeleted(bson.M{"receipt_template_id": c.Param("receipt_template_id")})).Decode(&template)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "receipt template was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the receipt template"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.ETag(template.Version)) {
+			return
+		}
+		c.JSON(http.StatusOK, template)
+	}
+}
+
+func CreateReceiptTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var template models.ReceiptTemplate
+
+		if err := c.BindJSON(&template); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validatorErr := validate.Struct(template); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+		if err := receipt.CheckTemplates(template); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		branchCount, err := receiptTemplateCollection.CountDocuments(ctx, notDeleted(bson.M{"branch": template.Branch}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the receipt template"})
+			return
+		}
+		if branchCount > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "this branch already has a receipt template"})
+			return
+		}
+
+		template.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		template.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		template.ID = primitive.NewObjectID()
+		template.Receipt_template_id = template.ID.Hex()
+		template.Deleted_at = nil
+		template.Deleted_by = nil
+		template.Version = 1
+
+		if _, insertErr := receiptTemplateCollection.InsertOne(ctx, template); insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the receipt template"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(template.Version))
+		c.JSON(http.StatusCreated, template)
+	}
+}
+
+func UpdateReceiptTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		templateId := c.Param("receipt_template_id")
+		filter := notDeleted(bson.M{"receipt_template_id": templateId})
+
+		var template models.ReceiptTemplate
+		err := receiptTemplateCollection.FindOne(ctx, filter).Decode(&template)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "receipt template was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the receipt template"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(template.Version)) {
+			return
+		}
+
+		var patched models.ReceiptTemplate
+		if err := applyMergePatch(c, template, &patched); err != nil {
+			c.JSON(patchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		patched.ID = template.ID
+		patched.Receipt_template_id = template.Receipt_template_id
+		patched.Created_at = template.Created_at
+		patched.Deleted_at = template.Deleted_at
+		patched.Deleted_by = template.Deleted_by
+		patched.Version = template.Version + 1
+
+		if validatorErr := validate.Struct(patched); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+		if err := receipt.CheckTemplates(patched); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if *patched.Branch != *template.Branch {
+			branchCount, err := receiptTemplateCollection.CountDocuments(ctx, notDeleted(bson.M{"branch": patched.Branch}))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "receipt template failed to update"})
+				return
+			}
+			if branchCount > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "this branch already has a receipt template"})
+				return
+			}
+		}
+
+		patched.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedTemplate models.ReceiptTemplate
+		err = receiptTemplateCollection.FindOneAndReplace(
+			ctx,
+			matchVersion(filter, template.Version),
+			patched,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		).Decode(&updatedTemplate)
+
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the receipt template was modified by someone else, reload it and try again"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "receipt template failed to update"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedTemplate.Version))
+		c.JSON(http.StatusOK, updatedTemplate)
+	}
+}
+
+func DeleteReceiptTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		templateId := c.Param("receipt_template_id")
+
+		var template models.ReceiptTemplate
+		err := receiptTemplateCollection.FindOne(ctx, notDeleted(bson.M{"receipt_template_id": templateId})).Decode(&template)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "receipt template was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "receipt template failed to delete"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(template.Version)) {
+			return
+		}
+
+		result, err := archiveRecord(ctx, receiptTemplateCollection, matchVersion(bson.M{"receipt_template_id": templateId}, template.Version), c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "receipt template failed to delete"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the receipt template was modified by someone else, reload it and try again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "receipt template deleted", "receipt_template_id": templateId})
+	}
+}
@@ -0,0 +1,303 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/notifier"
+	"golang-restaurant-backend-app/receipt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var receiptDeliveryCollection *mongo.Collection = database.OpenCollection(database.Client, "receipt_delivery")
+
+var receiptNotifier notifier.Notifier = notifier.FromEnv()
+
+const (
+	DeliveryEmail = "EMAIL"
+	DeliverySMS   = "SMS"
+
+	DeliveryQueued  = "QUEUED"
+	DeliverySending = "SENDING"
+	DeliverySent    = "SENT"
+	DeliveryFailed  = "FAILED"
+)
+
+var errDeliveryNotFailed = errors.New("only failed deliveries can be retried")
+
+// deliveryMaxAttempts is how many times a receipt is sent before it is given
+// up, from DELIVERY_MAX_ATTEMPTS.
+func deliveryMaxAttempts() int {
+	if attempts, err := strconv.Atoi(os.Getenv("DELIVERY_MAX_ATTEMPTS")); err == nil && attempts > 0 {
+		return attempts
+	}
+	return 5
+}
+
+// deliveryMessage is the notification a delivery sends.
+func deliveryMessage(delivery models.ReceiptDelivery) notifier.Message {
+	message := notifier.Message{Channel: notifier.SMS, To: *delivery.To, Subject: delivery.Subject, Body: delivery.Body}
+	if *delivery.Channel == DeliveryEmail {
+		message.Channel = notifier.EMAIL
+		if len(delivery.Attachment) > 0 {
+			message.Attachments = []notifier.Attachment{{
+				Name:         "receipt-" + delivery.Invoice_id + ".pdf",
+				Content_type: "application/pdf",
+				Data:         delivery.Attachment,
+			}}
+		}
+	}
+	return message
+}
+
+// sendDelivery hands a delivery to the notifier and records how it went.
+func sendDelivery(ctx context.Context, delivery models.ReceiptDelivery) {
+	err := receiptNotifier.Send(ctx, deliveryMessage(delivery))
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	set := bson.D{{Key: "updated_at", Value: now}, {Key: "attempts", Value: delivery.Attempts + 1}}
+	switch {
+	case err == nil:
+		set = append(set, bson.E{Key: "status", Value: DeliverySent}, bson.E{Key: "sent_at", Value: now}, bson.E{Key: "last_error", Value: nil})
+	case delivery.Attempts+1 >= deliveryMaxAttempts():
+		log.Printf("receipt delivery %s to %s failed for good: %v", delivery.Receipt_delivery_id, *delivery.To, err)
+		set = append(set, bson.E{Key: "status", Value: DeliveryFailed}, bson.E{Key: "last_error", Value: err.Error()})
+	default:
+		set = append(set, bson.E{Key: "status", Value: DeliveryQueued}, bson.E{Key: "last_error", Value: err.Error()},
+			bson.E{Key: "next_attempt_at", Value: now.Add(retryDelay(delivery.Attempts + 1))})
+	}
+
+	if _, err := receiptDeliveryCollection.UpdateOne(ctx, bson.M{"receipt_delivery_id": delivery.Receipt_delivery_id}, bson.D{
+		{Key: "$set", Value: set},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+	}); err != nil {
+		log.Printf("receipt delivery %s could not be updated: %v", delivery.Receipt_delivery_id, err)
+	}
+}
+
+// processDeliveries sends every receipt that is due. Deliveries left SENDING
+// by a crash are queued again after a minute.
+func processDeliveries(ctx context.Context) {
+	stale, _ := time.Parse(time.RFC3339, time.Now().Add(-time.Minute).Format(time.RFC3339))
+	if _, err := receiptDeliveryCollection.UpdateMany(ctx,
+		bson.M{"status": DeliverySending, "updated_at": bson.M{"$lt": stale}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: DeliveryQueued}}}},
+	); err != nil {
+		log.Printf("receipt deliveries could not requeue stale deliveries: %v", err)
+	}
+
+	for {
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		var delivery models.ReceiptDelivery
+		err := receiptDeliveryCollection.FindOneAndUpdate(ctx,
+			bson.M{"status": DeliveryQueued, "next_attempt_at": bson.M{"$lte": now}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: DeliverySending}, {Key: "updated_at", Value: now}}}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetReturnDocument(options.After),
+		).Decode(&delivery)
+		if err == mongo.ErrNoDocuments {
+			return
+		}
+		if err != nil {
+			log.Printf("receipt deliveries could not fetch a delivery: %v", err)
+			return
+		}
+		sendDelivery(ctx, delivery)
+	}
+}
+
+// StartReceiptDeliveries sends queued receipts in the background, checking
+// every DELIVERY_INTERVAL.
+func StartReceiptDeliveries() {
+	interval, err := time.ParseDuration(os.Getenv("DELIVERY_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			processDeliveries(ctx)
+			cancel()
+		}
+	}()
+}
+
+// SendInvoiceReceipt queues the receipt of an invoice for a guest, by email
+// with the PDF attached or as a short text message.
+func SendInvoiceReceipt() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var delivery models.ReceiptDelivery
+		if err := c.BindJSON(&delivery); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if delivery.Channel != nil {
+			channel := strings.ToUpper(*delivery.Channel)
+			delivery.Channel = &channel
+		}
+		if validatorErr := validate.Struct(delivery); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+		rule := "e164"
+		if *delivery.Channel == DeliveryEmail {
+			rule = "email"
+		}
+		if err := validate.Var(*delivery.To, rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an email address for EMAIL and a phone number like +4915112345678 for SMS"})
+			return
+		}
+
+		invoice, err := findInvoice(ctx, c.Param("invoice_id"))
+		if err != nil {
+			c.JSON(paymentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		bill, err := buildReceipt(ctx, invoice)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the receipt"})
+			return
+		}
+		branch := helper.BranchCode()
+		if invoice.Branch != nil {
+			branch = *invoice.Branch
+		}
+		template, err := receiptTemplate(ctx, branch)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the receipt"})
+			return
+		}
+		messages, err := receipt.RenderMessages(template, bill)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "the message templates of this branch are broken: " + err.Error()})
+			return
+		}
+
+		if *delivery.Channel == DeliveryEmail {
+			delivery.Subject = messages.Email_subject
+			delivery.Body = messages.Email_body
+			if delivery.Attachment, err = receipt.PDF(bill); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while rendering the receipt"})
+				return
+			}
+		} else {
+			delivery.Body = messages.SMS_body
+		}
+
+		delivery.ID = primitive.NewObjectID()
+		delivery.Receipt_delivery_id = delivery.ID.Hex()
+		delivery.Invoice_id = invoice.Invoice_id
+		delivery.Status = DeliveryQueued
+		delivery.Attempts = 0
+		delivery.Last_error = nil
+		delivery.Sent_at = nil
+		delivery.Created_by = c.GetString("uid")
+		delivery.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		delivery.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		delivery.Next_attempt_at = delivery.Created_at
+		delivery.Version = 1
+
+		if _, err := receiptDeliveryCollection.InsertOne(ctx, delivery); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while queueing the receipt"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, delivery)
+	}
+}
+
+// GetInvoiceDeliveries lists the receipts sent for an invoice, newest first.
+func GetInvoiceDeliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		result, err := receiptDeliveryCollection.Find(ctx, bson.M{"invoice_id": c.Param("invoice_id")},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the deliveries"})
+			return
+		}
+		deliveries := []models.ReceiptDelivery{}
+		if err = result.All(ctx, &deliveries); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the deliveries"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(deliveries)) {
+			return
+		}
+		c.JSON(http.StatusOK, deliveries)
+	}
+}
+
+// RetryReceiptDelivery queues a failed delivery again with a fresh set of
+// attempts.
+func RetryReceiptDelivery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		deliveryId := c.Param("receipt_delivery_id")
+
+		var delivery models.ReceiptDelivery
+		err := receiptDeliveryCollection.FindOne(ctx, bson.M{"receipt_delivery_id": deliveryId}).Decode(&delivery)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "receipt delivery was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the receipt delivery"})
+			return
+		}
+		if delivery.Status != DeliveryFailed {
+			c.JSON(http.StatusConflict, gin.H{"error": errDeliveryNotFailed.Error()})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		var updatedDelivery models.ReceiptDelivery
+		err = receiptDeliveryCollection.FindOneAndUpdate(ctx,
+			bson.M{"receipt_delivery_id": deliveryId, "status": DeliveryFailed},
+			bson.D{
+				{Key: "$set", Value: bson.D{{Key: "status", Value: DeliveryQueued}, {Key: "attempts", Value: 0}, {Key: "next_attempt_at", Value: now}, {Key: "updated_at", Value: now}}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedDelivery)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusConflict, gin.H{"error": "the receipt delivery is already being retried"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while retrying the receipt delivery"})
+			return
+		}
+
+		c.JSON(http.StatusOK, updatedDelivery)
+	}
+}
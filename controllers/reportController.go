@@ -0,0 +1,365 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/money"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// reportRange reads the from and to dates of a report, both inclusive. It
+// defaults to today.
+func reportRange(c *gin.Context) (time.Time, time.Time, error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	from, to := today, today
+
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = time.ParseInLocation("2006-01-02", value, time.Local); err != nil {
+			return from, to, errors.New("from must look like 2006-01-02")
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.ParseInLocation("2006-01-02", value, time.Local); err != nil {
+			return from, to, errors.New("to must look like 2006-01-02")
+		}
+	}
+	if to.Before(from) {
+		return from, to, errors.New("to must not be before from")
+	}
+
+	return from, to.AddDate(0, 0, 1), nil
+}
+
+// paidInvoices matches the invoices settled in the date range, at a branch
+// when one is given. An invoice is paid when its last payment was taken,
+// later writes to it do not move it.
+func paidInvoices(from time.Time, to time.Time, branch string) []bson.D {
+	match := bson.D{
+		{Key: "deleted_at", Value: nil},
+		{Key: "payment_status", Value: "PAID"},
+		{Key: "payments.paid_at", Value: bson.D{{Key: "$gte", Value: from}}},
+	}
+	if branch != "" {
+		match = append(match, bson.E{Key: "branch", Value: branch})
+	}
+	return []bson.D{
+		{{Key: "$match", Value: match}},
+		{{Key: "$addFields", Value: bson.D{{Key: "paid_at", Value: bson.D{{Key: "$max", Value: "$payments.paid_at"}}}}}},
+		{{Key: "$match", Value: bson.D{{Key: "paid_at", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}}}}},
+	}
+}
+
+// issuedCreditNotes matches the credit notes issued in the date range, only
+// those on the invoices of a branch when one is given.
+func issuedCreditNotes(from time.Time, to time.Time, branch string) []bson.D {
+	stages := []bson.D{
+		{{Key: "$match", Value: bson.D{
+			{Key: "created_at", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+		}}},
+	}
+	if branch != "" {
+		stages = append(stages, branchInvoiceLookup(branch)...)
+	}
+	return stages
+}
+
+// GetTaxReport sums the tax collected on invoices paid in the date range, per
+// tax rate, less the tax on credit notes issued in the range. It covers one
+// branch with ?branch.
+func GetTaxReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		from, to, err := reportRange(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		branch := c.Query("branch")
+
+		unwindStage := bson.D{{Key: "$unwind", Value: "$tax_lines"}}
+		groupStage := bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "code", Value: "$tax_lines.code"},
+				{Key: "name", Value: "$tax_lines.name"},
+				{Key: "rate", Value: "$tax_lines.rate"},
+				{Key: "inclusive", Value: "$tax_lines.inclusive"},
+			}},
+			{Key: "taxable_amount", Value: bson.D{{Key: "$sum", Value: money.Field("$tax_lines.taxable_amount")}}},
+			{Key: "tax_amount", Value: bson.D{{Key: "$sum", Value: money.Field("$tax_lines.amount")}}},
+			{Key: "invoice_count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}}
+		projectStage := bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "code", Value: "$_id.code"},
+			{Key: "name", Value: "$_id.name"},
+			{Key: "rate", Value: "$_id.rate"},
+			{Key: "inclusive", Value: "$_id.inclusive"},
+			{Key: "taxable_amount", Value: "$taxable_amount"},
+			{Key: "tax_amount", Value: "$tax_amount"},
+			{Key: "invoice_count", Value: 1},
+		}}}
+		sortStage := bson.D{{Key: "$sort", Value: bson.D{{Key: "code", Value: 1}, {Key: "rate", Value: 1}}}}
+
+		pipeline := append(mongo.Pipeline{}, paidInvoices(from, to, branch)...)
+		pipeline = append(pipeline, unwindStage, groupStage, projectStage, sortStage)
+		result, err := invoiceCollection.Aggregate(ctx, pipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the tax report"})
+			return
+		}
+
+		var taxes []bson.M
+		if err = result.All(ctx, &taxes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the tax report"})
+			return
+		}
+		money.Decimals(taxes)
+
+		creditPipeline := append(mongo.Pipeline{}, issuedCreditNotes(from, to, branch)...)
+		creditPipeline = append(creditPipeline, unwindStage, groupStage, projectStage, sortStage)
+		result, err = creditNoteCollection.Aggregate(ctx, creditPipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the tax report"})
+			return
+		}
+
+		var credits []bson.M
+		if err = result.All(ctx, &credits); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the tax report"})
+			return
+		}
+		money.Decimals(credits)
+
+		// credits are matched to the sales of the same rate, or listed on
+		// their own when the sale fell in an earlier range
+		taxKey := func(row bson.M) string {
+			return fmt.Sprint(row["code"], "|", row["name"], "|", row["rate"], "|", row["inclusive"])
+		}
+		rows := map[string]bson.M{}
+		for _, tax := range taxes {
+			tax["credited_tax_amount"] = money.Zero()
+			rows[taxKey(tax)] = tax
+		}
+		for _, credit := range credits {
+			row, ok := rows[taxKey(credit)]
+			if !ok {
+				row = bson.M{"code": credit["code"], "name": credit["name"], "rate": credit["rate"], "inclusive": credit["inclusive"],
+					"taxable_amount": money.Zero(), "tax_amount": money.Zero(), "invoice_count": 0, "credited_tax_amount": money.Zero()}
+				rows[taxKey(credit)] = row
+				taxes = append(taxes, row)
+			}
+			row["credited_tax_amount"] = money.FromValue(credit["tax_amount"])
+		}
+
+		total, credited := money.Zero(), money.Zero()
+		for _, tax := range taxes {
+			amount := money.FromValue(tax["tax_amount"])
+			credit := money.FromValue(tax["credited_tax_amount"])
+			tax["net_tax_amount"] = amount.Sub(credit)
+			total = total.Add(amount)
+			credited = credited.Add(credit)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"from":               from.Format("2006-01-02"),
+			"to":                 to.AddDate(0, 0, -1).Format("2006-01-02"),
+			"branch":             branch,
+			"taxes":              taxes,
+			"tax_total":          total,
+			"credited_tax_total": credited,
+			"net_tax_total":      total.Sub(credited),
+		})
+	}
+}
+
+// GetTipReport sums the tips on invoices paid in the date range, per server,
+// at one branch with ?branch.
+func GetTipReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		from, to, err := reportRange(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		branch := c.Query("branch")
+
+		tippedStage := bson.D{{Key: "$match", Value: bson.D{{Key: money.Field("tip"), Value: bson.D{{Key: "$gt", Value: 0}}}}}}
+		groupStage := bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$tip_server_id"},
+			{Key: "tip_total", Value: bson.D{{Key: "$sum", Value: money.Field("$tip")}}},
+			{Key: "invoice_count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}}
+		projectStage := bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "server_id", Value: "$_id"},
+			{Key: "tip_total", Value: "$tip_total"},
+			{Key: "invoice_count", Value: 1},
+		}}}
+		sortStage := bson.D{{Key: "$sort", Value: bson.D{{Key: "tip_total", Value: -1}}}}
+
+		pipeline := append(mongo.Pipeline{}, paidInvoices(from, to, branch)...)
+		pipeline = append(pipeline, tippedStage, groupStage, projectStage, sortStage)
+		result, err := invoiceCollection.Aggregate(ctx, pipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the tip report"})
+			return
+		}
+
+		var tips []bson.M
+		if err = result.All(ctx, &tips); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the tip report"})
+			return
+		}
+		money.Decimals(tips)
+
+		total := money.Zero()
+		for _, tip := range tips {
+			total = total.Add(money.FromValue(tip["tip_total"]))
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"from":      from.Format("2006-01-02"),
+			"to":        to.AddDate(0, 0, -1).Format("2006-01-02"),
+			"branch":    branch,
+			"servers":   tips,
+			"tip_total": total,
+		})
+	}
+}
+
+// GetSalesReport sums the invoices paid in the date range and the credit
+// notes issued in it. Refunds and voids are taken off the net sales, the
+// invoices themselves are left as they were billed. It covers one branch with
+// ?branch.
+func GetSalesReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		from, to, err := reportRange(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		branch := c.Query("branch")
+
+		salesPipeline := append(mongo.Pipeline{}, paidInvoices(from, to, branch)...)
+		salesPipeline = append(salesPipeline,
+			bson.D{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: nil},
+				{Key: "invoice_count", Value: bson.D{{Key: "$sum", Value: 1}}},
+				{Key: "total", Value: bson.D{{Key: "$sum", Value: money.Field("$total")}}},
+				{Key: "tips", Value: bson.D{{Key: "$sum", Value: money.Field("$tip")}}},
+				{Key: "discounts", Value: bson.D{{Key: "$sum", Value: money.Field("$discount_total")}}},
+				{Key: "service", Value: bson.D{{Key: "$sum", Value: money.Field("$service_total")}}},
+				{Key: "tax", Value: bson.D{{Key: "$sum", Value: money.Field("$tax_total")}}},
+			}}},
+		)
+		result, err := invoiceCollection.Aggregate(ctx, salesPipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the sales report"})
+			return
+		}
+		var sales []bson.M
+		if err = result.All(ctx, &sales); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the sales report"})
+			return
+		}
+
+		creditPipeline := append(mongo.Pipeline{}, issuedCreditNotes(from, to, branch)...)
+		creditPipeline = append(creditPipeline,
+			bson.D{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: "$kind"},
+				{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+				{Key: "amount", Value: bson.D{{Key: "$sum", Value: money.Field("$amount")}}},
+				{Key: "refunded", Value: bson.D{{Key: "$sum", Value: money.Field("$refunded")}}},
+			}}},
+			bson.D{{Key: "$project", Value: bson.D{
+				{Key: "_id", Value: 0},
+				{Key: "kind", Value: "$_id"},
+				{Key: "count", Value: 1},
+				{Key: "amount", Value: "$amount"},
+				{Key: "refunded", Value: "$refunded"},
+			}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "kind", Value: 1}}}},
+		)
+		result, err = creditNoteCollection.Aggregate(ctx, creditPipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the sales report"})
+			return
+		}
+		var credits []bson.M
+		if err = result.All(ctx, &credits); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while building the sales report"})
+			return
+		}
+		money.Decimals(credits)
+
+		totals := bson.M{}
+		if len(sales) > 0 {
+			totals = sales[0]
+		}
+		amount := func(row bson.M, key string) money.Money {
+			return money.FromValue(row[key])
+		}
+		gross := amount(totals, "total").Sub(amount(totals, "tips"))
+		credited, refunded := money.Zero(), money.Zero()
+		for _, credit := range credits {
+			credited = credited.Add(amount(credit, "amount"))
+			refunded = refunded.Add(amount(credit, "refunded"))
+		}
+		// the driver decodes the count as int32 or int64 depending on its size
+		var invoiceCount int64
+		switch count := totals["invoice_count"].(type) {
+		case int32:
+			invoiceCount = int64(count)
+		case int64:
+			invoiceCount = count
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"from":           from.Format("2006-01-02"),
+			"to":             to.AddDate(0, 0, -1).Format("2006-01-02"),
+			"branch":         branch,
+			"invoice_count":  invoiceCount,
+			"gross_sales":    gross,
+			"discount_total": amount(totals, "discounts"),
+			"service_total":  amount(totals, "service"),
+			"tax_total":      amount(totals, "tax"),
+			"tip_total":      amount(totals, "tips"),
+			"credits":        credits,
+			"credit_total":   credited,
+			"refund_total":   refunded,
+			"net_sales":      gross.Sub(credited),
+		})
+	}
+}
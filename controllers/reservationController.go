@@ -0,0 +1,708 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultReservationMinutes = 90
+	reservationSlotMinutes    = 30
+)
+
+// activeReservationStatuses are the statuses that keep a table blocked.
+var activeReservationStatuses = bson.A{"BOOKED", "ARRIVED"}
+
+var reservationCollection *mongo.Collection = database.OpenCollection(database.Client, "reservation")
+
+var reservationSlotCollection *mongo.Collection = database.OpenCollection(database.Client, "reservation_slot")
+
+var (
+	errNoTableAvailable = errors.New("no table is available for this party at that time")
+	errTableBooked      = errors.New("the table is already booked at that time")
+)
+
+type AvailableTable struct {
+	Table_id         string `json:"table_id"`
+	Table_number     *int   `json:"table_number"`
+	Number_of_guests *int   `json:"number_of_guests"`
+}
+
+type AvailabilitySlot struct {
+	Start_time time.Time        `json:"start_time"`
+	End_time   time.Time        `json:"end_time"`
+	Available  bool             `json:"available"`
+	Tables     []AvailableTable `json:"tables"`
+}
+
+func reservationDuration(reservation models.Reservation) time.Duration {
+	if reservation.Duration_minutes != nil {
+		return time.Duration(*reservation.Duration_minutes) * time.Minute
+	}
+	return defaultReservationMinutes * time.Minute
+}
+
+func overlaps(start time.Time, end time.Time, otherStart time.Time, otherEnd time.Time) bool {
+	return start.Before(otherEnd) && otherStart.Before(end)
+}
+
+// openingHours returns when the restaurant opens and closes on the given day,
+// configured with OPENING_TIME and CLOSING_TIME as HH:MM (defaults 11:00-23:00).
+func openingHours(day time.Time) (time.Time, time.Time) {
+	parse := func(value string, fallback string) time.Duration {
+		clock, err := time.Parse("15:04", value)
+		if err != nil {
+			clock, _ = time.Parse("15:04", fallback)
+		}
+		return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute
+	}
+
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	opening := midnight.Add(parse(os.Getenv("OPENING_TIME"), "11:00"))
+	closing := midnight.Add(parse(os.Getenv("CLOSING_TIME"), "23:00"))
+	if !closing.After(opening) {
+		closing = closing.Add(24 * time.Hour)
+	}
+	return opening, closing
+}
+
+// bookedTables returns the ids of tables that have an active reservation
+// overlapping the window, ignoring the reservation being modified.
+func bookedTables(ctx context.Context, start time.Time, end time.Time, excludeReservationId string) (map[string]bool, error) {
+	filter := notDeleted(bson.M{
+		"status":     bson.M{"$in": activeReservationStatuses},
+		"start_time": bson.M{"$lt": end},
+		"end_time":   bson.M{"$gt": start},
+		"table_id":   bson.M{"$ne": nil},
+	})
+	if excludeReservationId != "" {
+		filter["reservation_id"] = bson.M{"$ne": excludeReservationId}
+	}
+
+	result, err := reservationCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var reservations []models.Reservation
+	if err = result.All(ctx, &reservations); err != nil {
+		return nil, err
+	}
+
+	booked := map[string]bool{}
+	for _, reservation := range reservations {
+		booked[*reservation.Table_id] = true
+	}
+	return booked, nil
+}
+
+// bookableTable is a table guests can be booked at, together with the tables
+// combined with it. Tables combined into another are only booked through it.
+type bookableTable struct {
+	models.Table
+	Capacity int
+	Members  []string
+}
+
+// booked reports whether any table of the group is in the booked set.
+func (table bookableTable) booked(booked map[string]bool) bool {
+	for _, member := range table.Members {
+		if booked[member] {
+			return true
+		}
+	}
+	return false
+}
+
+// bookableTables groups the tables with the ones combined with them.
+func bookableTables(ctx context.Context) ([]bookableTable, error) {
+	result, err := tableCollection.Find(ctx, notDeleted(bson.M{}))
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []models.Table
+	if err = result.All(ctx, &tables); err != nil {
+		return nil, err
+	}
+
+	groups := []bookableTable{}
+	index := map[string]int{}
+	for _, table := range tables {
+		if table.Combined_with != nil {
+			continue
+		}
+		index[table.Table_id] = len(groups)
+		group := bookableTable{Table: table, Members: []string{table.Table_id}}
+		if table.Number_of_guests != nil {
+			group.Capacity = *table.Number_of_guests
+		}
+		groups = append(groups, group)
+	}
+	for _, table := range tables {
+		if table.Combined_with == nil {
+			continue
+		}
+		if i, ok := index[*table.Combined_with]; ok {
+			groups[i].Members = append(groups[i].Members, table.Table_id)
+			if table.Number_of_guests != nil {
+				groups[i].Capacity += *table.Number_of_guests
+			}
+		}
+	}
+	return groups, nil
+}
+
+// tablesForParty lists the tables that seat the party, smallest first so
+// large tables stay free for large parties.
+func tablesForParty(ctx context.Context, partySize int) ([]bookableTable, error) {
+	groups, err := bookableTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := []bookableTable{}
+	for _, group := range groups {
+		if group.Capacity >= partySize {
+			tables = append(tables, group)
+		}
+	}
+	sort.SliceStable(tables, func(i, j int) bool {
+		if tables[i].Capacity != tables[j].Capacity {
+			return tables[i].Capacity < tables[j].Capacity
+		}
+		a, b := tables[i].Table_number, tables[j].Table_number
+		return a != nil && (b == nil || *a < *b)
+	})
+	return tables, nil
+}
+
+// slotKeys are the reservation slots of the tables a booking holds, from the
+// slot it starts in to the one it ends in. Bookings sharing a slot of a table
+// conflict, so the check is never finer than reservationSlotMinutes.
+func slotKeys(tableIds []string, start time.Time, end time.Time) []string {
+	step := reservationSlotMinutes * time.Minute
+	keys := []string{}
+	for _, tableId := range tableIds {
+		for slot := start.Truncate(step); slot.Before(end); slot = slot.Add(step) {
+			keys = append(keys, tableId+"|"+strconv.FormatInt(slot.Unix(), 10))
+		}
+	}
+	return keys
+}
+
+// claimTableSlots takes the slots of the tables for the reservation. The
+// slot is the document id, so of two bookings made at the same time only one
+// gets it. Slots the reservation already holds are kept, the ones it takes
+// are returned so they can be given back if the booking is not saved.
+func claimTableSlots(ctx context.Context, reservation models.Reservation, tableIds []string) ([]string, error) {
+	keys := slotKeys(tableIds, *reservation.Start_time, reservation.End_time)
+
+	result, err := reservationSlotCollection.Find(ctx, bson.M{"reservation_id": reservation.Reservation_id, "_id": bson.M{"$in": keys}})
+	if err != nil {
+		return nil, err
+	}
+	var held []struct {
+		ID string `bson:"_id"`
+	}
+	if err = result.All(ctx, &held); err != nil {
+		return nil, err
+	}
+	owned := map[string]bool{}
+	for _, slot := range held {
+		owned[slot.ID] = true
+	}
+
+	claimed := []string{}
+	slots := []interface{}{}
+	for _, key := range keys {
+		if !owned[key] {
+			claimed = append(claimed, key)
+			slots = append(slots, bson.M{"_id": key, "reservation_id": reservation.Reservation_id})
+		}
+	}
+	if len(slots) == 0 {
+		return claimed, nil
+	}
+
+	if _, err := reservationSlotCollection.InsertMany(ctx, slots, options.InsertMany().SetOrdered(false)); err != nil {
+		releaseTableSlots(ctx, reservation.Reservation_id, claimed)
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errTableBooked
+		}
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// releaseTableSlots gives back slots of a reservation, all of them when keys
+// is nil.
+func releaseTableSlots(ctx context.Context, reservationId string, keys []string) {
+	filter := bson.M{"reservation_id": reservationId}
+	if keys != nil {
+		filter["_id"] = bson.M{"$in": keys}
+	}
+	if _, err := reservationSlotCollection.DeleteMany(ctx, filter); err != nil {
+		log.Printf("failed to release the table slots of reservation %s: %v", reservationId, err)
+	}
+}
+
+// releaseStaleSlots gives back the slots a reservation no longer needs after
+// it moved to another time or table.
+func releaseStaleSlots(ctx context.Context, reservation models.Reservation, tableIds []string) {
+	keys := slotKeys(tableIds, *reservation.Start_time, reservation.End_time)
+	filter := bson.M{"reservation_id": reservation.Reservation_id, "_id": bson.M{"$nin": keys}}
+	if _, err := reservationSlotCollection.DeleteMany(ctx, filter); err != nil {
+		log.Printf("failed to release the table slots of reservation %s: %v", reservation.Reservation_id, err)
+	}
+}
+
+// assignTable picks a table for the reservation and claims its slots. A
+// requested table is only checked for capacity and conflicts; otherwise the
+// smallest free table wins. It returns the tables held and the slots taken.
+func assignTable(ctx context.Context, reservation models.Reservation, requestedTableId *string) (*bookableTable, []string, error) {
+	booked, err := bookedTables(ctx, *reservation.Start_time, reservation.End_time, reservation.Reservation_id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tables, err := bookableTables(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if requestedTableId != nil {
+		var table models.Table
+		if err := tableCollection.FindOne(ctx, notDeleted(bson.M{"table_id": requestedTableId})).Decode(&table); err != nil {
+			return nil, nil, err
+		}
+		if table.Combined_with != nil {
+			return nil, nil, errTableCombined
+		}
+		for _, group := range tables {
+			if group.Table_id != table.Table_id {
+				continue
+			}
+			if group.Capacity < *reservation.Party_size {
+				return nil, nil, errors.New("the table is too small for this party")
+			}
+			if group.booked(booked) {
+				return nil, nil, errTableBooked
+			}
+			claimed, err := claimTableSlots(ctx, reservation, group.Members)
+			if err != nil {
+				return nil, nil, err
+			}
+			return &group, claimed, nil
+		}
+		return nil, nil, mongo.ErrNoDocuments
+	}
+
+	candidates, err := tablesForParty(ctx, *reservation.Party_size)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range candidates {
+		if candidates[i].booked(booked) {
+			continue
+		}
+		// another booking may have taken it since, then the next one is tried
+		claimed, err := claimTableSlots(ctx, reservation, candidates[i].Members)
+		if err == errTableBooked {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return &candidates[i], claimed, nil
+	}
+	return nil, nil, errNoTableAvailable
+}
+
+func GetReservations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := notDeleted(bson.M{})
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		if date := c.Query("date"); date != "" {
+			day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "date must be formatted as YYYY-MM-DD"})
+				return
+			}
+			filter["start_time"] = bson.M{"$gte": day, "$lt": day.AddDate(0, 0, 1)}
+		}
+
+		page, err := helper.Paginate(ctx, reservationCollection, filter, params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the reservations"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetReservation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		reservationId := c.Param("reservation_id")
+
+		var reservation models.Reservation
+		err := reservationCollection.FindOne(ctx, notDeleted(bson.M{"reservation_id": reservationId})).Decode(&reservation)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "reservation was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the reservation"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.ETag(reservation.Version)) {
+			return
+		}
+		c.JSON(http.StatusOK, reservation)
+	}
+}
+
+func GetAvailability() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		day, err := time.ParseInLocation("2006-01-02", c.Query("date"), time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be formatted as YYYY-MM-DD"})
+			return
+		}
+
+		partySize, err := strconv.Atoi(c.Query("party"))
+		if err != nil || partySize < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "party must be a positive number"})
+			return
+		}
+
+		duration := defaultReservationMinutes * time.Minute
+		if minutes, err := strconv.Atoi(c.Query("duration")); err == nil && minutes > 0 {
+			duration = time.Duration(minutes) * time.Minute
+		}
+
+		tables, err := tablesForParty(ctx, partySize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking availability"})
+			return
+		}
+
+		opening, closing := openingHours(day)
+
+		result, err := reservationCollection.Find(ctx, notDeleted(bson.M{
+			"status":     bson.M{"$in": activeReservationStatuses},
+			"start_time": bson.M{"$lt": closing},
+			"end_time":   bson.M{"$gt": opening},
+			"table_id":   bson.M{"$ne": nil},
+		}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking availability"})
+			return
+		}
+
+		var reservations []models.Reservation
+		if err = result.All(ctx, &reservations); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking availability"})
+			return
+		}
+
+		slots := []AvailabilitySlot{}
+		for start := opening; !start.Add(duration).After(closing); start = start.Add(reservationSlotMinutes * time.Minute) {
+			end := start.Add(duration)
+			slot := AvailabilitySlot{Start_time: start, End_time: end, Tables: []AvailableTable{}}
+
+			booked := map[string]bool{}
+			for _, reservation := range reservations {
+				if overlaps(start, end, *reservation.Start_time, reservation.End_time) {
+					booked[*reservation.Table_id] = true
+				}
+			}
+			for _, table := range tables {
+				if !table.booked(booked) {
+					capacity := table.Capacity
+					slot.Tables = append(slot.Tables, AvailableTable{
+						Table_id:         table.Table_id,
+						Table_number:     table.Table_number,
+						Number_of_guests: &capacity,
+					})
+				}
+			}
+
+			slot.Available = len(slot.Tables) > 0
+			slots = append(slots, slot)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"date": c.Query("date"), "party": partySize, "slots": slots})
+	}
+}
+
+func CreateReservation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var reservation models.Reservation
+
+		if err := c.BindJSON(&reservation); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		reservation.Status = "BOOKED"
+
+		if validatorErr := validate.Struct(reservation); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		if reservation.Start_time.Before(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reservations cannot start in the past"})
+			return
+		}
+
+		reservation.End_time = reservation.Start_time.Add(reservationDuration(reservation))
+		reservation.ID = primitive.NewObjectID()
+		reservation.Reservation_id = reservation.ID.Hex()
+
+		table, _, err := assignTable(ctx, reservation, reservation.Table_id)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "table was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		reservation.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		reservation.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		reservation.Table_id = &table.Table_id
+		reservation.Arrived_at = nil
+		reservation.Cancelled_at = nil
+		reservation.Deleted_at = nil
+		reservation.Deleted_by = nil
+		reservation.Version = 1
+
+		if _, insertErr := reservationCollection.InsertOne(ctx, reservation); insertErr != nil {
+			releaseTableSlots(ctx, reservation.Reservation_id, nil)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the reservation"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(reservation.Version))
+		c.JSON(http.StatusCreated, reservation)
+	}
+}
+
+func UpdateReservation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		reservationId := c.Param("reservation_id")
+		filter := notDeleted(bson.M{"reservation_id": reservationId})
+
+		var reservation models.Reservation
+		err := reservationCollection.FindOne(ctx, filter).Decode(&reservation)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "reservation was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the reservation"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(reservation.Version)) {
+			return
+		}
+
+		if reservation.Status != "BOOKED" {
+			c.JSON(http.StatusConflict, gin.H{"error": "only booked reservations can be modified"})
+			return
+		}
+
+		var patched models.Reservation
+		if err := applyMergePatch(c, reservation, &patched); err != nil {
+			c.JSON(patchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		// status changes go through the cancel, arrived and no-show actions
+		patched.ID = reservation.ID
+		patched.Reservation_id = reservation.Reservation_id
+		patched.Status = reservation.Status
+		patched.Arrived_at = reservation.Arrived_at
+		patched.Cancelled_at = reservation.Cancelled_at
+		patched.Created_at = reservation.Created_at
+		patched.Deleted_at = reservation.Deleted_at
+		patched.Deleted_by = reservation.Deleted_by
+		patched.Version = reservation.Version + 1
+
+		if validatorErr := validate.Struct(patched); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		patched.End_time = patched.Start_time.Add(reservationDuration(patched))
+
+		// keep the current table when it still works, otherwise look for another
+		table, claimed, err := assignTable(ctx, patched, patched.Table_id)
+		if err != nil && patched.Table_id != nil && reservation.Table_id != nil && *patched.Table_id == *reservation.Table_id {
+			table, claimed, err = assignTable(ctx, patched, nil)
+		}
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "table was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		patched.Table_id = &table.Table_id
+		patched.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedReservation models.Reservation
+		err = reservationCollection.FindOneAndReplace(
+			ctx,
+			matchVersion(filter, reservation.Version),
+			patched,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		).Decode(&updatedReservation)
+
+		if err != nil {
+			releaseTableSlots(ctx, reservation.Reservation_id, claimed)
+		}
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the reservation was modified by someone else, reload it and try again"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "reservation failed to update"})
+			return
+		}
+		releaseStaleSlots(ctx, updatedReservation, table.Members)
+
+		c.Header("ETag", helper.ETag(updatedReservation.Version))
+		c.JSON(http.StatusOK, updatedReservation)
+	}
+}
+
+// changeReservationStatus moves a reservation from one of the allowed
+// statuses to the next one, stamping the given time field.
+func changeReservationStatus(c *gin.Context, allowed bson.A, status string, stampField string) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	reservationId := c.Param("reservation_id")
+
+	var reservation models.Reservation
+	err := reservationCollection.FindOne(ctx, notDeleted(bson.M{"reservation_id": reservationId})).Decode(&reservation)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "reservation was not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the reservation"})
+		return
+	}
+
+	if status == "NO_SHOW" && time.Now().Before(*reservation.Start_time) {
+		c.JSON(http.StatusConflict, gin.H{"error": "a reservation cannot be a no-show before it starts"})
+		return
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	set := bson.D{
+		{Key: "status", Value: status},
+		{Key: "updated_at", Value: now},
+	}
+	if stampField != "" {
+		set = append(set, bson.E{Key: stampField, Value: now})
+	}
+
+	var updatedReservation models.Reservation
+	err = reservationCollection.FindOneAndUpdate(
+		ctx,
+		notDeleted(bson.M{"reservation_id": reservationId, "status": bson.M{"$in": allowed}}),
+		bson.D{
+			{Key: "$set", Value: set},
+			{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updatedReservation)
+
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusConflict, gin.H{"error": "reservation is " + reservation.Status + " and cannot be marked " + status})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "reservation failed to update"})
+		return
+	}
+
+	// cancelled and no-show bookings free their table
+	if status == "CANCELLED" || status == "NO_SHOW" {
+		releaseTableSlots(ctx, reservationId, nil)
+	}
+
+	c.Header("ETag", helper.ETag(updatedReservation.Version))
+	c.JSON(http.StatusOK, updatedReservation)
+}
+
+func CancelReservation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		changeReservationStatus(c, bson.A{"BOOKED", "ARRIVED"}, "CANCELLED", "cancelled_at")
+	}
+}
+
+func MarkReservationArrived() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		changeReservationStatus(c, bson.A{"BOOKED"}, "ARRIVED", "arrived_at")
+	}
+}
+
+func MarkReservationNoShow() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		changeReservationStatus(c, bson.A{"BOOKED"}, "NO_SHOW", "")
+	}
+}
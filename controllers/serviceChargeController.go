@@ -0,0 +1,237 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var serviceChargeCollection *mongo.Collection = database.OpenCollection(database.Client, "service_charge")
+
+func activeServiceCharges(ctx context.Context) ([]models.ServiceCharge, error) {
+	result, err := serviceChargeCollection.Find(ctx, notDeleted(bson.M{}))
+	if err != nil {
+		return nil, err
+	}
+
+	var charges []models.ServiceCharge
+	if err = result.All(ctx, &charges); err != nil {
+		return nil, err
+	}
+	return charges, nil
+}
+
+func GetServiceCharges() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := helper.Paginate(ctx, serviceChargeCollection, notDeleted(bson.M{}), params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the service charges"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetServiceCharge() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var charge models.ServiceCharge
+		err := serviceChargeCollection.FindOne(ctx, notDeleted(bson.M{"service_charge_id": c.Param("service_charge_id")})).Decode(&charge)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "service charge was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the service charge"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.ETag(charge.Version)) {
+			return
+		}
+		c.JSON(http.StatusOK, charge)
+	}
+}
+
+func CreateServiceCharge() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var charge models.ServiceCharge
+
+		if err := c.BindJSON(&charge); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validatorErr := validate.Struct(charge); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+		if err := helper.CheckKindValue(*charge.Kind, charge.Value, charge.Amount); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		charge.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		charge.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		charge.ID = primitive.NewObjectID()
+		charge.Service_charge_id = charge.ID.Hex()
+		charge.Deleted_at = nil
+		charge.Deleted_by = nil
+		charge.Version = 1
+
+		if _, insertErr := serviceChargeCollection.InsertOne(ctx, charge); insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the service charge"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(charge.Version))
+		c.JSON(http.StatusCreated, charge)
+	}
+}
+
+func UpdateServiceCharge() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		chargeId := c.Param("service_charge_id")
+		filter := notDeleted(bson.M{"service_charge_id": chargeId})
+
+		var charge models.ServiceCharge
+		err := serviceChargeCollection.FindOne(ctx, filter).Decode(&charge)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "service charge was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the service charge"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(charge.Version)) {
+			return
+		}
+
+		var patched models.ServiceCharge
+		if err := applyMergePatch(c, charge, &patched); err != nil {
+			c.JSON(patchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		patched.ID = charge.ID
+		patched.Service_charge_id = charge.Service_charge_id
+		patched.Created_at = charge.Created_at
+		patched.Deleted_at = charge.Deleted_at
+		patched.Deleted_by = charge.Deleted_by
+		patched.Version = charge.Version + 1
+
+		if validatorErr := validate.Struct(patched); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+		if err := helper.CheckKindValue(*patched.Kind, patched.Value, patched.Amount); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		patched.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedCharge models.ServiceCharge
+		err = serviceChargeCollection.FindOneAndReplace(
+			ctx,
+			matchVersion(filter, charge.Version),
+			patched,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		).Decode(&updatedCharge)
+
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the service charge was modified by someone else, reload it and try again"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "service charge failed to update"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedCharge.Version))
+		c.JSON(http.StatusOK, updatedCharge)
+	}
+}
+
+func DeleteServiceCharge() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		chargeId := c.Param("service_charge_id")
+
+		var charge models.ServiceCharge
+		err := serviceChargeCollection.FindOne(ctx, notDeleted(bson.M{"service_charge_id": chargeId})).Decode(&charge)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "service charge was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "service charge failed to delete"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(charge.Version)) {
+			return
+		}
+
+		result, err := archiveRecord(ctx, serviceChargeCollection, matchVersion(bson.M{"service_charge_id": chargeId}, charge.Version), c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "service charge failed to delete"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the service charge was modified by someone else, reload it and try again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "service charge deleted", "service_charge_id": chargeId})
+	}
+}
@@ -0,0 +1,587 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const OrderServerReassigned = "SERVER_REASSIGNED"
+
+var assignmentCollection *mongo.Collection = database.OpenCollection(database.Client, "shift_assignment")
+
+var (
+	errShiftEndsBeforeStart = errors.New("shift_end must be after shift_start")
+	errStaffNotFound        = errors.New("user was not found")
+	errSectionNotFound      = errors.New("section was not found")
+	errShiftOverlaps        = errors.New("the user already works another section during this shift")
+)
+
+type ReassignRequest struct {
+	User_id *string `json:"user_id" validate:"required"`
+}
+
+func assignmentErrorStatus(err error) int {
+	switch err {
+	case errShiftEndsBeforeStart:
+		return http.StatusBadRequest
+	case errStaffNotFound, errSectionNotFound:
+		return http.StatusNotFound
+	case errShiftOverlaps:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// checkAssignment makes sure the shift is well formed, points at an active
+// user and section, and does not double book the user in another section.
+func checkAssignment(ctx context.Context, assignment models.ShiftAssignment) error {
+	if !assignment.Shift_end.After(*assignment.Shift_start) {
+		return errShiftEndsBeforeStart
+	}
+
+	userCount, err := userCollection.CountDocuments(ctx, notDeleted(bson.M{"user_id": assignment.User_id}))
+	if err != nil {
+		return err
+	}
+	if userCount == 0 {
+		return errStaffNotFound
+	}
+
+	sectionCount, err := sectionCollection.CountDocuments(ctx, notDeleted(bson.M{"section_id": assignment.Section_id}))
+	if err != nil {
+		return err
+	}
+	if sectionCount == 0 {
+		return errSectionNotFound
+	}
+
+	overlapCount, err := assignmentCollection.CountDocuments(ctx, notDeleted(bson.M{
+		"assignment_id": bson.M{"$ne": assignment.Assignment_id},
+		"user_id":       assignment.User_id,
+		"section_id":    bson.M{"$ne": assignment.Section_id},
+		"shift_start":   bson.M{"$lt": assignment.Shift_end},
+		"shift_end":     bson.M{"$gt": assignment.Shift_start},
+	}))
+	if err != nil {
+		return err
+	}
+	if overlapCount > 0 {
+		return errShiftOverlaps
+	}
+	return nil
+}
+
+// assignedSections lists the sections the user is working at the given time.
+func assignedSections(ctx context.Context, userId string, at time.Time) ([]string, error) {
+	result, err := assignmentCollection.Find(ctx, notDeleted(bson.M{
+		"user_id":     userId,
+		"shift_start": bson.M{"$lte": at},
+		"shift_end":   bson.M{"$gt": at},
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	var assignments []models.ShiftAssignment
+	if err = result.All(ctx, &assignments); err != nil {
+		return nil, err
+	}
+
+	sectionIds := []string{}
+	for _, assignment := range assignments {
+		sectionIds = append(sectionIds, *assignment.Section_id)
+	}
+	return sectionIds, nil
+}
+
+// openOrders returns the orders matching filter that were not settled by a
+// paid invoice.
+func openOrders(ctx context.Context, filter bson.M) ([]models.Order, error) {
+	matchStage := bson.D{{Key: "$match", Value: notDeleted(filter)}}
+	lookupStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "invoice"}, {Key: "localField", Value: "order_id"}, {Key: "foreignField", Value: "order_id"}, {Key: "as", Value: "invoice"}}}}
+	unpaidStage := bson.D{{Key: "$match", Value: bson.D{{Key: "invoice", Value: bson.D{{Key: "$not", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+		{Key: "payment_status", Value: "PAID"},
+		{Key: "deleted_at", Value: nil},
+	}}}}}}}}}
+	projectStage := bson.D{{Key: "$project", Value: bson.D{{Key: "invoice", Value: 0}}}}
+
+	result, err := orderCollection.Aggregate(ctx, mongo.Pipeline{matchStage, lookupStage, unpaidStage, projectStage})
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []models.Order
+	if err = result.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// reassignOrder hands an order to another server and records who had it.
+func reassignOrder(ctx context.Context, c *gin.Context, order models.Order, serverId string) (models.Order, error) {
+	event := newOrderEvent(c, OrderServerReassigned)
+	event.From_server_id = order.Server_id
+	event.To_server_id = &serverId
+
+	return recordOrderEvent(
+		ctx,
+		matchVersion(notDeleted(bson.M{"order_id": order.Order_id}), order.Version),
+		bson.D{{Key: "server_id", Value: serverId}},
+		event,
+	)
+}
+
+func GetAssignments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := notDeleted(bson.M{})
+		if userId := c.Query("user_id"); userId != "" {
+			filter["user_id"] = userId
+		}
+		if sectionId := c.Query("section_id"); sectionId != "" {
+			filter["section_id"] = sectionId
+		}
+		if date := c.Query("date"); date != "" {
+			day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "date must look like 2006-01-02"})
+				return
+			}
+			filter["shift_start"] = bson.M{"$lt": day.AddDate(0, 0, 1)}
+			filter["shift_end"] = bson.M{"$gt": day}
+		}
+
+		page, err := helper.Paginate(ctx, assignmentCollection, filter, params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the shift assignments"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func CreateAssignment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var assignment models.ShiftAssignment
+
+		if err := c.BindJSON(&assignment); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validatorErr := validate.Struct(assignment); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		assignment.ID = primitive.NewObjectID()
+		assignment.Assignment_id = assignment.ID.Hex()
+
+		if err := checkAssignment(ctx, assignment); err != nil {
+			c.JSON(assignmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		assignment.Created_by = c.GetString("uid")
+		assignment.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		assignment.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		assignment.Deleted_at = nil
+		assignment.Deleted_by = nil
+		assignment.Version = 1
+
+		if _, insertErr := assignmentCollection.InsertOne(ctx, assignment); insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the shift assignment"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(assignment.Version))
+		c.JSON(http.StatusCreated, assignment)
+	}
+}
+
+func UpdateAssignment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		assignmentId := c.Param("assignment_id")
+		filter := notDeleted(bson.M{"assignment_id": assignmentId})
+
+		var assignment models.ShiftAssignment
+		err := assignmentCollection.FindOne(ctx, filter).Decode(&assignment)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "shift assignment was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the shift assignment"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(assignment.Version)) {
+			return
+		}
+
+		var patched models.ShiftAssignment
+		if err := applyMergePatch(c, assignment, &patched); err != nil {
+			c.JSON(patchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		patched.ID = assignment.ID
+		patched.Assignment_id = assignment.Assignment_id
+		patched.Created_by = assignment.Created_by
+		patched.Created_at = assignment.Created_at
+		patched.Deleted_at = assignment.Deleted_at
+		patched.Deleted_by = assignment.Deleted_by
+		patched.Version = assignment.Version + 1
+
+		if validatorErr := validate.Struct(patched); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		if err := checkAssignment(ctx, patched); err != nil {
+			c.JSON(assignmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		patched.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedAssignment models.ShiftAssignment
+		err = assignmentCollection.FindOneAndReplace(
+			ctx,
+			matchVersion(filter, assignment.Version),
+			patched,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		).Decode(&updatedAssignment)
+
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the shift assignment was modified by someone else, reload it and try again"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "shift assignment failed to update"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedAssignment.Version))
+		c.JSON(http.StatusOK, updatedAssignment)
+	}
+}
+
+func DeleteAssignment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		assignmentId := c.Param("assignment_id")
+
+		var assignment models.ShiftAssignment
+		err := assignmentCollection.FindOne(ctx, notDeleted(bson.M{"assignment_id": assignmentId})).Decode(&assignment)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "shift assignment was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "shift assignment failed to delete"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(assignment.Version)) {
+			return
+		}
+
+		result, err := archiveRecord(ctx, assignmentCollection, matchVersion(bson.M{"assignment_id": assignmentId}, assignment.Version), c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "shift assignment failed to delete"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the shift assignment was modified by someone else, reload it and try again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "shift assignment deleted", "assignment_id": assignmentId})
+	}
+}
+
+// ReassignSection hands a section to another server mid shift. Open orders
+// the previous server had at the section's tables go along with it.
+func ReassignSection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var request ReassignRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		assignmentId := c.Param("assignment_id")
+		filter := notDeleted(bson.M{"assignment_id": assignmentId})
+
+		var assignment models.ShiftAssignment
+		err := assignmentCollection.FindOne(ctx, filter).Decode(&assignment)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "shift assignment was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the shift assignment"})
+			return
+		}
+
+		previousServer := *assignment.User_id
+		assignment.User_id = request.User_id
+		if err := checkAssignment(ctx, assignment); err != nil {
+			c.JSON(assignmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedAssignment models.ShiftAssignment
+		err = assignmentCollection.FindOneAndUpdate(
+			ctx,
+			matchVersion(filter, assignment.Version),
+			bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "user_id", Value: request.User_id},
+					{Key: "updated_at", Value: now},
+				}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedAssignment)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the shift assignment was modified by someone else, reload it and try again"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "shift assignment failed to update"})
+			return
+		}
+
+		var tables []models.Table
+		result, err := tableCollection.Find(ctx, notDeleted(bson.M{"section_id": assignment.Section_id}))
+		if err == nil {
+			err = result.All(ctx, &tables)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while moving the open orders"})
+			return
+		}
+
+		tableIds := []string{}
+		for _, table := range tables {
+			tableIds = append(tableIds, table.Table_id)
+		}
+
+		orders, err := openOrders(ctx, bson.M{"table_id": bson.M{"$in": tableIds}, "server_id": previousServer})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while moving the open orders"})
+			return
+		}
+
+		movedOrders := []string{}
+		for _, order := range orders {
+			if _, err := reassignOrder(ctx, c, order, *request.User_id); err != nil {
+				continue
+			}
+			movedOrders = append(movedOrders, order.Order_id)
+		}
+
+		c.Header("ETag", helper.ETag(updatedAssignment.Version))
+		c.JSON(http.StatusOK, gin.H{"assignment": updatedAssignment, "reassigned_orders": movedOrders})
+	}
+}
+
+// ReassignOrder hands a single order to another server. Managers can move
+// any order, servers only the ones they hold.
+func ReassignOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request ReassignRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		order, err := findChangeableOrder(ctx, c.Param("order_id"), true)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		isOwner := order.Server_id != nil && *order.Server_id == c.GetString("uid")
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil && !isOwner {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		userCount, err := userCollection.CountDocuments(ctx, notDeleted(bson.M{"user_id": request.User_id}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while reassigning the order"})
+			return
+		}
+		if userCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": errStaffNotFound.Error()})
+			return
+		}
+
+		updatedOrder, err := reassignOrder(ctx, c, order, *request.User_id)
+		if err != nil {
+			c.JSON(orderChangeStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedOrder.Version))
+		c.JSON(http.StatusOK, updatedOrder)
+	}
+}
+
+// GetMyTables shows the logged in server the tables of the sections they are
+// working now, plus any other table where they hold an open order.
+func GetMyTables() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		uid := c.GetString("uid")
+
+		sectionIds, err := assignedSections(ctx, uid, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing your tables"})
+			return
+		}
+
+		orders, err := openOrders(ctx, bson.M{"server_id": uid})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing your tables"})
+			return
+		}
+
+		tableIds := []string{}
+		for _, order := range orders {
+			if order.Table_id != nil {
+				tableIds = append(tableIds, *order.Table_id)
+			}
+		}
+
+		tables, err := floorTables(ctx, bson.M{"$or": bson.A{
+			bson.M{"section_id": bson.M{"$in": sectionIds}},
+			bson.M{"table_id": bson.M{"$in": tableIds}},
+		}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing your tables"})
+			return
+		}
+
+		response := gin.H{"section_ids": sectionIds, "tables": tables}
+		if helper.CheckNotModified(c, helper.BodyETag(response)) {
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// GetMyOrders lists the orders of the logged in server, only the open ones
+// unless all=true.
+func GetMyOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		filter := notDeleted(bson.M{"server_id": uid})
+
+		if c.Query("all") != "true" {
+			orders, err := openOrders(ctx, bson.M{"server_id": uid})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing your orders"})
+				return
+			}
+
+			orderIds := []string{}
+			for _, order := range orders {
+				orderIds = append(orderIds, order.Order_id)
+			}
+			filter["order_id"] = bson.M{"$in": orderIds}
+		}
+
+		page, err := helper.Paginate(ctx, orderCollection, filter, params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing your orders"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
 	"golang-restaurant-backend-app/models"
 	"net/http"
 	"time"
@@ -20,38 +21,48 @@ var tableCollection *mongo.Collection = database.OpenCollection(database.Client,
 func GetTables() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-
-		result, err := tableCollection.Find(context.TODO(), bson.M{})
-
 		defer cancel()
 
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := helper.Paginate(ctx, tableCollection, notDeleted(bson.M{}), params, nil)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the table items"})
+			return
 		}
 
-		var allTables []bson.M
-		if err = result.All(ctx, &allTables); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
 			return
 		}
-		c.JSON(http.StatusOK, allTables)
+		c.JSON(http.StatusOK, page)
 	}
 }
 
 func GetTable() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
-		tableId := c.Param("order_id")
+		tableId := c.Param("table_id")
 
 		var table models.Table
 
-		err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(&table)
-
-		defer cancel()
-
+		err := tableCollection.FindOne(ctx, notDeleted(bson.M{"table_id": tableId})).Decode(&table)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "table was not found"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the table item"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.ETag(table.Version)) {
+			return
 		}
 		c.JSON(http.StatusOK, table)
 	}
@@ -76,10 +87,22 @@ func CreateTable() gin.HandlerFunc {
 			return
 		}
 
+		if table.Section_id != nil {
+			sectionCount, err := sectionCollection.CountDocuments(ctx, notDeleted(bson.M{"section_id": table.Section_id}))
+			if err != nil || sectionCount == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "section was not found"})
+				return
+			}
+		}
+
 		table.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		table.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		table.ID = primitive.NewObjectID()
 		table.Table_id = table.ID.Hex()
+		table.Deleted_at = nil
+		table.Deleted_by = nil
+		table.Version = 1
+		table.Cleaned_at = nil
 
 		result, insertErr := tableCollection.InsertOne(ctx, table)
 
@@ -100,47 +123,369 @@ func UpdateTable() gin.HandlerFunc {
 		var table models.Table
 
 		tableId := c.Param("table_id")
-		filter := bson.M{"table_id": tableId}
+		filter := notDeleted(bson.M{"table_id": tableId})
 
-		if err := c.BindJSON(&table); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		err := tableCollection.FindOne(ctx, filter).Decode(&table)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "table was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the table item"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(table.Version)) {
 			return
 		}
 
-		var updateObj primitive.D
+		var patched models.Table
+		if err := applyMergePatch(c, table, &patched); err != nil {
+			c.JSON(patchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		patched.ID = table.ID
+		patched.Table_id = table.Table_id
+		patched.Created_at = table.Created_at
+		patched.Deleted_at = table.Deleted_at
+		patched.Deleted_by = table.Deleted_by
+		patched.Version = table.Version + 1
+		patched.Cleaned_at = table.Cleaned_at
+		patched.Combined_with = table.Combined_with
 
-		if table.Number_of_guests != nil {
-			updateObj = append(updateObj, bson.E{Key: "number_of_guests", Value: table.Number_of_guests})
+		if validatedErr := validate.Struct(patched); validatedErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatedErr.Error()})
+			return
 		}
 
-		if table.Table_number != nil {
-			updateObj = append(updateObj, bson.E{Key: "table_number", Value: table.Table_number})
+		if patched.Section_id != nil && (table.Section_id == nil || *patched.Section_id != *table.Section_id) {
+			sectionCount, err := sectionCollection.CountDocuments(ctx, notDeleted(bson.M{"section_id": patched.Section_id}))
+			if err != nil || sectionCount == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "section was not found"})
+				return
+			}
 		}
 
-		table.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		patched.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedTable models.Table
+		err = tableCollection.FindOneAndReplace(
+			ctx,
+			matchVersion(filter, table.Version),
+			patched,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		).Decode(&updatedTable)
+
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the table was modified by someone else, reload it and try again"})
+			return
+		}
+		if err != nil {
+			msg := fmt.Sprint("table item failed to update")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedTable.Version))
+		c.JSON(http.StatusOK, updatedTable)
+	}
+}
+
+func DeleteTable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		tableId := c.Param("table_id")
+
+		var table models.Table
+		err := tableCollection.FindOne(ctx, notDeleted(bson.M{"table_id": tableId})).Decode(&table)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "table was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "table item failed to delete"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(table.Version)) {
+			return
+		}
+
+		hasOpenOrders, err := tableHasOpenOrders(ctx, tableId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "table item failed to delete"})
+			return
+		}
+		if hasOpenOrders {
+			c.JSON(http.StatusConflict, gin.H{"error": "table still has open orders"})
+			return
+		}
+
+		combinedCount, err := tableCollection.CountDocuments(ctx, notDeleted(bson.M{"combined_with": tableId}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "table item failed to delete"})
+			return
+		}
+		if table.Combined_with != nil || combinedCount > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "table is combined with other tables, split them first"})
+			return
+		}
+
+		result, err := archiveRecord(ctx, tableCollection, matchVersion(bson.M{"table_id": tableId}, table.Version), c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "table item failed to delete"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the table was modified by someone else, reload it and try again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "table deleted", "table_id": tableId})
+	}
+}
+
+func RestoreTable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
-		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: table.Updated_at})
+		if err := helper.CheckUserType(c, helper.ADMIN); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		tableId := c.Param("table_id")
+
+		result, err := restoreRecord(ctx, tableCollection, bson.M{"table_id": tableId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "table item failed to restore"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no archived table with this id"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "table restored", "table_id": tableId})
+	}
+}
+
+type CombineTablesRequest struct {
+	Table_ids []string `json:"table_ids" validate:"required,min=1,dive,required"`
+}
+
+// tableCapacity is the number of guests a table seats together with the
+// tables combined with it.
+func tableCapacity(ctx context.Context, table models.Table) (int, error) {
+	capacity := 0
+	if table.Number_of_guests != nil {
+		capacity = *table.Number_of_guests
+	}
+
+	result, err := tableCollection.Find(ctx, notDeleted(bson.M{"combined_with": table.Table_id}))
+	if err != nil {
+		return 0, err
+	}
+
+	var combined []models.Table
+	if err = result.All(ctx, &combined); err != nil {
+		return 0, err
+	}
+
+	for _, other := range combined {
+		if other.Number_of_guests != nil {
+			capacity += *other.Number_of_guests
+		}
+	}
+	return capacity, nil
+}
+
+// recordTableEvent adds the event to the history of the open order at the
+// table, if there is one.
+func recordTableEvent(ctx context.Context, tableId string, event models.OrderEvent) error {
+	activities, err := tableActivities(ctx, []string{tableId})
+	if err != nil {
+		return err
+	}
+
+	openOrder := activities[tableId].openOrder
+	if openOrder == nil {
+		return nil
+	}
+
+	_, err = recordOrderEvent(ctx, notDeleted(bson.M{"order_id": openOrder.Order_id}), bson.D{}, event)
+	return err
+}
+
+// CombineTables pushes tables together for a large party. The combined
+// tables follow the table in the path, which keeps the order.
+func CombineTables() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
-		upsert := true
+		var request CombineTablesRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		tableId := c.Param("table_id")
+
+		var table models.Table
+		err := tableCollection.FindOne(ctx, notDeleted(bson.M{"table_id": tableId})).Decode(&table)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "table was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while combining the tables"})
+			return
+		}
+		if table.Combined_with != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": errTableCombined.Error()})
+			return
+		}
 
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
+		for _, otherId := range request.Table_ids {
+			if otherId == tableId {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "a table cannot be combined with itself"})
+				return
+			}
+
+			var other models.Table
+			if err := tableCollection.FindOne(ctx, notDeleted(bson.M{"table_id": otherId})).Decode(&other); err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "table " + otherId + " was not found"})
+				return
+			}
+			if other.Combined_with != nil && *other.Combined_with != tableId {
+				c.JSON(http.StatusConflict, gin.H{"error": "table " + otherId + " is already combined with another table"})
+				return
+			}
+
+			dependants, err := tableCollection.CountDocuments(ctx, notDeleted(bson.M{"combined_with": otherId}))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while combining the tables"})
+				return
+			}
+			if dependants > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "table " + otherId + " has tables combined with it, split them first"})
+				return
+			}
+
+			hasOpenOrders, err := tableHasOpenOrders(ctx, otherId)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while combining the tables"})
+				return
+			}
+			if hasOpenOrders {
+				c.JSON(http.StatusConflict, gin.H{"error": "table " + otherId + " has an open order, transfer or merge it first"})
+				return
+			}
 		}
 
-		result, err := tableCollection.UpdateOne(
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		_, err = tableCollection.UpdateMany(
 			ctx,
-			filter,
+			notDeleted(bson.M{"table_id": bson.M{"$in": request.Table_ids}, "combined_with": nil}),
 			bson.D{
-				{Key: "$set", Value: updateObj},
+				{Key: "$set", Value: bson.D{
+					{Key: "combined_with", Value: tableId},
+					{Key: "updated_at", Value: now},
+				}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
 			},
-			&opt,
 		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while combining the tables"})
+			return
+		}
+
+		event := newOrderEvent(c, TablesCombined)
+		event.Table_ids = request.Table_ids
+		if err := recordTableEvent(ctx, tableId, event); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while recording the combination on the order"})
+			return
+		}
 
+		capacity, err := tableCapacity(ctx, table)
 		if err != nil {
-			msg := fmt.Sprint("table item failed to update")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while combining the tables"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"table_id": tableId, "combined_tables": request.Table_ids, "seats": capacity})
+	}
+}
+
+// SplitTables separates every table combined with the table in the path.
+func SplitTables() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		tableId := c.Param("table_id")
+
+		result, err := tableCollection.Find(ctx, notDeleted(bson.M{"combined_with": tableId}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while splitting the tables"})
+			return
+		}
+
+		var combined []models.Table
+		if err = result.All(ctx, &combined); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while splitting the tables"})
+			return
+		}
+		if len(combined) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no tables are combined with this table"})
+			return
+		}
+
+		tableIds := []string{}
+		for _, other := range combined {
+			tableIds = append(tableIds, other.Table_id)
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		_, err = tableCollection.UpdateMany(
+			ctx,
+			bson.M{"table_id": bson.M{"$in": tableIds}, "combined_with": tableId},
+			bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "combined_with", Value: nil},
+					{Key: "updated_at", Value: now},
+				}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while splitting the tables"})
+			return
+		}
+
+		event := newOrderEvent(c, TablesSplit)
+		event.Table_ids = tableIds
+		if err := recordTableEvent(ctx, tableId, event); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while recording the split on the order"})
+			return
 		}
 
-		c.JSON(http.StatusOK, result)
+		c.JSON(http.StatusOK, gin.H{"table_id": tableId, "split_tables": tableIds})
 	}
 }
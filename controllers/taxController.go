@@ -0,0 +1,251 @@
+package controller
+
+import (
+	"context"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var taxRateCollection *mongo.Collection = database.OpenCollection(database.Client, "tax_rate")
+
+func activeTaxRates(ctx context.Context) ([]models.TaxRate, error) {
+	result, err := taxRateCollection.Find(ctx, notDeleted(bson.M{}), options.Find().SetSort(bson.D{{Key: "priority", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var rates []models.TaxRate
+	if err = result.All(ctx, &rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+func GetTaxRates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := helper.Paginate(ctx, taxRateCollection, notDeleted(bson.M{}), params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the tax rates"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetTaxRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var rate models.TaxRate
+		err := taxRateCollection.FindOne(ctx, notDeleted(bson.M{"tax_rate_id": c.Param("tax_rate_id")})).Decode(&rate)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "tax rate was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the tax rate"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.ETag(rate.Version)) {
+			return
+		}
+		c.JSON(http.StatusOK, rate)
+	}
+}
+
+func CreateTaxRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var rate models.TaxRate
+
+		if err := c.BindJSON(&rate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validatorErr := validate.Struct(rate); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		codeCount, err := taxRateCollection.CountDocuments(ctx, notDeleted(bson.M{"code": rate.Code}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the tax rate"})
+			return
+		}
+		if codeCount > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "a tax rate with this code already exists"})
+			return
+		}
+
+		rate.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		rate.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		rate.ID = primitive.NewObjectID()
+		rate.Tax_rate_id = rate.ID.Hex()
+		rate.Deleted_at = nil
+		rate.Deleted_by = nil
+		rate.Version = 1
+
+		if _, insertErr := taxRateCollection.InsertOne(ctx, rate); insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while creating the tax rate"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(rate.Version))
+		c.JSON(http.StatusCreated, rate)
+	}
+}
+
+func UpdateTaxRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		rateId := c.Param("tax_rate_id")
+		filter := notDeleted(bson.M{"tax_rate_id": rateId})
+
+		var rate models.TaxRate
+		err := taxRateCollection.FindOne(ctx, filter).Decode(&rate)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "tax rate was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the tax rate"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(rate.Version)) {
+			return
+		}
+
+		var patched models.TaxRate
+		if err := applyMergePatch(c, rate, &patched); err != nil {
+			c.JSON(patchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		patched.ID = rate.ID
+		patched.Tax_rate_id = rate.Tax_rate_id
+		patched.Created_at = rate.Created_at
+		patched.Deleted_at = rate.Deleted_at
+		patched.Deleted_by = rate.Deleted_by
+		patched.Version = rate.Version + 1
+
+		if validatorErr := validate.Struct(patched); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		if *patched.Code != *rate.Code {
+			codeCount, err := taxRateCollection.CountDocuments(ctx, notDeleted(bson.M{"code": patched.Code}))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "tax rate failed to update"})
+				return
+			}
+			if codeCount > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "a tax rate with this code already exists"})
+				return
+			}
+		}
+
+		patched.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedRate models.TaxRate
+		err = taxRateCollection.FindOneAndReplace(
+			ctx,
+			matchVersion(filter, rate.Version),
+			patched,
+			options.FindOneAndReplace().SetReturnDocument(options.After),
+		).Decode(&updatedRate)
+
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the tax rate was modified by someone else, reload it and try again"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "tax rate failed to update"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedRate.Version))
+		c.JSON(http.StatusOK, updatedRate)
+	}
+}
+
+func DeleteTaxRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN, helper.MANAGER); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		rateId := c.Param("tax_rate_id")
+
+		var rate models.TaxRate
+		err := taxRateCollection.FindOne(ctx, notDeleted(bson.M{"tax_rate_id": rateId})).Decode(&rate)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "tax rate was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "tax rate failed to delete"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(rate.Version)) {
+			return
+		}
+
+		result, err := archiveRecord(ctx, taxRateCollection, matchVersion(bson.M{"tax_rate_id": rateId}, rate.Version), c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "tax rate failed to delete"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the tax rate was modified by someone else, reload it and try again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "tax rate deleted", "tax_rate_id": rateId})
+	}
+}
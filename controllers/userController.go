@@ -7,7 +7,8 @@ import (
 	"golang-restaurant-backend-app/models"
 	"log"
 	"net/http"
-	"strconv"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -24,56 +25,34 @@ func GetUsers() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		// Default pagination values
-		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
-		if err != nil || recordPerPage < 1 {
-			recordPerPage = 10
-		}
-
-		page, err := strconv.Atoi(c.Query("page"))
-		if err != nil || page < 1 {
-			page = 1
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
-		// Calculate start index for pagination
-		startIndex := (page - 1) * recordPerPage
-
-		// MongoDB aggregation pipeline stages
-		matchStage := bson.D{{Key: "$match", Value: bson.D{}}}
-		skipStage := bson.D{{Key: "$skip", Value: startIndex}}
-		limitStage := bson.D{{Key: "$limit", Value: recordPerPage}}
-		projectStage := bson.D{{Key: "$project", Value: bson.D{
-			{Key: "_id", Value: 0}, // Exclude MongoDB's default "_id" field
+		// Only expose public profile fields; _id is kept for the cursor
+		projection := bson.D{
+			{Key: "_id", Value: 1},
+			{Key: "user_id", Value: 1},
 			{Key: "email", Value: 1},
 			{Key: "first_name", Value: 1},
 			{Key: "last_name", Value: 1},
+			{Key: "user_type", Value: 1},
 			{Key: "created_at", Value: 1},
 			{Key: "updated_at", Value: 1},
-		}}}
-
-		// Perform aggregation
-		result, err := userCollection.Aggregate(ctx, mongo.Pipeline{
-			matchStage, skipStage, limitStage, projectStage,
-		})
+		}
 
+		page, err := helper.Paginate(ctx, userCollection, notDeleted(bson.M{}), params, projection)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users"})
-			return // Exit early if aggregation fails
-		}
-
-		// Decode aggregation results into a slice of maps
-		var allUsers []bson.M
-		if err = result.All(ctx, &allUsers); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		// Return response
-		if len(allUsers) > 0 {
-			c.JSON(http.StatusOK, allUsers)
-		} else {
-			c.JSON(http.StatusOK, gin.H{"message": "No users found"})
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
 		}
+		c.JSON(http.StatusOK, page)
 	}
 }
 
@@ -83,14 +62,27 @@ func GetUser() gin.HandlerFunc {
 
 		userId := c.Param("user_id")
 
-		var user models.Table
+		var user models.User
 
-		err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user)
+		err := userCollection.FindOne(ctx, notDeleted(bson.M{"user_id": userId})).Decode(&user)
 
 		defer cancel()
 
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user was not found"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the user"})
+			return
+		}
+
+		user.Password = nil
+		user.Token = nil
+		user.Refresh_Token = nil
+
+		if helper.CheckNotModified(c, helper.ETag(user.Version)) {
+			return
 		}
 		c.JSON(http.StatusOK, user)
 	}
@@ -115,10 +107,10 @@ func SignUp() gin.HandlerFunc {
 			return
 		}
 
-		// Check if email or phone number already exists
+		// Check if email or phone number already exists, emails in any case
 		emailOrPhoneExists, err := userCollection.CountDocuments(ctx, bson.M{
 			"$or": []bson.M{
-				{"email": user.Email},
+				{"email": emailPattern(*user.Email)},
 				{"phone": user.Phone},
 			},
 		})
@@ -136,14 +128,23 @@ func SignUp() gin.HandlerFunc {
 		password := HashPassword(*user.Password)
 		user.Password = &password
 
+		// Everybody starts as a server until an admin changes their user
+		// type. The ADMIN_EMAIL account is only made an admin at startup, by
+		// PromoteBootstrapAdmin, never by signing up.
+		userType := helper.SERVER
+		user.User_type = &userType
+
 		// Set user metadata
 		user.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		user.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		user.ID = primitive.NewObjectID()
 		user.User_id = user.ID.Hex()
+		user.Deleted_at = nil
+		user.Deleted_by = nil
+		user.Version = 1
 
 		// Generate JWT tokens
-		token, refreshToken, tokenErr := helper.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, user.User_id)
+		token, refreshToken, tokenErr := helper.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, user.User_id, *user.User_type)
 		if tokenErr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
 			return
@@ -179,7 +180,7 @@ func Login() gin.HandlerFunc {
 		}
 
 		// Find user by email
-		err := userCollection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&foundUser)
+		err := userCollection.FindOne(ctx, notDeleted(bson.M{"email": user.Email})).Decode(&foundUser)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			return
@@ -192,8 +193,13 @@ func Login() gin.HandlerFunc {
 			return
 		}
 
+		userType := ""
+		if foundUser.User_type != nil {
+			userType = *foundUser.User_type
+		}
+
 		// Generate tokens
-		token, refreshToken, err := helper.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, foundUser.User_id)
+		token, refreshToken, err := helper.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, foundUser.User_id, userType)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
 			return
@@ -214,6 +220,128 @@ func Login() gin.HandlerFunc {
 	}
 }
 
+func UpdateUserType() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		var user models.User
+		if err := c.BindJSON(&user); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if user.User_type == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_type is required"})
+			return
+		}
+		if err := validate.Var(*user.User_type, "eq=ADMIN|eq=MANAGER|eq=CASHIER|eq=SERVER"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_type must be one of ADMIN, MANAGER, CASHIER or SERVER"})
+			return
+		}
+
+		userId := c.Param("user_id")
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		result, err := userCollection.UpdateOne(
+			ctx,
+			notDeleted(bson.M{"user_id": userId}),
+			bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "user_type", Value: user.User_type},
+					{Key: "updated_at", Value: updatedAt},
+				}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user failed to update"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user was not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"user_id": userId, "user_type": user.User_type})
+	}
+}
+
+func DeleteUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		userId := c.Param("user_id")
+		if userId == c.GetString("uid") {
+			c.JSON(http.StatusConflict, gin.H{"error": "you cannot delete your own account"})
+			return
+		}
+
+		var user models.User
+		err := userCollection.FindOne(ctx, notDeleted(bson.M{"user_id": userId})).Decode(&user)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user failed to delete"})
+			return
+		}
+
+		if !helper.CheckIfMatch(c, helper.ETag(user.Version)) {
+			return
+		}
+
+		result, err := archiveRecord(ctx, userCollection, matchVersion(bson.M{"user_id": userId}, user.Version), c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user failed to delete"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the user was modified by someone else, reload it and try again"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "user deleted", "user_id": userId})
+	}
+}
+
+func RestoreUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := helper.CheckUserType(c, helper.ADMIN); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		userId := c.Param("user_id")
+
+		result, err := restoreRecord(ctx, userCollection, bson.M{"user_id": userId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user failed to restore"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no archived user with this id"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "user restored", "user_id": userId})
+	}
+}
+
 func HashPassword(password string) string {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
 	if err != nil {
@@ -234,3 +362,55 @@ func VerifyPassword(userPassword string, providedPassword string) (bool, string)
 	}
 	return check, msg
 }
+
+// emailPattern matches an email in any case.
+func emailPattern(email string) primitive.Regex {
+	return primitive.Regex{Pattern: "^" + regexp.QuoteMeta(strings.TrimSpace(email)) + "$", Options: "i"}
+}
+
+// PromoteBootstrapAdmin makes the ADMIN_EMAIL user an admin at startup. It is
+// the only way to become an admin other than being made one by an admin; a
+// user who signs up with ADMIN_EMAIL is promoted on the next start. Should
+// several accounts differ from it only in case, none is promoted.
+func PromoteBootstrapAdmin() {
+	email := helper.BootstrapAdminEmail()
+	if email == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	matching, err := userCollection.CountDocuments(ctx, notDeleted(bson.M{"email": emailPattern(email)}))
+	if err != nil {
+		log.Printf("failed to promote %s to admin: %v", email, err)
+		return
+	}
+	if matching > 1 {
+		log.Printf("not promoting %s to admin: %d accounts use that email in different cases", email, matching)
+		return
+	}
+
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	result, err := userCollection.UpdateOne(
+		ctx,
+		notDeleted(bson.M{
+			"email":     emailPattern(email),
+			"user_type": bson.M{"$ne": helper.ADMIN},
+		}),
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "user_type", Value: helper.ADMIN},
+				{Key: "updated_at", Value: updatedAt},
+			}},
+			{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+		},
+	)
+	if err != nil {
+		log.Printf("failed to promote %s to admin: %v", email, err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("promoted %s to admin", email)
+	}
+}
@@ -0,0 +1,565 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"golang-restaurant-backend-app/database"
+	helper "golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/notifier"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// time it takes to bus a dirty table or settle a table awaiting its bill
+	bussingTime     = 5 * time.Minute
+	settlingTime    = 15 * time.Minute
+	turnTimeHistory = 7 * 24 * time.Hour
+)
+
+var waitlistCollection *mongo.Collection = database.OpenCollection(database.Client, "waitlist")
+
+// waitlistNotifier tells waiting parties their table is ready.
+var waitlistNotifier notifier.Notifier = notifier.FromEnv()
+
+// SeatPartyRequest names the table a waiting party is offered or seated at.
+type SeatPartyRequest struct {
+	Table_id *string `json:"table_id" validate:"required"`
+}
+
+// defaultTurnTime is used until there is enough history, configured with
+// DEFAULT_TURN_MINUTES.
+func defaultTurnTime() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("DEFAULT_TURN_MINUTES")); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return 60 * time.Minute
+}
+
+// averageTurnTime is the mean time between seating a table and the last
+// payment that settled its invoice, over the last week.
+func averageTurnTime(ctx context.Context) (time.Duration, error) {
+	matchStage := bson.D{{Key: "$match", Value: bson.D{
+		{Key: "deleted_at", Value: nil},
+		{Key: "payments.paid_at", Value: bson.D{{Key: "$gte", Value: time.Now().Add(-turnTimeHistory)}}},
+	}}}
+	lookupStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "order"}, {Key: "localField", Value: "order_id"}, {Key: "foreignField", Value: "order_id"}, {Key: "as", Value: "order"}}}}
+	unwindStage := bson.D{{Key: "$unwind", Value: "$order"}}
+	paidStage := bson.D{{Key: "$match", Value: bson.D{{Key: "payment_status", Value: "PAID"}}}}
+	groupStage := bson.D{{Key: "$group", Value: bson.D{
+		{Key: "_id", Value: nil},
+		{Key: "turn_ms", Value: bson.D{{Key: "$avg", Value: bson.D{{Key: "$subtract", Value: bson.A{bson.D{{Key: "$max", Value: "$payments.paid_at"}}, "$order.created_at"}}}}}},
+	}}}
+
+	result, err := invoiceCollection.Aggregate(ctx, mongo.Pipeline{matchStage, paidStage, lookupStage, unwindStage, groupStage})
+	if err != nil {
+		return 0, err
+	}
+
+	var turns []struct {
+		Turn_ms float64 `bson:"turn_ms"`
+	}
+	if err = result.All(ctx, &turns); err != nil {
+		return 0, err
+	}
+
+	if len(turns) == 0 || turns[0].Turn_ms <= 0 {
+		return defaultTurnTime(), nil
+	}
+	return time.Duration(turns[0].Turn_ms) * time.Millisecond, nil
+}
+
+// tableFreeAt estimates when a table can take a new party, given its live
+// status and the reservations coming up on it.
+func tableFreeAt(table FloorTable, turnTime time.Duration, reservations []models.Reservation, now time.Time) time.Time {
+	freeAt := now
+
+	switch table.Status {
+	case TableDirty:
+		freeAt = now.Add(bussingTime)
+	case TableSeated, TableOrdering, TableAwaitingBill:
+		freeAt = now.Add(bussingTime)
+		if table.Since != nil && table.Since.Add(turnTime).After(freeAt) {
+			freeAt = table.Since.Add(turnTime)
+		}
+		if table.Status == TableAwaitingBill && freeAt.After(now.Add(settlingTime)) {
+			freeAt = now.Add(settlingTime)
+		}
+	}
+
+	// a walk-in cannot be seated if they would run into a booking
+	for _, reservation := range reservations {
+		if *reservation.Table_id != table.Table_id {
+			continue
+		}
+		if overlaps(freeAt, freeAt.Add(turnTime), *reservation.Start_time, reservation.End_time) {
+			freeAt = reservation.End_time
+		}
+	}
+
+	return freeAt
+}
+
+// quoteWait estimates how long a party of the given size will wait when
+// partiesAhead compatible parties are already queued.
+func quoteWait(ctx context.Context, partySize int, partiesAhead int) (time.Duration, error) {
+	now := time.Now()
+
+	tables, err := floorTables(ctx, bson.M{"number_of_guests": bson.M{"$gte": partySize}})
+	if err != nil {
+		return 0, err
+	}
+	if len(tables) == 0 {
+		return 0, errNoTableAvailable
+	}
+
+	turnTime, err := averageTurnTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tableIds := []string{}
+	for _, table := range tables {
+		tableIds = append(tableIds, table.Table_id)
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "start_time", Value: 1}})
+	result, err := reservationCollection.Find(ctx, notDeleted(bson.M{
+		"table_id":   bson.M{"$in": tableIds},
+		"status":     bson.M{"$in": activeReservationStatuses},
+		"end_time":   bson.M{"$gt": now},
+		"start_time": bson.M{"$lt": now.Add(12 * time.Hour)},
+	}), opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var reservations []models.Reservation
+	if err = result.All(ctx, &reservations); err != nil {
+		return 0, err
+	}
+
+	freeTimes := []time.Time{}
+	for _, table := range tables {
+		freeTimes = append(freeTimes, tableFreeAt(table, turnTime, reservations, now))
+	}
+	sort.Slice(freeTimes, func(i, j int) bool { return freeTimes[i].Before(freeTimes[j]) })
+
+	// parties ahead take the first tables; beyond that every table has to turn again
+	rounds := partiesAhead / len(freeTimes)
+	readyAt := freeTimes[partiesAhead%len(freeTimes)].Add(time.Duration(rounds) * turnTime)
+
+	if readyAt.Before(now) {
+		return 0, nil
+	}
+	return readyAt.Sub(now), nil
+}
+
+// partiesAhead counts the waiting parties that were queued before the given
+// time and could take the same tables.
+func partiesAhead(ctx context.Context, partySize int, before time.Time) (int, error) {
+	count, err := waitlistCollection.CountDocuments(ctx, notDeleted(bson.M{
+		"status":     bson.M{"$in": bson.A{"WAITING", "NOTIFIED"}},
+		"party_size": bson.M{"$lte": partySize},
+		"created_at": bson.M{"$lt": before},
+	}))
+	return int(count), err
+}
+
+func notifyWaitingParty(ctx context.Context, entry models.WaitlistEntry, tableId string) (models.WaitlistEntry, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	var updatedEntry models.WaitlistEntry
+	err := waitlistCollection.FindOneAndUpdate(
+		ctx,
+		notDeleted(bson.M{"waitlist_id": entry.Waitlist_id, "status": bson.M{"$in": bson.A{"WAITING", "NOTIFIED"}}}),
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "status", Value: "NOTIFIED"},
+				{Key: "table_id", Value: tableId},
+				{Key: "notified_at", Value: now},
+				{Key: "updated_at", Value: now},
+			}},
+			{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updatedEntry)
+	if err != nil {
+		return entry, err
+	}
+
+	message := notifier.Message{
+		Channel: notifier.SMS,
+		To:      *entry.Phone,
+		Subject: "Your table is ready",
+		Body:    fmt.Sprintf("Hi %s, your table for %d is ready. Please come to the host stand.", *entry.Party_name, *entry.Party_size),
+	}
+	if err := waitlistNotifier.Send(ctx, message); err != nil {
+		return updatedEntry, err
+	}
+
+	return updatedEntry, nil
+}
+
+// notifyWaitlistForTable offers a table that just became free to the first
+// waiting party it fits, unless the table is held for a reservation.
+func notifyWaitlistForTable(ctx context.Context, table models.Table) {
+	tables, err := floorTables(ctx, bson.M{"table_id": table.Table_id})
+	if err != nil || len(tables) == 0 || tables[0].Status != TableAvailable || table.Number_of_guests == nil {
+		return
+	}
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	var entry models.WaitlistEntry
+	err = waitlistCollection.FindOne(ctx, notDeleted(bson.M{
+		"status":     "WAITING",
+		"party_size": bson.M{"$lte": *table.Number_of_guests},
+	}), opts).Decode(&entry)
+	if err != nil {
+		return
+	}
+
+	if _, err := notifyWaitingParty(ctx, entry, table.Table_id); err != nil {
+		log.Printf("failed to notify waitlist entry %s: %v", entry.Waitlist_id, err)
+	}
+}
+
+func GetWaitlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		params, err := helper.GetPageParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := notDeleted(bson.M{"status": bson.M{"$in": bson.A{"WAITING", "NOTIFIED"}}})
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+
+		page, err := helper.Paginate(ctx, waitlistCollection, filter, params, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing the waitlist"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.BodyETag(page)) {
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func GetWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var entry models.WaitlistEntry
+		err := waitlistCollection.FindOne(ctx, notDeleted(bson.M{"waitlist_id": c.Param("waitlist_id")})).Decode(&entry)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "waitlist entry was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the waitlist entry"})
+			return
+		}
+
+		if helper.CheckNotModified(c, helper.ETag(entry.Version)) {
+			return
+		}
+		c.JSON(http.StatusOK, entry)
+	}
+}
+
+func GetWaitQuote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		partySize, err := strconv.Atoi(c.Query("party"))
+		if err != nil || partySize < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "party must be a positive number"})
+			return
+		}
+
+		ahead, err := partiesAhead(ctx, partySize, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while quoting the wait"})
+			return
+		}
+
+		wait, err := quoteWait(ctx, partySize, ahead)
+		if err == errNoTableAvailable {
+			c.JSON(http.StatusConflict, gin.H{"error": "no table can seat a party of this size"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while quoting the wait"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"party": partySize, "parties_ahead": ahead, "quoted_wait_minutes": int(wait.Round(time.Minute).Minutes())})
+	}
+}
+
+func AddToWaitlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var entry models.WaitlistEntry
+
+		if err := c.BindJSON(&entry); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		entry.Status = "WAITING"
+
+		if validatorErr := validate.Struct(entry); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		entry.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		entry.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		ahead, err := partiesAhead(ctx, *entry.Party_size, entry.Created_at)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while quoting the wait"})
+			return
+		}
+
+		wait, err := quoteWait(ctx, *entry.Party_size, ahead)
+		if err == errNoTableAvailable {
+			c.JSON(http.StatusConflict, gin.H{"error": "no table can seat a party of this size"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while quoting the wait"})
+			return
+		}
+
+		entry.ID = primitive.NewObjectID()
+		entry.Waitlist_id = entry.ID.Hex()
+		entry.Quoted_wait_minutes = int(wait.Round(time.Minute).Minutes())
+		entry.Table_id = nil
+		entry.Order_id = nil
+		entry.Notified_at = nil
+		entry.Seated_at = nil
+		entry.Deleted_at = nil
+		entry.Deleted_by = nil
+		entry.Version = 1
+
+		if _, insertErr := waitlistCollection.InsertOne(ctx, entry); insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while adding the party to the waitlist"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(entry.Version))
+		c.JSON(http.StatusCreated, entry)
+	}
+}
+
+func NotifyWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request SeatPartyRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validatorErr := validate.Struct(request); validatorErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validatorErr.Error()})
+			return
+		}
+
+		var entry models.WaitlistEntry
+		err := waitlistCollection.FindOne(ctx, notDeleted(bson.M{"waitlist_id": c.Param("waitlist_id")})).Decode(&entry)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "waitlist entry was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the waitlist entry"})
+			return
+		}
+
+		var table models.Table
+		if err := tableCollection.FindOne(ctx, notDeleted(bson.M{"table_id": request.Table_id})).Decode(&table); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "table was not found"})
+			return
+		}
+
+		updatedEntry, err := notifyWaitingParty(ctx, entry, table.Table_id)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusConflict, gin.H{"error": "the party is no longer waiting"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "the party could not be notified"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedEntry.Version))
+		c.JSON(http.StatusOK, updatedEntry)
+	}
+}
+
+// SeatWaitlistEntry seats a waiting party at a table and opens their order.
+func SeatWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request SeatPartyRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.BindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		var entry models.WaitlistEntry
+		err := waitlistCollection.FindOne(ctx, notDeleted(bson.M{"waitlist_id": c.Param("waitlist_id")})).Decode(&entry)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "waitlist entry was not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the waitlist entry"})
+			return
+		}
+
+		if entry.Status != "WAITING" && entry.Status != "NOTIFIED" {
+			c.JSON(http.StatusConflict, gin.H{"error": "the party is no longer waiting"})
+			return
+		}
+
+		// seat them at the table they were offered unless the host picks another
+		if request.Table_id == nil {
+			request.Table_id = entry.Table_id
+		}
+		if request.Table_id == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "table_id is required"})
+			return
+		}
+
+		var table models.Table
+		if err := tableCollection.FindOne(ctx, notDeleted(bson.M{"table_id": request.Table_id})).Decode(&table); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "table was not found"})
+			return
+		}
+		if table.Combined_with != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": errTableCombined.Error()})
+			return
+		}
+
+		capacity, err := tableCapacity(ctx, table)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while seating the party"})
+			return
+		}
+		if capacity < *entry.Party_size {
+			c.JSON(http.StatusConflict, gin.H{"error": "the table is too small for this party"})
+			return
+		}
+
+		hasOpenOrders, err := tableHasOpenOrders(ctx, table.Table_id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while seating the party"})
+			return
+		}
+		if hasOpenOrders {
+			c.JSON(http.StatusConflict, gin.H{"error": "the table is still occupied"})
+			return
+		}
+
+		var order models.Order
+		order.Order_date = time.Now()
+		order.Table_id = &table.Table_id
+		order.Guests = entry.Party_size
+		uid := c.GetString("uid")
+		order.Server_id = &uid
+		orderId := OrderItemOrderCreated(order)
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedEntry models.WaitlistEntry
+		err = waitlistCollection.FindOneAndUpdate(
+			ctx,
+			matchVersion(notDeleted(bson.M{"waitlist_id": entry.Waitlist_id}), entry.Version),
+			bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "status", Value: "SEATED"},
+					{Key: "table_id", Value: table.Table_id},
+					{Key: "order_id", Value: orderId},
+					{Key: "seated_at", Value: now},
+					{Key: "updated_at", Value: now},
+				}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedEntry)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while seating the party"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedEntry.Version))
+		c.JSON(http.StatusOK, updatedEntry)
+	}
+}
+
+func CancelWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		var updatedEntry models.WaitlistEntry
+		err := waitlistCollection.FindOneAndUpdate(
+			ctx,
+			notDeleted(bson.M{"waitlist_id": c.Param("waitlist_id"), "status": bson.M{"$in": bson.A{"WAITING", "NOTIFIED"}}}),
+			bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "status", Value: "CANCELLED"},
+					{Key: "updated_at", Value: now},
+				}},
+				{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updatedEntry)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no waiting party with this id"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while cancelling the waitlist entry"})
+			return
+		}
+
+		c.Header("ETag", helper.ETag(updatedEntry.Version))
+		c.JSON(http.StatusOK, updatedEntry)
+	}
+}
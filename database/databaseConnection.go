@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"fmt"
+	"golang-restaurant-backend-app/money"
 	"log"
 	"time"
 
@@ -15,7 +16,7 @@ func DBinstance() *mongo.Client {
 
 	fmt.Print(MongoDb)
 
-	client, err := mongo.NewClient(options.Client().ApplyURI(MongoDb))
+	client, err := mongo.NewClient(options.Client().ApplyURI(MongoDb).SetRegistry(money.Registry()))
 	if err != nil {
 		log.Fatal(err)
 	}
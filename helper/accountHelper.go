@@ -0,0 +1,192 @@
+package helper
+
+import (
+	"errors"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of statement lines.
+const (
+	LineInvoice = "INVOICE"
+	LineLateFee = "LATE_FEE"
+	LinePayment = "PAYMENT"
+	LineCredit  = "CREDIT"
+)
+
+var (
+	ErrAccountSuspended = errors.New("the account is suspended")
+	ErrCreditLimit      = errors.New("the charge would take the account over its credit limit")
+	ErrAlreadyCharged   = errors.New("the invoice is already charged to an account")
+	ErrNothingDue       = errors.New("nothing is due on the invoice")
+)
+
+// PaymentTermsDays is how long an account has to pay a charge, 30 days
+// unless the account says otherwise.
+func PaymentTermsDays(account models.CustomerAccount) int {
+	if account.Payment_terms_days != nil {
+		return *account.Payment_terms_days
+	}
+	return 30
+}
+
+// AccountBalance is what is owed on the invoices charged to an account.
+func AccountBalance(invoices []models.Invoice) money.Money {
+	balance := money.Zero()
+	for _, invoice := range invoices {
+		if due := InvoiceDue(invoice); due.IsPositive() {
+			balance = balance.Add(due)
+		}
+	}
+	return balance
+}
+
+// ChargeToAccount puts what is due on an invoice on the account, as long as
+// it stays within the credit limit given the account's balance. The invoice
+// is then due after the account's payment terms.
+func ChargeToAccount(invoice *models.Invoice, account models.CustomerAccount, balance money.Money, at time.Time) error {
+	if account.Suspended {
+		return ErrAccountSuspended
+	}
+	if invoice.Draft {
+		return ErrInvoiceDraft
+	}
+	if invoice.Account_id != nil {
+		return ErrAlreadyCharged
+	}
+	if invoice.Payment_status != nil && *invoice.Payment_status == InvoicePaid {
+		return ErrInvoicePaid
+	}
+	due := InvoiceDue(*invoice)
+	if !due.IsPositive() {
+		return ErrNothingDue
+	}
+	if balance.Add(due).Cmp(money.Value(account.Credit_limit)) > 0 {
+		return ErrCreditLimit
+	}
+
+	invoice.Account_id = &account.Customer_account_id
+	invoice.Account_charge = &due
+	invoice.Charged_at = &at
+	invoice.Payment_due_date = at.AddDate(0, 0, PaymentTermsDays(account))
+	if invoice.Billing_email == nil {
+		invoice.Billing_email = account.Email
+	}
+	if invoice.Billing_phone == nil {
+		invoice.Billing_phone = account.Phone
+	}
+	return nil
+}
+
+// AllocateAccountPayment splits an amount over invoices in the order given,
+// settling each in full before moving on to the next. It fails when the
+// amount is more than the invoices owe.
+func AllocateAccountPayment(invoices []models.Invoice, amount money.Money) ([]money.Money, error) {
+	parts := make([]money.Money, len(invoices))
+	remaining := amount
+	for i, invoice := range invoices {
+		due := InvoiceDue(invoice)
+		if !due.IsPositive() {
+			parts[i] = money.Zero()
+			continue
+		}
+		parts[i] = money.Min(due, remaining)
+		remaining = remaining.Sub(parts[i])
+	}
+	if remaining.IsPositive() {
+		return nil, ErrOverpayment
+	}
+	return parts, nil
+}
+
+func invoiceReference(invoice models.Invoice) string {
+	if invoice.Invoice_number != nil {
+		return *invoice.Invoice_number
+	}
+	return invoice.Invoice_id
+}
+
+// AccountLedger lists everything that moved the balance of an account: the
+// invoices charged to it, late fees on them, payments taken on them after
+// they were charged and credit notes issued on them, oldest first. Tips are
+// left out, they were never on the account.
+func AccountLedger(invoices []models.Invoice, credits []models.CreditNote) []models.StatementLine {
+	lines := []models.StatementLine{}
+	chargedAt := map[string]time.Time{}
+	references := map[string]string{}
+
+	for _, invoice := range invoices {
+		if invoice.Charged_at == nil {
+			continue
+		}
+		reference := invoiceReference(invoice)
+		chargedAt[invoice.Invoice_id] = *invoice.Charged_at
+		references[invoice.Invoice_id] = reference
+
+		lines = append(lines, models.StatementLine{
+			Date: *invoice.Charged_at, Kind: LineInvoice, Invoice_id: invoice.Invoice_id, Reference: reference,
+			Description: "Invoice " + reference, Amount: money.Value(invoice.Account_charge),
+		})
+		for _, fee := range invoice.Late_fees {
+			if fee.Waived_at == nil {
+				lines = append(lines, models.StatementLine{
+					Date: fee.Charged_at, Kind: LineLateFee, Invoice_id: invoice.Invoice_id, Reference: reference,
+					Description: "Late fee on " + reference, Amount: fee.Amount,
+				})
+			}
+		}
+		for _, payment := range invoice.Payments {
+			if payment.Paid_at.Before(*invoice.Charged_at) {
+				continue
+			}
+			lines = append(lines, models.StatementLine{
+				Date: payment.Paid_at, Kind: LinePayment, Invoice_id: invoice.Invoice_id, Reference: reference,
+				Description: "Payment on " + reference + " (" + strings.ToLower(payment.Method) + ")",
+				Amount:      payment.Amount.Sub(payment.Tip).Neg(),
+			})
+		}
+	}
+
+	for _, credit := range credits {
+		charged, ok := chargedAt[credit.Invoice_id]
+		if !ok || credit.Created_at.Before(charged) {
+			continue
+		}
+		reference := references[credit.Invoice_id]
+		lines = append(lines, models.StatementLine{
+			Date: credit.Created_at, Kind: LineCredit, Invoice_id: credit.Invoice_id, Reference: reference,
+			Description: "Credit note on " + reference, Amount: credit.Amount.Sub(credit.Refunded).Neg(),
+		})
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Date.Before(lines[j].Date) })
+	return lines
+}
+
+// BuildStatement fills in a statement for the period from the ledger of the
+// account: the balance carried in, the lines of the period and the balance
+// carried out.
+func BuildStatement(statement *models.AccountStatement, ledger []models.StatementLine) {
+	statement.Opening_balance = money.Zero()
+	statement.Charges = money.Zero()
+	statement.Credits = money.Zero()
+	statement.Lines = []models.StatementLine{}
+
+	for _, line := range ledger {
+		switch {
+		case line.Date.Before(statement.Period_start):
+			statement.Opening_balance = statement.Opening_balance.Add(line.Amount)
+		case line.Date.Before(statement.Period_end):
+			statement.Lines = append(statement.Lines, line)
+			if line.Amount.IsNegative() {
+				statement.Credits = statement.Credits.Add(line.Amount.Neg())
+			} else {
+				statement.Charges = statement.Charges.Add(line.Amount)
+			}
+		}
+	}
+	statement.Closing_balance = statement.Opening_balance.Add(statement.Charges).Sub(statement.Credits)
+}
@@ -0,0 +1,33 @@
+package helper
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ADMIN   = "ADMIN"
+	MANAGER = "MANAGER"
+	CASHIER = "CASHIER"
+	SERVER  = "SERVER"
+)
+
+// CheckUserType makes sure the authenticated user has one of the given roles.
+func CheckUserType(c *gin.Context, roles ...string) error {
+	userType := c.GetString("user_type")
+	for _, role := range roles {
+		if userType == role {
+			return nil
+		}
+	}
+	return errors.New("unauthorized to access this resource")
+}
+
+// BootstrapAdminEmail is the user from ADMIN_EMAIL who is made an admin at
+// startup, so a database with users but no admin can still be managed.
+func BootstrapAdminEmail() string {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("ADMIN_EMAIL")))
+}
@@ -0,0 +1,48 @@
+package helper
+
+import (
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"math/big"
+)
+
+const (
+	CreditVoid   = "VOID"
+	CreditRefund = "REFUND"
+)
+
+// DiffTaxLines is the tax that went away between two pricings of an order.
+func DiffTaxLines(before []models.TaxLine, after []models.TaxLine) []models.TaxLine {
+	remaining := map[string]models.TaxLine{}
+	for _, line := range after {
+		remaining[line.Tax_rate_id] = line
+	}
+
+	lines := []models.TaxLine{}
+	for _, line := range before {
+		if other, ok := remaining[line.Tax_rate_id]; ok {
+			line.Taxable_amount = line.Taxable_amount.Sub(other.Taxable_amount)
+			line.Amount = line.Amount.Sub(other.Amount)
+		}
+		if !line.Amount.IsZero() || !line.Taxable_amount.IsZero() {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// ProrateTaxLines is the tax inside part of an invoice total, in proportion
+// to the part.
+func ProrateTaxLines(taxLines []models.TaxLine, part money.Money, total money.Money) []models.TaxLine {
+	lines := []models.TaxLine{}
+	if !total.IsPositive() {
+		return lines
+	}
+	share := new(big.Rat).Quo(part.Rat(), total.Rat())
+	for _, line := range taxLines {
+		line.Taxable_amount = line.Taxable_amount.Mul(share)
+		line.Amount = line.Amount.Mul(share)
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,66 @@
+package helper
+
+import (
+	"errors"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+)
+
+const (
+	DayOpen   = "OPEN"
+	DayClosed = "CLOSED"
+
+	DrawerOpen   = "OPEN"
+	DrawerClosed = "CLOSED"
+
+	DrawerDrop   = "DROP"
+	DrawerPayout = "PAYOUT"
+	DrawerPayIn  = "PAY_IN"
+
+	XReport = "X"
+	ZReport = "Z"
+)
+
+var (
+	ErrDayAlreadyOpen = errors.New("a business day is already open for this branch")
+	ErrDayClosed      = errors.New("the business day is closed")
+	ErrDrawersOpen    = errors.New("every drawer has to be counted before the day is closed")
+	ErrDrawerInUse    = errors.New("this drawer is already open")
+	ErrDrawerClosed   = errors.New("the drawer is closed")
+)
+
+// SummarizeDrawer works out the cash a drawer should hold: the float, plus
+// cash sales and pay ins, less cash refunds, drops and payouts. Once it is
+// counted the variance is what was counted over what was expected.
+func SummarizeDrawer(session models.DrawerSession, cashSales money.Money, cashRefunds money.Money) models.DrawerSummary {
+	summary := models.DrawerSummary{
+		Drawer_session_id: session.Drawer_session_id,
+		Drawer:            *session.Drawer,
+		Status:            session.Status,
+		Opening_float:     money.Value(session.Opening_float),
+		Cash_sales:        cashSales,
+		Cash_refunds:      cashRefunds,
+		Drops:             money.Zero(),
+		Payouts:           money.Zero(),
+		Pay_ins:           money.Zero(),
+		Counted_cash:      session.Counted_cash,
+	}
+	for _, movement := range session.Movements {
+		switch *movement.Kind {
+		case DrawerDrop:
+			summary.Drops = summary.Drops.Add(movement.Amount)
+		case DrawerPayout:
+			summary.Payouts = summary.Payouts.Add(movement.Amount)
+		case DrawerPayIn:
+			summary.Pay_ins = summary.Pay_ins.Add(movement.Amount)
+		}
+	}
+
+	summary.Expected_cash = summary.Opening_float.Add(cashSales).Add(summary.Pay_ins).
+		Sub(cashRefunds).Sub(summary.Drops).Sub(summary.Payouts)
+	if session.Counted_cash != nil {
+		variance := session.Counted_cash.Sub(summary.Expected_cash)
+		summary.Variance = &variance
+	}
+	return summary
+}
@@ -0,0 +1,74 @@
+package helper
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag builds the strong entity tag of a versioned record.
+func ETag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// BodyETag builds a weak entity tag from the JSON representation of a
+// response that has no version of its own, like a list page.
+func BodyETag(body interface{}) string {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return ""
+	}
+	sum := sha1.Sum(raw)
+	return `W/"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// ETagMatches reports whether an If-Match / If-None-Match header value
+// matches the given entity tag. Weak tags compare by their opaque value.
+func ETagMatches(header string, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckNotModified sets the ETag header and answers 304 when the client
+// already holds this representation. Callers stop when it returns true.
+func CheckNotModified(c *gin.Context, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	c.Header("ETag", etag)
+
+	if header := c.GetHeader("If-None-Match"); header != "" && ETagMatches(header, etag) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// CheckIfMatch enforces optimistic concurrency on writes. It answers 428 when
+// If-Match is missing and 412 when it does not match the current version.
+func CheckIfMatch(c *gin.Context, etag string) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header is required"})
+		return false
+	}
+	if !ETagMatches(header, etag) {
+		c.Header("ETag", etag)
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "the record was modified by someone else, reload it and try again"})
+		return false
+	}
+	return true
+}
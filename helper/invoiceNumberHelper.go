@@ -0,0 +1,46 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// InvoiceNumberFormat is the layout of invoice numbers, from
+// INVOICE_NUMBER_FORMAT. {branch}, {year} and {seq} are filled in; put
+// {branch} in it when several branches share a database.
+func InvoiceNumberFormat() string {
+	if format := os.Getenv("INVOICE_NUMBER_FORMAT"); format != "" {
+		return format
+	}
+	return "INV-{year}-{seq}"
+}
+
+// InvoiceNumberDigits is how many digits the sequence is padded to, from
+// INVOICE_NUMBER_DIGITS.
+func InvoiceNumberDigits() int {
+	if digits, err := strconv.Atoi(os.Getenv("INVOICE_NUMBER_DIGITS")); err == nil && digits > 0 {
+		return digits
+	}
+	return 6
+}
+
+// BranchCode is the branch this server bills for, from BRANCH_CODE. Each
+// branch numbers its invoices on its own.
+func BranchCode() string {
+	if branch := os.Getenv("BRANCH_CODE"); branch != "" {
+		return branch
+	}
+	return "MAIN"
+}
+
+// FormatInvoiceNumber fills in an invoice number format, for example
+// INV-{year}-{seq} gives INV-2026-000123.
+func FormatInvoiceNumber(format string, branch string, year int, seq int64, digits int) string {
+	return strings.NewReplacer(
+		"{branch}", branch,
+		"{year}", strconv.Itoa(year),
+		"{seq}", fmt.Sprintf("%0*d", digits, seq),
+	).Replace(format)
+}
@@ -0,0 +1,51 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidMergePatch = errors.New("merge patch must be a JSON object")
+
+// MergePatch applies an RFC 7396 JSON Merge Patch to the original document
+// and returns the merged document.
+func MergePatch(original []byte, patch []byte) ([]byte, error) {
+	var patchDoc interface{}
+	if err := json.Unmarshal(patch, &patchDoc); err != nil {
+		return nil, err
+	}
+	if _, ok := patchDoc.(map[string]interface{}); !ok {
+		return nil, ErrInvalidMergePatch
+	}
+
+	var originalDoc interface{}
+	if len(original) > 0 {
+		if err := json.Unmarshal(original, &originalDoc); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(mergeValue(originalDoc, patchDoc))
+}
+
+func mergeValue(target interface{}, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = mergeValue(targetObj[key], value)
+	}
+
+	return targetObj
+}
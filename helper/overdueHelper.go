@@ -0,0 +1,153 @@
+package helper
+
+import (
+	"errors"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrLateFeeNotFound = errors.New("the late fee was not found on this invoice")
+	ErrLateFeeWaived   = errors.New("the late fee is already waived")
+)
+
+// Aging buckets of the unpaid invoices, by days past their due date.
+const (
+	AgingCurrent = "CURRENT"
+	Aging0to30   = "0-30"
+	Aging31to60  = "31-60"
+	Aging60Plus  = "60+"
+)
+
+// ReminderDays are the days past the due date a reminder goes out on, from
+// REMINDER_DAYS as a comma separated list. An empty list sends none.
+func ReminderDays() []int {
+	value, ok := os.LookupEnv("REMINDER_DAYS")
+	if !ok {
+		value = "1,7,14,30"
+	}
+	days := []int{}
+	for _, part := range strings.Split(value, ",") {
+		if day, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && day >= 0 {
+			days = append(days, day)
+		}
+	}
+	sort.Ints(days)
+	return days
+}
+
+// LateFeePolicy is what an overdue invoice is charged: a flat Amount plus a
+// Percent of what is due, once it is more than Grace_days overdue and again
+// every Interval_days after that if set.
+type LateFeePolicy struct {
+	Amount        money.Money
+	Percent       float64
+	Grace_days    int
+	Interval_days int
+}
+
+// LateFeePolicyFromEnv reads the policy from LATE_FEE_AMOUNT,
+// LATE_FEE_PERCENT, LATE_FEE_GRACE_DAYS and LATE_FEE_INTERVAL_DAYS. Without
+// an amount or percent no fees are charged.
+func LateFeePolicyFromEnv() LateFeePolicy {
+	policy := LateFeePolicy{Amount: money.Zero()}
+	if amount, err := money.Parse(os.Getenv("LATE_FEE_AMOUNT")); err == nil && amount.IsPositive() {
+		policy.Amount = amount
+	}
+	if percent, err := strconv.ParseFloat(os.Getenv("LATE_FEE_PERCENT"), 64); err == nil && percent > 0 {
+		policy.Percent = percent
+	}
+	if days, err := strconv.Atoi(os.Getenv("LATE_FEE_GRACE_DAYS")); err == nil && days > 0 {
+		policy.Grace_days = days
+	}
+	if days, err := strconv.Atoi(os.Getenv("LATE_FEE_INTERVAL_DAYS")); err == nil && days > 0 {
+		policy.Interval_days = days
+	}
+	return policy
+}
+
+func (p LateFeePolicy) Enabled() bool {
+	return p.Amount.IsPositive() || p.Percent > 0
+}
+
+// FeesDue is how many fees an invoice that many days overdue should have
+// been charged in all.
+func (p LateFeePolicy) FeesDue(daysOverdue int) int {
+	if !p.Enabled() || daysOverdue <= p.Grace_days {
+		return 0
+	}
+	if p.Interval_days == 0 {
+		return 1
+	}
+	return 1 + (daysOverdue-p.Grace_days-1)/p.Interval_days
+}
+
+// Fee is the fee on an amount left unpaid. Fees are not charged on earlier
+// fees.
+func (p LateFeePolicy) Fee(unpaid money.Money) money.Money {
+	return p.Amount.Add(unpaid.Percent(p.Percent))
+}
+
+// DaysOverdue is how many whole days have passed since an invoice was due,
+// negative before it is due.
+func DaysOverdue(invoice models.Invoice, now time.Time) int {
+	if now.Before(invoice.Payment_due_date) {
+		return -1
+	}
+	return int(now.Sub(invoice.Payment_due_date) / (24 * time.Hour))
+}
+
+// AgingBucket is the aging bucket of an invoice that many days overdue.
+func AgingBucket(daysOverdue int) string {
+	switch {
+	case daysOverdue < 0:
+		return AgingCurrent
+	case daysOverdue <= 30:
+		return Aging0to30
+	case daysOverdue <= 60:
+		return Aging31to60
+	}
+	return Aging60Plus
+}
+
+// lateFeeTotal adds up the fees that are not waived.
+func lateFeeTotal(invoice models.Invoice) money.Money {
+	total := money.Zero()
+	for _, fee := range invoice.Late_fees {
+		if fee.Waived_at == nil {
+			total = total.Add(fee.Amount)
+		}
+	}
+	return total
+}
+
+// ChargeLateFee adds a fee to what is due on the invoice.
+func ChargeLateFee(invoice *models.Invoice, fee models.LateFee) {
+	invoice.Late_fees = append(invoice.Late_fees, fee)
+	invoice.Late_fee_total = money.Ptr(lateFeeTotal(*invoice))
+	SettleStatus(invoice)
+}
+
+// WaiveLateFee takes a fee back off what is due, keeping it on the invoice.
+func WaiveLateFee(invoice *models.Invoice, feeId string, by string, at time.Time) error {
+	for i := range invoice.Late_fees {
+		fee := &invoice.Late_fees[i]
+		if fee.Late_fee_id != feeId {
+			continue
+		}
+		if fee.Waived_at != nil {
+			return ErrLateFeeWaived
+		}
+		fee.Waived_at = &at
+		fee.Waived_by = &by
+		invoice.Late_fee_total = money.Ptr(lateFeeTotal(*invoice))
+		SettleStatus(invoice)
+		return nil
+	}
+	return ErrLateFeeNotFound
+}
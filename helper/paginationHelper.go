@@ -0,0 +1,191 @@
+package helper
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"golang-restaurant-backend-app/money"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultPageLimit = 10
+	maxPageLimit     = 100
+)
+
+// PageParams describes how a list endpoint should be paged. Cursor paging
+// (after/before) is preferred; Page is only used when no cursor is given.
+type PageParams struct {
+	Limit     int
+	Page      int
+	After     *primitive.ObjectID
+	Before    *primitive.ObjectID
+	WithTotal bool
+}
+
+// PageResponse is the envelope returned by every list endpoint.
+type PageResponse struct {
+	Data        []bson.M `json:"data"`
+	Next_cursor *string  `json:"next_cursor"`
+	Prev_cursor *string  `json:"prev_cursor"`
+	Total       *int64   `json:"total,omitempty"`
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// GetPageParams reads limit, cursor, before, page and total from the query
+// string. recordPerPage is still accepted as an alias for limit.
+func GetPageParams(c *gin.Context) (PageParams, error) {
+	params := PageParams{Limit: defaultPageLimit}
+
+	limit := c.Query("limit")
+	if limit == "" {
+		limit = c.Query("recordPerPage")
+	}
+	if n, err := strconv.Atoi(limit); err == nil && n > 0 {
+		params.Limit = n
+	}
+	if params.Limit > maxPageLimit {
+		params.Limit = maxPageLimit
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		id, err := DecodeCursor(cursor)
+		if err != nil {
+			return params, err
+		}
+		params.After = &id
+	}
+
+	if cursor := c.Query("before"); cursor != "" {
+		id, err := DecodeCursor(cursor)
+		if err != nil {
+			return params, err
+		}
+		params.Before = &id
+	}
+
+	if params.After != nil && params.Before != nil {
+		return params, errors.New("cursor and before cannot be combined")
+	}
+
+	if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 0 {
+		params.Page = page
+	}
+
+	params.WithTotal, _ = strconv.ParseBool(c.Query("total"))
+
+	return params, nil
+}
+
+func EncodeCursor(id primitive.ObjectID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id.Hex()))
+}
+
+func DecodeCursor(cursor string) (primitive.ObjectID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return primitive.NilObjectID, ErrInvalidCursor
+	}
+	id, err := primitive.ObjectIDFromHex(string(raw))
+	if err != nil {
+		return primitive.NilObjectID, ErrInvalidCursor
+	}
+	return id, nil
+}
+
+// Paginate runs a keyset query over _id and wraps the result in a
+// PageResponse. Documents are always returned in ascending _id order.
+func Paginate(ctx context.Context, collection *mongo.Collection, filter bson.M, params PageParams, projection interface{}) (PageResponse, error) {
+	var response PageResponse
+
+	query := bson.M{}
+	for key, value := range filter {
+		query[key] = value
+	}
+
+	opts := options.Find().SetLimit(int64(params.Limit + 1))
+	if projection != nil {
+		opts.SetProjection(projection)
+	}
+
+	backwards := params.Before != nil
+	switch {
+	case params.After != nil:
+		query["_id"] = bson.M{"$gt": *params.After}
+		opts.SetSort(bson.D{{Key: "_id", Value: 1}})
+	case backwards:
+		query["_id"] = bson.M{"$lt": *params.Before}
+		opts.SetSort(bson.D{{Key: "_id", Value: -1}})
+	default:
+		opts.SetSort(bson.D{{Key: "_id", Value: 1}})
+		if params.Page > 1 {
+			opts.SetSkip(int64((params.Page - 1) * params.Limit))
+		}
+	}
+
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return response, err
+	}
+
+	var docs []bson.M
+	if err = cursor.All(ctx, &docs); err != nil {
+		return response, err
+	}
+
+	hasMore := len(docs) > params.Limit
+	if hasMore {
+		docs = docs[:params.Limit]
+	}
+
+	if backwards {
+		for i, j := 0, len(docs)-1; i < j; i, j = i+1, j-1 {
+			docs[i], docs[j] = docs[j], docs[i]
+		}
+	}
+
+	if docs == nil {
+		docs = []bson.M{}
+	}
+	// amounts of money are listed as numbers, as they are everywhere else
+	money.Decimals(docs)
+	response.Data = docs
+
+	if len(docs) > 0 {
+		first, _ := docs[0]["_id"].(primitive.ObjectID)
+		last, _ := docs[len(docs)-1]["_id"].(primitive.ObjectID)
+
+		hasNext := hasMore
+		hasPrev := params.After != nil || params.Page > 1
+		if backwards {
+			hasNext = true
+			hasPrev = hasMore
+		}
+
+		if hasNext {
+			next := EncodeCursor(last)
+			response.Next_cursor = &next
+		}
+		if hasPrev {
+			prev := EncodeCursor(first)
+			response.Prev_cursor = &prev
+		}
+	}
+
+	if params.WithTotal {
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return response, err
+		}
+		response.Total = &total
+	}
+
+	return response, nil
+}
@@ -0,0 +1,137 @@
+package helper
+
+import (
+	"errors"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+)
+
+const (
+	CARD    = "CARD"
+	CASH    = "CASH"
+	ACCOUNT = "ACCOUNT"
+	MIXED   = "MIXED"
+
+	InvoicePending       = "PENDING"
+	InvoicePartiallyPaid = "PARTIALLY_PAID"
+	InvoicePaid          = "PAID"
+	// InvoiceVoid marks the archived record of an invoice number that was
+	// taken but never used.
+	InvoiceVoid = "VOID"
+)
+
+var (
+	ErrInvoicePaid   = errors.New("the invoice is already paid")
+	ErrInvoiceDraft  = errors.New("the invoice is a draft, issue it first")
+	ErrOverpayment   = errors.New("the payment is more than what is outstanding")
+	ErrShortTender   = errors.New("the cash tendered does not cover the payment")
+	ErrSplitNotFound = errors.New("the split was not found on this invoice")
+	ErrSplitPaid     = errors.New("the split is already paid")
+)
+
+// InvoiceDue is what is left to pay on an invoice. Credit notes lower it,
+// money refunded on them raises it again, and so do late fees.
+func InvoiceDue(invoice models.Invoice) money.Money {
+	return money.Value(invoice.Total).
+		Sub(money.Value(invoice.Amount_paid)).
+		Sub(money.Value(invoice.Credited)).
+		Add(money.Value(invoice.Refunded)).
+		Add(money.Value(invoice.Late_fee_total))
+}
+
+// SettleStatus works out the outstanding amount and the status of an invoice
+// from its payments and credits.
+func SettleStatus(invoice *models.Invoice) {
+	outstanding := InvoiceDue(*invoice)
+	invoice.Outstanding = &outstanding
+
+	status := InvoicePending
+	switch {
+	case !outstanding.IsPositive() && (len(invoice.Payments) > 0 || money.Value(invoice.Credited).IsPositive()):
+		status = InvoicePaid
+		for i := range invoice.Splits {
+			invoice.Splits[i].Paid = true
+		}
+		invoice.Overdue_at = nil
+	case len(invoice.Payments) > 0:
+		status = InvoicePartiallyPaid
+	}
+	invoice.Payment_status = &status
+}
+
+// ApplyPayment records a payment on the invoice. The payment comes in with
+// the amount to put towards the bill, or zero for all that is due on the
+// invoice or its split, and any tip. It leaves with Amount holding what was
+// charged including the tip and, for cash, the change due.
+func ApplyPayment(invoice *models.Invoice, payment *models.Payment) error {
+	if invoice.Draft {
+		return ErrInvoiceDraft
+	}
+	if invoice.Payment_status != nil && *invoice.Payment_status == InvoicePaid {
+		return ErrInvoicePaid
+	}
+
+	due := InvoiceDue(*invoice)
+	var split *models.BillSplit
+	if payment.Split_id != nil {
+		for i := range invoice.Splits {
+			if invoice.Splits[i].Split_id == *payment.Split_id {
+				split = &invoice.Splits[i]
+			}
+		}
+		if split == nil {
+			return ErrSplitNotFound
+		}
+		if split.Paid {
+			return ErrSplitPaid
+		}
+		// credits may leave less to pay than the split still shows
+		due = money.Min(due, split.Amount.Sub(split.Amount_paid))
+	}
+
+	amount := payment.Amount
+	if amount.IsZero() {
+		amount = due
+	}
+	if amount.Cmp(due) > 0 {
+		return ErrOverpayment
+	}
+
+	charged := amount.Add(payment.Tip)
+	if payment.Method == CASH {
+		if payment.Tendered.IsZero() {
+			payment.Tendered = charged
+		}
+		if payment.Tendered.Cmp(charged) < 0 {
+			return ErrShortTender
+		}
+		payment.Change = payment.Tendered.Sub(charged)
+	} else {
+		payment.Tendered = charged
+		payment.Change = money.Zero()
+	}
+	payment.Amount = charged
+
+	if split != nil {
+		split.Amount_paid = split.Amount_paid.Add(amount)
+		split.Paid = split.Amount_paid.Cmp(split.Amount) >= 0
+	}
+
+	if payment.Tip.IsPositive() {
+		invoice.Tip = money.Ptr(money.Value(invoice.Tip).Add(payment.Tip))
+		invoice.Total = money.Ptr(money.Value(invoice.Total).Add(payment.Tip))
+	}
+	invoice.Amount_paid = money.Ptr(money.Value(invoice.Amount_paid).Add(charged))
+
+	method := payment.Method
+	for _, previous := range invoice.Payments {
+		if previous.Method != payment.Method {
+			method = MIXED
+		}
+	}
+	invoice.Payment_method = &method
+	invoice.Payments = append(invoice.Payments, *payment)
+
+	SettleStatus(invoice)
+	return nil
+}
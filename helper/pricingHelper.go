@@ -0,0 +1,195 @@
+package helper
+
+import (
+	"errors"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"sort"
+	"time"
+)
+
+const (
+	PERCENTAGE = "PERCENTAGE"
+	FIXED      = "FIXED"
+	ITEM       = "ITEM"
+	BILL       = "BILL"
+
+	DiscountRule  = "RULE"
+	DiscountPromo = "PROMO"
+	DiscountComp  = "COMP"
+
+	DiscountApplied         = "APPLIED"
+	DiscountPendingApproval = "PENDING_APPROVAL"
+	DiscountRejected        = "REJECTED"
+)
+
+var (
+	ErrPercentageValue = errors.New("a PERCENTAGE needs a value and no amount")
+	ErrFixedAmount     = errors.New("a FIXED kind needs an amount and no value")
+)
+
+// CheckKindValue makes sure a discount or a service charge carries what its
+// kind is worked out from, a percentage in value or an amount of money.
+func CheckKindValue(kind string, value *float64, amount *money.Money) error {
+	if kind == PERCENTAGE && (value == nil || amount != nil) {
+		return ErrPercentageValue
+	}
+	if kind == FIXED && (amount == nil || value != nil) {
+		return ErrFixedAmount
+	}
+	return nil
+}
+
+// RuleActiveAt reports whether the time falls inside the validity period, the
+// week days and the daily window of the rule. A window like 22:00-02:00 runs
+// past midnight.
+func RuleActiveAt(rule models.PricingRule, at time.Time) bool {
+	at = at.In(time.Local)
+
+	if rule.Starts_at != nil && at.Before(*rule.Starts_at) {
+		return false
+	}
+	if rule.Expires_at != nil && !at.Before(*rule.Expires_at) {
+		return false
+	}
+
+	if len(rule.Days) > 0 {
+		onDay := false
+		for _, day := range rule.Days {
+			if int(at.Weekday()) == day {
+				onDay = true
+			}
+		}
+		if !onDay {
+			return false
+		}
+	}
+
+	clock := at.Format("15:04")
+	switch {
+	case rule.Start_time != nil && rule.End_time != nil && *rule.End_time < *rule.Start_time:
+		return clock >= *rule.Start_time || clock < *rule.End_time
+	case rule.Start_time != nil && clock < *rule.Start_time:
+		return false
+	case rule.End_time != nil && clock >= *rule.End_time:
+		return false
+	}
+	return true
+}
+
+func discountAmount(kind string, value *float64, fixed *money.Money, amount money.Money) money.Money {
+	if kind == PERCENTAGE {
+		if value == nil {
+			return money.Zero()
+		}
+		return amount.Percent(*value)
+	}
+	return money.Min(money.Value(fixed), amount)
+}
+
+// ApplyDiscounts takes the discounts off the items before they are taxed.
+// Automatic item rules apply when the item was ordered, so happy hour prices
+// stick; then come promo codes and comps on items, and last the bill level
+// discounts, which are spread over the items in proportion to their price,
+// in whole cents that add up to the discount.
+// Discounts that are not approved yet are left out.
+func ApplyDiscounts(items []TaxableItem, rules []models.PricingRule, discounts []models.OrderDiscount, at time.Time) ([]TaxableItem, []models.DiscountLine) {
+	discounted := append([]TaxableItem{}, items...)
+	lines := []models.DiscountLine{}
+
+	sortedRules := append([]models.PricingRule{}, rules...)
+	sort.SliceStable(sortedRules, func(i, j int) bool { return sortedRules[i].Priority < sortedRules[j].Priority })
+
+	addLine := func(line models.DiscountLine, amount money.Money) {
+		if !amount.IsPositive() {
+			return
+		}
+		line.Amount = amount
+		lines = append(lines, line)
+	}
+
+	subtotal := func() money.Money {
+		total := money.Zero()
+		for _, item := range discounted {
+			total = total.Add(item.Amount)
+		}
+		return total
+	}
+
+	// takeOffBill spreads a bill discount over every item
+	takeOffBill := func(kind string, value *float64, fixed *money.Money) money.Money {
+		total := subtotal()
+		if !total.IsPositive() {
+			return money.Zero()
+		}
+		amount := discountAmount(kind, value, fixed, total)
+		weights := make([]money.Money, len(discounted))
+		for i, item := range discounted {
+			weights[i] = item.Amount
+		}
+		for i, part := range amount.Allocate(weights) {
+			discounted[i].Amount = discounted[i].Amount.Sub(part)
+		}
+		return amount
+	}
+
+	for _, rule := range sortedRules {
+		if !rule.Automatic || *rule.Scope != ITEM {
+			continue
+		}
+		amount := money.Zero()
+		for i, item := range discounted {
+			if RuleActiveAt(rule, item.Ordered_at) && matchesItem(rule.Categories, rule.Food_ids, item) {
+				off := discountAmount(*rule.Kind, rule.Value, rule.Amount, item.Amount)
+				discounted[i].Amount = discounted[i].Amount.Sub(off)
+				amount = amount.Add(off)
+			}
+		}
+		ruleId := rule.Pricing_rule_id
+		addLine(models.DiscountLine{Source: DiscountRule, Name: *rule.Name, Pricing_rule_id: &ruleId, Scope: ITEM}, amount)
+	}
+
+	for _, discount := range discounts {
+		if discount.Status != DiscountApplied || discount.Scope != ITEM {
+			continue
+		}
+		amount := money.Zero()
+		for i, item := range discounted {
+			matches := contains(discount.Order_item_ids, item.Order_item_id)
+			if len(discount.Order_item_ids) == 0 {
+				matches = matchesItem(discount.Categories, discount.Food_ids, item)
+			}
+			if matches {
+				off := discountAmount(discount.Kind, discount.Value, discount.Amount, item.Amount)
+				discounted[i].Amount = discounted[i].Amount.Sub(off)
+				amount = amount.Add(off)
+			}
+		}
+		discountId := discount.Discount_id
+		addLine(models.DiscountLine{Source: discount.Source, Name: discount.Name, Pricing_rule_id: discount.Pricing_rule_id, Discount_id: &discountId, Scope: ITEM}, amount)
+	}
+
+	for _, rule := range sortedRules {
+		if !rule.Automatic || *rule.Scope != BILL || !RuleActiveAt(rule, at) {
+			continue
+		}
+		if rule.Min_subtotal != nil && subtotal().Cmp(*rule.Min_subtotal) < 0 {
+			continue
+		}
+		ruleId := rule.Pricing_rule_id
+		addLine(models.DiscountLine{Source: DiscountRule, Name: *rule.Name, Pricing_rule_id: &ruleId, Scope: BILL}, takeOffBill(*rule.Kind, rule.Value, rule.Amount))
+	}
+
+	for _, discount := range discounts {
+		if discount.Status != DiscountApplied || discount.Scope != BILL {
+			continue
+		}
+		if discount.Min_subtotal != nil && subtotal().Cmp(*discount.Min_subtotal) < 0 {
+			continue
+		}
+		discountId := discount.Discount_id
+		addLine(models.DiscountLine{Source: discount.Source, Name: discount.Name, Pricing_rule_id: discount.Pricing_rule_id, Discount_id: &discountId, Scope: BILL}, takeOffBill(discount.Kind, discount.Value, discount.Amount))
+	}
+
+	return discounted, lines
+}
@@ -0,0 +1,65 @@
+package helper
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// ReportCache keeps built reports in memory for a while, so dashboards that
+// refresh every few seconds do not run the same aggregations each time.
+type ReportCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedReport
+}
+
+type cachedReport struct {
+	body    interface{}
+	expires time.Time
+}
+
+func NewReportCache(ttl time.Duration) *ReportCache {
+	return &ReportCache{ttl: ttl, entries: map[string]cachedReport{}}
+}
+
+// ReportCacheTTL is how long a report is kept, from REPORT_CACHE_TTL. It
+// defaults to five minutes, zero turns the cache off.
+func ReportCacheTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("REPORT_CACHE_TTL")); err == nil && ttl >= 0 {
+		return ttl
+	}
+	return 5 * time.Minute
+}
+
+func (cache *ReportCache) TTL() time.Duration {
+	return cache.ttl
+}
+
+func (cache *ReportCache) Get(key string) (interface{}, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry, ok := cache.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.body, true
+}
+
+// Put stores a report and drops the ones that have expired.
+func (cache *ReportCache) Put(key string, body interface{}) {
+	if cache.ttl <= 0 {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	now := time.Now()
+	for other, entry := range cache.entries {
+		if now.After(entry.expires) {
+			delete(cache.entries, other)
+		}
+	}
+	cache.entries[key] = cachedReport{body: body, expires: now.Add(cache.ttl)}
+}
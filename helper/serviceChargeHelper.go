@@ -0,0 +1,45 @@
+package helper
+
+import (
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+)
+
+// SERVICE_CHARGE is the category taxable service charges are taxed under, so
+// only rates without categories or foods apply to them.
+const SERVICE_CHARGE = "SERVICE_CHARGE"
+
+// ServiceCharges works out the charges that apply to a party of the given size.
+// Percentages are taken of the items after their discounts.
+func ServiceCharges(items []TaxableItem, charges []models.ServiceCharge, partySize int) []models.ServiceChargeLine {
+	base := money.Zero()
+	for _, item := range items {
+		base = base.Add(item.Amount)
+	}
+
+	lines := []models.ServiceChargeLine{}
+	if !base.IsPositive() {
+		return lines
+	}
+
+	for _, charge := range charges {
+		if charge.Min_guests != nil && partySize < *charge.Min_guests {
+			continue
+		}
+
+		amount := money.Value(charge.Amount)
+		if *charge.Kind == PERCENTAGE && charge.Value != nil {
+			amount = base.Percent(*charge.Value)
+		}
+
+		lines = append(lines, models.ServiceChargeLine{
+			Service_charge_id: charge.Service_charge_id,
+			Name:              *charge.Name,
+			Kind:              *charge.Kind,
+			Value:             charge.Value,
+			Taxable:           charge.Taxable,
+			Amount:            amount,
+		})
+	}
+	return lines
+}
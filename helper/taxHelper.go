@@ -0,0 +1,147 @@
+package helper
+
+import (
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// TaxableItem is one priced line of an order.
+type TaxableItem struct {
+	Order_item_id string
+	Food_id       string
+	Category      string
+	Amount        money.Money
+	Ordered_at    time.Time
+}
+
+// TaxBreakdown is what an order comes to once its discounts and taxes are
+// applied. Subtotal excludes every tax, Total is what the guest pays. Items
+// are the order's items after their discounts.
+type TaxBreakdown struct {
+	Items          []TaxableItem              `json:"-"`
+	Discount_total money.Money                `json:"discount_total"`
+	Discount_lines []models.DiscountLine      `json:"discount_lines"`
+	Subtotal       money.Money                `json:"subtotal"`
+	Service_total  money.Money                `json:"service_total"`
+	Service_lines  []models.ServiceChargeLine `json:"service_lines"`
+	Tax_total      money.Money                `json:"tax_total"`
+	Total          money.Money                `json:"total"`
+	Tax_lines      []models.TaxLine           `json:"tax_lines"`
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesItem reports whether the item is in one of the categories or foods.
+// No categories and no foods match every item.
+func matchesItem(categories []string, foodIds []string, item TaxableItem) bool {
+	if len(categories) == 0 && len(foodIds) == 0 {
+		return true
+	}
+	return contains(categories, item.Category) || contains(foodIds, item.Food_id)
+}
+
+// TaxApplies reports whether the rate is charged on the item.
+func TaxApplies(rate models.TaxRate, item TaxableItem) bool {
+	return matchesItem(rate.Categories, rate.Food_ids, item)
+}
+
+// itemTaxes runs the rates over a net amount in priority order. Simple rates
+// are charged on the net amount, compound rates on the net amount plus the
+// taxes before them. The amounts are exact, they are rounded on the invoice.
+func itemTaxes(net *big.Rat, rates []models.TaxRate) []*big.Rat {
+	amounts := make([]*big.Rat, len(rates))
+	taxed := new(big.Rat)
+	for i, rate := range rates {
+		base := new(big.Rat).Set(net)
+		if rate.Compound {
+			base.Add(base, taxed)
+		}
+		amounts[i] = base.Mul(base, money.Rate(*rate.Rate))
+		taxed.Add(taxed, amounts[i])
+	}
+	return amounts
+}
+
+// ComputeTaxes works out the tax lines of a set of items. Inclusive rates are
+// backed out of the menu price, exclusive rates are added on top of it. Each
+// tax line is rounded once, on the invoice, rather than per item.
+func ComputeTaxes(items []TaxableItem, rates []models.TaxRate) TaxBreakdown {
+	sorted := append([]models.TaxRate{}, rates...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Priority < sorted[j].Priority })
+
+	lines := make([]models.TaxLine, len(sorted))
+	taxable := make([]*big.Rat, len(sorted))
+	taxes := make([]*big.Rat, len(sorted))
+	for i, rate := range sorted {
+		lines[i] = models.TaxLine{
+			Tax_rate_id: rate.Tax_rate_id,
+			Code:        *rate.Code,
+			Name:        *rate.Name,
+			Rate:        *rate.Rate,
+			Inclusive:   rate.Inclusive,
+			Compound:    rate.Compound,
+		}
+		taxable[i], taxes[i] = new(big.Rat), new(big.Rat)
+	}
+
+	gross := money.Zero()
+	for _, item := range items {
+		gross = gross.Add(item.Amount)
+
+		applicable := []models.TaxRate{}
+		indexes := []int{}
+		for i, rate := range sorted {
+			if TaxApplies(rate, item) {
+				applicable = append(applicable, rate)
+				indexes = append(indexes, i)
+			}
+		}
+		if len(applicable) == 0 {
+			continue
+		}
+
+		// the inclusive taxes on one unit of net price tell how much of the
+		// menu price is tax
+		included := big.NewRat(1, 1)
+		for i, amount := range itemTaxes(big.NewRat(1, 1), applicable) {
+			if applicable[i].Inclusive {
+				included.Add(included, amount)
+			}
+		}
+		net := new(big.Rat).Quo(item.Amount.Rat(), included)
+
+		for i, amount := range itemTaxes(net, applicable) {
+			taxable[indexes[i]].Add(taxable[indexes[i]], net)
+			taxes[indexes[i]].Add(taxes[indexes[i]], amount)
+		}
+	}
+
+	breakdown := TaxBreakdown{Tax_lines: []models.TaxLine{}, Tax_total: money.Zero()}
+	exclusive := money.Zero()
+	for i, line := range lines {
+		if taxable[i].Sign() == 0 {
+			continue
+		}
+		line.Taxable_amount = money.Round(taxable[i])
+		line.Amount = money.Round(taxes[i])
+		breakdown.Tax_lines = append(breakdown.Tax_lines, line)
+		breakdown.Tax_total = breakdown.Tax_total.Add(line.Amount)
+		if !line.Inclusive {
+			exclusive = exclusive.Add(line.Amount)
+		}
+	}
+
+	breakdown.Total = gross.Add(exclusive)
+	breakdown.Subtotal = breakdown.Total.Sub(breakdown.Tax_total)
+	return breakdown
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"log"
 	"os"
 
+	controller "golang-restaurant-backend-app/controllers"
 	"golang-restaurant-backend-app/database"
 	middleware "golang-restaurant-backend-app/middleware"
+	"golang-restaurant-backend-app/payments"
 	routes "golang-restaurant-backend-app/routes"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -16,6 +19,12 @@ var foodCollection *mongo.Collection = database.OpenCollection(database.Client,
 
 func main() {
 
+	provider, err := payments.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	controller.UsePaymentProvider(provider)
+
 	port := os.Getenv("PORT")
 
 	if port == "" {
@@ -25,6 +34,7 @@ func main() {
 	router := gin.New()
 	router.Use(gin.Logger())
 	routes.UserRoutes(router)
+	routes.WebhookRoutes(router)
 	router.Use(middleware.Authentication())
 
 	routes.FoodRoutes(router)
@@ -33,6 +43,26 @@ func main() {
 	routes.TableRoutes(router)
 	routes.OrderItemRoutes(router)
 	routes.InvoiceRoutes(router)
+	routes.PaymentRoutes(router)
+	routes.CreditNoteRoutes(router)
+	routes.ReservationRoutes(router)
+	routes.FloorRoutes(router)
+	routes.WaitlistRoutes(router)
+	routes.StaffRoutes(router)
+	routes.TaxRoutes(router)
+	routes.PricingRoutes(router)
+	routes.ServiceChargeRoutes(router)
+	routes.ReceiptRoutes(router)
+	routes.PrintRoutes(router)
+	routes.AccountRoutes(router)
+	routes.BusinessDayRoutes(router)
+	routes.ReportRoutes(router)
+
+	controller.PromoteBootstrapAdmin()
+	controller.StartPrintQueue()
+	controller.StartReceiptDeliveries()
+	controller.StartOverdueJob()
+	controller.StartStatementJob()
 
 	router.Run(":" + port)
 }
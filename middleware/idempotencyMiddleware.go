@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"golang-restaurant-backend-app/database"
+	"golang-restaurant-backend-app/models"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	idempotencyProcessing = "PROCESSING"
+	idempotencyCompleted  = "COMPLETED"
+	maxIdempotencyKeySize = 255
+)
+
+var idempotencyCollection *mongo.Collection = database.OpenCollection(database.Client, "idempotency_key")
+var idempotencyIndexes sync.Once
+
+// idempotencyWindow is how long a key and its cached response are kept,
+// configured with IDEMPOTENCY_KEY_TTL (a Go duration such as "24h").
+func idempotencyWindow() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_KEY_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 24 * time.Hour
+}
+
+func ensureIdempotencyIndexes() {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := idempotencyCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		log.Printf("failed to create idempotency key indexes: %v", err)
+	}
+}
+
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// Idempotency makes a POST endpoint safe to retry. Requests carrying an
+// Idempotency-Key header are fingerprinted; a retry with the same key and
+// body replays the stored response, a retry with a different body is refused.
+func Idempotency() gin.HandlerFunc {
+	idempotencyIndexes.Do(ensureIdempotencyIndexes)
+
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeySize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			c.Abort()
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n" + string(body)))
+		fingerprint := hex.EncodeToString(sum[:])
+
+		now := time.Now()
+		record := models.IdempotencyKey{
+			ID:          primitive.NewObjectID(),
+			Key:         key,
+			User_id:     c.GetString("uid"),
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			Fingerprint: fingerprint,
+			Status:      idempotencyProcessing,
+			Created_at:  now,
+			Expires_at:  now.Add(idempotencyWindow()),
+		}
+		filter := bson.M{"key": key, "user_id": record.User_id}
+
+		_, err = idempotencyCollection.InsertOne(ctx, record)
+		if mongo.IsDuplicateKeyError(err) {
+			var existing models.IdempotencyKey
+			if findErr := idempotencyCollection.FindOne(ctx, filter).Decode(&existing); findErr != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking the Idempotency-Key"})
+				c.Abort()
+				return
+			}
+
+			// the TTL monitor only runs periodically, so expired keys may linger
+			if existing.Expires_at.Before(now) {
+				idempotencyCollection.DeleteOne(ctx, bson.M{"_id": existing.ID})
+				_, err = idempotencyCollection.InsertOne(ctx, record)
+			} else {
+				replayIdempotentResponse(c, existing, fingerprint)
+				return
+			}
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while storing the Idempotency-Key"})
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		c.Next()
+
+		status := recorder.Status()
+
+		// server errors are not cached so the client can retry them
+		if status >= http.StatusInternalServerError {
+			idempotencyCollection.DeleteOne(ctx, bson.M{"_id": record.ID})
+			return
+		}
+
+		_, err = idempotencyCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": record.ID},
+			bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "status", Value: idempotencyCompleted},
+					{Key: "response_status", Value: status},
+					{Key: "response_content_type", Value: recorder.Header().Get("Content-Type")},
+					{Key: "response_body", Value: recorder.body.Bytes()},
+				}},
+			},
+		)
+		if err != nil {
+			log.Printf("failed to store response for Idempotency-Key %s: %v", key, err)
+		}
+	}
+}
+
+func replayIdempotentResponse(c *gin.Context, existing models.IdempotencyKey, fingerprint string) {
+	defer c.Abort()
+
+	if existing.Fingerprint != fingerprint {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+		return
+	}
+
+	if existing.Status != idempotencyCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still being processed"})
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(existing.Response_status, existing.Response_content_type, existing.Response_body)
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"golang-restaurant-backend-app/money"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BusinessDay is a trading day of a branch, from the manager opening it to
+// closing it. Closing it takes the Z report, numbered in sequence per branch.
+type BusinessDay struct {
+	ID              primitive.ObjectID `bson:"_id"`
+	Branch          string             `json:"branch"`
+	Status          string             `json:"status"`
+	Opened_at       time.Time          `json:"opened_at"`
+	Opened_by       string             `json:"opened_by"`
+	Closed_at       *time.Time         `json:"closed_at"`
+	Closed_by       *string            `json:"closed_by"`
+	Z_report        *ShiftReport       `json:"z_report"`
+	Created_at      time.Time          `json:"created_at"`
+	Updated_at      time.Time          `json:"updated_at"`
+	Version         int64              `json:"version"`
+	Business_day_id string             `json:"business_day_id"`
+}
+
+// DrawerSession is one cash drawer in use during a business day, from the
+// opening float being put in to the cash being counted out. Cash taken and
+// refunded by its Cashiers while it is open is expected in it.
+type DrawerSession struct {
+	ID                primitive.ObjectID `bson:"_id"`
+	Business_day_id   string             `json:"business_day_id"`
+	Drawer            *string            `json:"drawer" validate:"required,min=1,max=30"`
+	Cashiers          []string           `json:"cashiers" validate:"max=20"`
+	Opening_float     *money.Money       `json:"opening_float" validate:"required,gte=0"`
+	Movements         []DrawerMovement   `json:"movements"`
+	Status            string             `json:"status"`
+	Expected_cash     *money.Money       `json:"expected_cash"`
+	Counted_cash      *money.Money       `json:"counted_cash"`
+	Variance          *money.Money       `json:"variance"`
+	Count_note        *string            `json:"count_note"`
+	Opened_at         time.Time          `json:"opened_at"`
+	Opened_by         string             `json:"opened_by"`
+	Closed_at         *time.Time         `json:"closed_at"`
+	Closed_by         *string            `json:"closed_by"`
+	Version           int64              `json:"version"`
+	Drawer_session_id string             `json:"drawer_session_id"`
+}
+
+// DrawerMovement is cash taken out of or put into a drawer other than for a
+// sale: a DROP to the safe, a PAYOUT such as paying a supplier, or a PAY_IN.
+type DrawerMovement struct {
+	Movement_id string      `json:"movement_id"`
+	Kind        *string     `json:"kind" validate:"required,eq=DROP|eq=PAYOUT|eq=PAY_IN"`
+	Amount      money.Money `json:"amount" validate:"gt=0"`
+	Reason      *string     `json:"reason" validate:"required,min=2,max=200"`
+	Recorded_by string      `json:"recorded_by"`
+	Recorded_at time.Time   `json:"recorded_at"`
+}
+
+// ShiftReport sums up trading between two times. An X report is taken at any
+// time and changes nothing, the Z report is taken once when the day closes.
+// Net sales are billed without tax, gross sales add the discounts back.
+type ShiftReport struct {
+	Kind            string              `json:"kind"`
+	Number          *int64              `json:"number"`
+	Branch          string              `json:"branch"`
+	From            time.Time           `json:"from"`
+	To              time.Time           `json:"to"`
+	Currency        string              `json:"currency"`
+	Invoice_count   int                 `json:"invoice_count"`
+	Gross_sales     money.Money         `json:"gross_sales"`
+	Discount_total  money.Money         `json:"discount_total"`
+	Service_total   money.Money         `json:"service_total"`
+	Net_sales       money.Money         `json:"net_sales"`
+	Tax_total       money.Money         `json:"tax_total"`
+	Tax_lines       []ReportTaxLine     `json:"tax_lines"`
+	Tip_total       money.Money         `json:"tip_total"`
+	Payment_methods []ReportPaymentLine `json:"payment_methods"`
+	Void_count      int                 `json:"void_count"`
+	Void_total      money.Money         `json:"void_total"`
+	Credit_notes    []ReportCreditLine  `json:"credit_notes"`
+	Drawers         []DrawerSummary     `json:"drawers"`
+	Cash_variance   money.Money         `json:"cash_variance"`
+	Generated_at    time.Time           `json:"generated_at"`
+	Generated_by    string              `json:"generated_by"`
+}
+
+type ReportTaxLine struct {
+	Code           string      `json:"code"`
+	Name           string      `json:"name"`
+	Rate           float64     `json:"rate"`
+	Inclusive      bool        `json:"inclusive"`
+	Taxable_amount money.Money `json:"taxable_amount"`
+	Amount         money.Money `json:"amount"`
+}
+
+// ReportPaymentLine is what was taken with one method. Amount includes the
+// tips.
+type ReportPaymentLine struct {
+	Method string      `json:"method"`
+	Count  int         `json:"count"`
+	Amount money.Money `json:"amount"`
+	Tips   money.Money `json:"tips"`
+}
+
+type ReportCreditLine struct {
+	Kind     string      `json:"kind"`
+	Count    int         `json:"count"`
+	Amount   money.Money `json:"amount"`
+	Refunded money.Money `json:"refunded"`
+}
+
+// DrawerSummary reconciles one drawer: the cash it should hold against what
+// was counted. Counted cash and variance are empty while it is open.
+type DrawerSummary struct {
+	Drawer_session_id string       `json:"drawer_session_id"`
+	Drawer            string       `json:"drawer"`
+	Status            string       `json:"status"`
+	Opening_float     money.Money  `json:"opening_float"`
+	Cash_sales        money.Money  `json:"cash_sales"`
+	Cash_refunds      money.Money  `json:"cash_refunds"`
+	Drops             money.Money  `json:"drops"`
+	Payouts           money.Money  `json:"payouts"`
+	Pay_ins           money.Money  `json:"pay_ins"`
+	Expected_cash     money.Money  `json:"expected_cash"`
+	Counted_cash      *money.Money `json:"counted_cash"`
+	Variance          *money.Money `json:"variance"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"golang-restaurant-backend-app/money"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreditNote corrects an invoice after it was billed without changing it. A
+// VOID note credits items taken off the bill, a REFUND note gives money back
+// on a payment. Amount is what the note takes off the invoice, Refunded what
+// went back to the guest.
+type CreditNote struct {
+	ID                primitive.ObjectID `bson:"_id"`
+	Invoice_id        string             `json:"invoice_id"`
+	Order_id          string             `json:"order_id"`
+	Kind              string             `json:"kind"`
+	Reason_code       string             `json:"reason_code"`
+	Reason            string             `json:"reason"`
+	Currency          string             `json:"currency"`
+	Lines             []CreditNoteLine   `json:"lines"`
+	Amount            money.Money        `json:"amount"`
+	Tax_lines         []TaxLine          `json:"tax_lines"`
+	Payment_id        *string            `json:"payment_id"`
+	Refund_method     *string            `json:"refund_method"`
+	Refund_reference  *string            `json:"refund_reference"`
+	Refunded          money.Money        `json:"refunded"`
+	Drawer_session_id *string            `json:"drawer_session_id"`
+	Authorized_by     string             `json:"authorized_by"`
+	Created_at        time.Time          `json:"created_at"`
+	Updated_at        time.Time          `json:"updated_at"`
+	Version           int64              `json:"version"`
+	Credit_note_id    string             `json:"credit_note_id"`
+}
+
+// CreditNoteLine is one thing credited, an item or the refunded amount.
+type CreditNoteLine struct {
+	Order_item_id *string     `json:"order_item_id"`
+	Description   string      `json:"description"`
+	Amount        money.Money `json:"amount"`
+}
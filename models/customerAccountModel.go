@@ -0,0 +1,90 @@
+package models
+
+import (
+	"golang-restaurant-backend-app/money"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CustomerAccount is a house account of a regular or corporate customer.
+// Invoices are charged to it up to the Credit_limit and settled in bulk,
+// Payment_terms_days after they were charged. Suspended accounts take no new
+// charges. Charging_until is held while an invoice is being charged to it, so
+// two charges cannot both fit under the limit the other one fills.
+type CustomerAccount struct {
+	ID                  primitive.ObjectID `bson:"_id"`
+	Name                *string            `json:"name" validate:"required,min=2,max=100"`
+	Contact_name        *string            `json:"contact_name" validate:"omitempty,max=100"`
+	Email               *string            `json:"email" validate:"omitempty,email"`
+	Phone               *string            `json:"phone" validate:"omitempty,e164"`
+	Address_lines       []string           `json:"address_lines" validate:"max=5,dive,max=100"`
+	Tax_number          *string            `json:"tax_number" validate:"omitempty,max=50"`
+	Credit_limit        *money.Money       `json:"credit_limit" validate:"required,gte=0"`
+	Payment_terms_days  *int               `json:"payment_terms_days" validate:"omitempty,gte=0,lte=120"`
+	Suspended           bool               `json:"suspended"`
+	Charging_until      *time.Time         `json:"-"`
+	Created_at          time.Time          `json:"created_at"`
+	Updated_at          time.Time          `json:"updated_at"`
+	Deleted_at          *time.Time         `json:"deleted_at"`
+	Deleted_by          *string            `json:"deleted_by"`
+	Version             int64              `json:"version"`
+	Customer_account_id string             `json:"customer_account_id"`
+}
+
+// AccountPayment is money received on an account, settling its oldest
+// invoices first unless the customer said which.
+type AccountPayment struct {
+	ID                 primitive.ObjectID  `bson:"_id"`
+	Account_id         string              `json:"account_id"`
+	Method             string              `json:"method"`
+	Reference          *string             `json:"reference"`
+	Amount             money.Money         `json:"amount"`
+	Allocations        []PaymentAllocation `json:"allocations"`
+	Received_by        string              `json:"received_by"`
+	Received_at        time.Time           `json:"received_at"`
+	Created_at         time.Time           `json:"created_at"`
+	Version            int64               `json:"version"`
+	Account_payment_id string              `json:"account_payment_id"`
+}
+
+// PaymentAllocation is the part of an account payment put towards one
+// invoice.
+type PaymentAllocation struct {
+	Invoice_id     string      `json:"invoice_id"`
+	Invoice_number *string     `json:"invoice_number"`
+	Amount         money.Money `json:"amount"`
+}
+
+// AccountStatement is what an account was charged and paid in one month, with
+// the balance carried in and out of it.
+type AccountStatement struct {
+	ID                   primitive.ObjectID `bson:"_id"`
+	Account_id           string             `json:"account_id"`
+	Period               string             `json:"period"`
+	Period_start         time.Time          `json:"period_start"`
+	Period_end           time.Time          `json:"period_end"`
+	Currency             string             `json:"currency"`
+	Opening_balance      money.Money        `json:"opening_balance"`
+	Lines                []StatementLine    `json:"lines"`
+	Charges              money.Money        `json:"charges"`
+	Credits              money.Money        `json:"credits"`
+	Closing_balance      money.Money        `json:"closing_balance"`
+	Due_date             time.Time          `json:"due_date"`
+	Sent_to              *string            `json:"sent_to"`
+	Created_by           string             `json:"created_by"`
+	Created_at           time.Time          `json:"created_at"`
+	Version              int64              `json:"version"`
+	Account_statement_id string             `json:"account_statement_id"`
+}
+
+// StatementLine is one entry of an account's ledger. Charges are positive,
+// payments and credit notes negative.
+type StatementLine struct {
+	Date        time.Time   `json:"date"`
+	Kind        string      `json:"kind"`
+	Invoice_id  string      `json:"invoice_id"`
+	Reference   string      `json:"reference"`
+	Description string      `json:"description"`
+	Amount      money.Money `json:"amount"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"golang-restaurant-backend-app/money"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -9,10 +10,14 @@ import (
 type Food struct {
 	ID         primitive.ObjectID `bson:"_id"`
 	Name       *string            `json:"name" validate:"required,min=2,max=100"`
-	Price      *float64           `json:"price" validate:"required,gt=0"`
+	Price      *money.Money       `json:"price" validate:"required,gt=0"`
 	Food_image *string            `json:"food_image" validate:"required"`
 	Created_at time.Time          `json:"created_at"`
 	Updated_at time.Time          `json:"updated_at"`
+	Deleted_at *time.Time         `json:"deleted_at"`
+	Deleted_by *string            `json:"deleted_by"`
+	Version    int64              `json:"version"`
 	Food_id    string             `json:"food_id"`
 	Menu_id    *string            `json:"menu_id" validate:"required"`
+	Station    *string            `json:"station" validate:"omitempty,min=2,max=30"`
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type IdempotencyKey struct {
+	ID                    primitive.ObjectID `bson:"_id"`
+	Key                   string             `json:"key"`
+	User_id               string             `json:"user_id"`
+	Method                string             `json:"method"`
+	Path                  string             `json:"path"`
+	Fingerprint           string             `json:"fingerprint"`
+	Status                string             `json:"status"`
+	Response_status       int                `json:"response_status"`
+	Response_content_type string             `json:"response_content_type"`
+	Response_body         []byte             `json:"response_body"`
+	Created_at            time.Time          `json:"created_at"`
+	Expires_at            time.Time          `json:"expires_at"`
+}
@@ -1,18 +1,83 @@
 package models
 
 import (
+	"golang-restaurant-backend-app/money"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Invoice struct {
-	ID               primitive.ObjectID `bson:"_id"`
-	Invoice_id       string             `json:"invoice_id"`
-	Order_id         string             `json:"order_id"`
-	Payment_method   *string            `json:"payment_method" validate:"eq=CARD|eq=CASH|eq="`
-	Payment_status   *string            `json:"payment_status" validate:"required,eq=PENDING|eq=PAID"`
-	Payment_due_date time.Time          `json:"payment_due_date"`
-	Created_at       time.Time          `json:"created_at"`
-	Updated_at       time.Time          `json:"updated_at"`
+	ID               primitive.ObjectID  `bson:"_id"`
+	Invoice_id       string              `json:"invoice_id"`
+	Invoice_number   *string             `json:"invoice_number"`
+	Branch           *string             `json:"branch"`
+	Issued_at        *time.Time          `json:"issued_at"`
+	Draft            bool                `json:"draft"`
+	Order_id         string              `json:"order_id"`
+	Payment_method   *string             `json:"payment_method" validate:"eq=CARD|eq=CASH|eq=ACCOUNT|eq=MIXED|eq="`
+	Payment_status   *string             `json:"payment_status" validate:"required,eq=PENDING|eq=PARTIALLY_PAID|eq=PAID"`
+	Payment_due_date time.Time           `json:"payment_due_date"`
+	Currency         string              `json:"currency"`
+	Discount_total   *money.Money        `json:"discount_total"`
+	Discount_lines   []DiscountLine      `json:"discount_lines"`
+	Subtotal         *money.Money        `json:"subtotal"`
+	Service_total    *money.Money        `json:"service_total"`
+	Service_lines    []ServiceChargeLine `json:"service_lines"`
+	Tax_total        *money.Money        `json:"tax_total"`
+	Total            *money.Money        `json:"total"`
+	Tax_lines        []TaxLine           `json:"tax_lines"`
+	Tip              *money.Money        `json:"tip" validate:"omitempty,gte=0"`
+	Tip_server_id    *string             `json:"tip_server_id"`
+	Amount_paid      *money.Money        `json:"amount_paid"`
+	Outstanding      *money.Money        `json:"outstanding"`
+	Payments         []Payment           `json:"payments"`
+	Splits           []BillSplit         `json:"splits"`
+	Credited         *money.Money        `json:"credited"`
+	Refunded         *money.Money        `json:"refunded"`
+	Billing_email    *string             `json:"billing_email" validate:"omitempty,email"`
+	Billing_phone    *string             `json:"billing_phone" validate:"omitempty,e164"`
+	Overdue_at       *time.Time          `json:"overdue_at"`
+	Late_fee_total   *money.Money        `json:"late_fee_total"`
+	Late_fees        []LateFee           `json:"late_fees"`
+	Reminders        []PaymentReminder   `json:"reminders"`
+	Account_id       *string             `json:"account_id"`
+	Account_charge   *money.Money        `json:"account_charge"`
+	Charged_at       *time.Time          `json:"charged_at"`
+	Created_at       time.Time           `json:"created_at"`
+	Updated_at       time.Time           `json:"updated_at"`
+	Deleted_at       *time.Time          `json:"deleted_at"`
+	Deleted_by       *string             `json:"deleted_by"`
+	Version          int64               `json:"version"`
+}
+
+// TaxLine is the amount one tax rate adds up to on an invoice.
+type TaxLine struct {
+	Tax_rate_id    string      `json:"tax_rate_id"`
+	Code           string      `json:"code"`
+	Name           string      `json:"name"`
+	Rate           float64     `json:"rate"`
+	Inclusive      bool        `json:"inclusive"`
+	Compound       bool        `json:"compound"`
+	Taxable_amount money.Money `json:"taxable_amount"`
+	Amount         money.Money `json:"amount"`
+}
+
+// LateFee is charged on an invoice left unpaid past its due date. Waived
+// fees stay on the invoice but no longer count towards what is due.
+type LateFee struct {
+	Late_fee_id  string      `json:"late_fee_id"`
+	Amount       money.Money `json:"amount"`
+	Days_overdue int         `json:"days_overdue"`
+	Charged_at   time.Time   `json:"charged_at"`
+	Waived_at    *time.Time  `json:"waived_at"`
+	Waived_by    *string     `json:"waived_by"`
+}
+
+// PaymentReminder is a reminder sent about an overdue invoice.
+type PaymentReminder struct {
+	Channel      string    `json:"channel"`
+	To           string    `json:"to"`
+	Days_overdue int       `json:"days_overdue"`
+	Sent_at      time.Time `json:"sent_at"`
 }
@@ -14,5 +14,8 @@ type Menu struct {
 	End_date   *time.Time         `json:"end_date"`
 	Created_at *time.Time         `json:"created_at"`
 	Updated_at *time.Time         `json:"updated_at"`
+	Deleted_at *time.Time         `json:"deleted_at"`
+	Deleted_by *string            `json:"deleted_by"`
+	Version    int64              `json:"version"`
 	Menu_id    string             `json:"menu_id"`
 }
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"golang-restaurant-backend-app/money"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -9,10 +10,27 @@ import (
 type OrderItem struct {
 	ID            primitive.ObjectID `bson:"_id"`
 	Quantity      *string            `json:"quantity" validate:"required,eq=S|eq=M|eq=L"`
-	Unit_price    *float64           `json:"unit_price" validate:"required"`
+	Unit_price    *money.Money       `json:"unit_price" validate:"required"`
 	Created_at    time.Time          `json:"created_at"`
 	Updated_at    time.Time          `json:"updated_at"`
+	Deleted_at    *time.Time         `json:"deleted_at"`
+	Deleted_by    *string            `json:"deleted_by"`
+	Version       int64              `json:"version"`
 	Food_id       *string            `json:"food_id" validate:"required"`
 	Order_item_id string             `json:"order_item_id"`
 	Order_id      string             `json:"order_id" validate:"required"`
+	Void          *ItemVoid          `json:"void"`
+	Modifiers     []string           `json:"modifiers" validate:"max=10,dive,min=1,max=50"`
+	Notes         *string            `json:"notes" validate:"omitempty,max=200"`
+	Sent_at       *time.Time         `json:"sent_at"`
+}
+
+// ItemVoid records why an item was taken off the bill and who allowed it.
+// Items voided after the order was billed are credited on a credit note.
+type ItemVoid struct {
+	Reason_code    string    `json:"reason_code"`
+	Reason         string    `json:"reason"`
+	Voided_by      string    `json:"voided_by"`
+	Voided_at      time.Time `json:"voided_at"`
+	Credit_note_id *string   `json:"credit_note_id"`
 }
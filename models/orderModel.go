@@ -7,10 +7,33 @@ import (
 )
 
 type Order struct {
-	ID         primitive.ObjectID `bson:"_id"`
-	Order_date time.Time          `json:"order_date" validate:"required"`
-	Created_at time.Time          `json:"created_at"`
-	Updated_at time.Time          `json:"updated_at"`
-	Order_id   string             `json:"order_id"`
-	Table_id   *string            `json:"table_id" validate:"required"`
+	ID          primitive.ObjectID `bson:"_id"`
+	Order_date  time.Time          `json:"order_date" validate:"required"`
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+	Deleted_at  *time.Time         `json:"deleted_at"`
+	Deleted_by  *string            `json:"deleted_by"`
+	Version     int64              `json:"version"`
+	Order_id    string             `json:"order_id"`
+	Table_id    *string            `json:"table_id" validate:"required"`
+	Server_id   *string            `json:"server_id"`
+	Guests      *int               `json:"guests" validate:"omitempty,gt=0,lte=100"`
+	Merged_into *string            `json:"merged_into"`
+	Discounts   []OrderDiscount    `json:"discounts"`
+	History     []OrderEvent       `json:"history"`
+}
+
+// OrderEvent records a transfer, merge, split, table combination or server
+// reassignment that touched an order.
+type OrderEvent struct {
+	Action         string    `json:"action"`
+	From_table_id  *string   `json:"from_table_id,omitempty"`
+	To_table_id    *string   `json:"to_table_id,omitempty"`
+	Other_order_id *string   `json:"other_order_id,omitempty"`
+	From_server_id *string   `json:"from_server_id,omitempty"`
+	To_server_id   *string   `json:"to_server_id,omitempty"`
+	Order_item_ids []string  `json:"order_item_ids,omitempty"`
+	Table_ids      []string  `json:"table_ids,omitempty"`
+	User_id        string    `json:"user_id"`
+	At             time.Time `json:"at"`
 }
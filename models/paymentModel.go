@@ -0,0 +1,58 @@
+package models
+
+import (
+	"golang-restaurant-backend-app/money"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Payment is one tender taken against an invoice. Amount includes the tip,
+// Change is what a cash guest got back out of Tendered. Card payments carry
+// the provider and the payment intent they were captured on, ACCOUNT payments
+// the account payment they are part of.
+type Payment struct {
+	Payment_id         string      `json:"payment_id"`
+	Split_id           *string     `json:"split_id"`
+	Method             string      `json:"method"`
+	Provider           *string     `json:"provider"`
+	Intent_id          *string     `json:"intent_id"`
+	Account_payment_id *string     `json:"account_payment_id"`
+	Amount             money.Money `json:"amount"`
+	Tip                money.Money `json:"tip"`
+	Tendered           money.Money `json:"tendered"`
+	Change             money.Money `json:"change"`
+	Received_by        string      `json:"received_by"`
+	Paid_at            time.Time   `json:"paid_at"`
+}
+
+// BillSplit is the share of an invoice one guest pays, either an even part, the
+// items they had or an amount agreed at the table.
+type BillSplit struct {
+	Split_id       string      `json:"split_id"`
+	Label          string      `json:"label"`
+	Order_item_ids []string    `json:"order_item_ids"`
+	Amount         money.Money `json:"amount"`
+	Amount_paid    money.Money `json:"amount_paid"`
+	Paid           bool        `json:"paid"`
+}
+
+// CardPayment is a card payment held at the payment provider. It turns into a
+// Payment on the invoice once the provider confirms the capture.
+type CardPayment struct {
+	ID              primitive.ObjectID `bson:"_id"`
+	Invoice_id      string             `json:"invoice_id"`
+	Split_id        *string            `json:"split_id"`
+	Provider        string             `json:"provider"`
+	Intent_id       string             `json:"intent_id"`
+	Status          string             `json:"status"`
+	Amount          money.Money        `json:"amount"`
+	Tip             money.Money        `json:"tip"`
+	Created_by      string             `json:"created_by"`
+	Captured_at     *time.Time         `json:"captured_at"`
+	Voided_at       *time.Time         `json:"voided_at"`
+	Created_at      time.Time          `json:"created_at"`
+	Updated_at      time.Time          `json:"updated_at"`
+	Version         int64              `json:"version"`
+	Card_payment_id string             `json:"card_payment_id"`
+}
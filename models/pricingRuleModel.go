@@ -0,0 +1,74 @@
+package models
+
+import (
+	"golang-restaurant-backend-app/money"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PricingRule is a discount. Automatic rules apply on their own while their
+// time window is open, rules with a Promo_code only once the code is entered.
+// ITEM rules discount the matching items, BILL rules the whole order.
+// PERCENTAGE rules take Value percent off, FIXED rules take off Amount.
+type PricingRule struct {
+	ID              primitive.ObjectID `bson:"_id"`
+	Name            *string            `json:"name" validate:"required,min=2,max=100"`
+	Kind            *string            `json:"kind" validate:"required,eq=PERCENTAGE|eq=FIXED"`
+	Value           *float64           `json:"value" validate:"omitempty,gt=0"`
+	Amount          *money.Money       `json:"amount" validate:"omitempty,gt=0"`
+	Scope           *string            `json:"scope" validate:"required,eq=ITEM|eq=BILL"`
+	Categories      []string           `json:"categories"`
+	Food_ids        []string           `json:"food_ids"`
+	Automatic       bool               `json:"automatic"`
+	Promo_code      *string            `json:"promo_code" validate:"omitempty,min=3,max=40"`
+	Max_uses        *int               `json:"max_uses" validate:"omitempty,gt=0"`
+	Uses            int                `json:"uses"`
+	Starts_at       *time.Time         `json:"starts_at"`
+	Expires_at      *time.Time         `json:"expires_at"`
+	Days            []int              `json:"days" validate:"dive,gte=0,lte=6"`
+	Start_time      *string            `json:"start_time" validate:"omitempty,datetime=15:04"`
+	End_time        *string            `json:"end_time" validate:"omitempty,datetime=15:04"`
+	Min_subtotal    *money.Money       `json:"min_subtotal" validate:"omitempty,gt=0"`
+	Priority        int                `json:"priority"`
+	Created_at      time.Time          `json:"created_at"`
+	Updated_at      time.Time          `json:"updated_at"`
+	Deleted_at      *time.Time         `json:"deleted_at"`
+	Deleted_by      *string            `json:"deleted_by"`
+	Version         int64              `json:"version"`
+	Pricing_rule_id string             `json:"pricing_rule_id"`
+}
+
+// OrderDiscount is a promo code or a manual comp applied to an order. Comps
+// by staff below manager wait for approval before they count.
+type OrderDiscount struct {
+	Discount_id     string       `json:"discount_id"`
+	Source          string       `json:"source"`
+	Pricing_rule_id *string      `json:"pricing_rule_id"`
+	Promo_code      *string      `json:"promo_code"`
+	Name            string       `json:"name"`
+	Kind            string       `json:"kind"`
+	Value           *float64     `json:"value"`
+	Amount          *money.Money `json:"amount"`
+	Scope           string       `json:"scope"`
+	Categories      []string     `json:"categories"`
+	Food_ids        []string     `json:"food_ids"`
+	Order_item_ids  []string     `json:"order_item_ids"`
+	Min_subtotal    *money.Money `json:"min_subtotal"`
+	Reason          *string      `json:"reason"`
+	Status          string       `json:"status"`
+	Applied_by      string       `json:"applied_by"`
+	Approved_by     *string      `json:"approved_by"`
+	Approved_at     *time.Time   `json:"approved_at"`
+	Created_at      time.Time    `json:"created_at"`
+}
+
+// DiscountLine is the amount one discount took off an invoice.
+type DiscountLine struct {
+	Source          string      `json:"source"`
+	Name            string      `json:"name"`
+	Pricing_rule_id *string     `json:"pricing_rule_id"`
+	Discount_id     *string     `json:"discount_id"`
+	Scope           string      `json:"scope"`
+	Amount          money.Money `json:"amount"`
+}
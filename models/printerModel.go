@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Printer is a thermal printer on the network or attached to the server.
+// Kitchen tickets of the Stations it serves are routed to it, receipts only
+// if it prints Receipts. Paused printers are left out of the routing.
+type Printer struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Name       *string            `json:"name" validate:"required,min=2,max=100"`
+	Connection *string            `json:"connection" validate:"required,eq=TCP|eq=FILE"`
+	Address    *string            `json:"address" validate:"required,max=200"`
+	Stations   []string           `json:"stations" validate:"max=20,dive,min=2,max=30"`
+	Receipts   bool               `json:"receipts"`
+	Columns    *int               `json:"columns" validate:"omitempty,gte=24,lte=64"`
+	Paused     bool               `json:"paused"`
+	Created_at time.Time          `json:"created_at"`
+	Updated_at time.Time          `json:"updated_at"`
+	Deleted_at *time.Time         `json:"deleted_at"`
+	Deleted_by *string            `json:"deleted_by"`
+	Version    int64              `json:"version"`
+	Printer_id string             `json:"printer_id"`
+}
+
+// PrintJob is a ticket or receipt waiting for, or sent to, a printer. Failed
+// sends are retried until Attempts runs out.
+type PrintJob struct {
+	ID              primitive.ObjectID `bson:"_id"`
+	Printer_id      string             `json:"printer_id"`
+	Kind            string             `json:"kind"`
+	Reference       string             `json:"reference"`
+	Station         *string            `json:"station"`
+	Data            []byte             `json:"-"`
+	Status          string             `json:"status"`
+	Attempts        int                `json:"attempts"`
+	Last_error      *string            `json:"last_error"`
+	Next_attempt_at time.Time          `json:"next_attempt_at"`
+	Printed_at      *time.Time         `json:"printed_at"`
+	Created_by      string             `json:"created_by"`
+	Created_at      time.Time          `json:"created_at"`
+	Updated_at      time.Time          `json:"updated_at"`
+	Version         int64              `json:"version"`
+	Print_job_id    string             `json:"print_job_id"`
+}
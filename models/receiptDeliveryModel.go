@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReceiptDelivery is a receipt sent, or waiting to be sent, to a guest by
+// email or text message. The message is kept as rendered when it was asked
+// for, so retries send the same receipt.
+type ReceiptDelivery struct {
+	ID                  primitive.ObjectID `bson:"_id"`
+	Invoice_id          string             `json:"invoice_id"`
+	Channel             *string            `json:"channel" validate:"required,eq=EMAIL|eq=SMS"`
+	To                  *string            `json:"to" validate:"required,max=254"`
+	Subject             string             `json:"subject"`
+	Body                string             `json:"body"`
+	Attachment          []byte             `json:"-"`
+	Status              string             `json:"status"`
+	Attempts            int                `json:"attempts"`
+	Last_error          *string            `json:"last_error"`
+	Next_attempt_at     time.Time          `json:"next_attempt_at"`
+	Sent_at             *time.Time         `json:"sent_at"`
+	Created_by          string             `json:"created_by"`
+	Created_at          time.Time          `json:"created_at"`
+	Updated_at          time.Time          `json:"updated_at"`
+	Version             int64              `json:"version"`
+	Receipt_delivery_id string             `json:"receipt_delivery_id"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReceiptTemplate is how the receipts of one branch look: who they come from,
+// lines printed above and below the bill, the paper and the accent color.
+// The email and text message templates are Go templates over
+// receipt.MessageData; empty ones fall back to the defaults.
+type ReceiptTemplate struct {
+	ID                  primitive.ObjectID `bson:"_id"`
+	Branch              *string            `json:"branch" validate:"required,min=1,max=50"`
+	Restaurant_name     *string            `json:"restaurant_name" validate:"required,min=2,max=100"`
+	Address_lines       []string           `json:"address_lines" validate:"max=5,dive,max=100"`
+	Phone               *string            `json:"phone" validate:"omitempty,max=30"`
+	Email               *string            `json:"email" validate:"omitempty,email"`
+	Tax_number          *string            `json:"tax_number" validate:"omitempty,max=50"`
+	Header_lines        []string           `json:"header_lines" validate:"max=5,dive,max=100"`
+	Footer_lines        []string           `json:"footer_lines" validate:"max=5,dive,max=100"`
+	Paper               *string            `json:"paper" validate:"omitempty,eq=A4|eq=RECEIPT"`
+	Accent_color        *string            `json:"accent_color" validate:"omitempty,hexcolor,len=7"`
+	Email_subject       *string            `json:"email_subject" validate:"omitempty,max=200"`
+	Email_body          *string            `json:"email_body" validate:"omitempty,max=5000"`
+	Sms_body            *string            `json:"sms_body" validate:"omitempty,max=480"`
+	Created_at          time.Time          `json:"created_at"`
+	Updated_at          time.Time          `json:"updated_at"`
+	Deleted_at          *time.Time         `json:"deleted_at"`
+	Deleted_by          *string            `json:"deleted_by"`
+	Version             int64              `json:"version"`
+	Receipt_template_id string             `json:"receipt_template_id"`
+}
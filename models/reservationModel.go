@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Reservation struct {
+	ID               primitive.ObjectID `bson:"_id"`
+	Customer_name    *string            `json:"customer_name" validate:"required,min=2,max=100"`
+	Customer_phone   *string            `json:"customer_phone" validate:"required"`
+	Customer_email   *string            `json:"customer_email" validate:"omitempty,email"`
+	Party_size       *int               `json:"party_size" validate:"required,gt=0"`
+	Start_time       *time.Time         `json:"start_time" validate:"required"`
+	Duration_minutes *int               `json:"duration_minutes" validate:"omitempty,gt=0,lte=480"`
+	End_time         time.Time          `json:"end_time"`
+	Table_id         *string            `json:"table_id"`
+	Status           string             `json:"status" validate:"eq=BOOKED|eq=ARRIVED|eq=NO_SHOW|eq=CANCELLED"`
+	Notes            *string            `json:"notes"`
+	Arrived_at       *time.Time         `json:"arrived_at"`
+	Cancelled_at     *time.Time         `json:"cancelled_at"`
+	Created_at       time.Time          `json:"created_at"`
+	Updated_at       time.Time          `json:"updated_at"`
+	Deleted_at       *time.Time         `json:"deleted_at"`
+	Deleted_by       *string            `json:"deleted_by"`
+	Version          int64              `json:"version"`
+	Reservation_id   string             `json:"reservation_id"`
+}
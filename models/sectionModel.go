@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Section struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Name        *string            `json:"name" validate:"required,min=2,max=100"`
+	Description *string            `json:"description"`
+	Sort_order  int                `json:"sort_order"`
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+	Deleted_at  *time.Time         `json:"deleted_at"`
+	Deleted_by  *string            `json:"deleted_by"`
+	Version     int64              `json:"version"`
+	Section_id  string             `json:"section_id"`
+}
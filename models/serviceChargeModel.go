@@ -0,0 +1,38 @@
+package models
+
+import (
+	"golang-restaurant-backend-app/money"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ServiceCharge is added to the bill on its own, for example 12.5% on tables
+// of Min_guests or more. PERCENTAGE charges add Value percent, FIXED charges
+// add Amount. Taxable charges are taxed by the rates that apply to every item.
+type ServiceCharge struct {
+	ID                primitive.ObjectID `bson:"_id"`
+	Name              *string            `json:"name" validate:"required,min=2,max=100"`
+	Kind              *string            `json:"kind" validate:"required,eq=PERCENTAGE|eq=FIXED"`
+	Value             *float64           `json:"value" validate:"omitempty,gt=0"`
+	Amount            *money.Money       `json:"amount" validate:"omitempty,gt=0"`
+	Min_guests        *int               `json:"min_guests" validate:"omitempty,gt=0"`
+	Taxable           bool               `json:"taxable"`
+	Created_at        time.Time          `json:"created_at"`
+	Updated_at        time.Time          `json:"updated_at"`
+	Deleted_at        *time.Time         `json:"deleted_at"`
+	Deleted_by        *string            `json:"deleted_by"`
+	Version           int64              `json:"version"`
+	Service_charge_id string             `json:"service_charge_id"`
+}
+
+// ServiceChargeLine is the amount one service charge added to an invoice.
+// Value is the percentage charged, nil for FIXED charges.
+type ServiceChargeLine struct {
+	Service_charge_id string      `json:"service_charge_id"`
+	Name              string      `json:"name"`
+	Kind              string      `json:"kind"`
+	Value             *float64    `json:"value"`
+	Taxable           bool        `json:"taxable"`
+	Amount            money.Money `json:"amount"`
+}
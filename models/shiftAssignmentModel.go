@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ShiftAssignment puts a server in charge of a section for one shift.
+type ShiftAssignment struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	User_id       *string            `json:"user_id" validate:"required"`
+	Section_id    *string            `json:"section_id" validate:"required"`
+	Shift_start   *time.Time         `json:"shift_start" validate:"required"`
+	Shift_end     *time.Time         `json:"shift_end" validate:"required"`
+	Notes         *string            `json:"notes"`
+	Created_by    string             `json:"created_by"`
+	Created_at    time.Time          `json:"created_at"`
+	Updated_at    time.Time          `json:"updated_at"`
+	Deleted_at    *time.Time         `json:"deleted_at"`
+	Deleted_by    *string            `json:"deleted_by"`
+	Version       int64              `json:"version"`
+	Assignment_id string             `json:"assignment_id"`
+}
@@ -10,7 +10,16 @@ type Table struct {
 	ID               primitive.ObjectID `bson:"_id"`
 	Number_of_guests *int               `json:"number_of_guests" validate:"required"`
 	Table_number     *int               `json:"table_number" validate:"required"`
+	Section_id       *string            `json:"section_id"`
+	Pos_x            *float64           `json:"pos_x"`
+	Pos_y            *float64           `json:"pos_y"`
+	Shape            *string            `json:"shape" validate:"omitempty,eq=ROUND|eq=SQUARE|eq=RECTANGLE"`
+	Cleaned_at       *time.Time         `json:"cleaned_at"`
+	Combined_with    *string            `json:"combined_with"`
 	Created_at       time.Time          `json:"created_at"`
 	Updated_at       time.Time          `json:"updated_at"`
+	Deleted_at       *time.Time         `json:"deleted_at"`
+	Deleted_by       *string            `json:"deleted_by"`
+	Version          int64              `json:"version"`
 	Table_id         string             `json:"table_id"`
 }
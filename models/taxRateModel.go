@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TaxRate is a tax charged on food. A rate without categories or foods
+// applies to everything; inclusive rates are already part of the menu price
+// and compound rates are charged on top of the taxes ranked before them.
+type TaxRate struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Name        *string            `json:"name" validate:"required,min=2,max=100"`
+	Code        *string            `json:"code" validate:"required,min=1,max=20"`
+	Rate        *float64           `json:"rate" validate:"required,gte=0,lte=100"`
+	Inclusive   bool               `json:"inclusive"`
+	Compound    bool               `json:"compound"`
+	Priority    int                `json:"priority"`
+	Categories  []string           `json:"categories"`
+	Food_ids    []string           `json:"food_ids"`
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+	Deleted_at  *time.Time         `json:"deleted_at"`
+	Deleted_by  *string            `json:"deleted_by"`
+	Version     int64              `json:"version"`
+	Tax_rate_id string             `json:"tax_rate_id"`
+}
@@ -14,9 +14,13 @@ type User struct {
 	Email         *string            `json:"email" validate:"required"`
 	Avatar        *string            `json:"avatar"`
 	Phone         *string            `json:"phone" validate:"required"`
+	User_type     *string            `json:"user_type" validate:"omitempty,eq=ADMIN|eq=MANAGER|eq=CASHIER|eq=SERVER"`
 	Token         *string            `json:"token"`
 	Refresh_Token *string            `json:"refresh_token"`
 	Created_at    time.Time          `json:"created_at"`
 	Updated_at    time.Time          `json:"updated_at"`
+	Deleted_at    *time.Time         `json:"deleted_at"`
+	Deleted_by    *string            `json:"deleted_by"`
+	Version       int64              `json:"version"`
 	User_id       string             `json:"user_id"`
 }
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WaitlistEntry struct {
+	ID                  primitive.ObjectID `bson:"_id"`
+	Party_name          *string            `json:"party_name" validate:"required,min=2,max=100"`
+	Party_size          *int               `json:"party_size" validate:"required,gt=0"`
+	Phone               *string            `json:"phone" validate:"required"`
+	Email               *string            `json:"email" validate:"omitempty,email"`
+	Notes               *string            `json:"notes"`
+	Status              string             `json:"status" validate:"eq=WAITING|eq=NOTIFIED|eq=SEATED|eq=CANCELLED"`
+	Quoted_wait_minutes int                `json:"quoted_wait_minutes"`
+	Table_id            *string            `json:"table_id"`
+	Order_id            *string            `json:"order_id"`
+	Notified_at         *time.Time         `json:"notified_at"`
+	Seated_at           *time.Time         `json:"seated_at"`
+	Created_at          time.Time          `json:"created_at"`
+	Updated_at          time.Time          `json:"updated_at"`
+	Deleted_at          *time.Time         `json:"deleted_at"`
+	Deleted_by          *string            `json:"deleted_by"`
+	Version             int64              `json:"version"`
+	Waitlist_id         string             `json:"waitlist_id"`
+}
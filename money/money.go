@@ -0,0 +1,435 @@
+// Package money keeps amounts as whole cents so bills add up exactly.
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Money is an amount in cents of a currency. Amounts are stored in MongoDB as
+// a document of a Decimal128 amount and the currency, so they still add up in
+// aggregations through Field, and written in JSON as plain numbers such as
+// 12.50.
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+var (
+	ErrInvalid          = errors.New("not a valid amount of money")
+	ErrCurrencyMismatch = errors.New("amounts of money in different currencies")
+)
+
+// Field is the path of the Decimal128 amount of a stored amount of money,
+// for sums and comparisons in queries and aggregations.
+func Field(path string) string {
+	return path + ".amount"
+}
+
+// DefaultCurrency is the ISO code of the restaurant's currency, from
+// CURRENCY. Every currency is assumed to have cents.
+func DefaultCurrency() string {
+	if currency := os.Getenv("CURRENCY"); currency != "" {
+		return strings.ToUpper(currency)
+	}
+	if currency := os.Getenv("PAYMENT_CURRENCY"); currency != "" {
+		return strings.ToUpper(currency)
+	}
+	return "USD"
+}
+
+// New is an amount of cents in the restaurant's currency.
+func New(minor int64) Money {
+	return Money{Minor: minor, Currency: DefaultCurrency()}
+}
+
+// Zero is no money in the restaurant's currency.
+func Zero() Money {
+	return New(0)
+}
+
+// FromFloat rounds a float to the cent. It is only meant for values that
+// were stored or configured as floats.
+func FromFloat(amount float64) Money {
+	return New(int64(math.Round(amount * 100)))
+}
+
+// Parse reads a decimal amount such as "12.5" exactly, rounding half away
+// from zero past the cent.
+func Parse(value string) (Money, error) {
+	rat, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok {
+		return Money{}, ErrInvalid
+	}
+	return Round(rat), nil
+}
+
+// Round turns an exact amount into cents, half away from zero.
+func Round(amount *big.Rat) Money {
+	cents := new(big.Rat).Mul(amount, big.NewRat(100, 1))
+	num, den := cents.Num(), cents.Denom()
+
+	quotient, remainder := new(big.Int).QuoRem(num, den, new(big.Int))
+	// |remainder| * 2 >= den rounds away from zero
+	twice := new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2))
+	if twice.Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	return New(quotient.Int64())
+}
+
+// Rate turns a percentage such as 8.875 into the exact fraction 0.08875.
+func Rate(percent float64) *big.Rat {
+	rat, _ := new(big.Rat).SetString(strconv.FormatFloat(percent, 'f', -1, 64))
+	return rat.Quo(rat, big.NewRat(100, 1))
+}
+
+// Rat is the exact amount.
+func (m Money) Rat() *big.Rat {
+	return big.NewRat(m.Minor, 100)
+}
+
+// Float is the amount as a float, for display only.
+func (m Money) Float() float64 {
+	return float64(m.Minor) / 100
+}
+
+// currency is the currency of an amount worked out from two. Amounts without
+// a currency take the other's. Amounts are only ever in the restaurant's
+// currency, those stored in another are refused when they are read, so two
+// currencies never meet here.
+func (m Money) currency(other Money) string {
+	switch {
+	case m.Currency != "":
+		return m.Currency
+	case other.Currency != "":
+		return other.Currency
+	}
+	return DefaultCurrency()
+}
+
+func (m Money) Add(other Money) Money {
+	return Money{Minor: m.Minor + other.Minor, Currency: m.currency(other)}
+}
+
+func (m Money) Sub(other Money) Money {
+	return Money{Minor: m.Minor - other.Minor, Currency: m.currency(other)}
+}
+
+func (m Money) Neg() Money {
+	return Money{Minor: -m.Minor, Currency: m.currency(m)}
+}
+
+// Mul multiplies by an exact factor and rounds to the cent.
+func (m Money) Mul(factor *big.Rat) Money {
+	result := Round(new(big.Rat).Mul(m.Rat(), factor))
+	result.Currency = m.currency(m)
+	return result
+}
+
+// Percent is the given percentage of the amount, rounded to the cent.
+func (m Money) Percent(percent float64) Money {
+	return m.Mul(Rate(percent))
+}
+
+func (m Money) Cmp(other Money) int {
+	switch {
+	case m.Minor < other.Minor:
+		return -1
+	case m.Minor > other.Minor:
+		return 1
+	}
+	return 0
+}
+
+func (m Money) IsZero() bool     { return m.Minor == 0 }
+func (m Money) IsPositive() bool { return m.Minor > 0 }
+func (m Money) IsNegative() bool { return m.Minor < 0 }
+
+func Min(a Money, b Money) Money {
+	if a.Cmp(b) <= 0 {
+		return a
+	}
+	return b
+}
+
+// Sum adds the amounts up.
+func Sum(amounts ...Money) Money {
+	total := Zero()
+	for _, amount := range amounts {
+		total = total.Add(amount)
+	}
+	return total
+}
+
+// Value reads an optional amount, nil being nothing.
+func Value(amount *Money) Money {
+	if amount == nil {
+		return Zero()
+	}
+	return *amount
+}
+
+// Ptr is a pointer to a copy of the amount, for optional model fields.
+func Ptr(amount Money) *Money {
+	return &amount
+}
+
+// Allocate divides the amount in proportion to the weights. The parts are
+// whole cents and always add up to the amount, the cents left over by
+// rounding down going to the largest remainders. Zero weights all round share
+// evenly.
+func (m Money) Allocate(weights []Money) []Money {
+	parts := make([]Money, len(weights))
+	if len(weights) == 0 {
+		return parts
+	}
+
+	total := int64(0)
+	for _, weight := range weights {
+		total += weight.Minor
+	}
+	if total <= 0 {
+		even := make([]Money, len(weights))
+		for i := range even {
+			even[i] = New(1)
+		}
+		return m.Allocate(even)
+	}
+
+	remainders := make([]*big.Rat, len(weights))
+	allocated := int64(0)
+	for i, weight := range weights {
+		exact := new(big.Rat).Mul(big.NewRat(m.Minor, 1), big.NewRat(weight.Minor, total))
+		floor := new(big.Int).Div(exact.Num(), exact.Denom())
+		parts[i] = Money{Minor: floor.Int64(), Currency: m.currency(m)}
+		remainders[i] = new(big.Rat).Sub(exact, new(big.Rat).SetInt(floor))
+		allocated += parts[i].Minor
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return remainders[order[i]].Cmp(remainders[order[j]]) > 0 })
+	for i := int64(0); i < m.Minor-allocated; i++ {
+		parts[order[i%int64(len(order))]].Minor++
+	}
+	return parts
+}
+
+// Split divides the amount into equal parts, the odd cents going to the
+// first parts.
+func (m Money) Split(ways int) []Money {
+	return m.Allocate(make([]Money, ways))
+}
+
+// String writes the amount with its cents, such as 12.50 or -0.05.
+func (m Money) String() string {
+	sign := ""
+	minor := m.Minor
+	if minor < 0 {
+		sign, minor = "-", -minor
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/100, minor%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON takes a number or a string, read as an exact decimal.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		var text string
+		if json.Unmarshal(data, &text) != nil {
+			return ErrInvalid
+		}
+		number = json.Number(text)
+	}
+	parsed, err := Parse(number.String())
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Decimal128 is the amount as MongoDB stores it.
+func (m Money) Decimal128() primitive.Decimal128 {
+	decimal, _ := primitive.ParseDecimal128(m.String())
+	return decimal
+}
+
+// MarshalBSONValue stores the amount as {amount: Decimal128, currency}.
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	index, doc := bsoncore.AppendDocumentStart(nil)
+	doc = bsoncore.AppendDecimal128Element(doc, "amount", m.Decimal128())
+	doc = bsoncore.AppendStringElement(doc, "currency", m.currency(m))
+	doc, err := bsoncore.AppendDocumentEnd(doc, index)
+	return bsontype.EmbeddedDocument, doc, err
+}
+
+// UnmarshalBSONValue reads amounts stored with their currency, and the bare
+// Decimal128 amounts, floats and integers left from before, which are in the
+// restaurant's currency. Amounts in another currency, say from before
+// CURRENCY was changed, are refused with ErrCurrencyMismatch rather than
+// added up with the rest.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value := bsoncore.Value{Type: t, Data: data}
+	switch t {
+	case bsontype.EmbeddedDocument:
+		doc := value.Document()
+		amount, err := doc.LookupErr("amount")
+		if err != nil {
+			return fmt.Errorf("cannot read money without an amount: %w", err)
+		}
+		if err := m.UnmarshalBSONValue(amount.Type, amount.Data); err != nil {
+			return err
+		}
+		if currency, ok := doc.Lookup("currency").StringValueOK(); ok && currency != "" {
+			if currency != m.Currency {
+				return fmt.Errorf("%w: %s stored, %s expected", ErrCurrencyMismatch, currency, m.Currency)
+			}
+		}
+	case bsontype.Decimal128:
+		parsed, err := Parse(value.Decimal128().String())
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case bsontype.Double:
+		*m = FromFloat(value.Double())
+	case bsontype.Int32:
+		*m = New(int64(value.Int32()) * 100)
+	case bsontype.Int64:
+		*m = New(value.Int64() * 100)
+	case bsontype.Null, bsontype.Undefined:
+		*m = Zero()
+	default:
+		return fmt.Errorf("cannot read money from BSON %s", t)
+	}
+	return nil
+}
+
+// FromValue reads an amount out of a decoded aggregation result, either a sum
+// or an amount of money as it is stored.
+func FromValue(value interface{}) Money {
+	switch v := value.(type) {
+	case Money:
+		return v
+	case primitive.M:
+		if amount, ok := stored(v); ok {
+			return amount
+		}
+	case primitive.D:
+		if amount, ok := stored(v.Map()); ok {
+			return amount
+		}
+	case primitive.Decimal128:
+		parsed, _ := Parse(v.String())
+		return parsed
+	case float64:
+		return FromFloat(v)
+	case int32:
+		return New(int64(v) * 100)
+	case int64:
+		return New(v * 100)
+	}
+	return Zero()
+}
+
+// stored reads a decoded {amount, currency} document.
+func stored(doc primitive.M) (Money, bool) {
+	currency, ok := doc["currency"].(string)
+	if !ok || len(doc) != 2 {
+		return Money{}, false
+	}
+	amount := FromValue(doc["amount"])
+	amount.Currency = currency
+	return amount, true
+}
+
+// Decimals swaps the Decimal128 values and the stored amounts of money in a
+// decoded aggregation result for Money, so they are written to JSON as
+// numbers.
+func Decimals(value interface{}) interface{} {
+	switch v := value.(type) {
+	case primitive.Decimal128:
+		return FromValue(v)
+	case primitive.M:
+		if amount, ok := stored(v); ok {
+			return amount
+		}
+		for key, item := range v {
+			v[key] = Decimals(item)
+		}
+	case primitive.D:
+		if amount, ok := stored(v.Map()); ok {
+			return amount
+		}
+		for i, item := range v {
+			v[i].Value = Decimals(item.Value)
+		}
+	case primitive.A:
+		for i, item := range v {
+			v[i] = Decimals(item)
+		}
+	case []primitive.M:
+		for _, item := range v {
+			Decimals(item)
+		}
+	}
+	return value
+}
+
+// Registry is the BSON registry the database client decodes with. It leaves
+// optional amounts stored as null at nil, as the default decoder would
+// otherwise read them as zero.
+func Registry() *bsoncodec.Registry {
+	registry := bson.NewRegistry()
+	registry.RegisterTypeDecoder(reflect.TypeOf(&Money{}), bsoncodec.ValueDecoderFunc(decodeOptional))
+	return registry
+}
+
+func decodeOptional(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	switch vr.Type() {
+	case bsontype.Null:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadNull()
+	case bsontype.Undefined:
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadUndefined()
+	}
+
+	t, data, err := bsonrw.Copier{}.CopyValueToBytes(vr)
+	if err != nil {
+		return err
+	}
+	amount := new(Money)
+	if err := amount.UnmarshalBSONValue(t, data); err != nil {
+		return err
+	}
+	val.Set(reflect.ValueOf(amount))
+	return nil
+}
@@ -0,0 +1,38 @@
+package notifier
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9@.+_-]+`)
+
+// FileNotifier writes each message into Dir instead of delivering it, email
+// as an .eml file any mail client opens and text messages as plain text.
+type FileNotifier struct {
+	Dir  string
+	From string
+}
+
+func (n FileNotifier) Send(ctx context.Context, message Message) error {
+	dir := n.Dir
+	if dir == "" {
+		dir = "outbox"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	name := time.Now().Format("20060102-150405.000000") + "-" + message.Channel + "-" + unsafeName.ReplaceAllString(message.To, "_")
+	if message.Channel == EMAIL {
+		from := n.From
+		if from == "" {
+			from = "receipts@localhost"
+		}
+		return os.WriteFile(filepath.Join(dir, name+".eml"), Compose(from, message), 0o644)
+	}
+	return os.WriteFile(filepath.Join(dir, name+".txt"), []byte(message.Body+"\n"), 0o644)
+}
@@ -0,0 +1,88 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+)
+
+const (
+	EMAIL = "email"
+	SMS   = "sms"
+)
+
+var ErrUnsupportedChannel = errors.New("no notifier is set up for this channel")
+
+// Message is a notification to a guest. To is an email address or phone
+// number depending on the channel. Attachments only go out by email.
+type Message struct {
+	Channel     string
+	To          string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+// Attachment is a file sent along with an email, such as a PDF receipt.
+type Attachment struct {
+	Name         string
+	Content_type string
+	Data         []byte
+}
+
+// Notifier delivers messages to guests.
+type Notifier interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// LogNotifier writes messages to the application log instead of delivering
+// them, which is handy during development.
+type LogNotifier struct{}
+
+func (LogNotifier) Send(ctx context.Context, message Message) error {
+	log.Printf("notification via %s to %s: %s %s", message.Channel, message.To, message.Subject, message.Body)
+	return nil
+}
+
+// Channels sends each message with the notifier of its channel.
+type Channels map[string]Notifier
+
+func (c Channels) Send(ctx context.Context, message Message) error {
+	notifier, ok := c[message.Channel]
+	if !ok {
+		return ErrUnsupportedChannel
+	}
+	return notifier.Send(ctx, message)
+}
+
+// channelFromEnv picks the notifier of a channel from its own variable,
+// falling back to NOTIFIER. "file" writes messages to NOTIFIER_DIR, anything
+// unknown logs them.
+func channelFromEnv(variable string, live func() Notifier) Notifier {
+	kind := os.Getenv(variable)
+	if kind == "" {
+		kind = os.Getenv("NOTIFIER")
+	}
+	switch kind {
+	case "file":
+		return FileNotifier{Dir: os.Getenv("NOTIFIER_DIR"), From: os.Getenv("SMTP_FROM")}
+	case "live":
+		return live()
+	}
+	return LogNotifier{}
+}
+
+// FromEnv builds the notifier the application should use. EMAIL_NOTIFIER and
+// SMS_NOTIFIER choose per channel between "log", "file" and "live", which
+// sends email through SMTP_HOST and text messages through the SMS provider.
+func FromEnv() Notifier {
+	return Channels{
+		EMAIL: channelFromEnv("EMAIL_NOTIFIER", func() Notifier {
+			return NewSMTPNotifier(os.Getenv("SMTP_HOST"), os.Getenv("SMTP_PORT"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("SMTP_FROM"))
+		}),
+		SMS: channelFromEnv("SMS_NOTIFIER", func() Notifier {
+			return NewSMSNotifier(os.Getenv("SMS_API_URL"), os.Getenv("SMS_ACCOUNT_ID"), os.Getenv("SMS_AUTH_TOKEN"), os.Getenv("SMS_FROM"))
+		}),
+	}
+}
@@ -0,0 +1,73 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SMSNotifier sends text messages through a Twilio style messages API, or
+// anything that speaks it such as a stub server.
+type SMSNotifier struct {
+	baseURL   string
+	accountId string
+	authToken string
+	from      string
+	client    *http.Client
+}
+
+func NewSMSNotifier(baseURL string, accountId string, authToken string, from string) *SMSNotifier {
+	if baseURL == "" {
+		baseURL = "https://api.twilio.com"
+	}
+	return &SMSNotifier{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		accountId: accountId,
+		authToken: authToken,
+		from:      from,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type smsError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (n *SMSNotifier) Send(ctx context.Context, message Message) error {
+	if message.Channel != SMS {
+		return ErrUnsupportedChannel
+	}
+
+	form := url.Values{}
+	form.Set("To", message.To)
+	form.Set("From", n.from)
+	form.Set("Body", message.Body)
+
+	endpoint := n.baseURL + "/2010-04-01/Accounts/" + url.PathEscape(n.accountId) + "/Messages.json"
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.SetBasicAuth(n.accountId, n.authToken)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := n.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		body, _ := io.ReadAll(response.Body)
+		var apiErr smsError
+		json.Unmarshal(body, &apiErr)
+		return fmt.Errorf("sms provider answered %d: %s", response.StatusCode, apiErr.Message)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// sentSMS is what the stub was sent last.
+type sentSMS struct {
+	Method       string
+	Path         string
+	Content_type string
+	Account      string
+	Token        string
+	Form         url.Values
+}
+
+// stubSMS answers the messages API with status and body, recording the
+// request it was sent.
+func stubSMS(t *testing.T, status int, body interface{}) (*SMSNotifier, *sentSMS) {
+	t.Helper()
+	last := &sentSMS{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		last.Method, last.Path, last.Form = r.Method, r.URL.Path, r.PostForm
+		last.Content_type = r.Header.Get("Content-Type")
+		last.Account, last.Token, _ = r.BasicAuth()
+
+		w.WriteHeader(status)
+		switch b := body.(type) {
+		case string:
+			w.Write([]byte(b))
+		default:
+			json.NewEncoder(w).Encode(b)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return NewSMSNotifier(server.URL+"/", "AC 1", "token", "+15550000"), last
+}
+
+func TestSMSSendPostsMessageForm(t *testing.T) {
+	sms, last := stubSMS(t, http.StatusCreated, map[string]string{"sid": "SM1", "status": "queued"})
+
+	err := sms.Send(context.Background(), Message{Channel: SMS, To: "+15551234", Body: "Your table is ready"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if last.Method != http.MethodPost || last.Path != "/2010-04-01/Accounts/AC 1/Messages.json" {
+		t.Fatalf("sent %s %s", last.Method, last.Path)
+	}
+	if last.Account != "AC 1" || last.Token != "token" {
+		t.Fatalf("authenticated as %q/%q", last.Account, last.Token)
+	}
+	if last.Content_type != "application/x-www-form-urlencoded" {
+		t.Fatalf("content type %q", last.Content_type)
+	}
+	want := url.Values{"To": {"+15551234"}, "From": {"+15550000"}, "Body": {"Your table is ready"}}
+	for key := range want {
+		if last.Form.Get(key) != want.Get(key) {
+			t.Fatalf("form %s = %q, want %q", key, last.Form.Get(key), want.Get(key))
+		}
+	}
+}
+
+func TestSMSSendReportsProviderError(t *testing.T) {
+	sms, _ := stubSMS(t, http.StatusBadRequest, map[string]interface{}{"code": 21211, "message": "The 'To' number is not valid"})
+
+	err := sms.Send(context.Background(), Message{Channel: SMS, To: "nope", Body: "hi"})
+	if err == nil || err.Error() != "sms provider answered 400: The 'To' number is not valid" {
+		t.Fatalf("send: %v", err)
+	}
+}
+
+func TestSMSSendReportsStatusWithoutErrorBody(t *testing.T) {
+	sms, _ := stubSMS(t, http.StatusBadGateway, "<html>bad gateway</html>")
+
+	err := sms.Send(context.Background(), Message{Channel: SMS, To: "+15551234", Body: "hi"})
+	if err == nil || !strings.HasPrefix(err.Error(), "sms provider answered 502") {
+		t.Fatalf("send: %v", err)
+	}
+}
+
+func TestSMSSendRefusesEmail(t *testing.T) {
+	sms, last := stubSMS(t, http.StatusCreated, map[string]string{})
+
+	err := sms.Send(context.Background(), Message{Channel: EMAIL, To: "guest@example.com"})
+	if !errors.Is(err, ErrUnsupportedChannel) {
+		t.Fatalf("send: %v", err)
+	}
+	if last.Method != "" {
+		t.Fatal("an email was sent to the sms provider")
+	}
+}
@@ -0,0 +1,136 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPNotifier sends email through a mail server, upgrading to TLS when the
+// server offers it and logging in when a username is set.
+type SMTPNotifier struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+	// roots verifies the server's certificate, the system's when nil.
+	roots *x509.CertPool
+}
+
+func NewSMTPNotifier(host string, port string, username string, password string, from string) *SMTPNotifier {
+	if port == "" {
+		port = "587"
+	}
+	return &SMTPNotifier{host: host, port: port, username: username, password: password, from: from}
+}
+
+func (n *SMTPNotifier) Send(ctx context.Context, message Message) error {
+	if message.Channel != EMAIL {
+		return ErrUnsupportedChannel
+	}
+
+	dialer := net.Dialer{Timeout: 30 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(n.host, n.port))
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.host, RootCAs: n.roots}); err != nil {
+			return err
+		}
+	}
+	if n.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.username, n.password, n.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(n.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(message.To); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(Compose(n.from, message)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// base64Lines encodes data in lines of 76 characters as mail requires.
+func base64Lines(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var lines strings.Builder
+	for len(encoded) > 76 {
+		lines.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	lines.WriteString(encoded + "\r\n")
+	return lines.String()
+}
+
+// Compose writes a message out as an email, the body as plain text followed
+// by the attachments.
+func Compose(from string, message Message) []byte {
+	var out bytes.Buffer
+	header := func(name string, value string) {
+		fmt.Fprintf(&out, "%s: %s\r\n", name, value)
+	}
+	header("From", from)
+	header("To", message.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", message.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+
+	body := base64Lines([]byte(message.Body))
+	if len(message.Attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "base64")
+		out.WriteString("\r\n" + body)
+		return out.Bytes()
+	}
+
+	random := make([]byte, 12)
+	rand.Read(random)
+	boundary := "part-" + hex.EncodeToString(random)
+	header("Content-Type", `multipart/mixed; boundary="`+boundary+`"`)
+	out.WriteString("\r\n")
+
+	fmt.Fprintf(&out, "--%s\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: base64\r\n\r\n%s", boundary, body)
+	for _, attachment := range message.Attachments {
+		name := mime.QEncoding.Encode("utf-8", attachment.Name)
+		fmt.Fprintf(&out, "--%s\r\nContent-Type: %s; name=\"%s\"\r\nContent-Disposition: attachment; filename=\"%s\"\r\nContent-Transfer-Encoding: base64\r\n\r\n%s",
+			boundary, attachment.Content_type, name, name, base64Lines(attachment.Data))
+	}
+	fmt.Fprintf(&out, "--%s--\r\n", boundary)
+	return out.Bytes()
+}
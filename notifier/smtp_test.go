@@ -0,0 +1,311 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSession is what a client did on the fake mail server.
+type smtpSession struct {
+	TLS  bool
+	Auth string
+	From string
+	To   string
+	Data string
+}
+
+// testCertificate makes a self-signed certificate for 127.0.0.1 and a pool
+// that trusts it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake smtp"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, roots
+}
+
+// fakeSMTP serves one mail session on 127.0.0.1, offering STARTTLS when given
+// a certificate and refusing recipients with rejectRcpt when it is set. The
+// session is sent on the channel once the client quits or hangs up.
+func fakeSMTP(t *testing.T, cert *tls.Certificate, rejectRcpt string) (string, <-chan smtpSession) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+		var session smtpSession
+		defer func() { sessions <- session }()
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO":
+				text.PrintfLine("250-fake")
+				if cert != nil && !session.TLS {
+					text.PrintfLine("250-STARTTLS")
+				}
+				text.PrintfLine("250-AUTH PLAIN")
+				text.PrintfLine("250 HELP")
+			case "STARTTLS":
+				text.PrintfLine("220 ready to start TLS")
+				secure := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{*cert}})
+				if err := secure.Handshake(); err != nil {
+					return
+				}
+				text = textproto.NewConn(secure)
+				session.TLS = true
+			case "AUTH":
+				session.Auth = arg
+				text.PrintfLine("235 authenticated")
+			case "MAIL":
+				session.From = arg
+				text.PrintfLine("250 ok")
+			case "RCPT":
+				if rejectRcpt != "" {
+					text.PrintfLine("%s", rejectRcpt)
+					continue
+				}
+				session.To = arg
+				text.PrintfLine("250 ok")
+			case "DATA":
+				text.PrintfLine("354 go ahead")
+				data, err := text.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				session.Data = string(data)
+				text.PrintfLine("250 queued")
+			case "RSET", "NOOP":
+				text.PrintfLine("250 ok")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				return
+			default:
+				text.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port, sessions
+}
+
+func receipt() Message {
+	return Message{Channel: EMAIL, To: "guest@example.com", Subject: "Your receipt", Body: "Thanks for dining with us."}
+}
+
+func TestSMTPSendUpgradesToTLSAndLogsIn(t *testing.T) {
+	cert, roots := testCertificate(t)
+	port, sessions := fakeSMTP(t, &cert, "")
+	mailer := NewSMTPNotifier("127.0.0.1", port, "shop", "secret", "shop@example.com")
+	mailer.roots = roots
+
+	if err := mailer.Send(context.Background(), receipt()); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	session := <-sessions
+	if !session.TLS {
+		t.Fatal("the session was not upgraded to TLS")
+	}
+	if want := "PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00shop\x00secret")); session.Auth != want {
+		t.Fatalf("auth %q, want %q", session.Auth, want)
+	}
+	if session.From != "FROM:<shop@example.com>" || session.To != "TO:<guest@example.com>" {
+		t.Fatalf("envelope %q %q", session.From, session.To)
+	}
+	if !strings.Contains(session.Data, "\nSubject: Your receipt\n") {
+		t.Fatalf("data %q", session.Data)
+	}
+}
+
+func TestSMTPSendWithoutTLSOrLogin(t *testing.T) {
+	port, sessions := fakeSMTP(t, nil, "")
+	mailer := NewSMTPNotifier("127.0.0.1", port, "", "", "shop@example.com")
+
+	if err := mailer.Send(context.Background(), receipt()); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	session := <-sessions
+	if session.TLS || session.Auth != "" {
+		t.Fatalf("tls %v, auth %q without a username", session.TLS, session.Auth)
+	}
+	if session.Data == "" {
+		t.Fatal("no message was sent")
+	}
+}
+
+func TestSMTPSendRefusesUntrustedCertificate(t *testing.T) {
+	cert, _ := testCertificate(t)
+	port, sessions := fakeSMTP(t, &cert, "")
+	mailer := NewSMTPNotifier("127.0.0.1", port, "shop", "secret", "shop@example.com")
+
+	if err := mailer.Send(context.Background(), receipt()); err == nil {
+		t.Fatal("sent over TLS to a server with an untrusted certificate")
+	}
+	if session := <-sessions; session.Auth != "" || session.Data != "" {
+		t.Fatalf("logged in or sent data after a failed handshake: %+v", session)
+	}
+}
+
+func TestSMTPSendReportsRejectedRecipient(t *testing.T) {
+	port, sessions := fakeSMTP(t, nil, "550 no such mailbox")
+	mailer := NewSMTPNotifier("127.0.0.1", port, "", "", "shop@example.com")
+
+	err := mailer.Send(context.Background(), receipt())
+	var protocol *textproto.Error
+	if !errors.As(err, &protocol) || protocol.Code != 550 {
+		t.Fatalf("send: %v", err)
+	}
+	if session := <-sessions; session.Data != "" {
+		t.Fatal("data was sent to a rejected recipient")
+	}
+}
+
+func TestSMTPSendRefusesSMS(t *testing.T) {
+	mailer := NewSMTPNotifier("127.0.0.1", "1", "", "", "shop@example.com")
+	if err := mailer.Send(context.Background(), Message{Channel: SMS, To: "+15551234"}); !errors.Is(err, ErrUnsupportedChannel) {
+		t.Fatalf("send: %v", err)
+	}
+}
+
+func TestComposePlainText(t *testing.T) {
+	message := receipt()
+	message.Subject = "Reçu"
+	parsed, err := mail.ReadMessage(bytes.NewReader(Compose("shop@example.com", message)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != "Reçu" {
+		t.Fatalf("subject %q: %v", subject, err)
+	}
+	if parsed.Header.Get("From") != "shop@example.com" || parsed.Header.Get("To") != "guest@example.com" {
+		t.Fatalf("headers %v", parsed.Header)
+	}
+	if parsed.Header.Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Fatalf("content type %q", parsed.Header.Get("Content-Type"))
+	}
+	body, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, parsed.Body))
+	if err != nil || string(body) != message.Body {
+		t.Fatalf("body %q: %v", body, err)
+	}
+}
+
+func TestComposeWithAttachments(t *testing.T) {
+	pdf := bytes.Repeat([]byte("%PDF-1.4 receipt "), 20)
+	message := receipt()
+	message.Attachments = []Attachment{
+		{Name: "receipt.pdf", Content_type: "application/pdf", Data: pdf},
+		{Name: "note.txt", Content_type: "text/plain", Data: []byte("see you soon")},
+	}
+	raw := Compose("shop@example.com", message)
+
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) > 78 {
+			t.Fatalf("line of %d characters: %q", len(line), line)
+		}
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("content type %q: %v", parsed.Header.Get("Content-Type"), err)
+	}
+
+	type part struct {
+		Content_type string
+		Filename     string
+		Data         string
+	}
+	var parts []part
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for {
+		p, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Header.Get("Content-Transfer-Encoding") != "base64" {
+			t.Fatalf("part %q is not base64", p.FileName())
+		}
+		data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, part{Content_type: p.Header.Get("Content-Type"), Filename: p.FileName(), Data: string(data)})
+	}
+
+	want := []part{
+		{Content_type: "text/plain; charset=utf-8", Data: message.Body},
+		{Content_type: `application/pdf; name="receipt.pdf"`, Filename: "receipt.pdf", Data: string(pdf)},
+		{Content_type: `text/plain; name="note.txt"`, Filename: "note.txt", Data: "see you soon"},
+	}
+	if len(parts) != len(want) {
+		t.Fatalf("%d parts, want %d", len(parts), len(want))
+	}
+	for i := range want {
+		if parts[i] != want[i] {
+			t.Fatalf("part %d = %+v, want %+v", i, parts[i], want[i])
+		}
+	}
+}
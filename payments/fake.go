@@ -0,0 +1,176 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DeclinedSource is the card token the fake provider always declines.
+const DeclinedSource = "tok_declined"
+
+// FakeProvider keeps payments in memory so the till can be tried out without
+// a gateway. Any card token is accepted except DeclinedSource.
+type FakeProvider struct {
+	mu      sync.Mutex
+	secret  string
+	next    int
+	intents map[string]*Intent
+	keys    map[string]string
+	refunds map[string]Refund
+}
+
+func NewFakeProvider(secret string) *FakeProvider {
+	return &FakeProvider{secret: secret, intents: map[string]*Intent{}, keys: map[string]string{}, refunds: map[string]Refund{}}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Authorize(ctx context.Context, request AuthorizeRequest) (Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if id, ok := p.keys[request.Idempotency_key]; ok && request.Idempotency_key != "" {
+		return *p.intents[id], nil
+	}
+	if request.Source == DeclinedSource {
+		return Intent{}, ErrDeclined
+	}
+
+	p.next++
+	intent := &Intent{
+		ID:        fmt.Sprintf("pi_fake_%d", p.next),
+		Status:    AUTHORIZED,
+		Amount:    request.Amount,
+		Currency:  request.Currency,
+		Reference: request.Reference,
+	}
+	p.intents[intent.ID] = intent
+	if request.Idempotency_key != "" {
+		p.keys[request.Idempotency_key] = intent.ID
+	}
+	return *intent, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, intentId string) (Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentId]
+	if !ok {
+		return Intent{}, ErrNotFound
+	}
+	if intent.Status == CAPTURED {
+		return *intent, nil
+	}
+	if intent.Status != AUTHORIZED {
+		return Intent{}, ErrInvalidState
+	}
+	intent.Status = CAPTURED
+	intent.Captured = intent.Amount
+	return *intent, nil
+}
+
+func (p *FakeProvider) Void(ctx context.Context, intentId string) (Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentId]
+	if !ok {
+		return Intent{}, ErrNotFound
+	}
+	if intent.Status == VOIDED {
+		return *intent, nil
+	}
+	if intent.Status != AUTHORIZED {
+		return Intent{}, ErrInvalidState
+	}
+	intent.Status = VOIDED
+	return *intent, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, intentId string, amount int64, idempotencyKey string) (Refund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if refund, ok := p.refunds[idempotencyKey]; ok && idempotencyKey != "" {
+		return refund, nil
+	}
+
+	intent, ok := p.intents[intentId]
+	if !ok {
+		return Refund{}, ErrNotFound
+	}
+	if intent.Status != CAPTURED || amount <= 0 || intent.Refunded+amount > intent.Captured {
+		return Refund{}, ErrInvalidState
+	}
+	intent.Refunded += amount
+
+	p.next++
+	refund := Refund{ID: fmt.Sprintf("re_fake_%d", p.next), Intent_id: intentId, Amount: amount, Status: "SUCCEEDED"}
+	if idempotencyKey != "" {
+		p.refunds[idempotencyKey] = refund
+	}
+	return refund, nil
+}
+
+// fakeEvent is how the fake provider posts webhooks.
+type fakeEvent struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Intent_id string `json:"intent_id"`
+}
+
+func (p *FakeProvider) ParseWebhook(payload []byte, header http.Header) (Event, error) {
+	if p.secret == "" {
+		return Event{}, ErrBadSignature
+	}
+	if err := verifySignature(p.secret, header.Get("X-Payment-Signature"), payload, time.Now()); err != nil {
+		return Event{}, err
+	}
+
+	var event fakeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return Event{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	intent, ok := p.intents[event.Intent_id]
+	if !ok {
+		return Event{}, ErrNotFound
+	}
+	return Event{ID: event.ID, Type: event.Type, Intent: *intent}, nil
+}
+
+// SignedEvent builds a webhook the fake provider accepts, for trying out the
+// webhook endpoint locally, and moves the payment to the state the event
+// reports. It returns the body and the X-Payment-Signature header.
+func (p *FakeProvider) SignedEvent(eventType string, intentId string) ([]byte, string, error) {
+	p.mu.Lock()
+	if intent, ok := p.intents[intentId]; ok && intent.Status == AUTHORIZED {
+		switch eventType {
+		case EventCaptured:
+			intent.Status = CAPTURED
+			intent.Captured = intent.Amount
+		case EventVoided:
+			intent.Status = VOIDED
+		case EventFailed:
+			intent.Status = FAILED
+		}
+	}
+	p.next++
+	id := fmt.Sprintf("evt_fake_%d", p.next)
+	p.mu.Unlock()
+
+	payload, err := json.Marshal(fakeEvent{ID: id, Type: eventType, Intent_id: intentId})
+	if err != nil {
+		return nil, "", err
+	}
+	return payload, SignatureHeader(p.secret, time.Now(), payload), nil
+}
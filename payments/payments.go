@@ -0,0 +1,178 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang-restaurant-backend-app/money"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AUTHORIZED = "AUTHORIZED"
+	CAPTURED   = "CAPTURED"
+	VOIDED     = "VOIDED"
+	FAILED     = "FAILED"
+
+	EventCaptured = "payment.captured"
+	EventVoided   = "payment.voided"
+	EventFailed   = "payment.failed"
+	EventRefunded = "payment.refunded"
+)
+
+var (
+	ErrDeclined     = errors.New("the card was declined")
+	ErrNotFound     = errors.New("the payment was not found at the provider")
+	ErrInvalidState = errors.New("the payment cannot do that in its current state")
+	ErrBadSignature = errors.New("the webhook signature is not valid")
+)
+
+// webhookTolerance is how old a signed webhook may be before it is refused,
+// so a captured request cannot be replayed later.
+const webhookTolerance = 5 * time.Minute
+
+// AuthorizeRequest holds the funds for a card payment. Amount is in cents,
+// Source is the card token from the terminal or the checkout page.
+type AuthorizeRequest struct {
+	Amount          int64
+	Currency        string
+	Source          string
+	Reference       string
+	Idempotency_key string
+}
+
+// Intent is a card payment as the provider sees it. Amounts are in cents.
+type Intent struct {
+	ID        string
+	Status    string
+	Amount    int64
+	Captured  int64
+	Refunded  int64
+	Currency  string
+	Reference string
+}
+
+// Refund is money returned on a captured payment.
+type Refund struct {
+	ID        string
+	Intent_id string
+	Amount    int64
+	Status    string
+}
+
+// Event is a webhook the provider sent about a payment.
+type Event struct {
+	ID     string
+	Type   string
+	Intent Intent
+}
+
+// Provider is a card payment gateway. Payments are authorized first and only
+// count once they are captured.
+type Provider interface {
+	Name() string
+	Authorize(ctx context.Context, request AuthorizeRequest) (Intent, error)
+	Capture(ctx context.Context, intentId string) (Intent, error)
+	Void(ctx context.Context, intentId string) (Intent, error)
+	// Refund gives back part of a captured payment. Asking again with the
+	// same idempotency key returns the first refund instead of paying twice.
+	Refund(ctx context.Context, intentId string, amount int64, idempotencyKey string) (Refund, error)
+	ParseWebhook(payload []byte, header http.Header) (Event, error)
+}
+
+// Currency is the currency card payments are taken in, the restaurant's
+// currency in the lower case providers expect.
+func Currency() string {
+	return strings.ToLower(money.DefaultCurrency())
+}
+
+// signPayload signs a webhook the way Stripe does, over the timestamp and
+// the body.
+func signPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureHeader is the value of the signature header for a payload, in
+// the form t=<unix time>,v1=<hex hmac>.
+func SignatureHeader(secret string, at time.Time, payload []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", at.Unix(), signPayload(secret, at.Unix(), payload))
+}
+
+func verifySignature(secret string, header string, payload []byte, now time.Time) error {
+	var timestamp int64
+	signatures := []string{}
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return ErrBadSignature
+	}
+	if age := now.Sub(time.Unix(timestamp, 0)); age > webhookTolerance || age < -webhookTolerance {
+		return ErrBadSignature
+	}
+
+	expected := signPayload(secret, timestamp, payload)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrBadSignature
+}
+
+// defaultFakeSecret is the webhook secret the fake provider once fell back
+// to. It is public, so it is refused like an empty one.
+const defaultFakeSecret = "fake_webhook_secret"
+
+// FromEnv builds the provider chosen with PAYMENT_PROVIDER. "stripe" talks to
+// STRIPE_API_URL with STRIPE_API_KEY and checks webhooks with
+// STRIPE_WEBHOOK_SECRET. "fake" approves cards without taking money, so it
+// is only built for development with PAYMENT_ALLOW_FAKE=true and its own
+// PAYMENT_WEBHOOK_SECRET. Anything else is an error, the server must not
+// start without a real way to take cards.
+func FromEnv() (Provider, error) {
+	switch os.Getenv("PAYMENT_PROVIDER") {
+	case "stripe":
+		if os.Getenv("STRIPE_API_KEY") == "" {
+			return nil, errors.New("STRIPE_API_KEY is required for the stripe payment provider")
+		}
+		if err := checkWebhookSecret("STRIPE_WEBHOOK_SECRET"); err != nil {
+			return nil, err
+		}
+		return NewStripeProvider(os.Getenv("STRIPE_API_URL"), os.Getenv("STRIPE_API_KEY"), os.Getenv("STRIPE_WEBHOOK_SECRET")), nil
+	case "fake":
+		if os.Getenv("PAYMENT_ALLOW_FAKE") != "true" {
+			return nil, errors.New("the fake payment provider approves every card, set PAYMENT_ALLOW_FAKE=true to use it in development")
+		}
+		if err := checkWebhookSecret("PAYMENT_WEBHOOK_SECRET"); err != nil {
+			return nil, err
+		}
+		return NewFakeProvider(os.Getenv("PAYMENT_WEBHOOK_SECRET")), nil
+	}
+	return nil, errors.New("PAYMENT_PROVIDER must be stripe, or fake in development")
+}
+
+// checkWebhookSecret refuses a secret anyone could sign webhooks with.
+func checkWebhookSecret(name string) error {
+	secret := os.Getenv(name)
+	if secret == "" || secret == defaultFakeSecret {
+		return fmt.Errorf("%s must be set to a secret of its own", name)
+	}
+	return nil
+}
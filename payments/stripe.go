@@ -0,0 +1,224 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StripeProvider talks to the Stripe payment intents API, or anything that
+// speaks it such as a stub server. Payments are created with manual capture
+// so the card is only charged once the invoice is settled.
+type StripeProvider struct {
+	baseURL       string
+	apiKey        string
+	webhookSecret string
+	client        *http.Client
+}
+
+func NewStripeProvider(baseURL string, apiKey string, webhookSecret string) *StripeProvider {
+	if baseURL == "" {
+		baseURL = "https://api.stripe.com"
+	}
+	return &StripeProvider{
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		apiKey:        apiKey,
+		webhookSecret: webhookSecret,
+		client:        &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *StripeProvider) Name() string {
+	return "stripe"
+}
+
+type stripeIntent struct {
+	ID              string            `json:"id"`
+	Status          string            `json:"status"`
+	Amount          int64             `json:"amount"`
+	Amount_received int64             `json:"amount_received"`
+	Amount_refunded int64             `json:"amount_refunded"`
+	Payment_intent  string            `json:"payment_intent"`
+	Currency        string            `json:"currency"`
+	Metadata        map[string]string `json:"metadata"`
+}
+
+type stripeRefund struct {
+	ID             string `json:"id"`
+	Payment_intent string `json:"payment_intent"`
+	Amount         int64  `json:"amount"`
+	Status         string `json:"status"`
+}
+
+type stripeError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type stripeEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object stripeIntent `json:"object"`
+	} `json:"data"`
+}
+
+// intent maps a Stripe payment intent onto the statuses the till knows.
+func (i stripeIntent) intent() Intent {
+	intent := Intent{
+		ID:        i.ID,
+		Amount:    i.Amount,
+		Captured:  i.Amount_received,
+		Currency:  i.Currency,
+		Reference: i.Metadata["reference"],
+	}
+	switch i.Status {
+	case "requires_capture":
+		intent.Status = AUTHORIZED
+	case "succeeded":
+		intent.Status = CAPTURED
+	case "canceled":
+		intent.Status = VOIDED
+	default:
+		intent.Status = FAILED
+	}
+	return intent
+}
+
+// post sends a form to the API and decodes the answer into out.
+func (p *StripeProvider) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+p.apiKey)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		request.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode >= 300 {
+		var apiErr stripeError
+		json.Unmarshal(body, &apiErr)
+		switch {
+		case response.StatusCode == http.StatusPaymentRequired || apiErr.Error.Type == "card_error":
+			return ErrDeclined
+		case response.StatusCode == http.StatusNotFound:
+			return ErrNotFound
+		case apiErr.Error.Code == "payment_intent_unexpected_state":
+			return ErrInvalidState
+		}
+		return fmt.Errorf("stripe answered %d: %s", response.StatusCode, apiErr.Error.Message)
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+func (p *StripeProvider) Authorize(ctx context.Context, request AuthorizeRequest) (Intent, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(request.Amount, 10))
+	form.Set("currency", request.Currency)
+	form.Set("payment_method", request.Source)
+	form.Set("capture_method", "manual")
+	form.Set("confirm", "true")
+	form.Set("metadata[reference]", request.Reference)
+
+	var intent stripeIntent
+	if err := p.post(ctx, "/v1/payment_intents", form, request.Idempotency_key, &intent); err != nil {
+		return Intent{}, err
+	}
+	if intent.Status != "requires_capture" {
+		return intent.intent(), ErrDeclined
+	}
+	return intent.intent(), nil
+}
+
+func (p *StripeProvider) Capture(ctx context.Context, intentId string) (Intent, error) {
+	var intent stripeIntent
+	if err := p.post(ctx, "/v1/payment_intents/"+url.PathEscape(intentId)+"/capture", url.Values{}, "capture-"+intentId, &intent); err != nil {
+		return Intent{}, err
+	}
+	return intent.intent(), nil
+}
+
+func (p *StripeProvider) Void(ctx context.Context, intentId string) (Intent, error) {
+	var intent stripeIntent
+	if err := p.post(ctx, "/v1/payment_intents/"+url.PathEscape(intentId)+"/cancel", url.Values{}, "cancel-"+intentId, &intent); err != nil {
+		return Intent{}, err
+	}
+	return intent.intent(), nil
+}
+
+func (p *StripeProvider) Refund(ctx context.Context, intentId string, amount int64, idempotencyKey string) (Refund, error) {
+	form := url.Values{}
+	form.Set("payment_intent", intentId)
+	form.Set("amount", strconv.FormatInt(amount, 10))
+
+	var refund stripeRefund
+	if err := p.post(ctx, "/v1/refunds", form, idempotencyKey, &refund); err != nil {
+		return Refund{}, err
+	}
+	return Refund{ID: refund.ID, Intent_id: refund.Payment_intent, Amount: refund.Amount, Status: strings.ToUpper(refund.Status)}, nil
+}
+
+func (p *StripeProvider) ParseWebhook(payload []byte, header http.Header) (Event, error) {
+	// an empty secret would let anyone sign
+	if p.webhookSecret == "" {
+		return Event{}, ErrBadSignature
+	}
+	if err := verifySignature(p.webhookSecret, header.Get("Stripe-Signature"), payload, time.Now()); err != nil {
+		return Event{}, err
+	}
+
+	var event stripeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return Event{}, err
+	}
+
+	types := map[string]string{
+		"payment_intent.succeeded":      EventCaptured,
+		"payment_intent.canceled":       EventVoided,
+		"payment_intent.payment_failed": EventFailed,
+		"charge.refunded":               EventRefunded,
+	}
+	eventType, ok := types[event.Type]
+	if !ok {
+		eventType = event.Type
+	}
+
+	intent := event.Data.Object.intent()
+	// refunds arrive on the charge, which points back at its payment intent
+	if event.Type == "charge.refunded" {
+		object := event.Data.Object
+		intent = Intent{
+			ID:        object.Payment_intent,
+			Status:    CAPTURED,
+			Amount:    object.Amount,
+			Captured:  object.Amount,
+			Refunded:  object.Amount_refunded,
+			Currency:  object.Currency,
+			Reference: object.Metadata["reference"],
+		}
+	}
+	return Event{ID: event.ID, Type: eventType, Intent: intent}, nil
+}
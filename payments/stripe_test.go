@@ -0,0 +1,227 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// sentRequest is what the stub was sent last.
+type sentRequest struct {
+	Header   http.Header
+	PostForm url.Values
+}
+
+// stubStripe answers the payment intent calls the way Stripe does.
+func stubStripe(t *testing.T) (*StripeProvider, *sentRequest) {
+	t.Helper()
+	last := &sentRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		last.Header, last.PostForm = r.Header, r.PostForm
+
+		if r.Header.Get("Authorization") != "Bearer sk_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"message": "bad key"}})
+			return
+		}
+
+		intent := map[string]interface{}{"id": "pi_1", "amount": 2500, "currency": "usd", "metadata": map[string]string{"reference": "inv_1"}}
+		switch r.URL.Path {
+		case "/v1/payment_intents":
+			if r.PostForm.Get("payment_method") == "tok_declined" {
+				w.WriteHeader(http.StatusPaymentRequired)
+				json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"type": "card_error", "message": "declined"}})
+				return
+			}
+			intent["status"] = "requires_capture"
+		case "/v1/payment_intents/pi_1/capture":
+			intent["status"] = "succeeded"
+			intent["amount_received"] = 2500
+		case "/v1/payment_intents/pi_1/cancel":
+			intent["status"] = "canceled"
+		case "/v1/payment_intents/pi_2/capture":
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"code": "payment_intent_unexpected_state"}})
+			return
+		case "/v1/refunds":
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "re_1", "payment_intent": r.PostForm.Get("payment_intent"), "amount": 1000, "status": "succeeded"})
+			return
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"message": "no such payment intent"}})
+			return
+		}
+		json.NewEncoder(w).Encode(intent)
+	}))
+	t.Cleanup(server.Close)
+	return NewStripeProvider(server.URL, "sk_test", testWebhookSecret), last
+}
+
+func TestStripeAuthorize(t *testing.T) {
+	provider, last := stubStripe(t)
+
+	intent, err := provider.Authorize(context.Background(), AuthorizeRequest{Amount: 2500, Currency: "usd", Source: "pm_card", Reference: "inv_1", Idempotency_key: "cp_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intent.ID != "pi_1" || intent.Status != AUTHORIZED || intent.Amount != 2500 || intent.Reference != "inv_1" {
+		t.Errorf("unexpected intent %+v", intent)
+	}
+	if last.PostForm.Get("capture_method") != "manual" || last.PostForm.Get("amount") != "2500" {
+		t.Errorf("unexpected form %v", last.PostForm)
+	}
+	if last.Header.Get("Idempotency-Key") != "cp_1" {
+		t.Errorf("idempotency key %q was not sent", last.Header.Get("Idempotency-Key"))
+	}
+
+	if _, err := provider.Authorize(context.Background(), AuthorizeRequest{Amount: 2500, Currency: "usd", Source: "tok_declined"}); !errors.Is(err, ErrDeclined) {
+		t.Errorf("declined card returned %v", err)
+	}
+}
+
+func TestStripeCapture(t *testing.T) {
+	provider, last := stubStripe(t)
+
+	intent, err := provider.Capture(context.Background(), "pi_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intent.Status != CAPTURED || intent.Captured != 2500 {
+		t.Errorf("unexpected intent %+v", intent)
+	}
+	if last.Header.Get("Idempotency-Key") != "capture-pi_1" {
+		t.Errorf("idempotency key %q was not sent", last.Header.Get("Idempotency-Key"))
+	}
+
+	if _, err := provider.Capture(context.Background(), "pi_2"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("capture in the wrong state returned %v", err)
+	}
+	if _, err := provider.Capture(context.Background(), "pi_missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("capture of an unknown intent returned %v", err)
+	}
+}
+
+func TestStripeVoid(t *testing.T) {
+	provider, _ := stubStripe(t)
+
+	intent, err := provider.Void(context.Background(), "pi_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intent.Status != VOIDED {
+		t.Errorf("unexpected intent %+v", intent)
+	}
+}
+
+func TestStripeRefund(t *testing.T) {
+	provider, last := stubStripe(t)
+
+	refund, err := provider.Refund(context.Background(), "pi_1", 1000, "refund-cn_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.ID != "re_1" || refund.Intent_id != "pi_1" || refund.Amount != 1000 || refund.Status != "SUCCEEDED" {
+		t.Errorf("unexpected refund %+v", refund)
+	}
+	if last.PostForm.Get("amount") != "1000" {
+		t.Errorf("unexpected form %v", last.PostForm)
+	}
+	if last.Header.Get("Idempotency-Key") != "refund-cn_1" {
+		t.Errorf("idempotency key %q was not sent", last.Header.Get("Idempotency-Key"))
+	}
+}
+
+func TestStripeWrongKey(t *testing.T) {
+	provider, _ := stubStripe(t)
+	provider.apiKey = "sk_wrong"
+
+	if _, err := provider.Capture(context.Background(), "pi_1"); err == nil {
+		t.Error("a refused key was taken as a capture")
+	}
+}
+
+var capturedEvent = []byte(`{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","status":"succeeded","amount":2500,"amount_received":2500,"currency":"usd","metadata":{"reference":"inv_1"}}}}`)
+
+func signedHeader(secret string, at time.Time, payload []byte) http.Header {
+	header := http.Header{}
+	header.Set("Stripe-Signature", SignatureHeader(secret, at, payload))
+	return header
+}
+
+func TestStripeWebhookAccepted(t *testing.T) {
+	provider := NewStripeProvider("", "sk_test", testWebhookSecret)
+
+	event, err := provider.ParseWebhook(capturedEvent, signedHeader(testWebhookSecret, time.Now(), capturedEvent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != "evt_1" || event.Type != EventCaptured {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if event.Intent.ID != "pi_1" || event.Intent.Status != CAPTURED || event.Intent.Captured != 2500 {
+		t.Errorf("unexpected intent %+v", event.Intent)
+	}
+}
+
+func TestStripeWebhookRejected(t *testing.T) {
+	provider := NewStripeProvider("", "sk_test", testWebhookSecret)
+	tampered := append([]byte{}, capturedEvent...)
+	tampered[len(tampered)-3] = ' '
+
+	headers := map[string]http.Header{
+		"unsigned":        {},
+		"wrong secret":    signedHeader("whsec_other", time.Now(), capturedEvent),
+		"tampered body":   signedHeader(testWebhookSecret, time.Now(), tampered),
+		"too old":         signedHeader(testWebhookSecret, time.Now().Add(-time.Hour), capturedEvent),
+		"malformed":       {"Stripe-Signature": {"v1=abc"}},
+		"from the future": signedHeader(testWebhookSecret, time.Now().Add(time.Hour), capturedEvent),
+	}
+	for name, header := range headers {
+		if _, err := provider.ParseWebhook(capturedEvent, header); !errors.Is(err, ErrBadSignature) {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+
+	// without a secret nothing is accepted, not even an empty signature
+	unset := NewStripeProvider("", "sk_test", "")
+	if _, err := unset.ParseWebhook(capturedEvent, signedHeader("", time.Now(), capturedEvent)); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("empty secret: got %v", err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	cases := []struct {
+		name string
+		env  map[string]string
+		ok   bool
+	}{
+		{"unset", map[string]string{}, false},
+		{"stripe", map[string]string{"PAYMENT_PROVIDER": "stripe", "STRIPE_API_KEY": "sk_test", "STRIPE_WEBHOOK_SECRET": testWebhookSecret}, true},
+		{"stripe without secret", map[string]string{"PAYMENT_PROVIDER": "stripe", "STRIPE_API_KEY": "sk_test"}, false},
+		{"fake without flag", map[string]string{"PAYMENT_PROVIDER": "fake", "PAYMENT_WEBHOOK_SECRET": testWebhookSecret}, false},
+		{"fake with default secret", map[string]string{"PAYMENT_PROVIDER": "fake", "PAYMENT_ALLOW_FAKE": "true", "PAYMENT_WEBHOOK_SECRET": defaultFakeSecret}, false},
+		{"fake", map[string]string{"PAYMENT_PROVIDER": "fake", "PAYMENT_ALLOW_FAKE": "true", "PAYMENT_WEBHOOK_SECRET": testWebhookSecret}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, key := range []string{"PAYMENT_PROVIDER", "PAYMENT_ALLOW_FAKE", "PAYMENT_WEBHOOK_SECRET", "STRIPE_API_KEY", "STRIPE_WEBHOOK_SECRET"} {
+				t.Setenv(key, tc.env[key])
+			}
+			_, err := FromEnv()
+			if tc.ok && err != nil {
+				t.Errorf("refused: %v", err)
+			}
+			if !tc.ok && err == nil {
+				t.Error("accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Package printing renders kitchen tickets and receipts for ESC/POS thermal
+// printers and sends them to the printer.
+package printing
+
+import (
+	"bytes"
+	"strings"
+)
+
+const (
+	esc = 0x1b
+	gs  = 0x1d
+
+	LEFT   = 0
+	CENTER = 1
+	RIGHT  = 2
+
+	// DefaultColumns is how many characters fit on a line of 80 mm paper in
+	// the printer's standard font.
+	DefaultColumns = 42
+)
+
+// Document is an ESC/POS byte stream being written line by line.
+type Document struct {
+	buffer  bytes.Buffer
+	columns int
+}
+
+// NewDocument starts a document for a printer that fits columns characters
+// on a line. It resets the printer and selects the Windows-1252 code page.
+func NewDocument(columns int) *Document {
+	if columns <= 0 {
+		columns = DefaultColumns
+	}
+	d := &Document{columns: columns}
+	d.buffer.Write([]byte{esc, '@', esc, 't', 16})
+	return d
+}
+
+func (d *Document) Align(align byte) {
+	d.buffer.Write([]byte{esc, 'a', align})
+}
+
+func (d *Document) Bold(on bool) {
+	flag := byte(0)
+	if on {
+		flag = 1
+	}
+	d.buffer.Write([]byte{esc, 'E', flag})
+}
+
+// Size scales the characters that follow, 1 being the normal size.
+func (d *Document) Size(width int, height int) {
+	d.buffer.Write([]byte{gs, '!', byte((width-1)<<4 | (height - 1))})
+}
+
+// encode turns text into Windows-1252 bytes. Characters the printer cannot
+// show become question marks, control characters spaces.
+func encode(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r < 0x20:
+			encoded = append(encoded, ' ')
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			encoded = append(encoded, byte(r))
+		case r == '€':
+			encoded = append(encoded, 0x80)
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+// Line writes text and ends the line. The printer wraps text that is too
+// long.
+func (d *Document) Line(text string) {
+	d.buffer.Write(encode(text))
+	d.buffer.WriteByte('\n')
+}
+
+// Wrapped writes text broken into lines at spaces, indented by indent after
+// the first line. Width is the number of characters a line takes, fewer
+// than the document's columns for enlarged text.
+func (d *Document) Wrapped(text string, width int, indent string) {
+	line := ""
+	for _, word := range strings.Fields(text) {
+		switch {
+		case line == "":
+			line = word
+		case len([]rune(line))+1+len([]rune(word)) <= width:
+			line += " " + word
+		default:
+			d.Line(line)
+			line = indent + word
+		}
+	}
+	d.Line(line)
+}
+
+// Columns writes a label on the left and a value on the right of one line,
+// cutting the label short when both do not fit.
+func (d *Document) Columns(label string, value string) {
+	room := d.columns - len([]rune(value)) - 1
+	runes := []rune(label)
+	if room < 1 {
+		room = 1
+	}
+	if len(runes) > room {
+		runes = runes[:room]
+	}
+	padding := d.columns - len(runes) - len([]rune(value))
+	if padding < 1 {
+		padding = 1
+	}
+	d.Line(string(runes) + strings.Repeat(" ", padding) + value)
+}
+
+// Rule draws a line across the paper.
+func (d *Document) Rule(char string) {
+	d.Line(strings.Repeat(char, d.columns))
+}
+
+// Feed moves the paper on by a number of lines.
+func (d *Document) Feed(lines int) {
+	d.buffer.Write([]byte{esc, 'd', byte(lines)})
+}
+
+// Cut feeds the paper past the cutter and cuts it, leaving a small tab.
+func (d *Document) Cut() {
+	d.buffer.Write([]byte{gs, 'V', 66, 3})
+}
+
+func (d *Document) Bytes() []byte {
+	return d.buffer.Bytes()
+}
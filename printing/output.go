@@ -0,0 +1,113 @@
+package printing
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	TCP  = "TCP"
+	FILE = "FILE"
+)
+
+var (
+	ErrUnknownConnection = errors.New("printers connect over TCP or to a FILE")
+	ErrNoPrintDir        = errors.New("FILE printers need PRINT_DIR to be set")
+	ErrOutsidePrintDir   = errors.New("the path of a FILE printer must stay inside PRINT_DIR")
+)
+
+// Output is where a printer's byte stream goes.
+type Output interface {
+	Write(ctx context.Context, data []byte) error
+}
+
+// TCPOutput sends to a network printer, which listens on port 9100 unless the
+// address says otherwise.
+type TCPOutput struct {
+	Address string
+	Timeout time.Duration
+}
+
+func (o TCPOutput) Write(ctx context.Context, data []byte) error {
+	address := o.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "9100")
+	}
+
+	timeout := o.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	_, err = conn.Write(data)
+	return err
+}
+
+// FileOutput appends to a file inside Dir, a printer device linked into it
+// such as lp0 -> /dev/usb/lp0 or a plain file to look at during development.
+// Name is relative to Dir and may not lead out of it.
+type FileOutput struct {
+	Dir  string
+	Name string
+}
+
+// Path is where the output goes, refused when there is no Dir or Name
+// escapes it.
+func (o FileOutput) Path() (string, error) {
+	if o.Dir == "" {
+		return "", ErrNoPrintDir
+	}
+	if !filepath.IsLocal(o.Name) {
+		return "", ErrOutsidePrintDir
+	}
+	return filepath.Join(o.Dir, o.Name), nil
+}
+
+func (o FileOutput) Write(ctx context.Context, data []byte) error {
+	path, err := o.Path()
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// NewOutput is the output of a printer connected over TCP at an address or
+// to a FILE at a path inside PRINT_DIR.
+func NewOutput(connection string, address string) (Output, error) {
+	switch connection {
+	case TCP:
+		return TCPOutput{Address: address}, nil
+	case FILE:
+		output := FileOutput{Dir: os.Getenv("PRINT_DIR"), Name: address}
+		if _, err := output.Path(); err != nil {
+			return nil, err
+		}
+		return output, nil
+	}
+	return nil, ErrUnknownConnection
+}
@@ -0,0 +1,121 @@
+package printing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTCPOutput(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	data := RenderTicket(Ticket{Station: "grill", Table: "4"}, 0)
+	output := TCPOutput{Address: listener.Addr().String(), Timeout: 5 * time.Second}
+	if err := output.Write(context.Background(), data); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-received:
+		if !bytes.Equal(got, data) {
+			t.Errorf("printer received %q, want %q", got, data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("printer received nothing")
+	}
+}
+
+func TestTCPOutputUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	output := TCPOutput{Address: address, Timeout: time.Second}
+	if err := output.Write(context.Background(), []byte("x")); err == nil {
+		t.Error("a printer that is off took the job")
+	}
+}
+
+func TestFileOutput(t *testing.T) {
+	dir := t.TempDir()
+	output := FileOutput{Dir: dir, Name: "kitchen/lp0"}
+	if err := os.Mkdir(filepath.Join(dir, "kitchen"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{"first", "second"} {
+		if err := output.Write(context.Background(), []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "kitchen", "lp0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "firstsecond" {
+		t.Errorf("file holds %q", got)
+	}
+}
+
+func TestFileOutputConfined(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"", "/etc/passwd", "../escape", "kitchen/../../escape"} {
+		output := FileOutput{Dir: dir, Name: name}
+		if err := output.Write(context.Background(), []byte("x")); !errors.Is(err, ErrOutsidePrintDir) {
+			t.Errorf("%q: got %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escape")); err == nil {
+		t.Error("a file was written outside the print directory")
+	}
+
+	if err := (FileOutput{Name: "lp0"}).Write(context.Background(), []byte("x")); !errors.Is(err, ErrNoPrintDir) {
+		t.Errorf("without a directory: got %v", err)
+	}
+}
+
+func TestNewOutput(t *testing.T) {
+	t.Setenv("PRINT_DIR", "")
+	if _, err := NewOutput(FILE, "lp0"); !errors.Is(err, ErrNoPrintDir) {
+		t.Errorf("FILE without PRINT_DIR: got %v", err)
+	}
+
+	t.Setenv("PRINT_DIR", t.TempDir())
+	if _, err := NewOutput(FILE, "../lp0"); !errors.Is(err, ErrOutsidePrintDir) {
+		t.Errorf("FILE outside PRINT_DIR: got %v", err)
+	}
+	if output, err := NewOutput(FILE, "lp0"); err != nil || output.(FileOutput).Name != "lp0" {
+		t.Errorf("FILE inside PRINT_DIR: got %v, %v", output, err)
+	}
+	if _, err := NewOutput(TCP, "10.0.0.5"); err != nil {
+		t.Errorf("TCP: got %v", err)
+	}
+	if _, err := NewOutput("USB", "lp0"); !errors.Is(err, ErrUnknownConnection) {
+		t.Errorf("USB: got %v", err)
+	}
+}
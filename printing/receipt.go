@@ -0,0 +1,62 @@
+package printing
+
+import (
+	"golang-restaurant-backend-app/receipt"
+	"strconv"
+)
+
+func rows(d *Document, rows []receipt.Row) {
+	for _, row := range rows {
+		d.Bold(row.Bold)
+		d.Columns(row.Label, row.Amount.String())
+	}
+	d.Bold(false)
+}
+
+// RenderReceipt writes the receipt handed to the guest.
+func RenderReceipt(bill receipt.Receipt, columns int) []byte {
+	d := NewDocument(columns)
+
+	d.Align(CENTER)
+	d.Bold(true)
+	d.Size(2, 2)
+	d.Wrapped(bill.Title, d.columns/2, "")
+	d.Size(1, 1)
+	d.Bold(false)
+	for _, line := range bill.Details {
+		d.Line(line)
+	}
+	for _, line := range bill.Header_lines {
+		d.Line(line)
+	}
+
+	d.Align(LEFT)
+	d.Feed(1)
+	for _, field := range bill.Fields {
+		d.Columns(field.Label, field.Value)
+	}
+
+	d.Rule("-")
+	for _, item := range bill.Items {
+		d.Columns(strconv.Itoa(item.Quantity)+" x "+item.Description, item.Amount.String())
+	}
+
+	d.Rule("-")
+	rows(d, bill.Totals)
+	if len(bill.Payments) > 0 {
+		d.Rule("-")
+		rows(d, bill.Payments)
+	}
+
+	if len(bill.Footer_lines) > 0 {
+		d.Feed(1)
+		d.Align(CENTER)
+		for _, line := range bill.Footer_lines {
+			d.Line(line)
+		}
+	}
+
+	d.Feed(4)
+	d.Cut()
+	return d.Bytes()
+}
@@ -0,0 +1,75 @@
+package printing
+
+import (
+	"bytes"
+	"flag"
+	"golang-restaurant-backend-app/money"
+	"golang-restaurant-backend-app/receipt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares a rendering byte for byte with testdata/name, rewriting it
+// with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs:\ngot  %q\nwant %q", name, got, want)
+	}
+}
+
+func TestRenderTicket(t *testing.T) {
+	local := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = local }()
+
+	ticket := Ticket{
+		Station:   "grill",
+		Order_id:  "652f1c9e8b3a4d0012345678",
+		Table:     "12",
+		Server:    "Dana",
+		Reprint:   true,
+		Issued_at: time.Date(2024, 3, 9, 19, 45, 0, 0, time.UTC),
+	}
+	ticket.AddItem(TicketItem{Name: "Ribeye", Size: "400 g", Quantity: 1, Modifiers: []string{"medium rare", "no butter"}})
+	ticket.AddItem(TicketItem{Name: "Crème brûlée", Quantity: 1, Notes: "birthday candle, bring out with the coffees please"})
+	ticket.AddItem(TicketItem{Name: "Ribeye", Size: "400 g", Quantity: 1, Modifiers: []string{"medium rare", "no butter"}})
+
+	golden(t, "ticket.golden", RenderTicket(ticket, 32))
+}
+
+func TestRenderReceipt(t *testing.T) {
+	bill := receipt.Receipt{
+		Title:        "Trattoria da Luca",
+		Details:      []string{"Via Roma 1, Milano", "VAT IT01234567890"},
+		Header_lines: []string{"Thank you for dining with us"},
+		Fields:       []receipt.Field{{Label: "Invoice", Value: "A-000042"}, {Label: "Table", Value: "12"}},
+		Items: []receipt.Item{
+			{Description: "Margherita", Quantity: 2, Amount: money.New(1800)},
+			{Description: "Tiramisù", Quantity: 1, Amount: money.New(650)},
+		},
+		Totals: []receipt.Row{
+			{Label: "Subtotal", Amount: money.New(2450)},
+			{Label: "incl. VAT 10%", Amount: money.New(223), Info: true},
+			{Label: "Total", Amount: money.New(2450), Bold: true},
+		},
+		Payments:     []receipt.Row{{Label: "Card", Amount: money.New(2450)}},
+		Footer_lines: []string{"See you soon!"},
+	}
+
+	golden(t, "receipt.golden", RenderReceipt(bill, 0))
+}
@@ -0,0 +1,96 @@
+package printing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Ticket is what one station is asked to make for an order.
+type Ticket struct {
+	Station   string       `json:"station"`
+	Order_id  string       `json:"order_id"`
+	Table     string       `json:"table"`
+	Server    string       `json:"server"`
+	Items     []TicketItem `json:"items"`
+	Reprint   bool         `json:"reprint"`
+	Issued_at time.Time    `json:"issued_at"`
+}
+
+// TicketItem is a dish on a ticket. Items that are the same in every way are
+// counted together.
+type TicketItem struct {
+	Name      string   `json:"name"`
+	Size      string   `json:"size"`
+	Quantity  int      `json:"quantity"`
+	Modifiers []string `json:"modifiers"`
+	Notes     string   `json:"notes"`
+}
+
+// AddItem puts an item on the ticket, counting it with an earlier one that is
+// the same.
+func (t *Ticket) AddItem(item TicketItem) {
+	for i, other := range t.Items {
+		if other.Name == item.Name && other.Size == item.Size && other.Notes == item.Notes &&
+			strings.Join(other.Modifiers, "\x00") == strings.Join(item.Modifiers, "\x00") {
+			t.Items[i].Quantity += item.Quantity
+			return
+		}
+	}
+	t.Items = append(t.Items, item)
+}
+
+// shortId is the end of an order id, enough to tell tickets apart at the pass.
+func shortId(id string) string {
+	if len(id) > 6 {
+		return id[len(id)-6:]
+	}
+	return id
+}
+
+// RenderTicket writes a kitchen ticket in large print, the station and table
+// on top and each dish with its modifiers and notes below.
+func RenderTicket(ticket Ticket, columns int) []byte {
+	d := NewDocument(columns)
+
+	d.Align(CENTER)
+	d.Bold(true)
+	d.Size(2, 2)
+	d.Line(strings.ToUpper(ticket.Station))
+	if ticket.Reprint {
+		d.Line("** REPRINT **")
+	}
+	d.Line("Table " + ticket.Table)
+	d.Size(1, 1)
+	d.Bold(false)
+
+	d.Align(LEFT)
+	d.Columns("Order "+shortId(ticket.Order_id), ticket.Issued_at.In(time.Local).Format("15:04"))
+	if ticket.Server != "" {
+		d.Line("Server " + ticket.Server)
+	}
+	d.Rule("=")
+
+	for _, item := range ticket.Items {
+		name := fmt.Sprintf("%d x %s", item.Quantity, item.Name)
+		if item.Size != "" {
+			name += " (" + item.Size + ")"
+		}
+		d.Bold(true)
+		d.Size(1, 2)
+		d.Wrapped(name, d.columns, "    ")
+		d.Size(1, 1)
+		d.Bold(false)
+		for _, modifier := range item.Modifiers {
+			d.Wrapped("  + "+modifier, d.columns, "    ")
+		}
+		if item.Notes != "" {
+			d.Wrapped("  ! "+item.Notes, d.columns, "    ")
+		}
+	}
+
+	d.Rule("=")
+	d.Feed(3)
+	d.Cut()
+	return d.Bytes()
+}
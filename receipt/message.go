@@ -0,0 +1,135 @@
+package receipt
+
+import (
+	"bytes"
+	"golang-restaurant-backend-app/models"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The messages sent when a template leaves them out.
+const (
+	DefaultEmailSubject = "Your receipt from {{.Restaurant}}"
+	DefaultEmailBody    = "Thank you for your visit to {{.Restaurant}}.\n\n{{.Receipt}}\nThe receipt is attached as a PDF."
+	DefaultSMSBody      = "{{.Restaurant}}: thank you for your visit. Receipt {{.Number}} of {{.Date}}, total {{.Total}} {{.Currency}}."
+)
+
+// textColumns is how wide the plain text receipt in emails is.
+const textColumns = 40
+
+// MessageData is what the email and text message templates are filled with.
+type MessageData struct {
+	Restaurant string
+	Number     string
+	Date       string
+	Total      string
+	Currency   string
+	Receipt    string
+}
+
+// Messages are the texts sending a receipt to a guest.
+type Messages struct {
+	Email_subject string
+	Email_body    string
+	SMS_body      string
+}
+
+func columns(label string, value string) string {
+	padding := textColumns - len([]rune(label)) - len([]rune(value))
+	if padding < 1 {
+		padding = 1
+	}
+	return label + strings.Repeat(" ", padding) + value + "\n"
+}
+
+func textRows(out *strings.Builder, rows []Row) {
+	for _, row := range rows {
+		out.WriteString(columns(row.Label, row.Amount.String()))
+	}
+}
+
+// Text writes the receipt as plain text for monospaced display.
+func Text(receipt Receipt) string {
+	var out strings.Builder
+	rule := strings.Repeat("-", textColumns) + "\n"
+
+	out.WriteString(receipt.Title + "\n")
+	for _, line := range receipt.Details {
+		out.WriteString(line + "\n")
+	}
+	for _, line := range receipt.Header_lines {
+		out.WriteString(line + "\n")
+	}
+	out.WriteString("\n")
+	for _, field := range receipt.Fields {
+		out.WriteString(columns(field.Label, field.Value))
+	}
+
+	out.WriteString(rule)
+	for _, item := range receipt.Items {
+		out.WriteString(columns(strconv.Itoa(item.Quantity)+" x "+item.Description, item.Amount.String()))
+	}
+	out.WriteString(rule)
+	textRows(&out, receipt.Totals)
+	if len(receipt.Payments) > 0 {
+		out.WriteString(rule)
+		textRows(&out, receipt.Payments)
+	}
+
+	if len(receipt.Footer_lines) > 0 {
+		out.WriteString("\n")
+		for _, line := range receipt.Footer_lines {
+			out.WriteString(line + "\n")
+		}
+	}
+	return out.String()
+}
+
+func fill(name string, text *string, fallback string, data MessageData) (string, error) {
+	if text != nil && *text != "" {
+		fallback = *text
+	}
+	parsed, err := template.New(name).Parse(fallback)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := parsed.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// CheckTemplates reports the first message template of a receipt template
+// that does not parse or uses a field MessageData lacks.
+func CheckTemplates(receiptTemplate models.ReceiptTemplate) error {
+	_, err := RenderMessages(receiptTemplate, Receipt{})
+	return err
+}
+
+// RenderMessages fills the message templates of a branch with a receipt.
+func RenderMessages(receiptTemplate models.ReceiptTemplate, receipt Receipt) (Messages, error) {
+	data := MessageData{
+		Restaurant: receipt.Title,
+		Number:     receipt.Number,
+		Date:       receipt.Date.In(time.Local).Format("2006-01-02"),
+		Total:      receipt.Total.String(),
+		Currency:   receipt.Currency,
+		Receipt:    Text(receipt),
+	}
+
+	var messages Messages
+	var err error
+	if messages.Email_subject, err = fill("email_subject", receiptTemplate.Email_subject, DefaultEmailSubject, data); err != nil {
+		return messages, err
+	}
+	if messages.Email_body, err = fill("email_body", receiptTemplate.Email_body, DefaultEmailBody, data); err != nil {
+		return messages, err
+	}
+	if messages.SMS_body, err = fill("sms_body", receiptTemplate.Sms_body, DefaultSMSBody, data); err != nil {
+		return messages, err
+	}
+	return messages, nil
+}
@@ -0,0 +1,173 @@
+package receipt
+
+import (
+	"golang-restaurant-backend-app/pdf"
+	"strconv"
+)
+
+var grey = pdf.Color{R: 0.4, G: 0.4, B: 0.4}
+
+// block is a strip of the receipt, drawn with its top at y.
+type block struct {
+	height float64
+	draw   func(page *pdf.Page, y float64)
+}
+
+type pdfLayout struct {
+	left     float64
+	right    float64
+	size     float64
+	blocks   []block
+	centered bool
+}
+
+func (l *pdfLayout) add(height float64, draw func(page *pdf.Page, y float64)) {
+	l.blocks = append(l.blocks, block{height: height, draw: draw})
+}
+
+func (l *pdfLayout) space(height float64) {
+	l.add(height, func(*pdf.Page, float64) {})
+}
+
+// text adds wrapped lines, centered on receipts and flush left on A4.
+func (l *pdfLayout) text(font pdf.Font, size float64, color pdf.Color, text string) {
+	centered := l.centered
+	for _, line := range pdf.Wrap(font, size, text, l.right-l.left) {
+		line := line
+		l.add(size*1.35, func(page *pdf.Page, y float64) {
+			if centered {
+				page.TextCenter((l.left+l.right)/2, y+size, font, size, color, line)
+			} else {
+				page.Text(l.left, y+size, font, size, color, line)
+			}
+		})
+	}
+}
+
+func (l *pdfLayout) rule() {
+	l.add(l.size, func(page *pdf.Page, y float64) {
+		page.Line(l.left, y+l.size/2, l.right, y+l.size/2, 0.5, grey)
+	})
+}
+
+// row adds a label on the left and a value on the right.
+func (l *pdfLayout) row(font pdf.Font, color pdf.Color, label string, value string) {
+	width := l.right - l.left - pdf.TextWidth(font, l.size, value) - l.size
+	lines := pdf.Wrap(font, l.size, label, width)
+	for i, line := range lines {
+		line, last := line, i == len(lines)-1
+		l.add(l.size*1.4, func(page *pdf.Page, y float64) {
+			page.Text(l.left, y+l.size, font, l.size, color, line)
+			if last {
+				page.TextRight(l.right, y+l.size, font, l.size, color, value)
+			}
+		})
+	}
+}
+
+func (l *pdfLayout) amounts(rows []Row) {
+	for _, row := range rows {
+		font, color := pdf.Regular, pdf.Black
+		if row.Bold {
+			font = pdf.Bold
+		}
+		if row.Info {
+			color = grey
+		}
+		l.row(font, color, row.Label, row.Amount.String())
+	}
+}
+
+// PDF renders the receipt, on one long page of receipt paper or on as many A4
+// pages as it takes.
+func PDF(receipt Receipt) ([]byte, error) {
+	accent := pdf.Black
+	if color, err := pdf.ParseColor(receipt.Accent_color); err == nil {
+		accent = color
+	}
+
+	width, margin, size := pdf.ReceiptWidth, 12.0, 8.0
+	if receipt.Paper == A4 {
+		width, margin, size = pdf.A4Width, 50.0, 10.0
+	}
+	layout := &pdfLayout{left: margin, right: width - margin, size: size, centered: receipt.Paper != A4}
+
+	if receipt.Paper == A4 {
+		layout.add(6, func(page *pdf.Page, y float64) {
+			page.Rect(0, 0, page.Width, 6, accent)
+		})
+		layout.space(24)
+	}
+	layout.text(pdf.Bold, size*1.8, accent, receipt.Title)
+	for _, line := range receipt.Details {
+		layout.text(pdf.Regular, size, grey, line)
+	}
+	if len(receipt.Header_lines) > 0 {
+		layout.space(size / 2)
+		for _, line := range receipt.Header_lines {
+			layout.text(pdf.Regular, size, pdf.Black, line)
+		}
+	}
+
+	layout.space(size)
+	for _, field := range receipt.Fields {
+		layout.row(pdf.Regular, pdf.Black, field.Label, field.Value)
+	}
+
+	layout.rule()
+	layout.row(pdf.Bold, accent, "Item", "Amount")
+	for _, item := range receipt.Items {
+		layout.row(pdf.Regular, pdf.Black, strconv.Itoa(item.Quantity)+" x "+item.Description, item.Amount.String())
+	}
+
+	layout.rule()
+	layout.amounts(receipt.Totals)
+	if len(receipt.Payments) > 0 {
+		layout.rule()
+		layout.amounts(receipt.Payments)
+	}
+
+	if len(receipt.Footer_lines) > 0 {
+		layout.space(size)
+		centered := layout.centered
+		layout.centered = true
+		for _, line := range receipt.Footer_lines {
+			layout.text(pdf.Regular, size, grey, line)
+		}
+		layout.centered = centered
+	}
+
+	return layout.render(receipt.Paper, width, margin)
+}
+
+func (l *pdfLayout) render(paper string, width float64, margin float64) ([]byte, error) {
+	document := pdf.New()
+
+	if paper != A4 {
+		height := 2 * margin
+		for _, b := range l.blocks {
+			height += b.height
+		}
+		page := document.AddPage(width, height)
+		y := margin
+		for _, b := range l.blocks {
+			b.draw(page, y)
+			y += b.height
+		}
+		return document.Bytes()
+	}
+
+	// the accent band sits on the edge of the first page, later pages start
+	// inside the margin
+	page := document.AddPage(width, pdf.A4Height)
+	y := 0.0
+	for _, b := range l.blocks {
+		if y+b.height > pdf.A4Height-margin {
+			page = document.AddPage(width, pdf.A4Height)
+			y = margin
+		}
+		b.draw(page, y)
+		y += b.height
+	}
+	return document.Bytes()
+}
@@ -0,0 +1,211 @@
+// Package receipt lays an invoice out as the receipt handed to the guest, the
+// same for every way it is printed.
+package receipt
+
+import (
+	"fmt"
+	"golang-restaurant-backend-app/helper"
+	"golang-restaurant-backend-app/models"
+	"golang-restaurant-backend-app/money"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	A4      = "A4"
+	RECEIPT = "RECEIPT"
+)
+
+// Receipt is everything printed on a receipt, in the order it is printed.
+type Receipt struct {
+	Title        string   `json:"title"`
+	Details      []string `json:"details"`
+	Header_lines []string `json:"header_lines"`
+	Fields       []Field  `json:"fields"`
+	Items        []Item   `json:"items"`
+	Totals       []Row    `json:"totals"`
+	Payments     []Row    `json:"payments"`
+	Footer_lines []string `json:"footer_lines"`
+	Paper        string   `json:"paper"`
+	Accent_color string   `json:"accent_color"`
+	// what messages about the receipt quote
+	Number   string      `json:"number"`
+	Date     time.Time   `json:"date"`
+	Total    money.Money `json:"total"`
+	Currency string      `json:"currency"`
+}
+
+// Field is a labelled detail of the bill, such as its number or table.
+type Field struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// Item is one kind of food on the bill with how many were had.
+type Item struct {
+	Description string      `json:"description"`
+	Quantity    int         `json:"quantity"`
+	Amount      money.Money `json:"amount"`
+}
+
+// Row is a labelled amount. Info rows are shown but not added up, like taxes
+// included in the prices.
+type Row struct {
+	Label  string      `json:"label"`
+	Amount money.Money `json:"amount"`
+	Bold   bool        `json:"bold"`
+	Info   bool        `json:"info"`
+}
+
+func percent(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', -1, 64) + "%"
+}
+
+// items groups the order items of ItemsByOrder by food and price.
+func items(orderItems interface{}) []Item {
+	grouped := []Item{}
+	index := map[string]int{}
+	rows, _ := orderItems.(primitive.A)
+	for _, raw := range rows {
+		orderItem, ok := raw.(primitive.M)
+		if !ok {
+			continue
+		}
+		name, _ := orderItem["food_name"].(string)
+		if name == "" {
+			name = "Item"
+		}
+		price := money.FromValue(orderItem["price"])
+		key := fmt.Sprint(orderItem["food_id"], "|", price)
+
+		i, seen := index[key]
+		if !seen {
+			i = len(grouped)
+			index[key] = i
+			grouped = append(grouped, Item{Description: name, Amount: money.Zero()})
+		}
+		grouped[i].Quantity++
+		grouped[i].Amount = grouped[i].Amount.Add(price)
+	}
+	return grouped
+}
+
+// Build lays out the receipt of an invoice. The breakdown is what the invoice
+// is billed at, the order is the group ItemsByOrder gives for its order, if
+// it has items.
+func Build(template models.ReceiptTemplate, invoice models.Invoice, breakdown helper.TaxBreakdown, order primitive.M) Receipt {
+	receipt := Receipt{
+		Title:        *template.Restaurant_name,
+		Details:      append([]string{}, template.Address_lines...),
+		Header_lines: template.Header_lines,
+		Footer_lines: template.Footer_lines,
+		Paper:        RECEIPT,
+	}
+	if template.Paper != nil {
+		receipt.Paper = *template.Paper
+	}
+	if template.Accent_color != nil {
+		receipt.Accent_color = *template.Accent_color
+	}
+	if template.Phone != nil {
+		receipt.Details = append(receipt.Details, "Tel "+*template.Phone)
+	}
+	if template.Email != nil {
+		receipt.Details = append(receipt.Details, *template.Email)
+	}
+	if template.Tax_number != nil {
+		receipt.Details = append(receipt.Details, "Tax no. "+*template.Tax_number)
+	}
+
+	number := invoice.Invoice_id
+	if invoice.Invoice_number != nil {
+		number = *invoice.Invoice_number
+	}
+	date := invoice.Created_at
+	if invoice.Issued_at != nil {
+		date = *invoice.Issued_at
+	}
+	receipt.Number, receipt.Date = number, date
+	receipt.Fields = []Field{
+		{Label: "Invoice", Value: number},
+		{Label: "Date", Value: date.In(time.Local).Format("2006-01-02 15:04")},
+	}
+	if order != nil && order["table_number"] != nil {
+		receipt.Fields = append(receipt.Fields, Field{Label: "Table", Value: fmt.Sprint(order["table_number"])})
+	}
+	if invoice.Payment_status != nil {
+		receipt.Fields = append(receipt.Fields, Field{Label: "Status", Value: strings.ReplaceAll(*invoice.Payment_status, "_", " ")})
+	}
+
+	receipt.Items = []Item{}
+	if order != nil {
+		receipt.Items = items(order["order_items"])
+	}
+
+	itemsTotal := money.Zero()
+	for _, item := range receipt.Items {
+		itemsTotal = itemsTotal.Add(item.Amount)
+	}
+	receipt.Totals = []Row{{Label: "Items", Amount: itemsTotal}}
+	for _, line := range breakdown.Discount_lines {
+		receipt.Totals = append(receipt.Totals, Row{Label: line.Name, Amount: line.Amount.Neg()})
+	}
+	for _, line := range breakdown.Service_lines {
+		label := line.Name
+		if line.Kind == helper.PERCENTAGE && line.Value != nil {
+			label += " " + percent(*line.Value)
+		}
+		receipt.Totals = append(receipt.Totals, Row{Label: label, Amount: line.Amount})
+	}
+	for _, line := range breakdown.Tax_lines {
+		label := line.Name + " " + percent(line.Rate)
+		if line.Inclusive {
+			label += " (included)"
+		}
+		receipt.Totals = append(receipt.Totals, Row{Label: label, Amount: line.Amount, Info: line.Inclusive})
+	}
+
+	tip := money.Value(invoice.Tip)
+	if tip.IsPositive() {
+		receipt.Totals = append(receipt.Totals, Row{Label: "Tip", Amount: tip})
+	}
+	total := breakdown.Total.Add(tip)
+	for _, fee := range invoice.Late_fees {
+		if fee.Waived_at == nil {
+			receipt.Totals = append(receipt.Totals, Row{Label: "Late fee", Amount: fee.Amount})
+			total = total.Add(fee.Amount)
+		}
+	}
+	receipt.Total, receipt.Currency = total, invoiceCurrency(invoice)
+	receipt.Totals = append(receipt.Totals, Row{Label: "Total " + invoiceCurrency(invoice), Amount: total, Bold: true})
+
+	receipt.Payments = []Row{}
+	for _, payment := range invoice.Payments {
+		receipt.Payments = append(receipt.Payments, Row{Label: "Paid " + strings.ToLower(payment.Method), Amount: payment.Amount})
+		if payment.Change.IsPositive() {
+			receipt.Payments = append(receipt.Payments, Row{Label: "Change", Amount: payment.Change, Info: true})
+		}
+	}
+	if credited := money.Value(invoice.Credited); credited.IsPositive() {
+		receipt.Payments = append(receipt.Payments, Row{Label: "Credited", Amount: credited})
+	}
+	if refunded := money.Value(invoice.Refunded); refunded.IsPositive() {
+		receipt.Payments = append(receipt.Payments, Row{Label: "Refunded", Amount: refunded.Neg()})
+	}
+
+	due := total.Sub(money.Value(invoice.Amount_paid)).Sub(money.Value(invoice.Credited)).Add(money.Value(invoice.Refunded))
+	if due.IsPositive() {
+		receipt.Payments = append(receipt.Payments, Row{Label: "Balance due", Amount: due, Bold: true})
+	}
+	return receipt
+}
+
+func invoiceCurrency(invoice models.Invoice) string {
+	if invoice.Currency != "" {
+		return invoice.Currency
+	}
+	return money.DefaultCurrency()
+}
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	controller "golang-restaurant-backend-app/controllers"
+	middleware "golang-restaurant-backend-app/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func AccountRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/accounts", controller.GetAccounts())
+	incomingRoutes.GET("/accounts/:account_id", controller.GetAccount())
+	incomingRoutes.POST("/accounts", controller.CreateAccount())
+	incomingRoutes.PATCH("/accounts/:account_id", controller.UpdateAccount())
+	incomingRoutes.DELETE("/accounts/:account_id", controller.DeleteAccount())
+	incomingRoutes.GET("/accounts/:account_id/invoices", controller.GetAccountInvoices())
+	incomingRoutes.GET("/accounts/:account_id/payments", controller.GetAccountPayments())
+	incomingRoutes.POST("/accounts/:account_id/payments", middleware.Idempotency(), controller.CreateAccountPayment())
+	incomingRoutes.GET("/accounts/:account_id/statements", controller.GetAccountStatements())
+	incomingRoutes.POST("/accounts/:account_id/statements", controller.CreateAccountStatement())
+	incomingRoutes.GET("/account-statements/:account_statement_id", controller.GetAccountStatement())
+	incomingRoutes.POST("/invoices/:invoice_id/charge-account", middleware.Idempotency(), controller.ChargeInvoiceToAccount())
+}
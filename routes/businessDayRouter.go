@@ -0,0 +1,21 @@
+package routes
+
+import (
+	controller "golang-restaurant-backend-app/controllers"
+	middleware "golang-restaurant-backend-app/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func BusinessDayRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/business-days", controller.GetBusinessDays())
+	incomingRoutes.GET("/business-days/:business_day_id", controller.GetBusinessDay())
+	incomingRoutes.POST("/business-days", controller.OpenBusinessDay())
+	incomingRoutes.POST("/business-days/:business_day_id/close", controller.CloseBusinessDay())
+	incomingRoutes.GET("/business-days/:business_day_id/x-report", controller.GetXReport())
+	incomingRoutes.GET("/business-days/:business_day_id/drawers", controller.GetDrawers())
+	incomingRoutes.POST("/business-days/:business_day_id/drawers", controller.OpenDrawer())
+	incomingRoutes.GET("/drawer-sessions/:drawer_session_id", controller.GetDrawer())
+	incomingRoutes.POST("/drawer-sessions/:drawer_session_id/movements", middleware.Idempotency(), controller.AddDrawerMovement())
+	incomingRoutes.POST("/drawer-sessions/:drawer_session_id/close", controller.CloseDrawer())
+}
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	controller "golang-restaurant-backend-app/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CreditNoteRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/credit-notes", controller.GetCreditNotes())
+	incomingRoutes.GET("/credit-notes/:credit_note_id", controller.GetCreditNote())
+}
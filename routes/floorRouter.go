@@ -0,0 +1,15 @@
+package routes
+
+import (
+	controller "golang-restaurant-backend-app/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func FloorRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/floor", controller.GetFloor())
+	incomingRoutes.GET("/floor/sections", controller.GetSections())
+	incomingRoutes.POST("/floor/sections", controller.CreateSection())
+	incomingRoutes.PATCH("/floor/sections/:section_id", controller.UpdateSection())
+	incomingRoutes.DELETE("/floor/sections/:section_id", controller.DeleteSection())
+}
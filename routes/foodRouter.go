@@ -11,4 +11,6 @@ func FoodRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/foods/:food_id", controller.GetFood())
 	incomingRoutes.POST("/foods", controller.CreateFood())
 	incomingRoutes.PATCH("/foods/:food_id", controller.UpdateFood())
+	incomingRoutes.DELETE("/foods/:food_id", controller.DeleteFood())
+	incomingRoutes.POST("/foods/:food_id/restore", controller.RestoreFood())
 }
@@ -2,6 +2,7 @@ package routes
 
 import (
 	controller "golang-restaurant-backend-app/controllers"
+	middleware "golang-restaurant-backend-app/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -9,6 +10,21 @@ import (
 func InvoiceRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/invoices", controller.GetInvoices())
 	incomingRoutes.GET("/invoices/:invoice_id", controller.GetInvoice())
-	incomingRoutes.POST("/invoices", controller.CreateInvoice())
+	incomingRoutes.GET("/invoices/:invoice_id/pdf", controller.GetInvoicePDF())
+	incomingRoutes.POST("/invoices/:invoice_id/send", controller.SendInvoiceReceipt())
+	incomingRoutes.GET("/invoices/:invoice_id/deliveries", controller.GetInvoiceDeliveries())
+	incomingRoutes.GET("/invoice-numbers/:invoice_number", controller.GetInvoiceByNumber())
+	incomingRoutes.POST("/invoices", middleware.Idempotency(), controller.CreateInvoice())
 	incomingRoutes.PATCH("/invoices/:invoice_id", controller.UpdateInvoice())
+	incomingRoutes.POST("/invoices/:invoice_id/issue", controller.IssueInvoice())
+	incomingRoutes.DELETE("/invoices/:invoice_id", controller.DeleteInvoice())
+	incomingRoutes.POST("/invoices/:invoice_id/restore", controller.RestoreInvoice())
+	incomingRoutes.POST("/invoices/:invoice_id/pay", middleware.Idempotency(), controller.PayInvoice())
+	incomingRoutes.POST("/invoices/:invoice_id/payments", middleware.Idempotency(), controller.AddPayment())
+	incomingRoutes.POST("/invoices/:invoice_id/splits", controller.SplitInvoice())
+	incomingRoutes.DELETE("/invoices/:invoice_id/splits", controller.ClearInvoiceSplits())
+	incomingRoutes.GET("/invoices/:invoice_id/card-payments", controller.GetCardPayments())
+	incomingRoutes.POST("/invoices/:invoice_id/card-payments", middleware.Idempotency(), controller.AuthorizeCardPayment())
+	incomingRoutes.POST("/invoices/:invoice_id/refunds", middleware.Idempotency(), controller.RefundPayment())
+	incomingRoutes.POST("/invoices/:invoice_id/late-fees/:late_fee_id/waive", controller.WaiveLateFee())
 }
@@ -11,4 +11,6 @@ func MenuRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/menus/:menu_id", controller.GetMenu())
 	incomingRoutes.POST("/menus", controller.CreateMenu())
 	incomingRoutes.PATCH("/menus/:menu_id", controller.UpdateMenu())
+	incomingRoutes.DELETE("/menus/:menu_id", controller.DeleteMenu())
+	incomingRoutes.POST("/menus/:menu_id/restore", controller.RestoreMenu())
 }
@@ -2,6 +2,7 @@ package routes
 
 import (
 	controller "golang-restaurant-backend-app/controllers"
+	middleware "golang-restaurant-backend-app/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,6 +11,9 @@ func OrderItemRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/order-items", controller.GetOrderItems())
 	incomingRoutes.GET("/order-items/:order_item_id", controller.GetOrderItem())
 	incomingRoutes.GET("/order-items-order/:order_id", controller.GetOrderItemsByOrder())
-	incomingRoutes.POST("/order-items", controller.CreateOrderItem())
+	incomingRoutes.POST("/order-items", middleware.Idempotency(), controller.CreateOrderItem())
 	incomingRoutes.PATCH("/order-items/:order_item_id", controller.UpdateOrderItem())
+	incomingRoutes.DELETE("/order-items/:order_item_id", controller.DeleteOrderItem())
+	incomingRoutes.POST("/order-items/:order_item_id/restore", controller.RestoreOrderItem())
+	incomingRoutes.POST("/order-items/:order_item_id/void", middleware.Idempotency(), controller.VoidOrderItem())
 }
@@ -2,6 +2,7 @@ package routes
 
 import (
 	controller "golang-restaurant-backend-app/controllers"
+	middleware "golang-restaurant-backend-app/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -9,6 +10,17 @@ import (
 func OrderRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/orders", controller.GetOrders())
 	incomingRoutes.GET("/orders/:order_id", controller.GetOrder())
-	incomingRoutes.POST("/orders", controller.CreateOrder())
+	incomingRoutes.POST("/orders", middleware.Idempotency(), controller.CreateOrder())
 	incomingRoutes.PATCH("/orders/:order_id", controller.UpdateOrder())
+	incomingRoutes.POST("/orders/:order_id/transfer", controller.TransferOrder())
+	incomingRoutes.POST("/orders/:order_id/merge", controller.MergeOrder())
+	incomingRoutes.POST("/orders/:order_id/move-items", controller.MoveOrderItems())
+	incomingRoutes.POST("/orders/:order_id/reassign", controller.ReassignOrder())
+	incomingRoutes.POST("/orders/:order_id/promo", controller.ApplyPromoCode())
+	incomingRoutes.POST("/orders/:order_id/discounts", controller.AddComp())
+	incomingRoutes.POST("/orders/:order_id/discounts/:discount_id/approve", controller.ApproveComp())
+	incomingRoutes.POST("/orders/:order_id/discounts/:discount_id/reject", controller.RejectComp())
+	incomingRoutes.DELETE("/orders/:order_id/discounts/:discount_id", controller.RemoveOrderDiscount())
+	incomingRoutes.DELETE("/orders/:order_id", controller.DeleteOrder())
+	incomingRoutes.POST("/orders/:order_id/restore", controller.RestoreOrder())
 }
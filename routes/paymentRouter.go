@@ -0,0 +1,19 @@
+package routes
+
+import (
+	controller "golang-restaurant-backend-app/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func PaymentRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/card-payments/:card_payment_id", controller.GetCardPayment())
+	incomingRoutes.POST("/card-payments/:card_payment_id/capture", controller.CaptureCardPayment())
+	incomingRoutes.POST("/card-payments/:card_payment_id/void", controller.VoidCardPayment())
+}
+
+// WebhookRoutes are called by the payment provider, which signs its requests
+// instead of logging in.
+func WebhookRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.POST("/payments/webhook", controller.PaymentWebhook())
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	controller "golang-restaurant-backend-app/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func PricingRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/pricing-rules", controller.GetPricingRules())
+	incomingRoutes.GET("/pricing-rules/:pricing_rule_id", controller.GetPricingRule())
+	incomingRoutes.POST("/pricing-rules", controller.CreatePricingRule())
+	incomingRoutes.PATCH("/pricing-rules/:pricing_rule_id", controller.UpdatePricingRule())
+	incomingRoutes.DELETE("/pricing-rules/:pricing_rule_id", controller.DeletePricingRule())
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	controller "golang-restaurant-backend-app/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func PrintRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/printers", controller.GetPrinters())
+	incomingRoutes.GET("/printers/:printer_id", controller.GetPrinter())
+	incomingRoutes.POST("/printers", controller.CreatePrinter())
+	incomingRoutes.PATCH("/printers/:printer_id", controller.UpdatePrinter())
+	incomingRoutes.DELETE("/printers/:printer_id", controller.DeletePrinter())
+	incomingRoutes.GET("/print-jobs", controller.GetPrintJobs())
+	incomingRoutes.POST("/print-jobs/:print_job_id/retry", controller.RetryPrintJob())
+	incomingRoutes.POST("/orders/:order_id/tickets", controller.SendOrderTickets())
+	incomingRoutes.POST("/invoices/:invoice_id/print", controller.PrintInvoiceReceipt())
+}
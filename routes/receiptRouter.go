@@ -0,0 +1,16 @@
+package routes
+
+import (
+	controller "golang-restaurant-backend-app/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ReceiptRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/receipt-templates", controller.GetReceiptTemplates())
+	incomingRoutes.GET("/receipt-templates/:receipt_template_id", controller.GetReceiptTemplate())
+	incomingRoutes.POST("/receipt-templates", controller.CreateReceiptTemplate())
+	incomingRoutes.PATCH("/receipt-templates/:receipt_template_id", controller.UpdateReceiptTemplate())
+	incomingRoutes.DELETE("/receipt-templates/:receipt_template_id", controller.DeleteReceiptTemplate())
+	incomingRoutes.POST("/receipt-deliveries/:receipt_delivery_id/retry", controller.RetryReceiptDelivery())
+}
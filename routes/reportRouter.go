@@ -0,0 +1,19 @@
+package routes
+
+import (
+	controller "golang-restaurant-backend-app/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ReportRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/reports/taxes", controller.GetTaxReport())
+	incomingRoutes.GET("/reports/tips", controller.GetTipReport())
+	incomingRoutes.GET("/reports/sales", controller.GetSalesReport())
+	incomingRoutes.GET("/reports/aging", controller.GetAgingReport())
+	incomingRoutes.GET("/reports/revenue", controller.GetRevenueReport())
+	incomingRoutes.GET("/reports/covers", controller.GetCoversReport())
+	incomingRoutes.GET("/reports/foods", controller.GetFoodSalesReport())
+	incomingRoutes.GET("/reports/menus", controller.GetMenuSalesReport())
+	incomingRoutes.GET("/reports/servers", controller.GetServerSalesReport())
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	controller "golang-restaurant-backend-app/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ReservationRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/reservations", controller.GetReservations())
+	incomingRoutes.GET("/reservations/availability", controller.GetAvailability())
+	incomingRoutes.GET("/reservations/:reservation_id", controller.GetReservation())
+	incomingRoutes.POST("/reservations", controller.CreateReservation())
+	incomingRoutes.PATCH("/reservations/:reservation_id", controller.UpdateReservation())
+	incomingRoutes.POST("/reservations/:reservation_id/cancel", controller.CancelReservation())
+	incomingRoutes.POST("/reservations/:reservation_id/arrived", controller.MarkReservationArrived())
+	incomingRoutes.POST("/reservations/:reservation_id/no-show", controller.MarkReservationNoShow())
+}
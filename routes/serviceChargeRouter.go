@@ -0,0 +1,15 @@
+package routes
+
+import (
+	controller "golang-restaurant-backend-app/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ServiceChargeRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/service-charges", controller.GetServiceCharges())
+	incomingRoutes.GET("/service-charges/:service_charge_id", controller.GetServiceCharge())
+	incomingRoutes.POST("/service-charges", controller.CreateServiceCharge())
+	incomingRoutes.PATCH("/service-charges/:service_charge_id", controller.UpdateServiceCharge())
+	incomingRoutes.DELETE("/service-charges/:service_charge_id", controller.DeleteServiceCharge())
+}
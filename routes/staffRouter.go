@@ -0,0 +1,17 @@
+package routes
+
+import (
+	controller "golang-restaurant-backend-app/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func StaffRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/assignments", controller.GetAssignments())
+	incomingRoutes.POST("/assignments", controller.CreateAssignment())
+	incomingRoutes.PATCH("/assignments/:assignment_id", controller.UpdateAssignment())
+	incomingRoutes.DELETE("/assignments/:assignment_id", controller.DeleteAssignment())
+	incomingRoutes.POST("/assignments/:assignment_id/reassign", controller.ReassignSection())
+	incomingRoutes.GET("/me/tables", controller.GetMyTables())
+	incomingRoutes.GET("/me/orders", controller.GetMyOrders())
+}
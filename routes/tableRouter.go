@@ -11,4 +11,10 @@ func TableRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/table/:table_id", controller.GetTable())
 	incomingRoutes.POST("/table", controller.CreateTable())
 	incomingRoutes.PATCH("/table/:table_id", controller.UpdateTable())
+	incomingRoutes.GET("/table/:table_id/status", controller.GetTableStatus())
+	incomingRoutes.POST("/table/:table_id/clean", controller.MarkTableClean())
+	incomingRoutes.POST("/table/:table_id/combine", controller.CombineTables())
+	incomingRoutes.POST("/table/:table_id/split", controller.SplitTables())
+	incomingRoutes.DELETE("/table/:table_id", controller.DeleteTable())
+	incomingRoutes.POST("/table/:table_id/restore", controller.RestoreTable())
 }
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	controller "golang-restaurant-backend-app/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TaxRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/tax-rates", controller.GetTaxRates())
+	incomingRoutes.GET("/tax-rates/:tax_rate_id", controller.GetTaxRate())
+	incomingRoutes.POST("/tax-rates", controller.CreateTaxRate())
+	incomingRoutes.PATCH("/tax-rates/:tax_rate_id", controller.UpdateTaxRate())
+	incomingRoutes.DELETE("/tax-rates/:tax_rate_id", controller.DeleteTaxRate())
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	controller "golang-restaurant-backend-app/controllers"
+	middleware "golang-restaurant-backend-app/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,4 +12,7 @@ func UserRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/users/:user_id", controller.GetUser())
 	incomingRoutes.POST("/users/signup", controller.SignUp())
 	incomingRoutes.POST("/users/login", controller.Login())
+	incomingRoutes.PATCH("/users/:user_id/user-type", middleware.Authentication(), controller.UpdateUserType())
+	incomingRoutes.DELETE("/users/:user_id", middleware.Authentication(), controller.DeleteUser())
+	incomingRoutes.POST("/users/:user_id/restore", middleware.Authentication(), controller.RestoreUser())
 }
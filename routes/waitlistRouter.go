@@ -0,0 +1,17 @@
+package routes
+
+import (
+	controller "golang-restaurant-backend-app/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func WaitlistRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/waitlist", controller.GetWaitlist())
+	incomingRoutes.GET("/waitlist/quote", controller.GetWaitQuote())
+	incomingRoutes.GET("/waitlist/:waitlist_id", controller.GetWaitlistEntry())
+	incomingRoutes.POST("/waitlist", controller.AddToWaitlist())
+	incomingRoutes.POST("/waitlist/:waitlist_id/notify", controller.NotifyWaitlistEntry())
+	incomingRoutes.POST("/waitlist/:waitlist_id/seat", controller.SeatWaitlistEntry())
+	incomingRoutes.POST("/waitlist/:waitlist_id/cancel", controller.CancelWaitlistEntry())
+}